@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gagliardetto/solana-go"
+)
+
+// AddressNamespace 地址所属的链族
+type AddressNamespace string
+
+const (
+	AddressNamespaceEVM    AddressNamespace = "evm"
+	AddressNamespaceSolana AddressNamespace = "solana"
+)
+
+// ChainAddress 跨链地址：命名空间 + 规范字节（EVM 20 字节地址 / Solana 32 字节公钥）
+//
+// 可比较，可直接作为 map 的键。零值表示空地址。
+//   - 展示（String / JSON）：EVM 为 EIP-55 校验和地址，Solana 为 Base58；
+//   - 存储与比较（Key / 数据库）：EVM 为小写十六进制，Solana 为 Base58（大小写敏感，不做任何转换）。
+//
+// 两种文本形式互不重叠（Base58 字母表不含 0），解析时无需额外的命名空间前缀。
+type ChainAddress struct {
+	ns  AddressNamespace
+	raw [32]byte // EVM 地址占前 20 字节
+}
+
+// EVMChainAddress 由 EVM 地址构造
+func EVMChainAddress(addr common.Address) ChainAddress {
+	a := ChainAddress{ns: AddressNamespaceEVM}
+	copy(a.raw[:], addr.Bytes())
+	return a
+}
+
+// SolanaChainAddress 由 Solana 公钥构造
+func SolanaChainAddress(pk solana.PublicKey) ChainAddress {
+	return ChainAddress{ns: AddressNamespaceSolana, raw: pk}
+}
+
+// ChainAddressFromBytes32 按命名空间解释合约事件 / LayerZero 消息中的 bytes32 地址
+// （EVM 取后 20 字节，Solana 为完整公钥）
+func ChainAddressFromBytes32(ns AddressNamespace, b common.Hash) ChainAddress {
+	if ns == AddressNamespaceSolana {
+		return SolanaChainAddress(solana.PublicKeyFromBytes(b.Bytes()))
+	}
+	return EVMChainAddress(common.BytesToAddress(b.Bytes()))
+}
+
+// addressNamespaceForEID 目标链 EID 对应的地址命名空间（未知链按 EVM 处理）
+func addressNamespaceForEID(eid int64) AddressNamespace {
+	if isSolanaChain(eid) {
+		return AddressNamespaceSolana
+	}
+	return AddressNamespaceEVM
+}
+
+// ParseChainAddress 解析 0x 十六进制（EVM，大小写不敏感）或 Base58（Solana）地址
+func ParseChainAddress(s string) (ChainAddress, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		if !common.IsHexAddress(s) {
+			return ChainAddress{}, fmt.Errorf("invalid EVM address %q", s)
+		}
+		return EVMChainAddress(common.HexToAddress(s)), nil
+	}
+	if len(s) < 32 || len(s) > 44 {
+		return ChainAddress{}, fmt.Errorf("invalid address %q", s)
+	}
+	pk, err := solana.PublicKeyFromBase58(s)
+	if err != nil {
+		return ChainAddress{}, fmt.Errorf("invalid Solana address %q: %w", s, err)
+	}
+	return SolanaChainAddress(pk), nil
+}
+
+// MustParseChainAddress 同 ParseChainAddress，解析失败时 panic（用于常量）
+func MustParseChainAddress(s string) ChainAddress {
+	a, err := ParseChainAddress(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Namespace 地址命名空间（零值为空）
+func (a ChainAddress) Namespace() AddressNamespace { return a.ns }
+
+// IsZero 是否为空地址
+func (a ChainAddress) IsZero() bool { return a.ns == "" }
+
+// Bytes 规范字节（EVM 20 字节，Solana 32 字节）
+func (a ChainAddress) Bytes() []byte {
+	switch a.ns {
+	case AddressNamespaceEVM:
+		return append([]byte(nil), a.raw[:common.AddressLength]...)
+	case AddressNamespaceSolana:
+		return append([]byte(nil), a.raw[:]...)
+	}
+	return nil
+}
+
+// EVM 返回 EVM 地址（非 EVM 地址返回零地址）
+func (a ChainAddress) EVM() common.Address {
+	if a.ns != AddressNamespaceEVM {
+		return common.Address{}
+	}
+	return common.BytesToAddress(a.raw[:common.AddressLength])
+}
+
+// String 展示形式：EVM 校验和地址 / Solana Base58；空地址为 ""
+func (a ChainAddress) String() string {
+	switch a.ns {
+	case AddressNamespaceEVM:
+		return a.EVM().Hex()
+	case AddressNamespaceSolana:
+		return solana.PublicKey(a.raw).String()
+	}
+	return ""
+}
+
+// Key 存储与比较形式：EVM 小写十六进制 / Solana Base58；空地址为 ""
+func (a ChainAddress) Key() string {
+	if a.ns == AddressNamespaceEVM {
+		return strings.ToLower(a.EVM().Hex())
+	}
+	return a.String()
+}
+
+// MarshalJSON 以展示形式编码
+func (a ChainAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON 解析展示或存储形式（空字符串为零值）
+func (a *ChainAddress) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*a = ChainAddress{}
+		return nil
+	}
+	parsed, err := ParseChainAddress(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
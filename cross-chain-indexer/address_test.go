@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParseChainAddress(t *testing.T) {
+	const (
+		evm = "0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438"
+		sol = "6H7AYKpUHnMuca92gc82oArXC48igkLi14mcZh9XNLpp"
+	)
+
+	// EVM：大小写不敏感，展示为校验和地址，存储为小写
+	a, err := ParseChainAddress(strings.ToUpper(evm[2:]))
+	if err == nil {
+		t.Fatalf("hex without 0x parsed as %v", a)
+	}
+	a = MustParseChainAddress(strings.ToLower(evm))
+	if a != MustParseChainAddress(evm) || a.Namespace() != AddressNamespaceEVM || a.String() != evm || a.Key() != strings.ToLower(evm) {
+		t.Errorf("EVM address = %s / %s", a, a.Key())
+	}
+
+	// Solana：Base58 大小写敏感，小写化得到的是另一个地址（或无效）
+	b := MustParseChainAddress(sol)
+	if b.Namespace() != AddressNamespaceSolana || b.String() != sol || b.Key() != sol || len(b.Bytes()) != 32 {
+		t.Errorf("Solana address = %s / %s", b, b.Key())
+	}
+	if lower, err := ParseChainAddress(strings.ToLower(sol)); err == nil && lower == b {
+		t.Error("lowercased Solana address parsed to the same key")
+	}
+
+	// bytes32：EVM 取后 20 字节，Solana 为完整公钥；同一 bytes32 在两个命名空间中互不相等
+	word := common.BytesToHash(b.Bytes())
+	if ChainAddressFromBytes32(AddressNamespaceSolana, word) != b {
+		t.Error("bytes32 Solana address mismatch")
+	}
+	if e := ChainAddressFromBytes32(AddressNamespaceEVM, word); e.EVM() != common.BytesToAddress(word.Bytes()) || e == b {
+		t.Errorf("bytes32 EVM address = %s", e)
+	}
+
+	for _, bad := range []string{"", "0x1234", "not-an-address", "0OIl" + sol[4:]} {
+		if _, err := ParseChainAddress(bad); err == nil {
+			t.Errorf("ParseChainAddress(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestChainAddressJSON(t *testing.T) {
+	in := map[string]ChainAddress{
+		"evm":    MustParseChainAddress("0x1a9c0a66cb68d92c598b0d2f10de3c755eb6d438"),
+		"solana": MustParseChainAddress("8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq"),
+		"zero":   {},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"evm":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","solana":"8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq","zero":""}`; string(data) != want {
+		t.Errorf("json = %s", data)
+	}
+	var out map[string]ChainAddress
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range in {
+		if out[k] != v {
+			t.Errorf("%s round trip = %v, want %v", k, out[k], v)
+		}
+	}
+}
+
+func TestWhitelistAddresses(t *testing.T) {
+	t.Setenv("MERCHANT_ADDRESSES", "")
+	cfg := LoadMerchantConfig()
+	if !cfg.IsMerchantAddress("6H7AYKpUHnMuca92gc82oArXC48igkLi14mcZh9XNLpp") {
+		t.Error("default Solana merchant not whitelisted")
+	}
+	if cfg.IsMerchantAddress("6h7aykpuhnmuca92gc82oarxc48igkli14mczh9xnlpp") {
+		t.Error("lowercased Solana merchant whitelisted")
+	}
+	if !cfg.IsMerchantAddress("0x77ED7F6455FE291728A48785090292E3D10F53BB") {
+		t.Error("EVM merchant lookup should be case-insensitive")
+	}
+
+	// JWT 中的地址与白名单使用同一规范形式
+	jwtSecret = testJWTSecret
+	addr := MustParseChainAddress("AWuN8Gk6X3xKR73YBRw2H8WXC6QGbJRveHS5DgEJX3ZS")
+	token, err := generateJWT(addr, "merchant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, role, err := verifyAndExtractClaims(token, jwtSecret)
+	if err != nil || got != addr || role != "merchant" || !cfg.IsMerchant(got) {
+		t.Errorf("claims = %v %s %v", got, role, err)
+	}
+}
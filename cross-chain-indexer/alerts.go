@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 告警类型
+const (
+	AlertPayoutStuck  = "payout_stuck"
+	AlertPayoutFailed = "payout_failed"
+	AlertDeadLetters  = "dead_letters" // 死信队列增长
+)
+
+// 内存中保留的最近告警数
+const recentAlertLimit = 200
+
+// Alert 一条告警
+type Alert struct {
+	Kind    string    `json:"kind"`
+	TxHash  string    `json:"tx_hash,omitempty"` // 源链 payout 交易
+	Route   string    `json:"route,omitempty"`   // "源链 -> 目标链"
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Alerter 记录告警日志，并在配置了 webhook 时异步推送（JSON POST）
+type Alerter struct {
+	webhookURL string
+	client     *http.Client
+
+	mu     sync.Mutex
+	recent []Alert
+}
+
+// NewAlerter 创建告警器；webhookURL 为空时只写日志
+func NewAlerter(webhookURL string) *Alerter {
+	return &Alerter{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// 全局告警器（在 main 中按 NOTIFICATION_WEBHOOK 配置）
+var alerter = NewAlerter("")
+
+// Notify 发出告警
+func (a *Alerter) Notify(alert Alert) {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now().UTC()
+	}
+	log.Printf("ALERT[%s]: %s (tx=%s route=%s)", alert.Kind, alert.Message, alert.TxHash, alert.Route)
+
+	a.mu.Lock()
+	a.recent = append(a.recent, alert)
+	if len(a.recent) > recentAlertLimit {
+		a.recent = a.recent[len(a.recent)-recentAlertLimit:]
+	}
+	a.mu.Unlock()
+
+	if a.webhookURL == "" {
+		return
+	}
+	go func() {
+		body, _ := json.Marshal(alert)
+		resp, err := a.client.Post(a.webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Alerter: webhook error: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Alerter: webhook returned %s", resp.Status)
+		}
+	}()
+}
+
+// Recent 最近的告警（新的在前）
+func (a *Alerter) Recent(limit int) []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]Alert, 0, limit)
+	for i := len(a.recent) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, a.recent[i])
+	}
+	return out
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gagliardetto/solana-go"
+)
+
+// 内置的 Anchor IDL（transfer_contract 与 my_oapp），可在 chains.json 中通过 programs[].idl 覆盖
+//
+//go:embed idl/*.json
+var embeddedIDLs embed.FS
+
+// 各程序角色默认使用的内置 IDL
+var defaultIDLByRole = map[string]string{
+	ProgramRoleTransfer: "idl/transfer_contract.json",
+	ProgramRoleOApp:     "idl/my_oapp.json",
+}
+
+// anchorDiscriminator Anchor discriminator：sha256("<namespace>:<name>")[:8]
+// 指令使用 "global:<snake_case 指令名>"，事件使用 "event:<事件结构体名>"
+func anchorDiscriminator(namespace, name string) [8]byte {
+	sum := sha256.Sum256([]byte(namespace + ":" + name))
+	var d [8]byte
+	copy(d[:], sum[:8])
+	return d
+}
+
+// --------------------------- IDL 结构 ---------------------------
+
+// anchorIDL Anchor IDL（兼容 0.30+ 与旧版 0.29 格式）
+type anchorIDL struct {
+	Address  string `json:"address"`
+	Name     string `json:"name"` // 旧版格式
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Instructions []idlInstruction `json:"instructions"`
+	Events       []idlEvent       `json:"events"`
+	Types        []idlTypeDef     `json:"types"`
+}
+
+type idlInstruction struct {
+	Name     string       `json:"name"`
+	RawDisc  []int        `json:"discriminator"`
+	Accounts []idlAccount `json:"accounts"`
+	Args     []idlField   `json:"args"`
+}
+
+type idlAccount struct {
+	Name       string       `json:"name"`
+	Optional   bool         `json:"optional"`
+	IsOptional bool         `json:"isOptional"` // 旧版格式
+	Accounts   []idlAccount `json:"accounts"`   // 嵌套的账户组
+}
+
+type idlEvent struct {
+	Name    string     `json:"name"`
+	RawDisc []int      `json:"discriminator"`
+	Fields  []idlField `json:"fields"` // 旧版格式直接内联字段
+}
+
+type idlTypeDef struct {
+	Name string `json:"name"`
+	Type struct {
+		Kind     string       `json:"kind"`
+		Fields   idlFields    `json:"fields"`
+		Variants []idlVariant `json:"variants"`
+	} `json:"type"`
+}
+
+type idlVariant struct {
+	Name   string    `json:"name"`
+	Fields idlFields `json:"fields"`
+}
+
+type idlField struct {
+	Name string  `json:"name"`
+	Type idlType `json:"type"`
+}
+
+// idlFields 字段列表：具名字段 [{name, type}] 或元组字段 [type, ...]（以序号命名）
+type idlFields []idlField
+
+func (f *idlFields) UnmarshalJSON(b []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return err
+	}
+	out := make(idlFields, 0, len(raws))
+	for i, raw := range raws {
+		var named struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		}
+		if err := json.Unmarshal(raw, &named); err == nil && named.Name != "" && named.Type != nil {
+			var field idlField
+			if err := json.Unmarshal(raw, &field); err != nil {
+				return err
+			}
+			out = append(out, field)
+			continue
+		}
+		var t idlType
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+		out = append(out, idlField{Name: strconv.Itoa(i), Type: t})
+	}
+	*f = out
+	return nil
+}
+
+// idlType 类型描述：基础类型、vec / option / array 或自定义类型
+type idlType struct {
+	Prim    string
+	Vec     *idlType
+	Option  *idlType
+	Array   *idlType
+	Len     int
+	Defined string
+}
+
+func (t *idlType) UnmarshalJSON(b []byte) error {
+	var prim string
+	if err := json.Unmarshal(b, &prim); err == nil {
+		t.Prim = prim
+		return nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return fmt.Errorf("invalid idl type %s", b)
+	}
+	switch {
+	case obj["vec"] != nil:
+		t.Vec = new(idlType)
+		return json.Unmarshal(obj["vec"], t.Vec)
+	case obj["option"] != nil:
+		t.Option = new(idlType)
+		return json.Unmarshal(obj["option"], t.Option)
+	case obj["array"] != nil:
+		var arr []json.RawMessage
+		if err := json.Unmarshal(obj["array"], &arr); err != nil || len(arr) != 2 {
+			return fmt.Errorf("invalid idl array type %s", b)
+		}
+		t.Array = new(idlType)
+		if err := json.Unmarshal(arr[0], t.Array); err != nil {
+			return err
+		}
+		return json.Unmarshal(arr[1], &t.Len)
+	case obj["defined"] != nil:
+		// 0.30+: {"defined": {"name": "X"}}；旧版: {"defined": "X"}
+		if err := json.Unmarshal(obj["defined"], &t.Defined); err == nil {
+			return nil
+		}
+		var def struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(obj["defined"], &def); err != nil {
+			return err
+		}
+		t.Defined = def.Name
+		return nil
+	}
+	return fmt.Errorf("unsupported idl type %s", b)
+}
+
+// --------------------------- 程序解码器 ---------------------------
+
+// AnchorProgram 根据 IDL 解码某个 Anchor 程序的指令与事件
+type AnchorProgram struct {
+	ID   solana.PublicKey
+	Name string
+
+	instructions map[[8]byte]*idlInstruction
+	events       map[[8]byte]*idlEvent
+	types        map[string]*idlTypeDef
+}
+
+// AnchorInstruction 解码后的指令：参数与账户均按 IDL 中的名称索引
+type AnchorInstruction struct {
+	Program  string                      `json:"program"`
+	Name     string                      `json:"name"`
+	Args     map[string]interface{}      `json:"args"`
+	Accounts map[string]solana.PublicKey `json:"accounts"`
+}
+
+// AnchorEvent 解码后的 Anchor 事件（emit! 输出的 "Program data:" 日志）
+type AnchorEvent struct {
+	Program string                 `json:"program"`
+	Name    string                 `json:"name"`
+	Fields  map[string]interface{} `json:"fields"`
+}
+
+// ParseAnchorIDL 解析 IDL；programID 为空时使用 IDL 中的 address
+func ParseAnchorIDL(data []byte, programID string) (*AnchorProgram, error) {
+	var idl anchorIDL
+	if err := json.Unmarshal(data, &idl); err != nil {
+		return nil, fmt.Errorf("parse idl: %w", err)
+	}
+	if programID == "" {
+		programID = idl.Address
+	}
+	id, err := solana.PublicKeyFromBase58(programID)
+	if err != nil {
+		return nil, fmt.Errorf("idl: invalid program id %q: %w", programID, err)
+	}
+	p := &AnchorProgram{
+		ID:           id,
+		Name:         idl.Metadata.Name,
+		instructions: make(map[[8]byte]*idlInstruction),
+		events:       make(map[[8]byte]*idlEvent),
+		types:        make(map[string]*idlTypeDef),
+	}
+	if p.Name == "" {
+		p.Name = idl.Name
+	}
+	for i := range idl.Types {
+		p.types[idl.Types[i].Name] = &idl.Types[i]
+	}
+	for i := range idl.Instructions {
+		ix := &idl.Instructions[i]
+		disc, err := idlDiscriminator(ix.RawDisc, "global", toSnakeCase(ix.Name))
+		if err != nil {
+			return nil, fmt.Errorf("idl instruction %s: %w", ix.Name, err)
+		}
+		ix.Name = toSnakeCase(ix.Name)
+		p.instructions[disc] = ix
+	}
+	for i := range idl.Events {
+		ev := &idl.Events[i]
+		disc, err := idlDiscriminator(ev.RawDisc, "event", ev.Name)
+		if err != nil {
+			return nil, fmt.Errorf("idl event %s: %w", ev.Name, err)
+		}
+		if ev.Fields == nil {
+			def, ok := p.types[ev.Name]
+			if !ok {
+				return nil, fmt.Errorf("idl event %s: type not found", ev.Name)
+			}
+			ev.Fields = def.Type.Fields
+		}
+		p.events[disc] = ev
+	}
+	return p, nil
+}
+
+// loadProgramIDL 加载程序 IDL：优先使用配置的 idl 路径，否则使用该角色的内置 IDL
+func loadProgramIDL(p ProgramConfig) (*AnchorProgram, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case p.IDL != "":
+		data, err = os.ReadFile(p.IDL)
+	case defaultIDLByRole[p.Role] != "":
+		data, err = embeddedIDLs.ReadFile(defaultIDLByRole[p.Role])
+	default:
+		return nil, fmt.Errorf("no idl for program %s (role %q)", p.ProgramID, p.Role)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read idl for program %s: %w", p.ProgramID, err)
+	}
+	return ParseAnchorIDL(data, p.ProgramID)
+}
+
+// idlDiscriminator IDL 中给出 discriminator 时直接使用（0.30+），否则按名称计算（旧版）
+func idlDiscriminator(raw []int, namespace, name string) ([8]byte, error) {
+	if raw == nil {
+		return anchorDiscriminator(namespace, name), nil
+	}
+	var d [8]byte
+	if len(raw) != len(d) {
+		return d, fmt.Errorf("discriminator must be 8 bytes, got %d", len(raw))
+	}
+	for i, v := range raw {
+		if v < 0 || v > math.MaxUint8 {
+			return d, fmt.Errorf("invalid discriminator byte %d", v)
+		}
+		d[i] = byte(v)
+	}
+	return d, nil
+}
+
+// toSnakeCase 旧版 IDL 的指令名为 camelCase（transferOut -> transfer_out）
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// DecodeInstruction 按 discriminator 匹配指令并解码参数；accounts 为指令引用的账户（按顺序）
+//
+// programID 为实际被调用的程序；未传入的可选账户（Anchor 以程序 ID 占位）不出现在结果中。
+func (p *AnchorProgram) DecodeInstruction(programID solana.PublicKey, data []byte, accounts []solana.PublicKey) (*AnchorInstruction, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%s: instruction data too short: %d bytes", p.Name, len(data))
+	}
+	ix, ok := p.instructions[[8]byte(data[:8])]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown instruction discriminator %x", p.Name, data[:8])
+	}
+	dec := &borshDecoder{buf: data[8:], types: p.types}
+	args, err := dec.fields(ix.Args)
+	if err != nil {
+		return nil, fmt.Errorf("%s.%s: decode args: %w", p.Name, ix.Name, err)
+	}
+
+	out := &AnchorInstruction{Program: p.Name, Name: ix.Name, Args: args, Accounts: make(map[string]solana.PublicKey)}
+	i := 0
+	var assign func(list []idlAccount)
+	assign = func(list []idlAccount) {
+		for _, a := range list {
+			if len(a.Accounts) > 0 {
+				assign(a.Accounts)
+				continue
+			}
+			if i >= len(accounts) {
+				return
+			}
+			key := accounts[i]
+			i++
+			if (a.Optional || a.IsOptional) && key.Equals(programID) {
+				continue
+			}
+			out.Accounts[a.Name] = key
+		}
+	}
+	assign(ix.Accounts)
+	return out, nil
+}
+
+// decodeEvent 解码 "Program data:" 中的事件数据
+func (p *AnchorProgram) decodeEvent(data []byte) (*AnchorEvent, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%s: event data too short: %d bytes", p.Name, len(data))
+	}
+	ev, ok := p.events[[8]byte(data[:8])]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown event discriminator %x", p.Name, data[:8])
+	}
+	dec := &borshDecoder{buf: data[8:], types: p.types}
+	fields, err := dec.fields(ev.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s.%s: decode event: %w", p.Name, ev.Name, err)
+	}
+	return &AnchorEvent{Program: p.Name, Name: ev.Name, Fields: fields}, nil
+}
+
+// decodeAnchorEvents 从交易日志中解码各程序 emit! 的事件
+//
+// 通过 "Program <id> invoke / success / failed" 维护调用栈，"Program data:" 归属当前栈顶程序。
+func decodeAnchorEvents(logs []string, programs ...*AnchorProgram) []AnchorEvent {
+	byID := make(map[string]*AnchorProgram, len(programs))
+	for _, p := range programs {
+		if p != nil {
+			byID[p.ID.String()] = p
+		}
+	}
+	var (
+		stack  []string
+		events []AnchorEvent
+	)
+	for _, line := range logs {
+		switch {
+		case strings.HasPrefix(line, "Program data: "):
+			if len(stack) == 0 {
+				continue
+			}
+			p, ok := byID[stack[len(stack)-1]]
+			if !ok {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "Program data: "))
+			if err != nil {
+				continue
+			}
+			if ev, err := p.decodeEvent(data); err == nil {
+				events = append(events, *ev)
+			}
+		case strings.HasPrefix(line, "Program "):
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			switch {
+			case fields[2] == "invoke":
+				stack = append(stack, fields[1])
+			case fields[2] == "success" || strings.HasPrefix(fields[2], "failed"):
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		}
+	}
+	return events
+}
+
+// --------------------------- Borsh 解码 ---------------------------
+
+// borshDecoder 按 IDL 类型解码 Borsh 数据
+//
+// 数值类型保持 Go 原生类型（u64 -> uint64，u128 -> *big.Int），
+// pubkey 为 solana.PublicKey，bytes 与 [u8; N] 为 hexutil.Bytes，结构体为 map[string]interface{}。
+type borshDecoder struct {
+	buf   []byte
+	types map[string]*idlTypeDef
+}
+
+func (d *borshDecoder) take(n int) ([]byte, error) {
+	if n < 0 || n > len(d.buf) {
+		return nil, fmt.Errorf("unexpected end of data (need %d, have %d)", n, len(d.buf))
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+func (d *borshDecoder) length() (int, error) {
+	b, err := d.take(4)
+	if err != nil {
+		return 0, err
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if int64(n) > int64(len(d.buf)) {
+		return 0, fmt.Errorf("length %d exceeds remaining data", n)
+	}
+	return int(n), nil
+}
+
+func (d *borshDecoder) fields(fields []idlField) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		v, err := d.value(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		out[f.Name] = v
+	}
+	return out, nil
+}
+
+func (d *borshDecoder) value(t idlType) (interface{}, error) {
+	switch {
+	case t.Vec != nil:
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		return d.sequence(*t.Vec, n)
+	case t.Array != nil:
+		return d.sequence(*t.Array, t.Len)
+	case t.Option != nil:
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] == 0 {
+			return nil, nil
+		}
+		return d.value(*t.Option)
+	case t.Defined != "":
+		return d.defined(t.Defined)
+	}
+	return d.primitive(t.Prim)
+}
+
+func (d *borshDecoder) sequence(elem idlType, n int) (interface{}, error) {
+	if elem.Prim == "u8" {
+		b, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return hexutil.Bytes(append([]byte(nil), b...)), nil
+	}
+	out := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.value(elem)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *borshDecoder) defined(name string) (interface{}, error) {
+	def, ok := d.types[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined type %q", name)
+	}
+	switch def.Type.Kind {
+	case "struct":
+		return d.fields(def.Type.Fields)
+	case "enum":
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		if int(b[0]) >= len(def.Type.Variants) {
+			return nil, fmt.Errorf("%s: invalid enum variant %d", name, b[0])
+		}
+		variant := def.Type.Variants[b[0]]
+		if len(variant.Fields) == 0 {
+			return variant.Name, nil
+		}
+		fields, err := d.fields(variant.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s::%s: %w", name, variant.Name, err)
+		}
+		return map[string]interface{}{variant.Name: fields}, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported type kind %q", name, def.Type.Kind)
+}
+
+// 定长基础类型的字节数（publicKey 为旧版 IDL 写法）
+var borshPrimitiveSizes = map[string]int{
+	"bool": 1, "u8": 1, "i8": 1, "u16": 2, "i16": 2, "u32": 4, "i32": 4, "f32": 4,
+	"u64": 8, "i64": 8, "f64": 8, "u128": 16, "i128": 16, "pubkey": 32, "publicKey": 32,
+}
+
+func (d *borshDecoder) primitive(prim string) (interface{}, error) {
+	switch prim {
+	case "string":
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		b, _ := d.take(n)
+		return string(b), nil
+	case "bytes":
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		b, _ := d.take(n)
+		return hexutil.Bytes(append([]byte(nil), b...)), nil
+	}
+	n, ok := borshPrimitiveSizes[prim]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %q", prim)
+	}
+	b, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	switch prim {
+	case "bool":
+		return b[0] != 0, nil
+	case "u8":
+		return b[0], nil
+	case "i8":
+		return int8(b[0]), nil
+	case "u16":
+		return binary.LittleEndian.Uint16(b), nil
+	case "i16":
+		return int16(binary.LittleEndian.Uint16(b)), nil
+	case "u32":
+		return binary.LittleEndian.Uint32(b), nil
+	case "i32":
+		return int32(binary.LittleEndian.Uint32(b)), nil
+	case "f32":
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case "u64":
+		return binary.LittleEndian.Uint64(b), nil
+	case "i64":
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case "f64":
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "u128", "i128":
+		be := make([]byte, 16)
+		for i := range b {
+			be[15-i] = b[i]
+		}
+		v := new(big.Int).SetBytes(be)
+		if prim == "i128" && b[15]&0x80 != 0 {
+			v.Sub(v, new(big.Int).Lsh(big.NewInt(1), 128))
+		}
+		return v, nil
+	}
+	return solana.PublicKeyFromBytes(b), nil
+}
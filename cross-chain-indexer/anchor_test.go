@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gagliardetto/solana-go"
+)
+
+func mustLoadIDL(t *testing.T, role, programID string) *AnchorProgram {
+	t.Helper()
+	p, err := loadProgramIDL(ProgramConfig{ProgramID: programID, Role: role})
+	if err != nil {
+		t.Fatalf("loadProgramIDL(%s): %v", role, err)
+	}
+	return p
+}
+
+func TestDecodeLzReceiveInstruction(t *testing.T) {
+	oapp := mustLoadIDL(t, ProgramRoleOApp, "")
+	sender := common.HexToHash("0x000000000000000000000000a1d91cdcbd933c3385d7dea34d87357f5e62f6d6")
+	guid := common.HexToHash(fixtureGUID)
+	message := make([]byte, 128)
+	message[31] = 101
+
+	disc := anchorDiscriminator("global", "lz_receive")
+	data := append([]byte(nil), disc[:]...)
+	data = binary.LittleEndian.AppendUint32(data, 40245)
+	data = append(data, sender.Bytes()...)
+	data = binary.LittleEndian.AppendUint64(data, 7)
+	data = append(data, guid.Bytes()...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(message)))
+	data = append(data, message...)
+	data = binary.LittleEndian.AppendUint32(data, 0) // extra_data
+
+	// store, peer, transfer_program 以及未传入的可选账户（以程序 ID 占位）
+	store, peer, transfer := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	accounts := []solana.PublicKey{store, peer, transfer, oapp.ID, oapp.ID, oapp.ID, oapp.ID, oapp.ID, oapp.ID}
+	ix, err := oapp.DecodeInstruction(oapp.ID, data, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Name != "lz_receive" || !ix.Accounts["store"].Equals(store) || !ix.Accounts["transfer_program"].Equals(transfer) {
+		t.Errorf("decoded %+v", ix)
+	}
+	if _, ok := ix.Accounts["mint"]; ok {
+		t.Error("absent optional account should be omitted")
+	}
+
+	p, err := lzPacketFromInstruction(ix, 40168)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.GUID != guid || p.Nonce != 7 || p.SrcEid != 40245 || p.DstEid != 40168 || p.Sender != sender ||
+		len(p.Message) != 128 || p.Receiver != common.BytesToHash(store.Bytes()) {
+		t.Errorf("packet %+v", p)
+	}
+
+	data[0] ^= 0xff
+	if _, err := oapp.DecodeInstruction(oapp.ID, data, accounts); err == nil {
+		t.Error("expected discriminator mismatch")
+	}
+	data[0] ^= 0xff
+	if _, err := oapp.DecodeInstruction(oapp.ID, data[:40], accounts); err == nil {
+		t.Error("expected truncated data error")
+	}
+}
+
+func TestDecodeTransferOut(t *testing.T) {
+	transfer := mustLoadIDL(t, ProgramRoleTransfer, "GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1")
+	disc := anchorDiscriminator("global", "transfer_out")
+	data := binary.LittleEndian.AppendUint64(disc[:], 2500000)
+
+	accounts := make([]solana.PublicKey, 7)
+	for i := range accounts {
+		accounts[i] = solana.NewWallet().PublicKey()
+	}
+	ix, err := transfer.DecodeInstruction(transfer.ID, data, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Name != "transfer_out" || ix.Args["amount"] != uint64(2500000) {
+		t.Errorf("decoded %+v", ix)
+	}
+	if !ix.Accounts["authority"].Equals(accounts[1]) || !ix.Accounts["recipient_token_account"].Equals(accounts[4]) || !ix.Accounts["mint"].Equals(accounts[5]) {
+		t.Errorf("accounts %+v", ix.Accounts)
+	}
+
+	// 其他 7 账户指令不再被误判为 transfer_out
+	other := anchorDiscriminator("global", "initialize")
+	if _, err := transfer.DecodeInstruction(transfer.ID, binary.LittleEndian.AppendUint64(other[:], 1), accounts); err == nil {
+		t.Error("unknown instruction should not decode")
+	}
+}
+
+func TestDecodeAnchorEvents(t *testing.T) {
+	oapp := mustLoadIDL(t, ProgramRoleOApp, "")
+	caller := solana.NewWallet().PublicKey()
+
+	disc := anchorDiscriminator("event", "RelaySendEvent")
+	data := append([]byte(nil), disc[:]...)
+	data = append(data, caller.Bytes()...)
+	data = binary.LittleEndian.AppendUint32(data, 40245)
+	data = binary.LittleEndian.AppendUint32(data, 2)
+	data = append(data, "hi"...)
+	data = binary.LittleEndian.AppendUint64(data, 5000)
+	data = binary.LittleEndian.AppendUint64(data, 0)
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	other := solana.NewWallet().PublicKey().String()
+	logs := []string{
+		"Program " + oapp.ID.String() + " invoke [1]",
+		"Program log: Instruction: RelaySend",
+		"Program " + other + " invoke [2]",
+		"Program data: " + encoded, // 属于被调用的其他程序，不解码
+		"Program " + other + " success",
+		"Program data: " + encoded,
+		"Program " + oapp.ID.String() + " consumed 12345 of 200000 compute units",
+		"Program " + oapp.ID.String() + " success",
+	}
+	events := decodeAnchorEvents(logs, oapp)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Name != "RelaySendEvent" || ev.Fields["dst_eid"] != uint32(40245) || ev.Fields["message"] != "hi" ||
+		ev.Fields["native_fee"] != uint64(5000) || !ev.Fields["caller"].(solana.PublicKey).Equals(caller) {
+		t.Errorf("event %+v", ev)
+	}
+}
+
+func TestParseLegacyAnchorIDL(t *testing.T) {
+	// 0.29 格式：camelCase 指令名、无 discriminator、{"defined": "X"}、publicKey
+	idl := `{
+		"name": "legacy",
+		"instructions": [{
+			"name": "setPeerConfig",
+			"accounts": [{"name": "admin", "isMut": true, "isSigner": true}, {"name": "extra", "isMut": false, "isSigner": false, "isOptional": true}],
+			"args": [{"name": "remoteEid", "type": "u32"}, {"name": "config", "type": {"defined": "PeerConfigParam"}}, {"name": "owner", "type": {"option": "publicKey"}}]
+		}],
+		"types": [{"name": "PeerConfigParam", "type": {"kind": "enum", "variants": [
+			{"name": "PeerAddress", "fields": [{"array": ["u8", 32]}]},
+			{"name": "EnforcedOptions", "fields": [{"name": "send", "type": "bytes"}, {"name": "sendAndCall", "type": "bytes"}]}
+		]}}]
+	}`
+	programID := solana.NewWallet().PublicKey()
+	p, err := ParseAnchorIDL([]byte(idl), programID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc := anchorDiscriminator("global", "set_peer_config")
+	data := binary.LittleEndian.AppendUint32(disc[:], 40245)
+	data = append(data, 1)                                      // EnforcedOptions
+	data = append(binary.LittleEndian.AppendUint32(data, 1), 3) // send
+	data = binary.LittleEndian.AppendUint32(data, 0)            // sendAndCall
+	data = append(data, 0)                                      // owner: None
+
+	admin := solana.NewWallet().PublicKey()
+	ix, err := p.DecodeInstruction(programID, data, []solana.PublicKey{admin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Name != "set_peer_config" || ix.Args["remoteEid"] != uint32(40245) || ix.Args["owner"] != nil || !ix.Accounts["admin"].Equals(admin) {
+		t.Errorf("decoded %+v", ix)
+	}
+	cfg, ok := ix.Args["config"].(map[string]interface{})["EnforcedOptions"].(map[string]interface{})
+	if !ok || cfg["send"].(hexutil.Bytes).String() != "0x03" {
+		t.Errorf("config %+v", ix.Args["config"])
+	}
+}
@@ -3,17 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json" // 新增
+	"errors"
 	"fmt"
 	"log"
-	"math/big"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv" // 新增
 	"strings"
 	"time"
 
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient" // 新增
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 )
@@ -48,10 +47,10 @@ func parseBearerToken(r *http.Request) (string, error) {
 	return parts[1], nil
 }
 
-// 校验并解析 JWT，返回 merchant 地址与 role
-func generateJWT(merchant, role string) (string, error) {
+// generateJWT 签发 JWT（merchant 声明为地址的展示形式：EVM 校验和地址 / Solana Base58）
+func generateJWT(merchant ChainAddress, role string) (string, error) {
 	claims := jwt.MapClaims{
-		"merchant": merchant,
+		"merchant": merchant.String(),
 		"role":     role,
 		"exp":      time.Now().Add(time.Hour * 24).Unix(), // 24小时过期
 	}
@@ -60,7 +59,8 @@ func generateJWT(merchant, role string) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-func verifyAndExtractClaims(tokenStr string, secret []byte) (string, string, error) {
+// 校验并解析 JWT，返回 merchant 地址与 role
+func verifyAndExtractClaims(tokenStr string, secret []byte) (ChainAddress, string, error) {
 	tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
@@ -68,16 +68,20 @@ func verifyAndExtractClaims(tokenStr string, secret []byte) (string, string, err
 		return secret, nil
 	})
 	if err != nil || !tok.Valid {
-		return "", "", fmt.Errorf("invalid token: %w", err)
+		return ChainAddress{}, "", fmt.Errorf("invalid token: %w", err)
 	}
 	claims, ok := tok.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", "", fmt.Errorf("invalid claims")
+		return ChainAddress{}, "", fmt.Errorf("invalid claims")
 	}
-	merchant, _ := claims["merchant"].(string)
+	merchantStr, _ := claims["merchant"].(string)
 	role, _ := claims["role"].(string)
-	if merchant == "" {
-		return "", "", fmt.Errorf("missing merchant claim")
+	if merchantStr == "" {
+		return ChainAddress{}, "", fmt.Errorf("missing merchant claim")
+	}
+	merchant, err := ParseChainAddress(merchantStr)
+	if err != nil {
+		return ChainAddress{}, "", fmt.Errorf("invalid merchant claim: %w", err)
 	}
 	return merchant, role, nil
 }
@@ -92,30 +96,15 @@ func authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		// 使用 main.go 中定义的 jwtSecret
-		merchantStr, role, err := verifyAndExtractClaims(tokenStr, jwtSecret)
+		// merchant 声明解析为 ChainAddress（EVM / Solana），格式无效的 token 同样拒绝
+		merchant, role, err := verifyAndExtractClaims(tokenStr, jwtSecret)
 		if err != nil {
 			log.Printf("authMiddleware: failed to verify token: %v", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		// 验证地址格式（支持 EVM 和 Solana）
-		if !isValidAddress(merchantStr) {
-			log.Printf("authMiddleware: invalid address format: %s", merchantStr)
-			http.Error(w, "Invalid address format", http.StatusUnauthorized)
-			return
-		}
-		// 写入上下文（对于 Solana 地址，需要特殊处理）
-		var merchantAddr common.Address
-		if isValidEVMAddress(merchantStr) {
-			merchantAddr = common.HexToAddress(merchantStr)
-		} else {
-			// Solana 地址：转换为 EVM 格式用于查询
-			merchantAddr = solanaAddressToEVMAddressShared(merchantStr)
-		}
-		ctx := context.WithValue(r.Context(), ctxKeyMerchant, merchantAddr)
+		ctx := context.WithValue(r.Context(), ctxKeyMerchant, merchant)
 		ctx = context.WithValue(ctx, ctxKeyRole, role)
-		// 保存原始地址字符串，用于查询
-		ctx = context.WithValue(ctx, "merchant_original", merchantStr)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -134,39 +123,45 @@ func adminOnlyMiddleware(next http.Handler) http.Handler {
 
 // 仅供 API 使用的最小 Store 接口，便于在测试中注入 Mock
 type PayoutStore interface {
-	ListPayouts(limit, offset int) ([]PayoutRecord, error)
-	ListMerchantPayouts(merchant common.Address, limit, offset int) ([]PayoutRecord, error)
-	ListMerchantPayoutsByString(merchantAddr string, limit, offset int) ([]PayoutRecord, error)
+	ListPayoutsFiltered(f PayoutFilter, limit, offset int) ([]PayoutRecord, error)
 	GetAllEvents(limit, offset int) ([]RawEvent, error)
 	GetEventCount() (int, error)
+	ListReorgAudit(limit, offset int) ([]ReorgAuditEntry, error)
+	ListLZMessages(limit, offset int) ([]LZMessage, error)
+	GetLZMessage(guid string) (LZMessage, bool, error)
+	FeeRevenue(groupBy []string, from, to time.Time) ([]FeeRevenue, error)
+	ListFeeIssues(limit, offset int) ([]PayoutRecord, error)
+	ListSolanaInstructions(program, name string, limit, offset int) ([]SolanaInstructionRecord, error)
+	ListUnmatchedDeliveries(limit, offset int) ([]Delivery, error)
+	ListDeadLetters(f DeadLetterFilter, limit, offset int) ([]DeadLetter, error)
+	CountDeadLetters() (map[string]int, error)
 }
 
 // Server 承载 API，并可以触发后端操作（如 backfill）
 type Server struct {
-	store    PayoutStore
-	httpsCli *ethclient.Client
-	oappAddr common.Address
-	topic    common.Hash
-	proc     *Processor
+	store       PayoutStore
+	listeners   *ListenerSupervisor
+	reindexer   *Reindexer       // 为空时 /admin/reindex 不可用
+	deadLetters *DeadLetterQueue // 为空时不能重试 / 丢弃死信
+	ctx         context.Context  // 后台任务（重新索引）的根 context，进程关闭时取消
 
 	// backfill control channel，用于在同一进程内触发回填（可扩展）
 	backfillCh chan backfillRequest
 }
 
 type backfillRequest struct {
+	Chain     string // 为空表示所有链
 	FromBlock uint64
 	ToBlock   uint64
 	// 我们也可以加入回调或 request id
 }
 
 // NewServer 构造 Server（接受满足 PayoutStore 接口的实现，生产中传 *Store 即可）
-func NewServer(s PayoutStore, httpsCli *ethclient.Client, oappAddr common.Address, topic common.Hash, proc *Processor) *Server {
+func NewServer(s PayoutStore, listeners *ListenerSupervisor) *Server {
 	srv := &Server{
 		store:      s,
-		httpsCli:   httpsCli,
-		oappAddr:   oappAddr,
-		topic:      topic,
-		proc:       proc,
+		listeners:  listeners,
+		ctx:        context.Background(),
 		backfillCh: make(chan backfillRequest, 4),
 	}
 	// 后台 goroutine 负责实际执行 backfill，以避免在 HTTP handler 中阻塞
@@ -197,6 +192,8 @@ func (s *Server) routes() http.Handler {
 
 	// 公共
 	r.HandleFunc("/health", s.handleHealth).Methods("GET")
+	r.HandleFunc("/config/chains", s.handleListChains).Methods("GET")
+	r.HandleFunc("/config/tokens", s.handleListTokens).Methods("GET")
 	// 调试页面（仅开发环境）
 	r.HandleFunc("/debug", s.handleDebug).Methods("GET")
 	// 认证接口
@@ -214,6 +211,19 @@ func (s *Server) routes() http.Handler {
 	admin.Use(authMiddleware)
 	admin.Use(adminOnlyMiddleware)
 	admin.HandleFunc("/backfill", s.handleBackfill).Methods("POST")
+	admin.HandleFunc("/reindex", s.handleReindex).Methods("POST")
+	admin.HandleFunc("/reindex", s.handleReindexStatus).Methods("GET")
+	admin.HandleFunc("/reorgs", s.handleListReorgs).Methods("GET")
+	admin.HandleFunc("/messages", s.handleListMessages).Methods("GET")
+	admin.HandleFunc("/messages/{guid}", s.handleGetMessage).Methods("GET")
+	admin.HandleFunc("/deliveries/unmatched", s.handleListUnmatchedDeliveries).Methods("GET")
+	admin.HandleFunc("/dead-letters", s.handleListDeadLetters).Methods("GET")
+	admin.HandleFunc("/dead-letters/{id}/retry", s.handleRetryDeadLetter).Methods("POST")
+	admin.HandleFunc("/dead-letters/{id}/discard", s.handleDiscardDeadLetter).Methods("POST")
+	admin.HandleFunc("/alerts", s.handleListAlerts).Methods("GET")
+	admin.HandleFunc("/fees", s.handleFeeRevenue).Methods("GET")
+	admin.HandleFunc("/fees/issues", s.handleListFeeIssues).Methods("GET")
+	admin.HandleFunc("/solana/instructions", s.handleListSolanaInstructions).Methods("GET")
 	admin.HandleFunc("/admins", s.handleListAdmins).Methods("GET")
 	admin.HandleFunc("/admins", s.handleAddAdmin).Methods("POST")
 	admin.HandleFunc("/admins/{address}", s.handleRemoveAdmin).Methods("DELETE")
@@ -233,14 +243,68 @@ func (s *Server) routes() http.Handler {
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	var statuses []ListenerStatus
+	if s.listeners != nil {
+		statuses = s.listeners.Statuses()
+	}
 	resp := map[string]interface{}{
 		"ok":        true,
 		"db":        s.store != nil,
-		"wssStatus": getWssStatus(),
+		"wssStatus": aggregateWssStatus(statuses),
+		"listeners": statuses,
 	}
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// ChainInfo 对外公开的网络信息（不包含 RPC 端点，避免泄露 API key）
+type ChainInfo struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	EID       uint32   `json:"eid"`
+	ChainID   uint64   `json:"chain_id,omitempty"`
+	Enabled   bool     `json:"enabled"`
+	Contracts []string `json:"contracts,omitempty"`
+	Programs  []string `json:"programs,omitempty"`
+}
+
+// handleListChains 返回注册表中的网络列表（供 Dashboard 使用）
+func (s *Server) handleListChains(w http.ResponseWriter, r *http.Request) {
+	chains := []ChainInfo{}
+	if chainRegistry != nil {
+		for _, n := range chainRegistry.Networks {
+			info := ChainInfo{
+				Name:    n.Name,
+				Type:    n.Type,
+				EID:     n.EID,
+				ChainID: n.ChainID,
+				Enabled: n.IsEnabled(),
+			}
+			for _, c := range n.Contracts {
+				info.Contracts = append(info.Contracts, c.Address)
+			}
+			for _, p := range n.Programs {
+				info.Programs = append(info.Programs, p.ProgramID)
+			}
+			chains = append(chains, info)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"chains": chains})
+}
+
+// handleListTokens 返回代币注册表（配置 + 链上读取）
+func (s *Server) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens := tokenRegistry.List()
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].EID != tokens[j].EID {
+			return tokens[i].EID < tokens[j].EID
+		}
+		return tokens[i].Address < tokens[j].Address
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens})
+}
+
 // handleDebug 提供调试页面（仅开发环境）
 func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "debug.html")
@@ -267,96 +331,135 @@ type UserInfoResponse struct {
 
 // PayoutResponse API响应的支付记录结构，包含格式化后的金额
 type PayoutResponse struct {
-	TxHash         string    `json:"TxHash"`
-	BlockNumber    int64     `json:"BlockNumber"`
-	DstEid         int64     `json:"DstEid"`
-	DstChain       string    `json:"DstChain"` // 目标链名称
-	Payer          string    `json:"Payer"`
-	Merchant       string    `json:"Merchant"`
-	SrcToken       string    `json:"SrcToken"`
-	DstToken       string    `json:"DstToken"`
-	GrossAmount    string    `json:"GrossAmount"`    // 原始值（字符串）
-	NetAmount      string    `json:"NetAmount"`      // 原始值（字符串）
-	GrossAmountUSD string    `json:"GrossAmountUSD"` // 格式化后的USD值
-	NetAmountUSD   string    `json:"NetAmountUSD"`   // 格式化后的USD值
-	Status         string    `json:"Status"`
-	Timestamp      time.Time `json:"Timestamp"`
-	SolanaMerchant string    `json:"SolanaMerchant,omitempty"` // Solana 原始地址
-	SolanaPayer    string    `json:"SolanaPayer,omitempty"`    // Solana 原始地址
-}
-
-// formatAmountToUSD 将原始金额转换为USD显示格式
-func formatAmountToUSD(amount *big.Int) string {
-	if amount == nil {
-		return "0.00"
-	}
-
-	// 转换为浮点数，除以10^6（USDT/USDC的6位小数）
-	f := new(big.Float).SetInt(amount)
-	divisor := big.NewFloat(1000000) // 10^6
-	f.Quo(f, divisor)
-
-	// 格式化为2位小数
-	return fmt.Sprintf("%.2f", f)
-}
-
-// getChainName 根据 EID 返回链名称
+	TxHash         string     `json:"TxHash"`
+	BlockNumber    int64      `json:"BlockNumber"`
+	SrcEid         int64      `json:"SrcEid"`
+	SrcChain       string     `json:"SrcChain"`              // 源链名称（旧数据未回填时为空）
+	SrcContract    string     `json:"SrcContract,omitempty"` // 源链 MyOApp 合约
+	DstEid         int64      `json:"DstEid"`
+	DstChain       string     `json:"DstChain"`              // 目标链名称
+	DstContract    string     `json:"DstContract,omitempty"` // 目标链 OApp（EVM 合约 / Solana 程序）
+	Payer          string     `json:"Payer"`
+	Merchant       string     `json:"Merchant"`
+	SrcToken       string     `json:"SrcToken"`
+	DstToken       string     `json:"DstToken"`
+	GrossAmount    string     `json:"GrossAmount"`           // 原始值（字符串）
+	NetAmount      string     `json:"NetAmount"`             // 原始值（字符串）
+	GrossAmountUSD string     `json:"GrossAmountUSD"`        // USD 值（仅锚定 USD 的代币，否则为空）
+	NetAmountUSD   string     `json:"NetAmountUSD"`          // USD 值（仅锚定 USD 的代币，否则为空）
+	TokenSymbol    string     `json:"TokenSymbol,omitempty"` // 源链代币（金额计价代币），未知时以下字段为空
+	TokenDecimals  *uint8     `json:"TokenDecimals,omitempty"`
+	TokenPeg       string     `json:"TokenPeg,omitempty"`       // 锚定的法币
+	GrossAmountFmt string     `json:"GrossAmountFmt,omitempty"` // 按精度换算后的金额
+	NetAmountFmt   string     `json:"NetAmountFmt,omitempty"`
+	DstTokenSymbol string     `json:"DstTokenSymbol,omitempty"`
+	Status         string     `json:"Status"`
+	Timestamp      time.Time  `json:"Timestamp"`
+	SolanaMerchant string     `json:"SolanaMerchant,omitempty"` // 兼容旧版 Dashboard：Solana 商户（同 Merchant）
+	SolanaPayer    string     `json:"SolanaPayer,omitempty"`    // 兼容旧版 Dashboard：Solana 付款人（同 Payer）
+	Finalized      bool       `json:"Finalized"`                // 源链已达到确认深度
+	DstTxHash      string     `json:"DstTxHash,omitempty"`      // 目标链执行交易
+	DeliveredAt    *time.Time `json:"DeliveredAt,omitempty"`    // 目标链执行时间
+	GUID           string     `json:"GUID,omitempty"`           // LayerZero 消息 GUID
+	FailureReason  string     `json:"FailureReason,omitempty"`  // Stuck / Failed 原因
+	FeeAmount      string     `json:"FeeAmount"`                // 手续费原始值（srcToken 计价）
+	FeeAmountUSD   string     `json:"FeeAmountUSD"`             // USD 值（同 GrossAmountUSD）
+	FeeAmountFmt   string     `json:"FeeAmountFmt,omitempty"`   // 按精度换算后的手续费
+	FeeBps         *int       `json:"FeeBps,omitempty"`         // 合约 FEE_BPS（未知时省略）
+	FeeIssue       string     `json:"FeeIssue,omitempty"`       // 手续费校验问题
+}
+
+// getChainName 根据 EID 从注册表返回链名称
 func getChainName(eid int64) string {
-	switch eid {
-	case 40245:
-		return "Base Sepolia"
-	case 40231:
-		return "Arbitrum Sepolia"
-	case 40168:
-		return "Solana Devnet"
-	case 30168:
-		return "Solana Mainnet"
-	default:
-		return fmt.Sprintf("Chain %d", eid)
+	if n, ok := chainRegistry.NetworkByEID(uint32(eid)); ok {
+		return n.Name
 	}
+	return fmt.Sprintf("Chain %d", eid)
 }
 
 // isSolanaChain 判断是否为 Solana 链
 func isSolanaChain(eid int64) bool {
-	return eid == 40168 || eid == 30168
+	n, ok := chainRegistry.NetworkByEID(uint32(eid))
+	return ok && n.IsSolana()
 }
 
 // convertPayoutToResponse 转换 PayoutRecord 到 PayoutResponse
 func convertPayoutToResponse(payout PayoutRecord) PayoutResponse {
 	resp := PayoutResponse{
-		TxHash:         payout.TxHash,
-		BlockNumber:    payout.BlockNumber,
-		DstEid:         payout.DstEid,
-		DstChain:       getChainName(payout.DstEid),
-		SrcToken:       payout.SrcToken.Hex(),
-		DstToken:       payout.DstToken.Hex(),
-		GrossAmount:    payout.GrossAmount.String(),
-		NetAmount:      payout.NetAmount.String(),
-		GrossAmountUSD: formatAmountToUSD(payout.GrossAmount),
-		NetAmountUSD:   formatAmountToUSD(payout.NetAmount),
-		Status:         payout.Status,
-		Timestamp:      payout.Timestamp,
-	}
-
-	// 根据链类型决定显示哪种地址格式
-	if isSolanaChain(payout.DstEid) && payout.SolanaMerchant != "" {
-		// Solana 目标链：Merchant 显示 Solana 地址
-		resp.Merchant = payout.SolanaMerchant
-		// Payer 仍然是源链（EVM）地址
-		resp.Payer = payout.Payer.Hex()
-		// 如果需要也保存 Solana Payer（未来功能）
-		if payout.SolanaPayer != "" {
-			resp.SolanaPayer = payout.SolanaPayer
+		TxHash:        payout.TxHash,
+		BlockNumber:   payout.BlockNumber,
+		SrcEid:        payout.SrcEid,
+		SrcContract:   payout.SrcContract.String(),
+		DstEid:        payout.DstEid,
+		DstChain:      getChainName(payout.DstEid),
+		DstContract:   payout.DstContract.String(),
+		SrcToken:      payout.SrcToken.Hex(),
+		Payer:         payout.Payer.String(),
+		Merchant:      payout.Merchant.String(),
+		DstToken:      payout.DstToken.String(),
+		GrossAmount:   payout.GrossAmount.String(),
+		NetAmount:     payout.NetAmount.String(),
+		Status:        payout.Status,
+		Timestamp:     payout.Timestamp,
+		Finalized:     payout.Finalized,
+		DstTxHash:     payout.DstTxHash,
+		GUID:          payout.GUID,
+		FailureReason: payout.FailureReason,
+		FeeAmount:     "0",
+		FeeIssue:      payout.FeeIssue,
+	}
+	if payout.FeeAmount != nil {
+		resp.FeeAmount = payout.FeeAmount.String()
+	}
+	if payout.SrcEid != 0 {
+		resp.SrcChain = getChainName(payout.SrcEid)
+	}
+
+	// 金额按源链代币的精度换算；锚定 USD 的代币给出 USD 值
+	if token, ok := lookupSrcToken(payout.SrcEid, payout.SrcToken.Hex()); ok {
+		decimals := token.Decimals
+		resp.TokenSymbol = token.Symbol
+		resp.TokenDecimals = &decimals
+		resp.TokenPeg = token.Peg
+		resp.GrossAmountFmt = formatTokenAmount(payout.GrossAmount, decimals)
+		resp.NetAmountFmt = formatTokenAmount(payout.NetAmount, decimals)
+		resp.FeeAmountFmt = formatTokenAmount(payout.FeeAmount, decimals)
+		if token.Peg == "USD" {
+			resp.GrossAmountUSD = formatFiat(payout.GrossAmount, decimals)
+			resp.NetAmountUSD = formatFiat(payout.NetAmount, decimals)
+			resp.FeeAmountUSD = formatFiat(payout.FeeAmount, decimals)
 		}
-	} else {
-		// EVM 链：全部显示 0x 地址
-		resp.Merchant = payout.Merchant.Hex()
-		resp.Payer = payout.Payer.Hex()
+	}
+	if token, ok := tokenRegistry.Lookup(uint32(payout.DstEid), payout.DstToken.String()); ok {
+		resp.DstTokenSymbol = token.Symbol
+	}
+	if payout.FeeBps != feeBpsUnknown {
+		feeBps := payout.FeeBps
+		resp.FeeBps = &feeBps
+	}
+	if !payout.DeliveredAt.IsZero() {
+		deliveredAt := payout.DeliveredAt
+		resp.DeliveredAt = &deliveredAt
+	}
+
+	if payout.Merchant.Namespace() == AddressNamespaceSolana {
+		resp.SolanaMerchant = resp.Merchant
+	}
+	if payout.Payer.Namespace() == AddressNamespaceSolana {
+		resp.SolanaPayer = resp.Payer
 	}
 
 	return resp
 }
 
+// lookupSrcToken 按源链查找源链代币；旧数据尚未回填源链（srcEid 为 0）时只按地址查找
+func lookupSrcToken(srcEid int64, addr string) (TokenInfo, bool) {
+	if srcEid == 0 {
+		return tokenRegistry.LookupAny(addr)
+	}
+	return tokenRegistry.Lookup(uint32(srcEid), addr)
+}
+
 // handleLogin 处理登录请求
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
@@ -366,7 +469,8 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 验证地址格式（支持 EVM 和 Solana）
-	if !isValidAddress(req.Address) {
+	addr, err := ParseChainAddress(req.Address)
+	if err != nil {
 		http.Error(w, "Invalid address format. Must be EVM (0x...) or Solana (Base58)", http.StatusBadRequest)
 		return
 	}
@@ -377,23 +481,20 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 标准化地址（小写）
-	normalizedAddr := normalizeAddress(req.Address)
-
 	// 如果请求管理员权限，检查地址是否在管理员白名单中
-	if req.Role == "admin" && !adminConfig.IsAdminAddress(normalizedAddr) {
+	if req.Role == "admin" && !adminConfig.IsAdmin(addr) {
 		http.Error(w, "Address not authorized for admin access", http.StatusForbidden)
 		return
 	}
 
 	// 如果请求商家权限，检查地址是否在商家白名单中
-	if req.Role == "merchant" && !merchantConfig.IsMerchantAddress(normalizedAddr) {
+	if req.Role == "merchant" && !merchantConfig.IsMerchant(addr) {
 		http.Error(w, "Address not authorized for merchant access", http.StatusForbidden)
 		return
 	}
 
 	// 生成 JWT token
-	token, err := generateJWT(req.Address, req.Role)
+	token, err := generateJWT(addr, req.Role)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
@@ -401,7 +502,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	response := LoginResponse{
 		Token:   token,
-		Address: req.Address,
+		Address: addr.String(),
 		Role:    req.Role,
 	}
 
@@ -432,7 +533,7 @@ func (s *Server) handleGetUserInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := UserInfoResponse{
-		Address: merchant,
+		Address: merchant.String(),
 		Role:    role,
 	}
 
@@ -463,7 +564,7 @@ func (s *Server) handleListPayoutsWithURLAuth(w http.ResponseWriter, r *http.Req
 	}
 
 	// 将认证信息添加到请求上下文
-	ctx := context.WithValue(r.Context(), ctxKeyMerchant, common.HexToAddress(merchant))
+	ctx := context.WithValue(r.Context(), ctxKeyMerchant, merchant)
 	ctx = context.WithValue(ctx, ctxKeyRole, role)
 	r = r.WithContext(ctx)
 
@@ -478,7 +579,12 @@ func (s *Server) handleListPayouts(w http.ResponseWriter, r *http.Request) {
 		limit = 50
 	}
 	offset, _ := strconv.Atoi(q.Get("offset"))
-	list, err := s.store.ListPayouts(limit, offset)
+	filter, err := parsePayoutFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := s.store.ListPayoutsFiltered(filter, limit, offset)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -493,32 +599,319 @@ func (s *Server) handleListPayouts(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(responses)
 }
 
+// parsePayoutFilter 解析列表接口的过滤参数：
+// status=Stuck,Failed；src_eid / dst_eid；src_contract / dst_contract（EVM 地址或 Solana 程序 ID）
+func parsePayoutFilter(q url.Values) (PayoutFilter, error) {
+	var f PayoutFilter
+	for _, st := range strings.Split(q.Get("status"), ",") {
+		if st = strings.TrimSpace(st); st != "" {
+			f.Statuses = append(f.Statuses, st)
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"src_eid", &f.SrcEid}, {"dst_eid", &f.DstEid}} {
+		if v := q.Get(p.name); v != "" {
+			eid, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return PayoutFilter{}, fmt.Errorf("invalid %s %q", p.name, v)
+			}
+			*p.dst = int64(eid)
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *ChainAddress
+	}{{"src_contract", &f.SrcContract}, {"dst_contract", &f.DstContract}} {
+		if v := q.Get(p.name); v != "" {
+			addr, err := ParseChainAddress(v)
+			if err != nil {
+				return PayoutFilter{}, fmt.Errorf("invalid %s: %v", p.name, err)
+			}
+			*p.dst = addr
+		}
+	}
+	return f, nil
+}
+
+// handleFeeRevenue 手续费收入汇总
+//
+// 参数：group_by=day,chain,token,merchant（任意组合，默认 day,chain,token）；
+// from / to 为 YYYY-MM-DD（to 不含当天之后），均可省略。
+func (s *Server) handleFeeRevenue(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	groupBy := []string{FeeGroupDay, FeeGroupChain, FeeGroupToken}
+	if v := q.Get("group_by"); v != "" {
+		groupBy = groupBy[:0]
+		for _, g := range strings.Split(v, ",") {
+			g = strings.TrimSpace(g)
+			if _, ok := feeGroupColumns[g]; !ok {
+				http.Error(w, fmt.Sprintf("invalid group_by %q (day, chain, token, merchant)", g), http.StatusBadRequest)
+				return
+			}
+			groupBy = append(groupBy, g)
+		}
+	}
+	var from, to time.Time
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+		days int
+	}{{"from", &from, 0}, {"to", &to, 1}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s (YYYY-MM-DD)", p.name), http.StatusBadRequest)
+			return
+		}
+		*p.dst = d.AddDate(0, 0, p.days)
+	}
+
+	revenue, err := s.store.FeeRevenue(groupBy, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if revenue == nil {
+		revenue = []FeeRevenue{}
+	}
+	// 金额为代币最小单位：附上每组代币的精度，不同链上地址相同的代币各自换算
+	for i := range revenue {
+		if revenue[i].Token == "" {
+			continue
+		}
+		if token, ok := lookupSrcToken(revenue[i].TokenEid, revenue[i].Token); ok {
+			decimals := token.Decimals
+			revenue[i].Symbol, revenue[i].Decimals = token.Symbol, &decimals
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"group_by": groupBy, "fees": revenue})
+}
+
+// handleListFeeIssues 列出手续费校验未通过的 payout
+func (s *Server) handleListFeeIssues(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	list, err := s.store.ListFeeIssues(limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	responses := make([]PayoutResponse, len(list))
+	for i, payout := range list {
+		responses[i] = convertPayoutToResponse(payout)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"payouts": responses})
+}
+
+// handleListSolanaInstructions 列出按 IDL 解码的 Solana 指令与事件（可按 program / name 过滤）
+func (s *Server) handleListSolanaInstructions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	records, err := s.store.ListSolanaInstructions(q.Get("program"), q.Get("name"), limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []SolanaInstructionRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"instructions": records})
+}
+
+// handleListReorgs 列出重组审计记录（被回滚的事件与其回滚前状态）
+func (s *Server) handleListReorgs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	entries, err := s.store.ListReorgAudit(limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []ReorgAuditEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"reorgs": entries})
+}
+
+// handleListAlerts 列出最近的告警（Stuck / Failed）
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > recentAlertLimit {
+		limit = 50
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"alerts": alerter.Recent(limit)})
+}
+
+// handleListMessages 列出 LayerZero 消息（源链交易 / GUID / nonce / 目标链交易）
+func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	messages, err := s.store.ListLZMessages(limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []LZMessage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages})
+}
+
+// handleListUnmatchedDeliveries 列出尚未关联源链 payout 的目标链执行
+func (s *Server) handleListUnmatchedDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	deliveries, err := s.store.ListUnmatchedDeliveries(limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"deliveries": deliveries})
+}
+
+// handleListDeadLetters 列出死信（可按 chain / status 过滤），并返回各状态的数量
+func (s *Server) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	filter := DeadLetterFilter{Chain: q.Get("chain"), Status: q.Get("status")}
+	switch filter.Status {
+	case "", DeadLetterPending, DeadLetterExhausted, DeadLetterResolved, DeadLetterDiscarded:
+	default:
+		http.Error(w, "invalid status: "+filter.Status, http.StatusBadRequest)
+		return
+	}
+	list, err := s.store.ListDeadLetters(filter, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	counts, err := s.store.CountDeadLetters()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []DeadLetter{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"dead_letters": list, "counts": counts})
+}
+
+// handleRetryDeadLetter 立即重试一条死信，返回重试后的记录（失败时 status 与 error 反映本次结果）
+func (s *Server) handleRetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	s.handleDeadLetterAction(w, r, func(id int64) (DeadLetter, error) {
+		return s.deadLetters.Retry(r.Context(), id)
+	})
+}
+
+// handleDiscardDeadLetter 丢弃一条死信（不再自动重试）
+func (s *Server) handleDiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	s.handleDeadLetterAction(w, r, s.deadLetters.Discard)
+}
+
+func (s *Server) handleDeadLetterAction(w http.ResponseWriter, r *http.Request, action func(id int64) (DeadLetter, error)) {
+	if s.deadLetters == nil {
+		http.Error(w, "Dead-letter queue not available", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid dead letter id", http.StatusBadRequest)
+		return
+	}
+	dl, err := action(id)
+	switch {
+	case errors.Is(err, errDeadLetterNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errDeadLetterResolved):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("API: dead letter %d error: %v", id, err)
+		http.Error(w, "Dead letter operation failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(dl)
+}
+
+// handleGetMessage 按 GUID 查询 LayerZero 消息
+func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	guid := strings.ToLower(mux.Vars(r)["guid"])
+	message, ok, err := s.store.GetLZMessage(guid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(message)
+}
+
 // 已移除公开路由，所有商家数据访问都需要认证
 
 // 占位函数：模拟从认证/会话中获取商家地址
 // 【重要】在实际项目中，你需要替换为从用户的认证信息（如 JWT token）中安全提取地址的逻辑。
-func getAuthenticatedMerchantAddress(r *http.Request) (common.Address, error) {
+func getAuthenticatedMerchantAddress(r *http.Request) (ChainAddress, error) {
 	v := r.Context().Value(ctxKeyMerchant)
-	addr, ok := v.(common.Address)
-	if !ok {
-		return common.Address{}, fmt.Errorf("no merchant in context or context is not set")
+	addr, ok := v.(ChainAddress)
+	if !ok || addr.IsZero() {
+		return ChainAddress{}, fmt.Errorf("no merchant in context or context is not set")
 	}
 	return addr, nil
 }
 
 // handleListMerchantPayouts 处理 /merchant/payouts 请求，只返回与当前商家相关的交易数据
 func (s *Server) handleListMerchantPayouts(w http.ResponseWriter, r *http.Request) {
-	// 1. 【安全】获取当前请求的商家地址（原始地址）
-	merchantOriginal := r.Context().Value("merchant_original")
-	if merchantOriginal == nil {
+	// 1. 【安全】获取当前请求的商家地址
+	merchant, err := getAuthenticatedMerchantAddress(r)
+	if err != nil {
 		http.Error(w, "Authentication failed or merchant address missing", http.StatusUnauthorized)
 		return
 	}
-	merchantStr, ok := merchantOriginal.(string)
-	if !ok {
-		http.Error(w, "Invalid merchant address format", http.StatusUnauthorized)
-		return
-	}
 
 	// 2. 解析分页参数
 	q := r.URL.Query()
@@ -527,10 +920,15 @@ func (s *Server) handleListMerchantPayouts(w http.ResponseWriter, r *http.Reques
 		limit = 50
 	}
 	offset, _ := strconv.Atoi(q.Get("offset"))
+	filter, err := parsePayoutFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Merchant = merchant
 
-	// 3. 调用 Store 层的新方法进行筛选
-	// 支持 Solana 地址查询
-	list, err := s.store.ListMerchantPayoutsByString(merchantStr, limit, offset)
+	// 3. 调用 Store 层的新方法进行筛选（商户条件不可被查询参数覆盖）
+	list, err := s.store.ListPayoutsFiltered(filter, limit, offset)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -546,72 +944,115 @@ func (s *Server) handleListMerchantPayouts(w http.ResponseWriter, r *http.Reques
 	_ = json.NewEncoder(w).Encode(responses)
 }
 
-// handleBackfill: 支持可选 JSON body { "from_block": <n>, "to_block": <m> }
-// 若不提供，将使用默认后端逻辑 (e.g., last 200 blocks)
+// handleBackfill: 支持可选 JSON body { "chain": "<name>", "from_block": <n>, "to_block": <m> }
+// 若不提供区间，将回填各链最近 defaultAPIBackfillBlocks 个区块；不提供 chain 则回填所有链
 func (s *Server) handleBackfill(w http.ResponseWriter, r *http.Request) {
 	type Req struct {
+		Chain     string `json:"chain"`
 		FromBlock uint64 `json:"from_block"`
 		ToBlock   uint64 `json:"to_block"`
 	}
 	var req Req
 	_ = json.NewDecoder(r.Body).Decode(&req)
 
+	if req.Chain != "" {
+		if s.listeners == nil {
+			http.Error(w, "No listeners configured", http.StatusServiceUnavailable)
+			return
+		}
+		if _, ok := s.listeners.Get(req.Chain); !ok {
+			http.Error(w, "Unknown chain: "+req.Chain, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// 将请求异步放入队列，由后台 worker 处理
-	s.backfillCh <- backfillRequest{FromBlock: req.FromBlock, ToBlock: req.ToBlock}
+	s.backfillCh <- backfillRequest{Chain: req.Chain, FromBlock: req.FromBlock, ToBlock: req.ToBlock}
 
 	w.WriteHeader(http.StatusAccepted)
 	_, _ = w.Write([]byte(`{"status":"backfill queued"}`))
-	log.Printf("API: backfill queued from=%d to=%d", req.FromBlock, req.ToBlock)
+	log.Printf("API: backfill queued chain=%q from=%d to=%d", req.Chain, req.FromBlock, req.ToBlock)
 }
 
+// handleReindex 在后台按保存的原始事件重新生成 payout（body 为 ReindexOptions；已有任务在执行时返回 409）
+func (s *Server) handleReindex(w http.ResponseWriter, r *http.Request) {
+	if s.reindexer == nil {
+		http.Error(w, "Reindex not available", http.StatusServiceUnavailable)
+		return
+	}
+	var opts ReindexOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// 全表重放可能持续数分钟：在后台执行，通过 GET /admin/reindex 查询进度与结果
+	job, err := s.reindexer.Start(s.ctx, opts)
+	status := http.StatusAccepted
+	if errors.Is(err, errReindexRunning) {
+		status = http.StatusConflict
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// handleReindexStatus 最近一次重新索引任务的状态（完成后含扫描统计与差异）
+func (s *Server) handleReindexStatus(w http.ResponseWriter, r *http.Request) {
+	if s.reindexer == nil {
+		http.Error(w, "Reindex not available", http.StatusServiceUnavailable)
+		return
+	}
+	job, ok := s.reindexer.Job()
+	if !ok {
+		http.Error(w, "No reindex has been started", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// 未指定区间时的默认回填深度
+const defaultAPIBackfillBlocks = 200
+
 // backfillWorker: 处理队列中的 backfill 请求
 func (s *Server) backfillWorker() {
 	for req := range s.backfillCh {
-		// 如果用户没有指定区间（0,0），使用默认 backfill 最近 N blocks（由 backfillHistoricalEvents 处理）
-		log.Printf("backfillWorker: received request from=%d to=%d", req.FromBlock, req.ToBlock)
-		if req.FromBlock == 0 && req.ToBlock == 0 {
-			// 没有指定：使用默认策略（最近 200 区块）
-			_ = s.doBackfillDefault()
+		log.Printf("backfillWorker: received request chain=%q from=%d to=%d", req.Chain, req.FromBlock, req.ToBlock)
+		if s.listeners == nil {
+			continue
+		}
+		var targets []ChainListener
+		if req.Chain != "" {
+			if l, ok := s.listeners.Get(req.Chain); ok {
+				targets = append(targets, l)
+			}
 		} else {
-			// 指定区间：执行定制查询
-			_ = s.doBackfillRange(req.FromBlock, req.ToBlock)
+			targets = s.listeners.All()
+		}
+		for _, l := range targets {
+			go s.runBackfill(l, req)
 		}
 	}
 }
 
-func (s *Server) doBackfillDefault() error {
-	// 调用之前实现的 backfillHistoricalEvents（它会查询最近 200 blocks）
-	// 我们在这里传入 s.httpsCli, s.oappAddr, s.topic, s.proc
-	go func() {
-		// 另起协程避免阻塞 worker loop（但保证并发队列不被阻塞）
-		_ = backfillHistoricalEvents(s.httpsCli, s.oappAddr, s.topic, s.proc)
-	}()
-	return nil
-}
-
-func (s *Server) doBackfillRange(from, to uint64) error {
-	// 我们需要在这里使用 FilterLogs 显式按区间查询并调用 proc.ParseAndPersist
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+// runBackfill 在单个监听器上执行回填
+func (s *Server) runBackfill(l ChainListener, req backfillRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	query := ethereum.FilterQuery{
-		FromBlock: new(big.Int).SetUint64(from),
-		ToBlock:   new(big.Int).SetUint64(to),
-		Addresses: []common.Address{s.oappAddr},
-		Topics:    [][]common.Hash{{s.topic}},
-	}
-	logs, err := s.httpsCli.FilterLogs(ctx, query)
-	if err != nil {
-		log.Printf("doBackfillRange: FilterLogs error: %v", err)
-		return err
-	}
-	log.Printf("doBackfillRange: found %d logs in [%d - %d]", len(logs), from, to)
-	for i := len(logs) - 1; i >= 0; i-- {
-		if err := s.proc.ParseAndPersist(context.Background(), logs[i]); err != nil {
-			log.Printf("doBackfillRange: parse error tx=%s idx=%d: %v", logs[i].TxHash.Hex(), logs[i].Index, err)
+	from, to := req.FromBlock, req.ToBlock
+	if from == 0 && to == 0 {
+		// 没有指定：使用默认策略（最近 defaultAPIBackfillBlocks 个区块）
+		if last := l.Status().LastBlock; last > defaultAPIBackfillBlocks {
+			from = last - defaultAPIBackfillBlocks
 		}
 	}
-	return nil
+	if err := l.Backfill(ctx, from, to); err != nil {
+		log.Printf("backfillWorker: %s backfill [%d - %d] error: %v", l.Name(), from, to, err)
+	}
 }
 
 // 管理员管理接口
@@ -637,14 +1078,15 @@ func (s *Server) handleAddAdmin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证地址格式
-	if req.Address == "" || len(req.Address) != 42 || !strings.HasPrefix(req.Address, "0x") {
+	// 验证地址格式（支持 EVM 和 Solana）
+	addr, err := ParseChainAddress(req.Address)
+	if err != nil {
 		http.Error(w, "Invalid address format", http.StatusBadRequest)
 		return
 	}
 
 	// 检查是否已经是管理员
-	if adminConfig.IsAdminAddress(req.Address) {
+	if adminConfig.IsAdmin(addr) {
 		http.Error(w, "Address is already an admin", http.StatusConflict)
 		return
 	}
@@ -654,7 +1096,7 @@ func (s *Server) handleAddAdmin(w http.ResponseWriter, r *http.Request) {
 
 	response := map[string]interface{}{
 		"message": "Admin added successfully",
-		"address": req.Address,
+		"address": addr.String(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -665,14 +1107,15 @@ func (s *Server) handleRemoveAdmin(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	address := vars["address"]
 
-	// 验证地址格式
-	if address == "" || len(address) != 42 || !strings.HasPrefix(address, "0x") {
+	// 验证地址格式（支持 EVM 和 Solana）
+	addr, err := ParseChainAddress(address)
+	if err != nil {
 		http.Error(w, "Invalid address format", http.StatusBadRequest)
 		return
 	}
 
 	// 检查是否是管理员
-	if !adminConfig.IsAdminAddress(address) {
+	if !adminConfig.IsAdmin(addr) {
 		http.Error(w, "Address is not an admin", http.StatusNotFound)
 		return
 	}
@@ -682,7 +1125,7 @@ func (s *Server) handleRemoveAdmin(w http.ResponseWriter, r *http.Request) {
 
 	response := map[string]interface{}{
 		"message": "Admin removed successfully",
-		"address": address,
+		"address": addr.String(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -711,14 +1154,15 @@ func (s *Server) handleAddMerchant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证地址格式
-	if req.Address == "" || len(req.Address) != 42 || !strings.HasPrefix(req.Address, "0x") {
+	// 验证地址格式（支持 EVM 和 Solana）
+	addr, err := ParseChainAddress(req.Address)
+	if err != nil {
 		http.Error(w, "Invalid address format", http.StatusBadRequest)
 		return
 	}
 
 	// 检查是否已经是商家
-	if merchantConfig.IsMerchantAddress(req.Address) {
+	if merchantConfig.IsMerchant(addr) {
 		http.Error(w, "Address is already a merchant", http.StatusConflict)
 		return
 	}
@@ -728,7 +1172,7 @@ func (s *Server) handleAddMerchant(w http.ResponseWriter, r *http.Request) {
 
 	response := map[string]interface{}{
 		"message": "Merchant added successfully",
-		"address": req.Address,
+		"address": addr.String(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -739,14 +1183,15 @@ func (s *Server) handleRemoveMerchant(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	address := vars["address"]
 
-	// 验证地址格式
-	if address == "" || len(address) != 42 || !strings.HasPrefix(address, "0x") {
+	// 验证地址格式（支持 EVM 和 Solana）
+	addr, err := ParseChainAddress(address)
+	if err != nil {
 		http.Error(w, "Invalid address format", http.StatusBadRequest)
 		return
 	}
 
 	// 检查是否是商家
-	if !merchantConfig.IsMerchantAddress(address) {
+	if !merchantConfig.IsMerchant(addr) {
 		http.Error(w, "Address is not a merchant", http.StatusNotFound)
 		return
 	}
@@ -756,17 +1201,23 @@ func (s *Server) handleRemoveMerchant(w http.ResponseWriter, r *http.Request) {
 
 	response := map[string]interface{}{
 		"message": "Merchant removed successfully",
-		"address": address,
+		"address": addr.String(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// helper to read wss status safely
-func getWssStatus() string {
-	mu.Lock()
-	defer mu.Unlock()
-	return wssStatus
+// aggregateWssStatus 汇总各监听器状态：全部 Connected 才算 Connected
+func aggregateWssStatus(statuses []ListenerStatus) string {
+	if len(statuses) == 0 {
+		return ListenerStateDisconnected
+	}
+	for _, st := range statuses {
+		if st.State != ListenerStateConnected {
+			return st.State
+		}
+	}
+	return ListenerStateConnected
 }
 
 // handleListEventsWithURLAuth 列出所有原始事件（支持 URL 参数认证）
@@ -787,7 +1238,7 @@ func (s *Server) handleListEventsWithURLAuth(w http.ResponseWriter, r *http.Requ
 	}
 
 	// 验证是否为管理员
-	if role != "admin" || !adminConfig.IsAdminAddress(merchant) {
+	if role != "admin" || !adminConfig.IsAdmin(merchant) {
 		http.Error(w, "Admin access required", http.StatusForbidden)
 		return
 	}
@@ -856,7 +1307,7 @@ func (s *Server) handleDashboardPayoutsWithAuth(w http.ResponseWriter, r *http.R
 	}
 
 	// 验证是否为管理员
-	if role != "admin" || !adminConfig.IsAdminAddress(merchant) {
+	if role != "admin" || !adminConfig.IsAdmin(merchant) {
 		http.Error(w, "Admin access required", http.StatusForbidden)
 		return
 	}
@@ -877,9 +1328,14 @@ func (s *Server) handleDashboardPayoutsWithAuth(w http.ResponseWriter, r *http.R
 		}
 	}
 
-	payouts, err := s.store.ListPayouts(limit, offset)
+	filter, err := parsePayoutFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payouts, err := s.store.ListPayoutsFiltered(filter, limit, offset)
 	if err != nil {
-		log.Printf("handleDashboardPayoutsWithAuth: ListPayouts error: %v", err)
+		log.Printf("handleDashboardPayoutsWithAuth: ListPayoutsFiltered error: %v", err)
 		http.Error(w, "Failed to fetch payouts", http.StatusInternalServerError)
 		return
 	}
@@ -904,27 +1360,18 @@ func (s *Server) handleDashboardMerchantPayouts(w http.ResponseWriter, r *http.R
 	addressStr := vars["address"]
 
 	// 验证地址格式（支持 EVM 和 Solana）
-	if !isValidAddress(addressStr) {
+	merchantAddr, err := ParseChainAddress(addressStr)
+	if err != nil {
 		http.Error(w, "Invalid address format", http.StatusBadRequest)
 		return
 	}
 
-	// 验证是否为白名单商户（使用标准化地址）
-	normalizedAddr := normalizeAddress(addressStr)
-	if !merchantConfig.IsMerchantAddress(normalizedAddr) {
+	// 验证是否为白名单商户
+	if !merchantConfig.IsMerchant(merchantAddr) {
 		http.Error(w, "Merchant not found or not authorized", http.StatusNotFound)
 		return
 	}
 
-	// 转换为 EVM 格式用于数据库查询
-	var merchantAddr common.Address
-	if isValidEVMAddress(addressStr) {
-		merchantAddr = common.HexToAddress(addressStr)
-	} else {
-		// Solana 地址：转换为 EVM 格式查询
-		merchantAddr = solanaAddressToEVMAddressShared(addressStr)
-	}
-
 	limit := 100
 	offset := 0
 
@@ -940,9 +1387,15 @@ func (s *Server) handleDashboardMerchantPayouts(w http.ResponseWriter, r *http.R
 		}
 	}
 
-	payouts, err := s.store.ListMerchantPayouts(merchantAddr, limit, offset)
+	filter, err := parsePayoutFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Merchant = merchantAddr
+	payouts, err := s.store.ListPayoutsFiltered(filter, limit, offset)
 	if err != nil {
-		log.Printf("handleDashboardMerchantPayouts: ListMerchantPayouts error: %v", err)
+		log.Printf("handleDashboardMerchantPayouts: ListPayoutsFiltered error: %v", err)
 		http.Error(w, "Failed to fetch payouts", http.StatusInternalServerError)
 		return
 	}
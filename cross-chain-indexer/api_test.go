@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -22,7 +21,7 @@ var testJWTSecret = []byte("dev-local-secret-change-me")
 // MockStore 用于测试 API 路由和鉴权，隔离数据库依赖。
 type MockStore struct {
 	ListPayoutsFn         func(limit, offset int) ([]PayoutRecord, error)
-	ListMerchantPayoutsFn func(merchant common.Address, limit, offset int) ([]PayoutRecord, error)
+	ListMerchantPayoutsFn func(merchant ChainAddress, limit, offset int) ([]PayoutRecord, error)
 }
 
 // 模拟 ListPayouts 方法
@@ -33,19 +32,53 @@ func (m *MockStore) ListPayouts(limit, offset int) ([]PayoutRecord, error) {
 	return []PayoutRecord{}, nil // 默认返回空列表
 }
 
+// 模拟 ListPayoutsFiltered 方法（带商户条件时委托给 ListMerchantPayouts，其余条件忽略）
+func (m *MockStore) ListPayoutsFiltered(f PayoutFilter, limit, offset int) ([]PayoutRecord, error) {
+	if !f.Merchant.IsZero() {
+		return m.ListMerchantPayouts(f.Merchant, limit, offset)
+	}
+	return m.ListPayouts(limit, offset)
+}
+
 // 模拟 ListMerchantPayouts 方法
-func (m *MockStore) ListMerchantPayouts(merchant common.Address, limit, offset int) ([]PayoutRecord, error) {
+func (m *MockStore) ListMerchantPayouts(merchant ChainAddress, limit, offset int) ([]PayoutRecord, error) {
 	if m.ListMerchantPayoutsFn != nil {
 		return m.ListMerchantPayoutsFn(merchant, limit, offset)
 	}
 	return []PayoutRecord{}, nil
 }
 
+func (m *MockStore) GetAllEvents(limit, offset int) ([]RawEvent, error) { return nil, nil }
+func (m *MockStore) GetEventCount() (int, error)                        { return 0, nil }
+
 // 占位符方法：Store 结构体中必须存在的方法 (尽管在 API 测试中可能用不到)
-func (m *MockStore) Close() error                                             { return nil }
-func (m *MockStore) GetLastProcessedBlock(chainID int) (uint64, error)        { return 0, nil }
-func (m *MockStore) SetLastProcessedBlock(chainID int, blockNum uint64) error { return nil }
-func (m *MockStore) InsertEventIfNotExists(txHash string, logIndex uint, blockNumber uint64, rawLog string) (bool, error) {
+func (m *MockStore) Close() error { return nil }
+func (m *MockStore) GetCheckpoint(chain, contract string) (Checkpoint, bool, error) {
+	return Checkpoint{}, false, nil
+}
+func (m *MockStore) SetCheckpoint(chain, contract string, cp Checkpoint) error { return nil }
+func (m *MockStore) ListReorgAudit(limit, offset int) ([]ReorgAuditEntry, error) {
+	return nil, nil
+}
+func (m *MockStore) ListLZMessages(limit, offset int) ([]LZMessage, error) {
+	return nil, nil
+}
+func (m *MockStore) GetLZMessage(guid string) (LZMessage, bool, error) {
+	return LZMessage{}, false, nil
+}
+func (m *MockStore) FeeRevenue(groupBy []string, from, to time.Time) ([]FeeRevenue, error) {
+	return nil, nil
+}
+func (m *MockStore) ListFeeIssues(limit, offset int) ([]PayoutRecord, error) { return nil, nil }
+func (m *MockStore) ListSolanaInstructions(program, name string, limit, offset int) ([]SolanaInstructionRecord, error) {
+	return nil, nil
+}
+func (m *MockStore) ListUnmatchedDeliveries(limit, offset int) ([]Delivery, error) { return nil, nil }
+func (m *MockStore) ListDeadLetters(f DeadLetterFilter, limit, offset int) ([]DeadLetter, error) {
+	return nil, nil
+}
+func (m *MockStore) CountDeadLetters() (map[string]int, error) { return map[string]int{}, nil }
+func (m *MockStore) InsertEventIfNotExists(chain, txHash string, logIndex uint, blockNumber uint64, blockHash, rawLog string) (bool, error) {
 	return true, nil
 }
 func (m *MockStore) MarkEventAsParsed(txHash string, logIndex uint) error { return nil }
@@ -76,18 +109,9 @@ func createTestServer(store *MockStore) *Server {
 	// 由于 Server.routes() 依赖于全局变量 jwtSecret，我们需要在测试前设置它
 	jwtSecret = testJWTSecret
 
-	// 需要 ethclient 占位符，但不必是有效的
-	mockClient, _ := ethclient.Dial("http://127.0.0.1:8545")
-
-	// 创建一个 Processor 占位符
-	mockProcessor := NewProcessor(mockClient, nil)
-
 	return NewServer(
 		store, // 直接以接口注入，无需强转
-		mockClient,
-		common.Address{},
-		common.Hash{},
-		mockProcessor,
+		NewListenerSupervisor(),
 	)
 }
 
@@ -98,9 +122,9 @@ func TestAuthMiddleware(t *testing.T) {
 	testAdminAddr := "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
 
 	// 1. 设置 Mock Store
-	var merchantCallAddr common.Address
+	var merchantCallAddr ChainAddress
 	mockStore := &MockStore{
-		ListMerchantPayoutsFn: func(merchant common.Address, limit, offset int) ([]PayoutRecord, error) {
+		ListMerchantPayoutsFn: func(merchant ChainAddress, limit, offset int) ([]PayoutRecord, error) {
 			merchantCallAddr = merchant // 记录被调用的商家地址
 			return []PayoutRecord{{TxHash: "test_tx_merch"}}, nil
 		},
@@ -190,9 +214,14 @@ func TestAuthMiddleware(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// 重置记录
-			merchantCallAddr = common.Address{}
+			merchantCallAddr = ChainAddress{}
 
-			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			path := tt.path
+			// /admin/payouts 使用 URL 参数认证（方便浏览器直接访问）
+			if tt.token != "" && strings.HasPrefix(path, "/admin/payouts") {
+				path += "?token=" + tt.token
+			}
+			req, _ := http.NewRequest(tt.method, path, nil)
 			if tt.token != "" {
 				req.Header.Set("Authorization", "Bearer "+tt.token)
 			}
@@ -208,7 +237,7 @@ func TestAuthMiddleware(t *testing.T) {
 			// 进一步验证成功状态下的内容和调用
 			if tt.expectedCode == http.StatusOK {
 				bodyBytes, _ := io.ReadAll(rr.Body)
-				var records []PayoutRecord
+				var records []PayoutResponse
 				if err := json.Unmarshal(bodyBytes, &records); err != nil {
 					t.Fatalf("Could not unmarshal response body: %v", err)
 				}
@@ -224,7 +253,7 @@ func TestAuthMiddleware(t *testing.T) {
 				}
 
 				// 验证 ListMerchantPayouts 是否被调用了正确的地址
-				if tt.isMerchantFn && merchantCallAddr.Hex() != testMerchantAddr {
+				if tt.isMerchantFn && merchantCallAddr.String() != testMerchantAddr {
 					// 如果是商家路由，且成功，必须验证商家地址是否被正确传递
 					// 注意：AdminToken 也可以访问 /merchant，此时应该传递 AdminToken 载荷中的地址
 					expectedAddr := common.HexToAddress(testMerchantAddr).Hex()
@@ -232,9 +261,9 @@ func TestAuthMiddleware(t *testing.T) {
 						expectedAddr = common.HexToAddress(testAdminAddr).Hex()
 					}
 
-					if merchantCallAddr.Hex() != expectedAddr {
+					if merchantCallAddr.String() != expectedAddr {
 						t.Errorf("ListMerchantPayouts not called with correct merchant address. Got %s, want %s",
-							merchantCallAddr.Hex(), expectedAddr)
+							merchantCallAddr.String(), expectedAddr)
 					}
 				}
 			}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/time/rate"
+)
+
+// 回填引擎默认参数
+const (
+	defaultBackfillChunkSize    = 2000
+	defaultBackfillMaxChunkSize = 10000
+	defaultBackfillConcurrency  = 4
+	defaultBackfillMaxRetries   = 5
+	defaultRequestsPerSecond    = 10
+)
+
+// BackfillOptions 回填引擎参数（对应 chains.json 中的 "backfill"）
+type BackfillOptions struct {
+	ChunkSize    uint64 `json:"chunk_size,omitempty"`     // 初始区间大小
+	MaxChunkSize uint64 `json:"max_chunk_size,omitempty"` // 区间增长上限
+	Concurrency  int    `json:"concurrency,omitempty"`    // 并发拉取的区间数
+	MaxRetries   int    `json:"max_retries,omitempty"`    // 非区间限制类错误的重试次数
+}
+
+func (o BackfillOptions) withDefaults() BackfillOptions {
+	if o.ChunkSize == 0 {
+		o.ChunkSize = defaultBackfillChunkSize
+	}
+	if o.MaxChunkSize == 0 {
+		o.MaxChunkSize = defaultBackfillMaxChunkSize
+	}
+	if o.ChunkSize > o.MaxChunkSize {
+		o.ChunkSize = o.MaxChunkSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultBackfillConcurrency
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = defaultBackfillMaxRetries
+	}
+	return o
+}
+
+// LogFetcher 拉取 [from, to] 区间的日志（通常包装 FilterLogs）
+type LogFetcher func(ctx context.Context, from, to uint64) ([]types.Log, error)
+
+// BackfillEngine 分块、自适应、限速的历史回填引擎
+//
+// 区间大小在遇到 RPC 的区间/结果数限制时减半，成功后逐步增大；
+// 多个区间并发拉取，但始终按区块顺序交给 handle 并调用 commit，
+// 因此 commit 的区块之前的所有日志都已处理，可直接作为检查点。
+type BackfillEngine struct {
+	opts    BackfillOptions
+	limiter *rate.Limiter
+
+	mu    sync.Mutex
+	chunk uint64
+}
+
+// NewBackfillEngine 创建回填引擎；limiter 为 nil 时不限速
+func NewBackfillEngine(opts BackfillOptions, limiter *rate.Limiter) *BackfillEngine {
+	opts = opts.withDefaults()
+	return &BackfillEngine{opts: opts, limiter: limiter, chunk: opts.ChunkSize}
+}
+
+// ChunkSize 当前区间大小
+func (e *BackfillEngine) ChunkSize() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.chunk
+}
+
+// shrink 区间过大时减半
+func (e *BackfillEngine) shrink(size uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if half := size / 2; half < e.chunk {
+		e.chunk = half
+		if e.chunk == 0 {
+			e.chunk = 1
+		}
+	}
+}
+
+// grow 成功后增大 50%（不超过上限）
+func (e *BackfillEngine) grow(size uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if size < e.chunk {
+		return
+	}
+	e.chunk = e.chunk + e.chunk/2 + 1
+	if e.chunk > e.opts.MaxChunkSize {
+		e.chunk = e.opts.MaxChunkSize
+	}
+}
+
+type chunkResult struct {
+	from, to uint64
+	logs     []types.Log
+	err      error
+}
+
+// Run 回填 [from, to]：并发拉取各区间，按顺序把日志交给 handle，
+// 每个区间处理成功后调用 commit(区间末尾区块)。
+//
+// 出错时立即返回，已 commit 的进度保留，下次从 commit 的区块之后继续。
+func (e *BackfillEngine) Run(ctx context.Context, fetch LogFetcher, from, to uint64,
+	handle func(context.Context, []types.Log) error, commit func(uint64) error) error {
+	if from > to {
+		return fmt.Errorf("invalid range [%d - %d]", from, to)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 分配区间
+	var claimMu sync.Mutex
+	cursor, exhausted := from, false
+	claim := func() (uint64, uint64, bool) {
+		claimMu.Lock()
+		defer claimMu.Unlock()
+		if exhausted {
+			return 0, 0, false
+		}
+		start := cursor
+		end := start + e.ChunkSize() - 1
+		if end > to || end < start {
+			end = to
+		}
+		if end == to {
+			exhausted = true
+		} else {
+			cursor = end + 1
+		}
+		return start, end, true
+	}
+
+	// window 限制已拉取但尚未提交的区间数，避免前面的慢区间导致内存无限增长
+	window := make(chan struct{}, 2*e.opts.Concurrency)
+	results := make(chan chunkResult)
+	stopped := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case window <- struct{}{}:
+				case <-stopped:
+					return
+				case <-runCtx.Done():
+					return
+				}
+				start, end, ok := claim()
+				if !ok {
+					<-window
+					return
+				}
+				logs, err := e.fetchRange(runCtx, fetch, start, end)
+				select {
+				case results <- chunkResult{from: start, to: end, logs: logs, err: err}:
+				case <-runCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 某个区间失败后不再分配新区间，但仍提交它之前已拉取完成的区间
+	var failed error
+	failedFrom := to
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() {
+			claimMu.Lock()
+			exhausted = true
+			claimMu.Unlock()
+			close(stopped)
+		})
+	}
+
+	pending := make(map[uint64]chunkResult)
+	next := from
+	for r := range results {
+		if r.err != nil {
+			stop()
+			if failed == nil || r.from < failedFrom {
+				failed, failedFrom = r.err, r.from
+			}
+			continue
+		}
+		pending[r.from] = r
+		for {
+			c, ok := pending[next]
+			if !ok || (failed != nil && c.from >= failedFrom) {
+				break
+			}
+			delete(pending, next)
+
+			sort.SliceStable(c.logs, func(i, j int) bool {
+				if c.logs[i].BlockNumber != c.logs[j].BlockNumber {
+					return c.logs[i].BlockNumber < c.logs[j].BlockNumber
+				}
+				return c.logs[i].Index < c.logs[j].Index
+			})
+			if err := handle(runCtx, c.logs); err != nil {
+				return fmt.Errorf("handle [%d - %d]: %w", c.from, c.to, err)
+			}
+			if err := commit(c.to); err != nil {
+				return fmt.Errorf("commit block %d: %w", c.to, err)
+			}
+			<-window
+
+			if c.to == to {
+				return nil
+			}
+			next = c.to + 1
+		}
+	}
+	if failed != nil {
+		return failed
+	}
+	return ctx.Err()
+}
+
+// fetchRange 拉取单个区间：区间限制错误时二分，其余错误按指数退避重试
+func (e *BackfillEngine) fetchRange(ctx context.Context, fetch LogFetcher, from, to uint64) ([]types.Log, error) {
+	backoff := 1 * time.Second
+	for attempt := 0; ; attempt++ {
+		if e.limiter != nil {
+			if err := e.limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		logs, err := fetch(ctx, from, to)
+		if err == nil {
+			e.grow(to - from + 1)
+			return logs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if isRangeLimitError(err) && to > from {
+			e.shrink(to - from + 1)
+			mid := from + (to-from)/2
+			left, err := e.fetchRange(ctx, fetch, from, mid)
+			if err != nil {
+				return nil, err
+			}
+			right, err := e.fetchRange(ctx, fetch, mid+1, to)
+			if err != nil {
+				return nil, err
+			}
+			return append(left, right...), nil
+		}
+
+		if attempt >= e.opts.MaxRetries {
+			return nil, fmt.Errorf("fetch logs [%d - %d]: %w", from, to, err)
+		}
+		if !sleepCtx(ctx, backoff) {
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// rangeLimitErrors 各 RPC 服务商在区间过大 / 结果过多时返回的错误片段
+//
+// 只列出明确指区间或结果数的措辞：笼统的 "limit exceeded" 也可能是限流（如 "request limit exceeded"）。
+var rangeLimitErrors = []string{
+	"range too large",
+	"range is too large",
+	"block range",
+	"blocks range",
+	"too many results",
+	"query returned more than",
+	"more than 10000 results",
+	"is limited to a",
+	"response size exceeded",
+	"response size should not",
+	"exceed maximum block range",
+	"query timeout exceeded",
+	"log response size",
+}
+
+// rateLimitErrors 限流错误片段：退避重试即可，缩小区间只会增加请求数
+var rateLimitErrors = []string{
+	"rate limit",
+	"rate-limit",
+	"429",
+	"too many requests",
+	"request limit",
+	"requests limit",
+	"quota",
+	"compute units",
+}
+
+// isRangeLimitError 是否为可通过缩小区间解决的错误（先排除限流错误，它们只需退避重试）
+func isRangeLimitError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range rateLimitErrors {
+		if strings.Contains(msg, s) {
+			return false
+		}
+	}
+	for _, s := range rangeLimitErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// --------------------------- 每个端点的请求预算 ---------------------------
+
+var (
+	endpointLimitersMu sync.Mutex
+	endpointLimiters   = make(map[string]*rate.Limiter)
+)
+
+// endpointLimiter 返回端点共享的限速器（同一 URL 的所有调用方共用一个预算）
+func endpointLimiter(url string, rps float64) *rate.Limiter {
+	if rps <= 0 {
+		rps = defaultRequestsPerSecond
+	}
+	endpointLimitersMu.Lock()
+	defer endpointLimitersMu.Unlock()
+	if l, ok := endpointLimiters[url]; ok {
+		return l
+	}
+	burst := int(rps)
+	if burst < 1 {
+		burst = 1
+	}
+	l := rate.NewLimiter(rate.Limit(rps), burst)
+	endpointLimiters[url] = l
+	return l
+}
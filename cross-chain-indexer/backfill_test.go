@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeChain 每个区块一条日志；区间超过 maxRange 时返回与公共 RPC 相同的限制错误
+type fakeChain struct {
+	maxRange uint64
+	failAt   uint64 // 包含该区块的区间总是失败（0 表示不失败）
+
+	calls    atomic.Int64
+	inFlight atomic.Int64
+	peak     atomic.Int64
+}
+
+func (f *fakeChain) fetch(ctx context.Context, from, to uint64) ([]types.Log, error) {
+	f.calls.Add(1)
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		p := f.peak.Load()
+		if n <= p || f.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	if f.failAt != 0 && from <= f.failAt && f.failAt <= to {
+		return nil, errors.New("connection reset by peer")
+	}
+	if to-from+1 > f.maxRange {
+		return nil, fmt.Errorf("query returned more than 10000 results")
+	}
+	logs := make([]types.Log, 0, to-from+1)
+	// 倒序返回，验证引擎会按区块排序
+	for b := to; ; b-- {
+		logs = append(logs, types.Log{BlockNumber: b})
+		if b == from {
+			break
+		}
+	}
+	return logs, nil
+}
+
+func TestBackfillEngineSplitsAndOrders(t *testing.T) {
+	chain := &fakeChain{maxRange: 300}
+	engine := NewBackfillEngine(BackfillOptions{ChunkSize: 1000, MaxChunkSize: 2000, Concurrency: 3}, nil)
+
+	var mu sync.Mutex
+	var seen []uint64
+	var commits []uint64
+	err := engine.Run(context.Background(), chain.fetch, 100, 5099,
+		func(_ context.Context, logs []types.Log) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, l := range logs {
+				seen = append(seen, l.BlockNumber)
+			}
+			return nil
+		},
+		func(block uint64) error {
+			commits = append(commits, block)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(seen) != 5000 {
+		t.Fatalf("expected 5000 logs, got %d", len(seen))
+	}
+	for i, b := range seen {
+		if b != uint64(100+i) {
+			t.Fatalf("log %d out of order: block %d", i, b)
+		}
+	}
+	for i := 1; i < len(commits); i++ {
+		if commits[i] <= commits[i-1] {
+			t.Fatalf("commits not increasing: %v", commits)
+		}
+	}
+	if commits[len(commits)-1] != 5099 {
+		t.Errorf("last commit = %d, want 5099", commits[len(commits)-1])
+	}
+	// 增长后再次触发限制会重新减半，区间大小在限制附近波动
+	if size := engine.ChunkSize(); size >= 1000 {
+		t.Errorf("chunk size should have adapted to the RPC limit, got %d", size)
+	}
+	if peak := chain.peak.Load(); peak > 3 {
+		t.Errorf("concurrency exceeded: %d", peak)
+	}
+}
+
+func TestBackfillEngineKeepsProgressOnFailure(t *testing.T) {
+	chain := &fakeChain{maxRange: 10000, failAt: 2500}
+	engine := NewBackfillEngine(BackfillOptions{ChunkSize: 500, MaxChunkSize: 500, Concurrency: 2}, nil)
+	engine.opts.MaxRetries = 0 // 不重试，直接失败
+
+	var last uint64
+	err := engine.Run(context.Background(), chain.fetch, 0, 4999,
+		func(context.Context, []types.Log) error { return nil },
+		func(block uint64) error {
+			last = block
+			return nil
+		})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// [2500, 2999] 失败，之前的区间均已提交
+	if last != 2499 {
+		t.Errorf("last commit = %d, want 2499", last)
+	}
+}
+
+func TestIsRangeLimitError(t *testing.T) {
+	for _, msg := range []string{
+		"query returned more than 10000 results",
+		"block range is too large",
+		"eth_getLogs is limited to a 10,000 range: Log response size exceeded",
+		"exceed maximum block range: 50000",
+		"eth_getLogs is limited to a 10000 range",
+		"Block range limit exceeded.",
+	} {
+		if !isRangeLimitError(errors.New(msg)) {
+			t.Errorf("%q should be a range limit error", msg)
+		}
+	}
+	for _, msg := range []string{
+		"429 Too Many Requests",
+		"rate limit exceeded",
+		"request limit exceeded",
+		"daily request count exceeded, request rate limited",
+		"Your app has exceeded its compute units per second capacity",
+		"connection reset by peer",
+	} {
+		if isRangeLimitError(errors.New(msg)) {
+			t.Errorf("%q should not be a range limit error", msg)
+		}
+	}
+}
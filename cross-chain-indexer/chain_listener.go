@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 监听器连接状态
+const (
+	ListenerStateStopped      = "Stopped"
+	ListenerStateConnecting   = "Connecting"
+	ListenerStateConnected    = "Connected"
+	ListenerStatePolling      = "Polling"
+	ListenerStateDisconnected = "Disconnected"
+)
+
+// ChainListener 所有链监听器（EVM / Solana）的统一接口
+//
+// Start 必须是非阻塞的：内部启动回填与实时监听协程后立即返回。
+// Backfill 按区块（Solana 为 slot）区间同步回填，toBlock 为 0 表示到最新高度。
+type ChainListener interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop() error
+	Status() ListenerStatus
+	Backfill(ctx context.Context, fromBlock, toBlock uint64) error
+}
+
+// ListenerStatus 监听器运行状态快照（用于 /health 与终端面板）
+type ListenerStatus struct {
+	Chain     string    `json:"chain"`
+	EID       uint32    `json:"eid"`
+	State     string    `json:"state"`
+	LastBlock uint64    `json:"last_block"`
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Queue 实时处理队列指标
+	Queue *WorkQueueStats `json:"queue,omitempty"`
+	// Endpoints RPC 池中各端点的健康状况
+	Endpoints []EndpointHealth `json:"endpoints,omitempty"`
+}
+
+// listenerState 监听器内部共享的并发安全状态
+type listenerState struct {
+	mu     sync.Mutex
+	status ListenerStatus
+}
+
+func newListenerState(chain string, eid uint32) *listenerState {
+	return &listenerState{status: ListenerStatus{
+		Chain:     chain,
+		EID:       eid,
+		State:     ListenerStateStopped,
+		UpdatedAt: time.Now().UTC(),
+	}}
+}
+
+func (s *listenerState) setState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.State = state
+	s.status.UpdatedAt = time.Now().UTC()
+}
+
+// setError 记录最近的错误（URL 只保留主机名，避免在 /health 上泄露 RPC 的 API key）
+func (s *listenerState) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := redactURLs(err.Error())
+	if len(msg) > 120 {
+		msg = msg[:120] + "..."
+	}
+	s.status.LastError = msg
+	s.status.UpdatedAt = time.Now().UTC()
+}
+
+// observeBlock 记录已处理的最高区块（只增不减）
+func (s *listenerState) observeBlock(block uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if block > s.status.LastBlock {
+		s.status.LastBlock = block
+	}
+	s.status.UpdatedAt = time.Now().UTC()
+}
+
+func (s *listenerState) snapshot() ListenerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// --------------------------- Supervisor ---------------------------
+
+// ListenerSupervisor 统一启动、监督与停止所有链的监听器
+type ListenerSupervisor struct {
+	mu        sync.Mutex
+	listeners map[string]ChainListener
+	order     []string
+}
+
+// NewListenerSupervisor 创建监听器管理器
+func NewListenerSupervisor() *ListenerSupervisor {
+	return &ListenerSupervisor{listeners: make(map[string]ChainListener)}
+}
+
+// Add 注册监听器（按名称去重）
+func (sv *ListenerSupervisor) Add(l ChainListener) error {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	name := l.Name()
+	if _, exists := sv.listeners[name]; exists {
+		return fmt.Errorf("listener %q already registered", name)
+	}
+	sv.listeners[name] = l
+	sv.order = append(sv.order, name)
+	return nil
+}
+
+// Get 按名称获取监听器
+func (sv *ListenerSupervisor) Get(name string) (ChainListener, bool) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	l, ok := sv.listeners[name]
+	return l, ok
+}
+
+// All 按注册顺序返回所有监听器
+func (sv *ListenerSupervisor) All() []ChainListener {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	out := make([]ChainListener, 0, len(sv.order))
+	for _, name := range sv.order {
+		out = append(out, sv.listeners[name])
+	}
+	return out
+}
+
+// StartAll 启动所有监听器；启动失败的监听器在后台按指数退避重试
+func (sv *ListenerSupervisor) StartAll(ctx context.Context) {
+	for _, l := range sv.All() {
+		log.Printf("supervisor: starting %s listener", l.Name())
+		if err := l.Start(ctx); err != nil {
+			log.Printf("supervisor: %s start error: %v (will retry)", l.Name(), err)
+			go sv.retryStart(ctx, l)
+		}
+	}
+}
+
+func (sv *ListenerSupervisor) retryStart(ctx context.Context, l ChainListener) {
+	backoff := 5 * time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if err := l.Start(ctx); err != nil {
+			log.Printf("supervisor: %s start retry failed: %v", l.Name(), err)
+			backoff *= 2
+			if backoff > 5*time.Minute {
+				backoff = 5 * time.Minute
+			}
+			continue
+		}
+		log.Printf("supervisor: %s started after retry", l.Name())
+		return
+	}
+}
+
+// StopAll 停止所有监听器
+func (sv *ListenerSupervisor) StopAll() {
+	for _, l := range sv.All() {
+		if err := l.Stop(); err != nil {
+			log.Printf("supervisor: %s stop error: %v", l.Name(), err)
+		}
+	}
+}
+
+// Statuses 返回所有监听器状态（按链名称排序）
+func (sv *ListenerSupervisor) Statuses() []ListenerStatus {
+	listeners := sv.All()
+	out := make([]ListenerStatus, 0, len(listeners))
+	for _, l := range listeners {
+		out = append(out, l.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Chain < out[j].Chain })
+	return out
+}
@@ -236,11 +236,21 @@
     }
   }
 
-  // LayerZero Endpoint IDs
-  const EID_BASE_SEPOLIA = 40245;
-  const EID_ARB_SEPOLIA = 40231;
-  const EID_SOLANA_DEVNET = 40168;
-  const EID_SOLANA_MAINNET = 30168;
+  // LayerZero EID -> 链名称（由后端注册表 /config/chains 提供）
+  let CHAIN_NAMES = {};
+
+  async function loadChains() {
+    try {
+      const res = await fetch('/config/chains');
+      if (!res.ok) return;
+      const data = await res.json();
+      const names = {};
+      (data.chains || []).forEach((c) => { names[Number(c.eid)] = c.name; });
+      CHAIN_NAMES = names;
+    } catch (e) {
+      console.warn('Failed to load chain registry', e);
+    }
+  }
 
   // Token recognition map (extend as needed)
   const TOKEN_MAP = {
@@ -270,13 +280,7 @@
 
   // Get chain name by EID
   function getChainNameByEid(eid) {
-    switch(Number(eid)) {
-      case EID_BASE_SEPOLIA: return 'Base Sepolia';
-      case EID_ARB_SEPOLIA: return 'Arbitrum Sepolia';
-      case EID_SOLANA_DEVNET: return 'Solana Devnet';
-      case EID_SOLANA_MAINNET: return 'Solana Mainnet';
-      default: return `Chain ${eid}`;
-    }
+    return CHAIN_NAMES[Number(eid)] || `Chain ${eid}`;
   }
 
   function getTokenInfo(addr, dstChain, srcToken) {
@@ -401,8 +405,8 @@
       // 获取目标链名称
       const dstChain = tx.DstChain || getChainNameByEid(tx.DstEid);
       
-      // 优先检查 SrcToken（源链代币），传入目标链信息以便智能推断
-      let token = getTokenInfo(tx.SrcToken, dstChain, tx.DstToken);
+      // 优先使用后端代币注册表返回的符号，其次检查 SrcToken（源链代币），传入目标链信息以便智能推断
+      let token = tx.TokenSymbol ? { symbol: tx.TokenSymbol, chain: dstChain } : getTokenInfo(tx.SrcToken, dstChain, tx.DstToken);
       
       // 如果没有找到，尝试从 DstToken 查找
       if (!token) {
@@ -437,9 +441,10 @@
         ? `<span class="badge badge-success">${dstChain}</span>` 
         : `<span class="badge badge-default">${dstChain}</span>`;
       
-      // 使用 USD 格式化后的值
+      // 锚定 USD 的代币显示 USD 值，否则显示按精度换算后的代币金额
       const netAmountUSD = tx.NetAmountUSD || '0.00';
-      const activity = `<span class="icon inflow"></span>Sent $${netAmountUSD} ${token ? token.symbol : ''} to ${dstChain}`;
+      const amountText = tx.NetAmountUSD || !tx.NetAmountFmt ? `$${netAmountUSD}` : `${tx.NetAmountFmt} ${token.symbol}`;
+      const activity = `<span class="icon inflow"></span>Sent ${amountText} ${tx.NetAmountUSD ? token.symbol : ''} to ${dstChain}`;
       
       // 优先显示 Solana 地址（如果目标链是 Solana）
       const merchantAddr = tx.SolanaMerchant || tx.Merchant || '';
@@ -449,7 +454,7 @@
       row.innerHTML = `
         <div class="tx-cell" title="${merchantAddr}"><span class="avatar" style="--h:${hue}"></span><span class="mono">${short(merchantAddr)}</span></div>
         <div class="tx-cell" title="${tx.Timestamp}">${timeAgo(tx.Timestamp)}</div>
-        <div class="tx-cell">$${netAmountUSD}</div>
+        <div class="tx-cell">${amountText}</div>
         <div class="tx-cell">${dstChainBadge}</div>
         <div class="tx-cell hide-md">${tokensHTML}</div>
         <div class="tx-cell hide-md">${activity}</div>
@@ -471,7 +476,7 @@
     let cls = 'badge-default';
     if (s === 'delivered' || s === 'completed' || s === 'success' || s === 'succeeded') cls = 'badge-success';
     else if (s === 'pending' || s === 'processing' || s === 'in_progress') cls = 'badge-pending';
-    else if (s === 'failed' || s === 'error' || s === 'reverted') cls = 'badge-failed';
+    else if (s === 'failed' || s === 'error' || s === 'reverted' || s === 'reorged' || s === 'stuck') cls = 'badge-failed';
     const label = status || '-';
     return `<span class="badge ${cls}">${label}</span>`;
   }
@@ -623,6 +628,7 @@
   
   // 检查认证状态并加载数据
   async function init() {
+    await loadChains();
     const isAuthenticated = await checkAuth();
     if (isAuthenticated) {
       load();
@@ -142,12 +142,6 @@
     }
   }
 
-  // LayerZero Endpoint IDs
-  const EID_BASE_SEPOLIA = 40245;
-  const EID_ARB_SEPOLIA = 40231;
-  const EID_SOLANA_DEVNET = 40168;
-  const EID_SOLANA_MAINNET = 30168;
-
   // Token recognition map (extend as needed)
   const TOKEN_MAP = {
     // Base mainnet
@@ -286,7 +280,7 @@
           <span class="mono">${short(tx.Payer)}</span>
         </div>
         <div class="value">
-          $${(tx.NetAmountUSD || '0.00')}
+          ${tx.NetAmountUSD || !tx.NetAmountFmt ? '$' + (tx.NetAmountUSD || '0.00') : tx.NetAmountFmt + ' ' + (tx.TokenSymbol || '')}
           ${tokenHTML}
         </div>
       `;
@@ -357,18 +351,19 @@
 
     for (const tx of list) {
       // 优先检查 SrcToken（源链代币），再检查 DstToken（目标链代币）
-      const token = getTokenInfo(tx.SrcToken, tx.DstChain) || getTokenInfo(tx.DstToken, tx.DstChain, tx.SrcToken);
+      const token = (tx.TokenSymbol && { symbol: tx.TokenSymbol, chain: tx.DstChain }) || getTokenInfo(tx.SrcToken, tx.DstChain) || getTokenInfo(tx.DstToken, tx.DstChain, tx.SrcToken);
       const tokensHTML = token ? `<div class="tokens">${tokenPillHTML(token.symbol, token.chain)}</div>` : `<span class="badge badge-default">N/A</span>`;
-      // 使用 USD 格式化后的值
+      // 锚定 USD 的代币显示 USD 值，否则显示按精度换算后的代币金额
       const netAmountUSD = tx.NetAmountUSD || '0.00';
-      const activity = `<span class="icon inflow"></span>Received $${netAmountUSD} ${token ? token.symbol : ''} from ${short(tx.Payer)}`;
+      const amountText = tx.NetAmountUSD || !tx.NetAmountFmt ? `$${netAmountUSD}` : tx.NetAmountFmt;
+      const activity = `<span class="icon inflow"></span>Received ${amountText} ${token ? token.symbol : ''} from ${short(tx.Payer)}`;
       const hue = hueFromString(String(tx.Payer || ''));
       const row = document.createElement('div');
       row.className = 'tx-row';
       row.innerHTML = `
         <div class="tx-cell" title="${tx.Payer}"><span class="avatar" style="--h:${hue}"></span><span class="mono">${short(tx.Payer)}</span></div>
         <div class="tx-cell" title="${tx.Timestamp}">${timeAgo(tx.Timestamp)}</div>
-        <div class="tx-cell">$${netAmountUSD}</div>
+        <div class="tx-cell">${amountText}</div>
         <div class="tx-cell">${statusBadgeHTML(tx.Status)}</div>
         <div class="tx-cell hide-md">${tokensHTML}</div>
         <div class="tx-cell hide-md">${activity}</div>
@@ -383,7 +378,7 @@
     let cls = 'badge-default';
     if (s === 'delivered' || s === 'completed' || s === 'success' || s === 'succeeded') cls = 'badge-success';
     else if (s === 'pending' || s === 'processing' || s === 'in_progress') cls = 'badge-pending';
-    else if (s === 'failed' || s === 'error' || s === 'reverted') cls = 'badge-failed';
+    else if (s === 'failed' || s === 'error' || s === 'reverted' || s === 'reorged' || s === 'stuck') cls = 'badge-failed';
     const label = status || '-';
     return `<span class="badge ${cls}">${label}</span>`;
   }
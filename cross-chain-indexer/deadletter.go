@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 事件处理错误类别（写入死信）
+const (
+	ErrorClassDecode  = "decode"  // 事件无法解码：修复解码器后重试，或重新索引
+	ErrorClassRPC     = "rpc"     // 读取交易 / 区块头 / 回执失败
+	ErrorClassStorage = "storage" // 写入数据库失败
+	ErrorClassOther   = "other"
+)
+
+const (
+	deadLetterPollInterval = 30 * time.Second
+	deadLetterBatchSize    = 100 // 每轮最多重试的死信数
+	deadLetterBaseDelay    = time.Minute
+	deadLetterMaxDelay     = 6 * time.Hour
+	// deadLetterMaxAttempts 失败达到该次数后不再自动重试（等待管理员重试或丢弃）
+	deadLetterMaxAttempts = 10
+	// defaultDeadLetterAlertThreshold 未解决的死信达到该数量时告警（DEAD_LETTER_ALERT_THRESHOLD）
+	defaultDeadLetterAlertThreshold = 20
+)
+
+var (
+	errDeadLetterNotFound = errors.New("dead letter not found")
+	errDeadLetterResolved = errors.New("dead letter already resolved")
+	// errDeadLetterWrite 写入死信队列失败：事件既未处理也未入队，调用方不得推进检查点
+	errDeadLetterWrite = errors.New("add dead letter")
+)
+
+// classifiedError 带类别的事件处理错误
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// classify 为事件处理错误标注类别（err 为 nil 时返回 nil）
+func classify(class string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// errorClass 错误的类别；未标注时为 other
+func errorClass(err error) string {
+	var ce *classifiedError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	return ErrorClassOther
+}
+
+// deadLetterBackoff 第 attempts 次失败后到下次重试的间隔：从 deadLetterBaseDelay 起每次翻倍，不超过 deadLetterMaxDelay
+func deadLetterBackoff(attempts int) time.Duration {
+	d := deadLetterBaseDelay
+	for i := 1; i < attempts && d < deadLetterMaxDelay; i++ {
+		d *= 2
+	}
+	if d > deadLetterMaxDelay {
+		d = deadLetterMaxDelay
+	}
+	return d
+}
+
+// addDeadLetter 将处理失败的事件放入死信队列（dl 只需填写事件标识与 payload）
+func addDeadLetter(store Storage, dl DeadLetter, cause error) error {
+	dl.ErrorClass = errorClass(cause)
+	dl.Error = cause.Error()
+	dl.NextRetryAt = time.Now().UTC().Add(deadLetterBackoff(1))
+	if err := store.AddDeadLetter(dl); err != nil {
+		return fmt.Errorf("%w for %s: %w (original error: %v)", errDeadLetterWrite, dl.TxHash, err, cause)
+	}
+	return nil
+}
+
+// deadLetterRetrier 能重新处理本链死信的监听器（EVMListener / SolanaListener）
+//
+// RetryDeadLetter 按 payload 重新执行监听器的处理流程（已处理过的事件直接返回 nil）。
+type deadLetterRetrier interface {
+	RetryDeadLetter(ctx context.Context, dl DeadLetter) error
+}
+
+// DeadLetterQueue 死信重试：按指数退避自动重试到期的死信，失败 deadLetterMaxAttempts 次后转为 exhausted；
+// 管理员可立即重试或丢弃。未解决的死信达到阈值时告警，此后数量每翻一倍再告警一次。
+type DeadLetterQueue struct {
+	store          Storage
+	listeners      *ListenerSupervisor
+	alertThreshold int
+
+	mu        sync.Mutex // 同一时间只处理一条死信（自动重试与管理员操作互斥）
+	alertedAt int        // 上次告警时未解决的死信数；降到阈值以下时清零
+}
+
+// NewDeadLetterQueue 创建死信队列（alertThreshold <= 0 时使用默认值）
+func NewDeadLetterQueue(store Storage, listeners *ListenerSupervisor, alertThreshold int) *DeadLetterQueue {
+	if alertThreshold <= 0 {
+		alertThreshold = defaultDeadLetterAlertThreshold
+	}
+	return &DeadLetterQueue{store: store, listeners: listeners, alertThreshold: alertThreshold}
+}
+
+// Run 每 interval 重试一次到期的死信并检查队列长度，直到 ctx 结束
+func (q *DeadLetterQueue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("DeadLetters: started (retry every %s, alert at %d)", interval, q.alertThreshold)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := q.RetryDue(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			log.Printf("DeadLetters: retry error: %v", err)
+		}
+		q.checkGrowth()
+	}
+}
+
+// RetryDue 重试 now 时已到期的死信，返回重试成功的数量
+func (q *DeadLetterQueue) RetryDue(ctx context.Context, now time.Time) (int, error) {
+	due, err := q.store.DueDeadLetters(now, deadLetterBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	resolved := 0
+	for _, dl := range due {
+		dl, err := q.retry(ctx, dl.ID, now, false)
+		if err != nil {
+			return resolved, err
+		}
+		if dl.Status == DeadLetterResolved {
+			resolved++
+		}
+	}
+	if len(due) > 0 {
+		log.Printf("DeadLetters: retried %d, resolved %d", len(due), resolved)
+	}
+	return resolved, nil
+}
+
+// Retry 立即重试一条死信（不论重试时间与次数；已丢弃的死信也可重试），返回重试后的记录
+func (q *DeadLetterQueue) Retry(ctx context.Context, id int64) (DeadLetter, error) {
+	return q.retry(ctx, id, time.Now().UTC(), true)
+}
+
+// Discard 丢弃一条死信（不再重试）
+func (q *DeadLetterQueue) Discard(id int64) (DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dl, ok, err := q.store.GetDeadLetter(id)
+	if err != nil {
+		return dl, err
+	}
+	if !ok {
+		return dl, errDeadLetterNotFound
+	}
+	if dl.Status == DeadLetterResolved {
+		return dl, errDeadLetterResolved
+	}
+	dl.Status = DeadLetterDiscarded
+	if err := q.store.UpdateDeadLetter(dl); err != nil {
+		return dl, err
+	}
+	log.Printf("DeadLetters: discarded #%d (%s %s/%d)", dl.ID, dl.Chain, dl.TxHash, dl.LogIndex)
+	return dl, nil
+}
+
+// retry 交给所在链的监听器重新处理，并记录结果；自动重试（manual 为 false）只处理仍在等待且已到期的死信
+func (q *DeadLetterQueue) retry(ctx context.Context, id int64, now time.Time, manual bool) (DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// 重新读取：列出之后可能已被管理员处理
+	dl, ok, err := q.store.GetDeadLetter(id)
+	if err != nil {
+		return dl, err
+	}
+	if !ok {
+		return dl, errDeadLetterNotFound
+	}
+	if dl.Status == DeadLetterResolved {
+		if manual {
+			return dl, errDeadLetterResolved
+		}
+		return dl, nil
+	}
+	if !manual && (dl.Status != DeadLetterPending || dl.NextRetryAt.After(now)) {
+		return dl, nil
+	}
+
+	err = fmt.Errorf("no listener for chain %q", dl.Chain)
+	if l, ok := q.listeners.Get(dl.Chain); ok {
+		if r, ok := l.(deadLetterRetrier); ok {
+			err = r.RetryDeadLetter(ctx, dl)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return dl, ctx.Err() // 关闭时中断的重试不计入次数
+	}
+
+	if err == nil {
+		dl.Status = DeadLetterResolved
+		log.Printf("DeadLetters: #%d (%s %s/%d) resolved after %d failed attempt(s)", dl.ID, dl.Chain, dl.TxHash, dl.LogIndex, dl.Attempts)
+	} else {
+		dl.Attempts++
+		dl.ErrorClass, dl.Error = errorClass(err), err.Error()
+		dl.Status = DeadLetterPending
+		dl.NextRetryAt = now.Add(deadLetterBackoff(dl.Attempts))
+		if dl.Attempts >= deadLetterMaxAttempts {
+			dl.Status = DeadLetterExhausted
+		}
+		log.Printf("DeadLetters: #%d (%s %s/%d) attempt %d failed (%s): %v", dl.ID, dl.Chain, dl.TxHash, dl.LogIndex, dl.Attempts, dl.ErrorClass, err)
+	}
+	if err := q.store.UpdateDeadLetter(dl); err != nil {
+		return dl, err
+	}
+	return dl, nil
+}
+
+// checkGrowth 未解决的死信达到阈值时告警；之后数量每翻一倍再告警一次
+func (q *DeadLetterQueue) checkGrowth() {
+	counts, err := q.store.CountDeadLetters()
+	if err != nil {
+		log.Printf("DeadLetters: count error: %v", err)
+		return
+	}
+	open := counts[DeadLetterPending] + counts[DeadLetterExhausted]
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if open < q.alertThreshold {
+		q.alertedAt = 0
+		return
+	}
+	if q.alertedAt > 0 && open < 2*q.alertedAt {
+		return
+	}
+	q.alertedAt = open
+	alerter.Notify(Alert{
+		Kind: AlertDeadLetters,
+		Message: fmt.Sprintf("%d event(s) in dead-letter queue (%d awaiting retry, %d exhausted)",
+			open, counts[DeadLetterPending], counts[DeadLetterExhausted]),
+	})
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeRetrier 按 err 返回重试结果的监听器
+type fakeRetrier struct {
+	name    string
+	err     error
+	retried []string
+}
+
+func (f *fakeRetrier) Name() string                                        { return f.name }
+func (f *fakeRetrier) Start(ctx context.Context) error                     { return nil }
+func (f *fakeRetrier) Stop() error                                         { return nil }
+func (f *fakeRetrier) Status() ListenerStatus                              { return ListenerStatus{Chain: f.name} }
+func (f *fakeRetrier) Backfill(ctx context.Context, from, to uint64) error { return nil }
+
+func (f *fakeRetrier) RetryDeadLetter(ctx context.Context, dl DeadLetter) error {
+	f.retried = append(f.retried, dl.TxHash)
+	return f.err
+}
+
+func newTestDeadLetterQueue(t *testing.T, s *Store, l *fakeRetrier, threshold int) *DeadLetterQueue {
+	t.Helper()
+	sv := NewListenerSupervisor()
+	if err := sv.Add(l); err != nil {
+		t.Fatal(err)
+	}
+	return NewDeadLetterQueue(s, sv, threshold)
+}
+
+func deadLetterByTx(t *testing.T, s *Store, txHash string) DeadLetter {
+	t.Helper()
+	list, err := s.ListDeadLetters(DeadLetterFilter{}, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dl := range list {
+		if dl.TxHash == txHash {
+			return dl
+		}
+	}
+	t.Fatalf("no dead letter for %s", txHash)
+	return DeadLetter{}
+}
+
+func TestDeadLetterBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 5: 16 * time.Minute, 9: 256 * time.Minute, 10: 6 * time.Hour, 30: 6 * time.Hour} {
+		if got := deadLetterBackoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+	err := classify(ErrorClassDecode, errors.New("bad data"))
+	if errorClass(err) != ErrorClassDecode || errorClass(errors.New("x")) != ErrorClassOther || classify(ErrorClassRPC, nil) != nil {
+		t.Error("error classification")
+	}
+}
+
+// TestDeadLetterQueueRetry 到期才重试，失败按指数退避，达到次数上限后只能由管理员重试或丢弃
+func TestDeadLetterQueueRetry(t *testing.T) {
+	s := newTestStore(t)
+	l := &fakeRetrier{name: "Base Sepolia", err: classify(ErrorClassRPC, errors.New("header not found"))}
+	q := newTestDeadLetterQueue(t, s, l, 0)
+	ctx := context.Background()
+
+	if err := addDeadLetter(s, DeadLetter{Chain: "Base Sepolia", TxHash: "0xd1", LogIndex: 2, BlockNumber: 100, Payload: "{}"},
+		classify(ErrorClassDecode, errors.New("data too short"))); err != nil {
+		t.Fatal(err)
+	}
+	dl := deadLetterByTx(t, s, "0xd1")
+	if dl.Status != DeadLetterPending || dl.Attempts != 1 || dl.ErrorClass != ErrorClassDecode || dl.Payload != "{}" {
+		t.Fatalf("dead letter = %+v", dl)
+	}
+
+	// 未到期
+	now := time.Now().UTC().Truncate(time.Second) // 数据库按秒保存
+	if n, err := q.RetryDue(ctx, now); err != nil || n != 0 || len(l.retried) != 0 {
+		t.Fatalf("retry before due = %d, %v, %v", n, err, l.retried)
+	}
+	now = now.Add(2 * time.Minute)
+	if n, err := q.RetryDue(ctx, now); err != nil || n != 0 || len(l.retried) != 1 {
+		t.Fatalf("failed retry = %d, %v, %v", n, err, l.retried)
+	}
+	dl = deadLetterByTx(t, s, "0xd1")
+	if dl.Attempts != 2 || dl.ErrorClass != ErrorClassRPC || dl.Error != "header not found" || dl.Status != DeadLetterPending ||
+		dl.NextRetryAt.Sub(now) != 2*time.Minute {
+		t.Fatalf("after failed retry = %+v", dl)
+	}
+
+	// 最后一次自动重试失败后转为 exhausted，不再自动重试
+	dl.Attempts = deadLetterMaxAttempts - 1
+	if err := s.UpdateDeadLetter(dl); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(deadLetterMaxDelay)
+	if _, err := q.RetryDue(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if dl = deadLetterByTx(t, s, "0xd1"); dl.Status != DeadLetterExhausted || dl.Attempts != deadLetterMaxAttempts {
+		t.Fatalf("after max attempts = %+v", dl)
+	}
+	if _, err := q.RetryDue(ctx, now.Add(24*time.Hour)); err != nil || len(l.retried) != 2 {
+		t.Fatalf("exhausted dead letter retried: %v, %v", err, l.retried)
+	}
+
+	// 管理员重试成功
+	l.err = nil
+	if dl, err := q.Retry(ctx, dl.ID); err != nil || dl.Status != DeadLetterResolved {
+		t.Fatalf("manual retry = %+v, %v", dl, err)
+	}
+	if _, err := q.Retry(ctx, dl.ID); !errors.Is(err, errDeadLetterResolved) {
+		t.Errorf("retry resolved: %v", err)
+	}
+	if _, err := q.Discard(dl.ID); !errors.Is(err, errDeadLetterResolved) {
+		t.Errorf("discard resolved: %v", err)
+	}
+	if _, err := q.Discard(9999); !errors.Is(err, errDeadLetterNotFound) {
+		t.Errorf("discard missing: %v", err)
+	}
+
+	// 丢弃后不再自动重试
+	if err := addDeadLetter(s, DeadLetter{Chain: "Base Sepolia", TxHash: "0xd2"}, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	dl = deadLetterByTx(t, s, "0xd2")
+	if dl, err := q.Discard(dl.ID); err != nil || dl.Status != DeadLetterDiscarded {
+		t.Fatalf("discard = %+v, %v", dl, err)
+	}
+	if _, err := q.RetryDue(ctx, now.Add(24*time.Hour)); err != nil || len(l.retried) != 3 {
+		t.Errorf("discarded dead letter retried: %v, %v", err, l.retried)
+	}
+
+	// 没有对应监听器的死信计为失败
+	if err := addDeadLetter(s, DeadLetter{Chain: "Nowhere", TxHash: "0xd3"}, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	if dl, err := q.Retry(ctx, deadLetterByTx(t, s, "0xd3").ID); err != nil || dl.Attempts != 2 || dl.Status != DeadLetterPending {
+		t.Errorf("retry without listener = %+v, %v", dl, err)
+	}
+}
+
+// testDeadLetters 到期查询；事件经任何路径处理成功后死信自动解决，再次失败时重新打开；重组回滚时丢弃
+func testDeadLetters(t *testing.T, s *Store) {
+	merchant := common.HexToAddress("0x77ed7f6455fe291728a48785090292e3d10f53bb")
+	blockTime := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	logA := v2PayoutLog("0xe1", 100, merchant, 1000, 990)
+	logB := v2PayoutLog("0xe2", 101, merchant, 1000, 990)
+	for _, vLog := range []struct {
+		tx    string
+		block uint64
+		hash  string
+	}{{logA.TxHash.Hex(), 100, logA.BlockHash.Hex()}, {logB.TxHash.Hex(), 101, logB.BlockHash.Hex()}} {
+		if err := addDeadLetter(s, DeadLetter{Chain: "Base Sepolia", TxHash: vLog.tx, BlockNumber: vLog.block, BlockHash: vLog.hash},
+			classify(ErrorClassStorage, errors.New("database is locked"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UTC()
+	if due, err := s.DueDeadLetters(now, 10); err != nil || len(due) != 0 {
+		t.Fatalf("due before backoff = %+v, %v", due, err)
+	}
+	if due, err := s.DueDeadLetters(now.Add(2*time.Minute), 1); err != nil || len(due) != 1 || due[0].TxHash != logA.TxHash.Hex() {
+		t.Fatalf("due = %+v, %v", due, err)
+	}
+
+	p, err := decodePayoutV2(logA, 40245)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := persistLog(s, "Base Sepolia", logA, blockTime, EventEffects{Payout: &p}); err != nil {
+		t.Fatal(err)
+	}
+	if dl := deadLetterByTx(t, s, logA.TxHash.Hex()); dl.Status != DeadLetterResolved {
+		t.Errorf("persisted event dead letter = %+v", dl)
+	}
+
+	// 再次失败时重新打开
+	if err := addDeadLetter(s, DeadLetter{Chain: "Base Sepolia", TxHash: logA.TxHash.Hex()}, errors.New("again")); err != nil {
+		t.Fatal(err)
+	}
+	if dl := deadLetterByTx(t, s, logA.TxHash.Hex()); dl.Status != DeadLetterPending || dl.Attempts != 1 || dl.Error != "again" {
+		t.Errorf("reopened dead letter = %+v", dl)
+	}
+
+	if _, err := s.RollbackBlock("Base Sepolia", 101, logB.BlockHash.Hex(), "0xnew", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if dl := deadLetterByTx(t, s, logB.TxHash.Hex()); dl.Status != DeadLetterDiscarded {
+		t.Errorf("reorged dead letter = %+v", dl)
+	}
+	counts, err := s.CountDeadLetters()
+	if err != nil || counts[DeadLetterPending] != 1 || counts[DeadLetterDiscarded] != 1 {
+		t.Errorf("counts = %v, %v", counts, err)
+	}
+}
+
+func TestDeadLetterGrowthAlert(t *testing.T) {
+	s := newTestStore(t)
+	q := newTestDeadLetterQueue(t, s, &fakeRetrier{name: "Base Sepolia"}, 2)
+	alerts := func() int {
+		n := 0
+		for _, a := range alerter.Recent(recentAlertLimit) {
+			if a.Kind == AlertDeadLetters {
+				n++
+			}
+		}
+		return n
+	}
+	before := alerts()
+	add := func(txHash string) {
+		if err := addDeadLetter(s, DeadLetter{Chain: "Base Sepolia", TxHash: txHash}, errors.New("boom")); err != nil {
+			t.Fatal(err)
+		}
+		q.checkGrowth()
+	}
+
+	add("0xf1")
+	add("0xf2") // 达到阈值
+	add("0xf3")
+	add("0xf4") // 翻倍
+	if got := alerts() - before; got != 2 {
+		t.Errorf("got %d alerts, want 2", got)
+	}
+}
+
+func TestDeadLetterAPI(t *testing.T) {
+	s := newTestStore(t)
+	l := &fakeRetrier{name: "Base Sepolia"}
+	jwtSecret = testJWTSecret
+	server := NewServer(s, NewListenerSupervisor())
+	router := server.routes()
+	token, err := generateTestJWT("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if err := addDeadLetter(s, DeadLetter{Chain: "Base Sepolia", TxHash: "0xc1"}, classify(ErrorClassDecode, errors.New("bad"))); err != nil {
+		t.Fatal(err)
+	}
+	rr := do("GET", "/admin/dead-letters?status=pending")
+	var body struct {
+		DeadLetters []DeadLetter   `json:"dead_letters"`
+		Counts      map[string]int `json:"counts"`
+	}
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &body) != nil || len(body.DeadLetters) != 1 || body.Counts[DeadLetterPending] != 1 {
+		t.Fatalf("list = %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("GET", "/admin/dead-letters?status=bogus"); rr.Code != http.StatusBadRequest {
+		t.Errorf("bad status = %d", rr.Code)
+	}
+	id := body.DeadLetters[0].ID
+
+	// 未配置死信队列
+	if rr := do("POST", "/admin/dead-letters/1/retry"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("retry without queue = %d", rr.Code)
+	}
+	server.deadLetters = newTestDeadLetterQueue(t, s, l, 0)
+	if rr := do("POST", "/admin/dead-letters/x/retry"); rr.Code != http.StatusBadRequest {
+		t.Errorf("bad id = %d", rr.Code)
+	}
+	if rr := do("POST", "/admin/dead-letters/9999/discard"); rr.Code != http.StatusNotFound {
+		t.Errorf("missing = %d", rr.Code)
+	}
+	var dl DeadLetter
+	rr = do("POST", "/admin/dead-letters/"+strconv.FormatInt(id, 10)+"/retry")
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &dl) != nil || dl.Status != DeadLetterResolved || len(l.retried) != 1 {
+		t.Fatalf("retry = %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do("POST", "/admin/dead-letters/"+strconv.FormatInt(id, 10)+"/discard"); rr.Code != http.StatusConflict {
+		t.Errorf("discard resolved = %d", rr.Code)
+	}
+}
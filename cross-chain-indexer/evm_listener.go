@@ -0,0 +1,956 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 合约 ABI 版本
+const (
+	// ABIVersionV1 旧版 MyOApp：merchant / dstToken 为 address，使用合约 binding 解析
+	ABIVersionV1 = "v1"
+	// ABIVersionV2 新版 MyOApp：merchant / dstToken 为 bytes32（支持 Solana 目标链）
+	ABIVersionV2 = "v2"
+)
+
+// payoutTopicByABIVersion 各 ABI 版本的 TokenPayoutRequested 事件 topic
+var payoutTopicByABIVersion = map[string]common.Hash{
+	// TokenPayoutRequested(uint32,address,address,address,address,uint256,uint256,uint256)
+	ABIVersionV1: common.HexToHash("0xdd9e34114af31ed8b7896e826d4d77f69661c83c3fb0dfde856e2de117034601"),
+	// TokenPayoutRequested(uint32,address,bytes32,address,bytes32,uint256,uint256,uint256)
+	ABIVersionV2: common.HexToHash("0xd892a21f8b815c577e9ce52aa66d230fa1b28664b1286de9e4b85acfac750c31"),
+}
+
+// tokenPayoutExecutedTopic 目标链 MyOApp._lzReceive 完成转账后发出的事件
+// TokenPayoutExecuted(address indexed merchant, address token, uint256 amount)
+var tokenPayoutExecutedTopic = common.HexToHash("0x2e6e04a8b2c1647c89193b83e490574a4ddedb4ce7a402f93453cd40b67a8402")
+
+// 默认回填深度（区块数，仅在既无检查点也未配置 start_block 时使用）
+const defaultBackfillDepth = 50000
+
+// 默认确认深度（区块数）：超过该深度的 payout 视为最终确认，不再因重组回滚
+const defaultConfirmations = 12
+
+// WSS 模式下推进检查点的间隔
+const checkpointInterval = 30 * time.Second
+
+// EVMContract 单个被监听的合约
+type EVMContract struct {
+	Address    common.Address
+	ABIVersion string
+	StartBlock uint64 // 部署区块；无检查点时从此处开始
+}
+
+// EVMChainConfig 一条 EVM 链的监听配置
+type EVMChainConfig struct {
+	Name string
+	EID  uint32
+	// RPC 端点（第一个为主端点，其余为备用，按健康状况选择）
+	RPC []RPCEndpoint
+	// MaxHeadLag 端点落后最高端点超过该区块数时视为不健康（0 使用默认值）
+	MaxHeadLag    uint64
+	Contracts     []EVMContract
+	BackfillDepth uint64
+	Confirmations uint64
+	Backfill      BackfillOptions
+	// Processing 实时日志处理队列
+	Processing ProcessingOptions
+	// Endpoint LayerZero EndpointV2 地址（零值表示不捕获 LzReceiveAlert）
+	Endpoint common.Address
+}
+
+// EVMListener 通用 EVM 链监听器（按链名称、EID、RPC 与合约集合参数化）
+type EVMListener struct {
+	cfg       EVMChainConfig
+	rpc       *EVMPool // 多端点 RPC 池（按端点限速）
+	store     Storage
+	processor *Processor
+	fees      *FeeBpsReader
+	engine    *BackfillEngine
+	queue     *WorkQueue // 实时日志处理队列
+
+	// 合约地址 -> ABI 版本
+	contracts map[common.Address]string
+
+	state *listenerState
+
+	runMu     sync.Mutex
+	cancel    context.CancelFunc
+	queueDone chan struct{} // 处理队列停止后关闭
+}
+
+// NewEVMListener 创建 EVM 监听器（每个端点 HTTPS 必需、WSS 可选；都没有 WSS 时轮询）
+func NewEVMListener(cfg EVMChainConfig, store Storage) (*EVMListener, error) {
+	if len(cfg.Contracts) == 0 {
+		return nil, fmt.Errorf("EVMListener[%s]: no contracts configured", cfg.Name)
+	}
+	contracts := make(map[common.Address]string, len(cfg.Contracts))
+	for _, c := range cfg.Contracts {
+		if _, ok := payoutTopicByABIVersion[c.ABIVersion]; !ok {
+			return nil, fmt.Errorf("EVMListener[%s]: unsupported ABI version %q for %s", cfg.Name, c.ABIVersion, c.Address.Hex())
+		}
+		contracts[c.Address] = c.ABIVersion
+	}
+	if cfg.BackfillDepth == 0 {
+		cfg.BackfillDepth = defaultBackfillDepth
+	}
+	if cfg.Confirmations == 0 {
+		cfg.Confirmations = defaultConfirmations
+	}
+
+	pool, err := NewEVMPool(cfg.Name, cfg.RPC, cfg.MaxHeadLag)
+	if err != nil {
+		return nil, fmt.Errorf("EVMListener[%s]: %w", cfg.Name, err)
+	}
+	fees := NewFeeBpsReader(pool)
+
+	l := &EVMListener{
+		cfg:       cfg,
+		rpc:       pool,
+		store:     store,
+		processor: NewProcessor(cfg.Name, cfg.EID, pool, store, fees),
+		fees:      fees,
+		engine:    NewBackfillEngine(cfg.Backfill, nil),
+		queue:     NewWorkQueue(cfg.Processing),
+		contracts: contracts,
+		state:     newListenerState(cfg.Name, cfg.EID),
+	}
+	l.processor.packetSent = l.packetSent
+	return l, nil
+}
+
+// Name 链名称
+func (l *EVMListener) Name() string { return l.cfg.Name }
+
+// Status 当前状态快照（含处理队列指标与 RPC 端点健康状况）
+func (l *EVMListener) Status() ListenerStatus {
+	st := l.state.snapshot()
+	q := l.queue.Stats()
+	st.Queue = &q
+	st.Endpoints = l.rpc.Health()
+	return st
+}
+
+// Start 启动历史回填与实时监听（非阻塞）
+func (l *EVMListener) Start(ctx context.Context) error {
+	l.runMu.Lock()
+	defer l.runMu.Unlock()
+	if l.cancel != nil {
+		return fmt.Errorf("EVMListener[%s]: already running", l.cfg.Name)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	l.cancel = cancel
+	queueDone := make(chan struct{})
+	l.queueDone = queueDone
+	go func() {
+		defer close(queueDone)
+		l.queue.Run(runCtx)
+	}()
+	go l.rpc.Run(runCtx)
+
+	log.Printf("EVMListener[%s]: starting for %d contract(s), rpc %s", l.cfg.Name, len(l.cfg.Contracts), l.rpc)
+
+	// 从检查点追赶并进入实时监听（没有 WSS 端点时轮询）
+	if l.rpc.HasWSS() {
+		go l.listenForNewEvents(runCtx)
+	} else {
+		log.Printf("EVMListener[%s]: no WSS endpoint configured, will only use polling", l.cfg.Name)
+		go l.pollForNewEvents(runCtx)
+	}
+
+	return nil
+}
+
+// Stop 停止所有后台协程，并等待正在处理的日志结束（其 context 已取消）
+func (l *EVMListener) Stop() error {
+	l.runMu.Lock()
+	defer l.runMu.Unlock()
+	if l.cancel != nil {
+		l.cancel()
+		l.cancel = nil
+		<-l.queueDone
+	}
+	l.state.setState(ListenerStateStopped)
+	return nil
+}
+
+// filterQuery 构造覆盖所有合约与事件 topic 的查询（源链请求 + 目标链执行）
+func (l *EVMListener) filterQuery() ethereum.FilterQuery {
+	addrs := make([]common.Address, 0, len(l.cfg.Contracts))
+	seen := map[common.Hash]bool{tokenPayoutExecutedTopic: true}
+	topics := []common.Hash{tokenPayoutExecutedTopic}
+	for _, c := range l.cfg.Contracts {
+		addrs = append(addrs, c.Address)
+		topic := payoutTopicByABIVersion[c.ABIVersion]
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	// EndpointV2 的 LzReceiveAlert（目标链执行失败）
+	if l.cfg.Endpoint != (common.Address{}) {
+		addrs = append(addrs, l.cfg.Endpoint)
+		topics = append(topics, lzReceiveAlertTopic)
+	}
+	return ethereum.FilterQuery{
+		Addresses: addrs,
+		Topics:    [][]common.Hash{topics},
+	}
+}
+
+// contractQueries 构造单个合约的查询（含 EndpointV2 上以该合约为 receiver 的 LzReceiveAlert）
+func (l *EVMListener) contractQueries(c EVMContract) []ethereum.FilterQuery {
+	queries := []ethereum.FilterQuery{{
+		Addresses: []common.Address{c.Address},
+		Topics:    [][]common.Hash{{payoutTopicByABIVersion[c.ABIVersion], tokenPayoutExecutedTopic}},
+	}}
+	if l.cfg.Endpoint != (common.Address{}) {
+		queries = append(queries, ethereum.FilterQuery{
+			Addresses: []common.Address{l.cfg.Endpoint},
+			Topics:    [][]common.Hash{{lzReceiveAlertTopic}, {common.BytesToHash(c.Address.Bytes())}},
+		})
+	}
+	return queries
+}
+
+// latestBlock 获取最新区块高度
+func (l *EVMListener) latestBlock(ctx context.Context) (uint64, error) {
+	header, err := l.rpc.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("cannot get latest block: %w", err)
+	}
+	return header.Number.Uint64(), nil
+}
+
+// Backfill 回填 [fromBlock, toBlock] 区间的历史事件（toBlock 为 0 表示最新区块）
+//
+// 手动回填不会修改检查点：检查点只由连续追赶推进，避免跳过中间区块。
+func (l *EVMListener) Backfill(ctx context.Context, fromBlock, toBlock uint64) error {
+	if toBlock == 0 {
+		latest, err := l.latestBlock(ctx)
+		if err != nil {
+			return err
+		}
+		toBlock = latest
+	}
+	if fromBlock > toBlock {
+		return fmt.Errorf("invalid range [%d - %d]", fromBlock, toBlock)
+	}
+
+	log.Printf("EVMListener[%s] backfill: scanning blocks [%d - %d]", l.cfg.Name, fromBlock, toBlock)
+	return l.engine.Run(ctx, l.logFetcher(l.filterQuery()), fromBlock, toBlock, l.handleLogs,
+		func(block uint64) error {
+			l.state.observeBlock(block)
+			return nil
+		})
+}
+
+// logFetcher 将查询包装为回填引擎使用的 LogFetcher（多个查询的结果合并，由引擎排序）
+func (l *EVMListener) logFetcher(queries ...ethereum.FilterQuery) LogFetcher {
+	return func(ctx context.Context, from, to uint64) ([]types.Log, error) {
+		var logs []types.Log
+		for _, query := range queries {
+			q := query
+			q.FromBlock = new(big.Int).SetUint64(from)
+			q.ToBlock = new(big.Int).SetUint64(to)
+			part, err := l.rpc.FilterLogs(ctx, q)
+			if err != nil {
+				return nil, err
+			}
+			logs = append(logs, part...)
+		}
+		if len(logs) > 0 {
+			log.Printf("EVMListener[%s]: found %d logs in [%d - %d]", l.cfg.Name, len(logs), from, to)
+		}
+		return logs, nil
+	}
+}
+
+// handleLogs 按顺序处理一批日志；处理失败的日志放入死信队列，
+// 只有写入死信失败（或正在关闭）时返回错误（该批次不提交）
+func (l *EVMListener) handleLogs(ctx context.Context, logs []types.Log) error {
+	for _, vLog := range logs {
+		if err := l.handleLog(ctx, vLog); err != nil {
+			if err := l.deadLetter(ctx, vLog, err); err != nil {
+				return fmt.Errorf("tx %s: %w", vLog.TxHash.Hex(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// deadLetter 将处理失败的日志放入死信队列，由重试协程按指数退避重新处理；
+// 正在关闭时不写入，返回原错误
+func (l *EVMListener) deadLetter(ctx context.Context, vLog types.Log, cause error) error {
+	if ctx.Err() != nil {
+		return cause
+	}
+	log.Printf("EVMListener[%s]: failed to process tx %s idx %d (%s), moved to dead-letter queue: %v",
+		l.cfg.Name, vLog.TxHash.Hex(), vLog.Index, errorClass(cause), cause)
+	l.state.setError(cause)
+	payload, err := json.Marshal(vLog)
+	if err != nil {
+		return fmt.Errorf("marshal log: %w", err)
+	}
+	return addDeadLetter(l.store, DeadLetter{
+		Chain:       l.cfg.Name,
+		TxHash:      vLog.TxHash.Hex(),
+		LogIndex:    vLog.Index,
+		BlockNumber: vLog.BlockNumber,
+		BlockHash:   vLog.BlockHash.Hex(),
+		Payload:     string(payload),
+	}, cause)
+}
+
+// RetryDeadLetter 按保存的日志重新处理一条死信
+func (l *EVMListener) RetryDeadLetter(ctx context.Context, dl DeadLetter) error {
+	var vLog types.Log
+	if err := json.Unmarshal([]byte(dl.Payload), &vLog); err != nil {
+		return classify(ErrorClassDecode, fmt.Errorf("invalid log payload: %v", err))
+	}
+	return l.handleLog(ctx, vLog)
+}
+
+// resumeBlock 计算合约的起始区块：检查点 + 1 > 配置的 start_block > 最新区块 - BackfillDepth
+func (l *EVMListener) resumeBlock(c EVMContract, latest uint64) (uint64, error) {
+	checkpoint, ok, err := l.store.GetCheckpoint(l.cfg.Name, c.Address.Hex())
+	if err != nil {
+		return 0, fmt.Errorf("load checkpoint for %s: %w", c.Address.Hex(), err)
+	}
+	if ok {
+		return checkpoint.Block + 1, nil
+	}
+	if c.StartBlock > 0 {
+		return c.StartBlock, nil
+	}
+	if latest > l.cfg.BackfillDepth {
+		return latest - l.cfg.BackfillDepth, nil
+	}
+	return 0, nil
+}
+
+// headerByNumber 获取区块头（计入端点请求预算）
+func (l *EVMListener) headerByNumber(ctx context.Context, block uint64) (*types.Header, error) {
+	header, err := l.rpc.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+	if err != nil {
+		return nil, fmt.Errorf("get header %d: %w", block, err)
+	}
+	return header, nil
+}
+
+// saveCheckpoint 记录检查点及其区块哈希
+func (l *EVMListener) saveCheckpoint(ctx context.Context, c EVMContract, block uint64) error {
+	header, err := l.headerByNumber(ctx, block)
+	if err != nil {
+		return err
+	}
+	return l.store.SetCheckpoint(l.cfg.Name, c.Address.Hex(), Checkpoint{Block: block, BlockHash: header.Hash().Hex()})
+}
+
+// catchUp 将每个合约从其检查点追赶到最新区块，每处理完一个区间即持久化检查点
+func (l *EVMListener) catchUp(ctx context.Context) (uint64, error) {
+	latest, err := l.latestBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := l.detectReorg(ctx, latest); err != nil {
+		return 0, fmt.Errorf("reorg check: %w", err)
+	}
+	for _, c := range l.cfg.Contracts {
+		from, err := l.resumeBlock(c, latest)
+		if err != nil {
+			return 0, err
+		}
+		if from > latest {
+			continue
+		}
+		if latest-from > l.engine.ChunkSize() {
+			log.Printf("EVMListener[%s]: catching up %s from block %d to %d", l.cfg.Name, c.Address.Hex(), from, latest)
+		}
+		err = l.engine.Run(ctx, l.logFetcher(l.contractQueries(c)...), from, latest, l.handleLogs,
+			func(block uint64) error {
+				return l.saveCheckpoint(ctx, c, block)
+			})
+		if err != nil {
+			return 0, fmt.Errorf("catch up %s [%d - %d]: %w", c.Address.Hex(), from, latest, err)
+		}
+	}
+	l.state.observeBlock(latest)
+	l.finalize(latest)
+	return latest, nil
+}
+
+// advanceCheckpoints 将所有合约的检查点推进到 block（只增不减）
+func (l *EVMListener) advanceCheckpoints(ctx context.Context, block uint64) error {
+	var hash string
+	for _, c := range l.cfg.Contracts {
+		checkpoint, ok, err := l.store.GetCheckpoint(l.cfg.Name, c.Address.Hex())
+		if err != nil {
+			return err
+		}
+		if ok && checkpoint.Block >= block {
+			continue
+		}
+		if hash == "" {
+			header, err := l.headerByNumber(ctx, block)
+			if err != nil {
+				return err
+			}
+			hash = header.Hash().Hex()
+		}
+		if err := l.store.SetCheckpoint(l.cfg.Name, c.Address.Hex(), Checkpoint{Block: block, BlockHash: hash}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --------------------------- 重组处理 ---------------------------
+
+// detectReorg 校验检查点区块是否仍在规范链上（下一区块的 parentHash 是否等于检查点哈希）
+//
+// 发现不一致时，回滚确认深度窗口内哈希已变化的区块中的事件，并把检查点退回窗口起点，
+// 随后的追赶会从该处重新扫描新的规范链。
+func (l *EVMListener) detectReorg(ctx context.Context, latest uint64) error {
+	var mismatch *Checkpoint
+	for _, c := range l.cfg.Contracts {
+		cp, ok, err := l.store.GetCheckpoint(l.cfg.Name, c.Address.Hex())
+		if err != nil {
+			return err
+		}
+		if !ok || cp.BlockHash == "" || cp.Block >= latest {
+			continue
+		}
+		next, err := l.headerByNumber(ctx, cp.Block+1)
+		if err != nil {
+			return err
+		}
+		if next.ParentHash.Hex() != cp.BlockHash {
+			log.Printf("EVMListener[%s]: REORG detected at block %d (stored %s, parent of %d is %s)",
+				l.cfg.Name, cp.Block, cp.BlockHash[:10], cp.Block+1, next.ParentHash.Hex()[:10])
+			mismatch = &cp
+			break
+		}
+	}
+	if mismatch == nil {
+		return nil
+	}
+	return l.rollback(ctx, mismatch.Block)
+}
+
+// rollback 回滚 (block - 确认深度, block] 内已不在规范链上的事件，并退回检查点
+func (l *EVMListener) rollback(ctx context.Context, block uint64) error {
+	forkFrom := uint64(0)
+	if block > l.cfg.Confirmations {
+		forkFrom = block - l.cfg.Confirmations
+	}
+
+	blocks, err := l.store.ListEventBlocks(l.cfg.Name, forkFrom+1)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for num, oldHash := range blocks {
+		header, err := l.headerByNumber(ctx, num)
+		if err != nil {
+			return err
+		}
+		if newHash := header.Hash().Hex(); newHash != oldHash {
+			n, err := l.store.RollbackBlock(l.cfg.Name, num, oldHash, newHash, "parent_hash_mismatch")
+			if err != nil {
+				return fmt.Errorf("rollback block %d: %w", num, err)
+			}
+			total += n
+		}
+	}
+
+	for _, c := range l.cfg.Contracts {
+		cp, ok, err := l.store.GetCheckpoint(l.cfg.Name, c.Address.Hex())
+		if err != nil {
+			return err
+		}
+		if ok && cp.Block > forkFrom {
+			if err := l.saveCheckpoint(ctx, c, forkFrom); err != nil {
+				return err
+			}
+		}
+	}
+	log.Printf("EVMListener[%s]: rolled back %d event(s), rescanning from block %d", l.cfg.Name, total, forkFrom+1)
+	return nil
+}
+
+// handleRemovedLog 处理订阅推送的 Removed 日志（该日志所在区块已被重组移出）
+func (l *EVMListener) handleRemovedLog(vLog types.Log) error {
+	n, err := l.store.RollbackEvent(l.cfg.Name, vLog.TxHash.Hex(), vLog.Index, vLog.BlockHash.Hex(), "removed")
+	if err != nil {
+		return fmt.Errorf("rollback removed log: %w", err)
+	}
+	log.Printf("EVMListener[%s]: removed log tx=%s idx=%d block=%d, rolled back %d event(s)",
+		l.cfg.Name, vLog.TxHash.Hex(), vLog.Index, vLog.BlockNumber, n)
+	return nil
+}
+
+// finalize 将达到确认深度的 payout 标记为最终确认
+func (l *EVMListener) finalize(latest uint64) {
+	if latest < l.cfg.Confirmations {
+		return
+	}
+	n, err := l.store.FinalizePayouts(l.cfg.Name, latest-l.cfg.Confirmations)
+	if err != nil {
+		log.Printf("EVMListener[%s]: finalize payouts failed: %v", l.cfg.Name, err)
+		return
+	}
+	if n > 0 {
+		log.Printf("EVMListener[%s]: %d payout(s) reached %d confirmations", l.cfg.Name, n, l.cfg.Confirmations)
+	}
+}
+
+// listenForNewEvents 实时监听新事件（WSS，断线自动重连）
+//
+// 每次（重新）订阅成功后先从检查点追赶，弥补断线期间的区块；
+// 之后每隔 checkpointInterval 将检查点推进到上一个周期观察到的最新区块，
+// 留出一个周期让订阅推送完该区块之前的日志。
+//
+// 日志交给处理队列并发处理；队列满时停止从订阅接收，推进检查点前等待已接收的日志处理完成。
+func (l *EVMListener) listenForNewEvents(ctx context.Context) {
+	log.Printf("EVMListener[%s]: starting real-time listener", l.cfg.Name)
+
+	backoff := 1 * time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("EVMListener[%s]: context cancelled, stopping listener", l.cfg.Name)
+			return
+		default:
+		}
+
+		l.state.setState(ListenerStateConnecting)
+
+		logsCh := make(chan types.Log)
+		sub, err := l.rpc.SubscribeFilterLogs(ctx, l.filterQuery(), logsCh)
+		if err != nil {
+			log.Printf("EVMListener[%s]: SubscribeFilterLogs error: %v (retrying in %s)", l.cfg.Name, err, backoff)
+			l.state.setState(ListenerStateDisconnected)
+			l.state.setError(err)
+			if !sleepCtx(ctx, backoff) {
+				return
+			}
+			backoff *= 2
+			if backoff > 60*time.Second {
+				backoff = 60 * time.Second
+			}
+			continue
+		}
+
+		// 订阅建立后再追赶，保证追赶结束与订阅开始之间没有空档
+		pendingBlock, err := l.catchUp(ctx)
+		if err != nil {
+			log.Printf("EVMListener[%s]: catch-up failed: %v (retrying in %s)", l.cfg.Name, err, backoff)
+			l.state.setError(err)
+			sub.Unsubscribe()
+			if !sleepCtx(ctx, backoff) {
+				return
+			}
+			continue
+		}
+
+		backoff = 1 * time.Second
+		l.state.setState(ListenerStateConnected)
+		log.Printf("EVMListener[%s]: WSS subscription active, caught up to block %d", l.cfg.Name, pendingBlock)
+
+		ticker := time.NewTicker(checkpointInterval)
+		var resyncErr error
+		failover := false
+	recv:
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				sub.Unsubscribe()
+				return
+			case err := <-sub.Err():
+				// 端点不再健康：立即在更健康的端点上重新订阅并从检查点追赶
+				if failover = errors.Is(err, errRPCFailover); failover {
+					log.Printf("EVMListener[%s]: %v (resubscribing)", l.cfg.Name, err)
+					break recv
+				}
+				log.Printf("EVMListener[%s]: subscription error: %v (reconnecting)", l.cfg.Name, err)
+				l.state.setState(ListenerStateDisconnected)
+				if err != nil {
+					l.state.setError(err)
+				}
+				break recv
+			case vLog := <-logsCh:
+				// 写入死信失败时不推进检查点，重连后从检查点重新追赶
+				if resyncErr = l.submitLog(ctx, vLog); resyncErr != nil {
+					break recv
+				}
+			case <-ticker.C:
+				latest, err := l.latestBlock(ctx)
+				if err != nil {
+					log.Printf("EVMListener[%s]: %v", l.cfg.Name, err)
+					continue
+				}
+				if resyncErr = l.queue.Flush(ctx); resyncErr != nil {
+					break recv
+				}
+				if err := l.advanceCheckpoints(ctx, pendingBlock); err != nil {
+					log.Printf("EVMListener[%s]: save checkpoint failed: %v", l.cfg.Name, err)
+					continue
+				}
+				l.state.observeBlock(pendingBlock)
+				l.finalize(latest)
+				pendingBlock = latest
+			}
+		}
+		ticker.Stop()
+		sub.Unsubscribe()
+
+		// 等待已接收的日志处理完成后再重连追赶
+		if err := l.queue.Flush(ctx); err != nil && resyncErr == nil {
+			resyncErr = err
+		}
+		if resyncErr != nil && ctx.Err() == nil {
+			log.Printf("EVMListener[%s]: %v (resyncing)", l.cfg.Name, resyncErr)
+			l.state.setError(resyncErr)
+		}
+
+		if !failover && !sleepCtx(ctx, 5*time.Second) {
+			return
+		}
+	}
+}
+
+// submitLog 将订阅推送的日志交给处理队列（队列满时阻塞）；处理失败的日志按接收顺序放入死信队列
+//
+// 被移除的日志（重组）不与其他日志并发：等待此前的日志处理完成后同步回滚。
+func (l *EVMListener) submitLog(ctx context.Context, vLog types.Log) error {
+	if vLog.Removed {
+		if err := l.queue.Flush(ctx); err != nil {
+			return err
+		}
+		if err := l.handleLog(ctx, vLog); err != nil {
+			return l.deadLetter(ctx, vLog, err)
+		}
+		return nil
+	}
+	return l.queue.Submit(ctx, func(ctx context.Context) error {
+		return l.handleLog(ctx, vLog)
+	}, func(err error) error {
+		if err != nil {
+			return l.deadLetter(ctx, vLog, err)
+		}
+		return nil
+	})
+}
+
+// pollForNewEvents 轮询模式（当 WSS 不可用时）：每个周期从检查点追赶到最新区块
+func (l *EVMListener) pollForNewEvents(ctx context.Context) {
+	log.Printf("EVMListener[%s]: starting polling mode", l.cfg.Name)
+	l.state.setState(ListenerStatePolling)
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if _, err := l.catchUp(ctx); err != nil {
+			log.Printf("EVMListener[%s] poll: %v", l.cfg.Name, err)
+			l.state.setError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handleLog 按合约 ABI 版本分发日志
+func (l *EVMListener) handleLog(ctx context.Context, vLog types.Log) error {
+	if l.cfg.Endpoint != (common.Address{}) && vLog.Address == l.cfg.Endpoint {
+		if vLog.Removed {
+			return l.handleRemovedLog(vLog)
+		}
+		err := l.handleLzReceiveAlert(ctx, vLog)
+		if err == nil {
+			l.state.observeBlock(vLog.BlockNumber)
+		}
+		return err
+	}
+	version, ok := l.contracts[vLog.Address]
+	if !ok {
+		return classify(ErrorClassDecode, fmt.Errorf("log from unknown contract %s", vLog.Address.Hex()))
+	}
+	if vLog.Removed {
+		return l.handleRemovedLog(vLog)
+	}
+	// 请求与执行事件的第一个 data 字段都是本链代币（srcToken / token）
+	if len(vLog.Data) >= 32 {
+		l.resolveToken(ctx, common.BytesToAddress(vLog.Data[0:32]))
+	}
+	var err error
+	switch {
+	case len(vLog.Topics) > 0 && vLog.Topics[0] == tokenPayoutExecutedTopic:
+		err = l.handleExecution(ctx, vLog)
+	case version == ABIVersionV1:
+		err = l.processor.ParseAndPersist(ctx, vLog)
+	default:
+		err = l.parseAndPersistV2(ctx, vLog)
+	}
+	if err == nil {
+		l.state.observeBlock(vLog.BlockNumber)
+	}
+	return err
+}
+
+// resolveToken 确保本链代币已登记到代币注册表（ERC-20 decimals()/symbol()）；失败只记录日志
+func (l *EVMListener) resolveToken(ctx context.Context, token common.Address) {
+	_, err := tokenRegistry.Resolve(ctx, l.cfg.EID, token.Hex(), func(ctx context.Context, addr string) (TokenInfo, error) {
+		return fetchERC20Metadata(ctx, l.rpc, common.HexToAddress(addr))
+	})
+	if err != nil {
+		log.Printf("EVMListener[%s]: %v", l.cfg.Name, err)
+	}
+}
+
+// parseAndPersistV2 解析并持久化新版合约（bytes32 merchant）的事件
+func (l *EVMListener) parseAndPersistV2(ctx context.Context, vLog types.Log) error {
+	if done, err := l.store.EventProcessed(vLog.TxHash.Hex(), vLog.Index); err != nil || done {
+		return classify(ErrorClassStorage, err)
+	}
+
+	// 获取交易详情（用于验证交易是否确认）
+	_, pending, err := l.rpc.TransactionByHash(ctx, vLog.TxHash)
+	if err != nil {
+		return classify(ErrorClassRPC, fmt.Errorf("get transaction failed: %v", err))
+	}
+	if pending {
+		return classify(ErrorClassRPC, fmt.Errorf("transaction is pending"))
+	}
+
+	record, err := decodePayoutV2(vLog, l.cfg.EID)
+	if err != nil {
+		// 只保存原始事件（parsed = 0），修复解码后可重新索引
+		if _, ierr := insertRawLog(l.store, l.cfg.Name, vLog); ierr != nil {
+			return classify(ErrorClassStorage, ierr)
+		}
+		return classify(ErrorClassDecode, err)
+	}
+
+	header, err := l.rpc.HeaderByNumber(ctx, new(big.Int).SetUint64(vLog.BlockNumber))
+	if err != nil {
+		return classify(ErrorClassRPC, fmt.Errorf("get block header failed: %v", err))
+	}
+	blockTime := time.Unix(int64(header.Time), 0).UTC()
+	record.Timestamp = blockTime
+	record.FeeBps, record.FeeIssue = validateFee(ctx, l.fees, vLog.Address, record.GrossAmount, record.NetAmount, record.FeeAmount, record.TxHash)
+
+	packet, err := l.packetSent(ctx, vLog)
+	if err != nil {
+		return err
+	}
+	res, err := persistLog(l.store, l.cfg.Name, vLog, blockTime, EventEffects{Payout: &record, PacketSent: packet})
+	if err != nil {
+		return classify(ErrorClassStorage, fmt.Errorf("save payout failed: %v", err))
+	}
+	if res.Duplicate {
+		return nil
+	}
+
+	log.Printf("EVMListener[%s]: saved payout tx=%s, payer=%s, merchant=%s, amount=%s -> EID:%d",
+		l.cfg.Name,
+		record.TxHash[:10]+"...",
+		record.Payer.String()[:8]+"...",
+		record.Merchant.String()[:8]+"...",
+		tokenRegistry.FormatAmount(l.cfg.EID, record.SrcToken.Hex(), record.GrossAmount),
+		record.DstEid,
+	)
+
+	return nil
+}
+
+// handleExecution 记录目标链执行（TokenPayoutExecuted）并与源链 payout 匹配
+func (l *EVMListener) handleExecution(ctx context.Context, vLog types.Log) error {
+	// event TokenPayoutExecuted(address indexed merchant, address token, uint256 amount)
+	if len(vLog.Topics) < 2 {
+		return classify(ErrorClassDecode, fmt.Errorf("invalid log topics length: %d", len(vLog.Topics)))
+	}
+	if len(vLog.Data) < 64 {
+		return classify(ErrorClassDecode, fmt.Errorf("invalid log data length: %d", len(vLog.Data)))
+	}
+	if done, err := l.store.EventProcessed(vLog.TxHash.Hex(), vLog.Index); err != nil || done {
+		return classify(ErrorClassStorage, err)
+	}
+
+	header, err := l.rpc.HeaderByNumber(ctx, new(big.Int).SetUint64(vLog.BlockNumber))
+	if err != nil {
+		return classify(ErrorClassRPC, fmt.Errorf("get block header failed: %v", err))
+	}
+
+	// 同一交易中 EndpointV2 的 PacketDelivered 给出消息 GUID
+	logs, err := l.receiptLogs(ctx, vLog.TxHash)
+	if err != nil {
+		return err
+	}
+	var guid string
+	var delivered *LZMessage
+	if packet, ok := findPacketForLog(logs, vLog, []common.Hash{tokenPayoutExecutedTopic}, l.cfg.EID); ok {
+		guid = packet.GUID.Hex()
+		delivered = &LZMessage{
+			GUID:      guid,
+			SrcEid:    packet.SrcEid,
+			DstEid:    packet.DstEid,
+			Nonce:     packet.Nonce,
+			Sender:    packet.Sender.Hex(),
+			Receiver:  packet.Receiver.Hex(),
+			DstChain:  l.cfg.Name,
+			DstTxHash: strings.ToLower(vLog.TxHash.Hex()),
+		}
+	} else {
+		log.Printf("EVMListener[%s]: no PacketDelivered for execution in tx %s", l.cfg.Name, vLog.TxHash.Hex())
+	}
+
+	delivery := Delivery{
+		GUID:        guid,
+		DstTxHash:   strings.ToLower(vLog.TxHash.Hex()),
+		LogIndex:    vLog.Index,
+		DstChain:    l.cfg.Name,
+		DstEid:      int64(l.cfg.EID),
+		BlockNumber: vLog.BlockNumber,
+		Merchant:    common.BytesToAddress(vLog.Topics[1].Bytes()).Hex(),
+		Token:       common.BytesToAddress(vLog.Data[0:32]).Hex(),
+		Amount:      new(big.Int).SetBytes(vLog.Data[32:64]),
+		DeliveredAt: time.Unix(int64(header.Time), 0).UTC(),
+	}
+	res, err := persistLog(l.store, l.cfg.Name, vLog, delivery.DeliveredAt, EventEffects{PacketDelivered: delivered, Delivery: &delivery})
+	if err != nil {
+		return classify(ErrorClassStorage, fmt.Errorf("save delivery failed: %v", err))
+	}
+	if res.Duplicate {
+		return nil
+	}
+
+	if res.SrcTxHash != "" {
+		log.Printf("EVMListener[%s]: payout %s delivered in tx %s", l.cfg.Name, res.SrcTxHash[:10]+"...", delivery.DstTxHash[:10]+"...")
+	} else {
+		log.Printf("EVMListener[%s]: execution tx=%s merchant=%s amount=%s has no matching payout yet",
+			l.cfg.Name, delivery.DstTxHash[:10]+"...", delivery.Merchant[:8]+"...", tokenRegistry.FormatAmount(l.cfg.EID, delivery.Token, delivery.Amount))
+	}
+	return nil
+}
+
+// handleLzReceiveAlert 处理 EndpointV2 的 LzReceiveAlert：executor 调用本链 OApp 的 lzReceive 失败
+//
+// 记录一条失败的执行记录，匹配到的源链 payout 置为 Failed 并告警；
+// executor 重试成功后 TokenPayoutExecuted 会再将其置为 Delivered。
+func (l *EVMListener) handleLzReceiveAlert(ctx context.Context, vLog types.Log) error {
+	if len(vLog.Topics) < 2 || vLog.Topics[0] != lzReceiveAlertTopic {
+		return nil
+	}
+	if _, ours := l.contracts[common.BytesToAddress(vLog.Topics[1].Bytes())]; !ours {
+		return nil // 其他 OApp 的告警
+	}
+	if done, err := l.store.EventProcessed(vLog.TxHash.Hex(), vLog.Index); err != nil || done {
+		return classify(ErrorClassStorage, err)
+	}
+	packet, reason, err := decodeLzReceiveAlert(vLog, l.cfg.EID)
+	if err != nil {
+		return classify(ErrorClassDecode, fmt.Errorf("decode LzReceiveAlert failed: %v", err))
+	}
+	dstToken, merchant, amount, err := decodeTokenPayoutMessage(packet.Message)
+	if err != nil {
+		log.Printf("EVMListener[%s]: skip LzReceiveAlert in tx %s: %v", l.cfg.Name, vLog.TxHash.Hex(), err)
+		return nil
+	}
+
+	header, err := l.rpc.HeaderByNumber(ctx, new(big.Int).SetUint64(vLog.BlockNumber))
+	if err != nil {
+		return classify(ErrorClassRPC, fmt.Errorf("get block header failed: %v", err))
+	}
+
+	delivery := Delivery{
+		GUID:        packet.GUID.Hex(),
+		DstTxHash:   strings.ToLower(vLog.TxHash.Hex()),
+		LogIndex:    vLog.Index,
+		DstChain:    l.cfg.Name,
+		DstEid:      int64(l.cfg.EID),
+		BlockNumber: vLog.BlockNumber,
+		Merchant:    common.BytesToAddress(merchant.Bytes()).Hex(),
+		Token:       common.BytesToAddress(dstToken.Bytes()).Hex(),
+		Amount:      amount,
+		DeliveredAt: time.Unix(int64(header.Time), 0).UTC(),
+		Failed:      true,
+		Error:       "lzReceive reverted: " + revertReason(reason),
+	}
+	res, err := persistLog(l.store, l.cfg.Name, vLog, delivery.DeliveredAt, EventEffects{Delivery: &delivery})
+	if err != nil {
+		return classify(ErrorClassStorage, fmt.Errorf("save failed delivery failed: %v", err))
+	}
+	if res.Duplicate {
+		return nil // 重放时不重复告警
+	}
+
+	log.Printf("EVMListener[%s]: lzReceive failed in tx %s guid=%s: %s", l.cfg.Name, delivery.DstTxHash[:10]+"...", delivery.GUID[:10]+"...", delivery.Error)
+	if res.SrcTxHash != "" {
+		delivery.SrcTxHash = res.SrcTxHash
+		alertDeliveryFailed(delivery)
+	}
+	return nil
+}
+
+// receiptLogs 获取交易回执中的全部日志
+func (l *EVMListener) receiptLogs(ctx context.Context, txHash common.Hash) ([]*types.Log, error) {
+	receipt, err := l.rpc.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, classify(ErrorClassRPC, fmt.Errorf("get transaction receipt failed: %v", err))
+	}
+	return receipt.Logs, nil
+}
+
+// packetSent 从源链交易回执中提取 PacketSent（GUID / nonce），与 payout 一起写入；找不到时返回 nil
+func (l *EVMListener) packetSent(ctx context.Context, vLog types.Log) (*LZMessage, error) {
+	logs, err := l.receiptLogs(ctx, vLog.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	topics := []common.Hash{payoutTopicByABIVersion[ABIVersionV1], payoutTopicByABIVersion[ABIVersionV2]}
+	packet, ok := findPacketForLog(logs, vLog, topics, 0)
+	if !ok {
+		log.Printf("EVMListener[%s]: no PacketSent for payout tx %s", l.cfg.Name, vLog.TxHash.Hex())
+		return nil, nil
+	}
+	return &LZMessage{
+		GUID:      packet.GUID.Hex(),
+		SrcEid:    packet.SrcEid,
+		DstEid:    packet.DstEid,
+		Nonce:     packet.Nonce,
+		Sender:    packet.Sender.Hex(),
+		Receiver:  packet.Receiver.Hex(),
+		SrcChain:  l.cfg.Name,
+		SrcTxHash: strings.ToLower(vLog.TxHash.Hex()),
+	}, nil
+}
+
+// sleepCtx 可被 ctx 取消的 sleep，返回 false 表示 ctx 已结束
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
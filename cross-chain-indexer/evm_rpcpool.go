@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// EVMPool 一条 EVM 链的 RPC 池：实现监听器、Processor 与合约调用用到的 ethclient 方法，
+// 每次调用路由到最健康的 HTTPS 端点，订阅使用最健康的 WSS 端点
+type EVMPool struct {
+	*rpcPool
+	clients []*ethclient.Client // 与 endpoints 一一对应的 HTTPS 客户端
+}
+
+// NewEVMPool 创建 EVM RPC 池（maxHeadLag 为 0 时使用默认值）
+//
+// HTTPS 客户端只解析 URL、不建立连接，端点宕机不影响启动；WSS 在订阅时才连接。
+func NewEVMPool(chain string, endpoints []RPCEndpoint, maxHeadLag uint64) (*EVMPool, error) {
+	if len(endpoints) == 0 {
+		return nil, errNoEndpoint
+	}
+	if maxHeadLag == 0 {
+		maxHeadLag = defaultEVMMaxHeadLag
+	}
+	p := &EVMPool{rpcPool: newRPCPool(chain, endpoints, maxHeadLag)}
+	for _, ep := range p.endpoints {
+		c, err := ethclient.Dial(ep.cfg.HTTPS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rpc endpoint %s: %w", ep.name, err)
+		}
+		p.clients = append(p.clients, c)
+	}
+	p.head = func(ctx context.Context, ep *poolEndpoint) (uint64, error) {
+		return p.clients[ep.index].BlockNumber(ctx)
+	}
+	return p, nil
+}
+
+// do 在最健康的端点上执行 fn（端点故障时换端点重试）
+func (p *EVMPool) do(ctx context.Context, fn func(c *ethclient.Client) error) error {
+	return p.call(ctx, func(ep *poolEndpoint) error {
+		return fn(p.clients[ep.index])
+	})
+}
+
+// BlockNumber 最新区块高度
+func (p *EVMPool) BlockNumber(ctx context.Context) (n uint64, err error) {
+	err = p.do(ctx, func(c *ethclient.Client) (err error) {
+		n, err = c.BlockNumber(ctx)
+		return err
+	})
+	return n, err
+}
+
+// HeaderByNumber 区块头（number 为 nil 时取最新区块）
+func (p *EVMPool) HeaderByNumber(ctx context.Context, number *big.Int) (h *types.Header, err error) {
+	err = p.do(ctx, func(c *ethclient.Client) (err error) {
+		h, err = c.HeaderByNumber(ctx, number)
+		return err
+	})
+	return h, err
+}
+
+// FilterLogs 查询日志
+func (p *EVMPool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = p.do(ctx, func(c *ethclient.Client) (err error) {
+		logs, err = c.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+// TransactionByHash 交易及其是否仍在 pending
+func (p *EVMPool) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, pending bool, err error) {
+	err = p.do(ctx, func(c *ethclient.Client) (err error) {
+		tx, pending, err = c.TransactionByHash(ctx, hash)
+		return err
+	})
+	return tx, pending, err
+}
+
+// TransactionReceipt 交易回执
+func (p *EVMPool) TransactionReceipt(ctx context.Context, hash common.Hash) (r *types.Receipt, err error) {
+	err = p.do(ctx, func(c *ethclient.Client) (err error) {
+		r, err = c.TransactionReceipt(ctx, hash)
+		return err
+	})
+	return r, err
+}
+
+// CodeAt 合约代码（bind.ContractCaller）
+func (p *EVMPool) CodeAt(ctx context.Context, account common.Address, block *big.Int) (code []byte, err error) {
+	err = p.do(ctx, func(c *ethclient.Client) (err error) {
+		code, err = c.CodeAt(ctx, account, block)
+		return err
+	})
+	return code, err
+}
+
+// CallContract 只读合约调用（bind.ContractCaller / ethereum.ContractCaller）
+func (p *EVMPool) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) (out []byte, err error) {
+	err = p.do(ctx, func(c *ethclient.Client) (err error) {
+		out, err = c.CallContract(ctx, msg, block)
+		return err
+	})
+	return out, err
+}
+
+// SubscribeFilterLogs 在最健康的 WSS 端点上订阅日志（连接或订阅失败时依次尝试其他端点）
+//
+// 返回的订阅在连接断开，或所在端点不再健康且有健康的端点时以错误结束（后者为 errRPCFailover），
+// 调用方重新订阅即切换端点。
+func (p *EVMPool) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	tried := make(map[*poolEndpoint]bool, len(p.endpoints))
+	lastErr := errNoWSS
+	for {
+		ep := p.pick(tried, true)
+		if ep == nil {
+			return nil, lastErr
+		}
+		tried[ep] = true
+
+		client, err := ethclient.DialContext(ctx, ep.cfg.WSS)
+		var sub ethereum.Subscription
+		if err == nil {
+			if sub, err = client.SubscribeFilterLogs(ctx, q, ch); err != nil {
+				client.Close()
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		p.record(ep, 0, err)
+		if err == nil {
+			return p.newSubscription(ctx, ep, client, sub), nil
+		}
+		lastErr = fmt.Errorf("%s: %s", ep.name, p.redactError(ep, err))
+		log.Printf("RPCPool[%s]: subscribe on %s failed: %s", p.chain, ep.name, p.redactError(ep, err))
+	}
+}
+
+// poolSubscription 绑定到池内端点的订阅：端点不健康时主动结束，使调用方重新订阅到其他端点
+type poolSubscription struct {
+	err  chan error
+	stop func()
+	done chan struct{}
+}
+
+func (p *EVMPool) newSubscription(ctx context.Context, ep *poolEndpoint, client *ethclient.Client, sub ethereum.Subscription) *poolSubscription {
+	watchCtx, stop := p.watch(ctx, ep)
+	s := &poolSubscription{err: make(chan error, 1), stop: stop, done: make(chan struct{})}
+	go func() {
+		select {
+		case err := <-sub.Err():
+			if err != nil {
+				p.record(ep, 0, err)
+			}
+			s.err <- err
+		case <-watchCtx.Done():
+			if cause := context.Cause(watchCtx); errors.Is(cause, errRPCFailover) {
+				s.err <- cause
+			}
+		}
+		stop()
+		sub.Unsubscribe()
+		client.Close()
+		close(s.err)
+		close(s.done)
+	}()
+	return s
+}
+
+// Err 订阅结束时收到错误（取消订阅时通道关闭）
+func (s *poolSubscription) Err() <-chan error { return s.err }
+
+// Unsubscribe 取消订阅并关闭连接
+func (s *poolSubscription) Unsubscribe() {
+	s.stop()
+	<-s.done
+}
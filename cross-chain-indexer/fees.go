@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"cross-chain-indexer/contract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 手续费以基点（万分之一）计
+const feeBpsDenominator = 10000
+
+// feeBpsUnknown 未能读取合约 FEE_BPS 时写入的占位值
+const feeBpsUnknown = -1
+
+// FeeBpsReader 读取并缓存 MyOApp 合约的 FEE_BPS（合约常量，每个地址只读一次）
+type FeeBpsReader struct {
+	client bind.ContractCaller
+
+	mu     sync.Mutex
+	values map[common.Address]uint16
+}
+
+// NewFeeBpsReader 创建 FEE_BPS 读取器
+func NewFeeBpsReader(client bind.ContractCaller) *FeeBpsReader {
+	return &FeeBpsReader{client: client, values: make(map[common.Address]uint16)}
+}
+
+// FeeBps 返回合约的 FEE_BPS；读取失败时返回 feeBpsUnknown 与错误（不缓存，下次重试）
+func (r *FeeBpsReader) FeeBps(ctx context.Context, addr common.Address) (int, error) {
+	r.mu.Lock()
+	v, ok := r.values[addr]
+	r.mu.Unlock()
+	if ok {
+		return int(v), nil
+	}
+
+	caller, err := contract.NewMyOAppCaller(addr, r.client)
+	if err != nil {
+		return feeBpsUnknown, err
+	}
+	v, err = caller.FEEBPS(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return feeBpsUnknown, fmt.Errorf("read FEE_BPS of %s: %w", addr.Hex(), err)
+	}
+
+	r.mu.Lock()
+	r.values[addr] = v
+	r.mu.Unlock()
+	return int(v), nil
+}
+
+// checkFee 校验事件中的手续费，返回问题描述（空字符串表示通过）：
+// - gross - net 必须等于 fee
+// - FEE_BPS 已知时，fee 必须等于 gross * FEE_BPS / 10000（向下取整，与合约一致）
+func checkFee(gross, net, fee *big.Int, feeBps int) string {
+	if gross == nil || net == nil || fee == nil {
+		return "missing amount"
+	}
+	if diff := new(big.Int).Sub(gross, net); diff.Cmp(fee) != 0 {
+		return fmt.Sprintf("gross - net = %s, fee = %s", diff, fee)
+	}
+	if feeBps == feeBpsUnknown {
+		return ""
+	}
+	expected := new(big.Int).Mul(gross, big.NewInt(int64(feeBps)))
+	expected.Quo(expected, big.NewInt(feeBpsDenominator))
+	if expected.Cmp(fee) != 0 {
+		return fmt.Sprintf("fee %s != gross * %d bps = %s", fee, feeBps, expected)
+	}
+	return ""
+}
+
+// validateFee 读取合约 FEE_BPS 并校验手续费，返回写入 payout 的 FeeBps 与 FeeIssue
+func validateFee(ctx context.Context, fees *FeeBpsReader, oapp common.Address, gross, net, fee *big.Int, txHash string) (int, string) {
+	feeBps := feeBpsUnknown
+	if fees != nil {
+		var err error
+		if feeBps, err = fees.FeeBps(ctx, oapp); err != nil {
+			log.Printf("fees: %v", err)
+		}
+	}
+	issue := checkFee(gross, net, fee, feeBps)
+	if issue != "" {
+		log.Printf("fees: WARNING fee mismatch in payout %s: %s", txHash, issue)
+	}
+	return feeBps, issue
+}
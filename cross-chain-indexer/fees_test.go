@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestCheckFee(t *testing.T) {
+	tests := []struct {
+		name            string
+		gross, net, fee int64
+		feeBps          int
+		wantIssue       string
+	}{
+		{"Valid", 1000000, 970000, 30000, 300, ""},
+		{"RoundsDown", 999, 970, 29, 300, ""},
+		{"UnknownBps", 1000000, 970000, 30000, feeBpsUnknown, ""},
+		{"GrossMinusNet", 1000000, 970000, 20000, 300, "gross - net = 30000"},
+		{"WrongBps", 1000000, 980000, 20000, 300, "300 bps = 30000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issue := checkFee(big.NewInt(tt.gross), big.NewInt(tt.net), big.NewInt(tt.fee), tt.feeBps)
+			if (tt.wantIssue == "") != (issue == "") || !strings.Contains(issue, tt.wantIssue) {
+				t.Errorf("checkFee = %q, want %q", issue, tt.wantIssue)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ go 1.25.2
 require (
 	github.com/ethereum/go-ethereum v1.16.4
 	github.com/gagliardetto/solana-go v1.14.0
+	github.com/lib/pq v1.12.3
+	golang.org/x/time v0.9.0
 )
 
 require (
@@ -41,7 +43,6 @@ require (
 	go.uber.org/zap v1.21.0 // indirect
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
 	golang.org/x/term v0.30.0 // indirect
-	golang.org/x/time v0.9.0 // indirect
 	modernc.org/libc v1.66.3 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// LayerZero EndpointV2 事件 topic
+var (
+	// PacketSent(bytes encodedPayload, bytes options, address sendLibrary)
+	packetSentTopic = common.HexToHash("0x1ab700d4ced0c005b164c0f789fd09fcbb0156d4c2041b8a3bfbcd961cd1567f")
+	// PacketDelivered((uint32 srcEid, bytes32 sender, uint64 nonce) origin, address receiver)
+	packetDeliveredTopic = common.HexToHash("0x3cd5e48f9730b129dc7550f0fcea9c767b7be37837cd10e55eb35f734f4bca04")
+	// LzReceiveAlert(address indexed receiver, address indexed executor, Origin origin, bytes32 guid,
+	//                uint256 gas, uint256 value, bytes message, bytes extraData, bytes reason)
+	// executor 执行 lzReceive 失败（目标合约 revert）后上报
+	lzReceiveAlertTopic = common.HexToHash("0x7edfa10fe10193301ad8a8bea7e968c7bcabcc64981f368e3aeada40ce26ae2c")
+)
+
+// MyOApp 消息类型
+const msgTagTokenPayout = 101
+
+// PacketV1Codec 头部布局：version(1) | nonce(8) | srcEid(4) | sender(32) | dstEid(4) | receiver(32) | guid(32) | message
+const (
+	packetV1Version      = 1
+	packetV1HeaderLength = 81
+	packetV1GUIDOffset   = packetV1HeaderLength
+	packetV1MessageStart = packetV1GUIDOffset + 32
+)
+
+// LZPacket LayerZero V2 消息标识
+type LZPacket struct {
+	GUID     common.Hash
+	Nonce    uint64
+	SrcEid   uint32
+	Sender   common.Hash // 源 OApp（bytes32）
+	DstEid   uint32
+	Receiver common.Hash // 目标 OApp（bytes32；Solana 为 Store PDA）
+	Message  []byte      // 消息体（PacketDelivered 中没有）
+}
+
+// lzGUID 按 EndpointV2 的规则计算 GUID：
+// keccak256(abi.encodePacked(nonce, srcEid, sender, dstEid, receiver))
+func lzGUID(nonce uint64, srcEid uint32, sender common.Hash, dstEid uint32, receiver common.Hash) common.Hash {
+	buf := make([]byte, 0, 8+4+32+4+32)
+	buf = binary.BigEndian.AppendUint64(buf, nonce)
+	buf = binary.BigEndian.AppendUint32(buf, srcEid)
+	buf = append(buf, sender.Bytes()...)
+	buf = binary.BigEndian.AppendUint32(buf, dstEid)
+	buf = append(buf, receiver.Bytes()...)
+	return crypto.Keccak256Hash(buf)
+}
+
+// decodePacketSent 解析源链 EndpointV2 的 PacketSent 事件
+func decodePacketSent(vLog types.Log) (LZPacket, error) {
+	if len(vLog.Topics) == 0 || vLog.Topics[0] != packetSentTopic {
+		return LZPacket{}, fmt.Errorf("not a PacketSent log")
+	}
+	payload, err := abiBytesArg(vLog.Data, 0)
+	if err != nil {
+		return LZPacket{}, fmt.Errorf("decode encodedPayload: %w", err)
+	}
+	if len(payload) < packetV1MessageStart {
+		return LZPacket{}, fmt.Errorf("encoded packet too short: %d bytes", len(payload))
+	}
+	if payload[0] != packetV1Version {
+		return LZPacket{}, fmt.Errorf("unsupported packet version %d", payload[0])
+	}
+	return LZPacket{
+		Nonce:    binary.BigEndian.Uint64(payload[1:9]),
+		SrcEid:   binary.BigEndian.Uint32(payload[9:13]),
+		Sender:   common.BytesToHash(payload[13:45]),
+		DstEid:   binary.BigEndian.Uint32(payload[45:49]),
+		Receiver: common.BytesToHash(payload[49:81]),
+		GUID:     common.BytesToHash(payload[packetV1GUIDOffset:packetV1MessageStart]),
+		Message:  append([]byte(nil), payload[packetV1MessageStart:]...),
+	}, nil
+}
+
+// decodePacketDelivered 解析目标链 EndpointV2 的 PacketDelivered 事件
+//
+// 事件本身不含 GUID，使用 origin、本链 EID 与 receiver 计算。
+func decodePacketDelivered(vLog types.Log, localEid uint32) (LZPacket, error) {
+	if len(vLog.Topics) == 0 || vLog.Topics[0] != packetDeliveredTopic {
+		return LZPacket{}, fmt.Errorf("not a PacketDelivered log")
+	}
+	if len(vLog.Data) < 128 { // srcEid, sender, nonce, receiver
+		return LZPacket{}, fmt.Errorf("invalid PacketDelivered data length: %d", len(vLog.Data))
+	}
+	p := LZPacket{
+		SrcEid:   uint32(new(big.Int).SetBytes(vLog.Data[0:32]).Uint64()),
+		Sender:   common.BytesToHash(vLog.Data[32:64]),
+		Nonce:    new(big.Int).SetBytes(vLog.Data[64:96]).Uint64(),
+		DstEid:   localEid,
+		Receiver: common.BytesToHash(vLog.Data[96:128]),
+	}
+	p.GUID = lzGUID(p.Nonce, p.SrcEid, p.Sender, p.DstEid, p.Receiver)
+	return p, nil
+}
+
+// decodeLzReceiveAlert 解析 LzReceiveAlert：返回消息标识与 revert 原因
+func decodeLzReceiveAlert(vLog types.Log, localEid uint32) (LZPacket, []byte, error) {
+	if len(vLog.Topics) < 3 || vLog.Topics[0] != lzReceiveAlertTopic {
+		return LZPacket{}, nil, fmt.Errorf("not an LzReceiveAlert log")
+	}
+	if len(vLog.Data) < 9*32 {
+		return LZPacket{}, nil, fmt.Errorf("invalid LzReceiveAlert data length: %d", len(vLog.Data))
+	}
+	p := LZPacket{
+		SrcEid:   uint32(new(big.Int).SetBytes(vLog.Data[0:32]).Uint64()),
+		Sender:   common.BytesToHash(vLog.Data[32:64]),
+		Nonce:    new(big.Int).SetBytes(vLog.Data[64:96]).Uint64(),
+		GUID:     common.BytesToHash(vLog.Data[96:128]),
+		DstEid:   localEid,
+		Receiver: vLog.Topics[1],
+	}
+	message, err := abiBytesArg(vLog.Data, 6)
+	if err != nil {
+		return LZPacket{}, nil, fmt.Errorf("decode message: %w", err)
+	}
+	p.Message = append([]byte(nil), message...)
+	reason, err := abiBytesArg(vLog.Data, 8)
+	if err != nil {
+		return LZPacket{}, nil, fmt.Errorf("decode reason: %w", err)
+	}
+	return p, append([]byte(nil), reason...), nil
+}
+
+// revertReason 将 revert 数据格式化为可读文本：Error(string) 解出字符串，其余输出十六进制
+func revertReason(data []byte) string {
+	if len(data) == 0 {
+		return "empty revert data"
+	}
+	if len(data) >= 4 && [4]byte(data[:4]) == [4]byte{0x08, 0xc3, 0x79, 0xa0} {
+		if msg, err := abiBytesArg(data[4:], 0); err == nil {
+			return string(msg)
+		}
+	}
+	return hexutil.Encode(data)
+}
+
+// decodeTokenPayoutMessage 解析 MyOApp 消息：abi.encode(uint8 tag, bytes32 dstToken, bytes32 merchant, uint256 netAmount)
+func decodeTokenPayoutMessage(message []byte) (dstToken, merchant common.Hash, amount *big.Int, err error) {
+	if len(message) != 128 {
+		return common.Hash{}, common.Hash{}, nil, fmt.Errorf("invalid message length: %d", len(message))
+	}
+	if tag := new(big.Int).SetBytes(message[0:32]); !tag.IsUint64() || tag.Uint64() != msgTagTokenPayout {
+		return common.Hash{}, common.Hash{}, nil, fmt.Errorf("not a token payout message (tag %s)", tag)
+	}
+	return common.BytesToHash(message[32:64]), common.BytesToHash(message[64:96]), new(big.Int).SetBytes(message[96:128]), nil
+}
+
+// abiBytesArg 读取 ABI 编码数据中第 i 个 bytes 参数
+func abiBytesArg(data []byte, i int) ([]byte, error) {
+	head := i * 32
+	if len(data) < head+32 {
+		return nil, fmt.Errorf("data too short")
+	}
+	offset := new(big.Int).SetBytes(data[head : head+32])
+	if !offset.IsUint64() || offset.Uint64()+32 > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid offset")
+	}
+	start := offset.Uint64() + 32
+	length := new(big.Int).SetBytes(data[offset.Uint64():start])
+	if !length.IsUint64() || start+length.Uint64() > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid length")
+	}
+	return data[start : start+length.Uint64()], nil
+}
+
+// findPacketForLog 在同一交易的回执日志中找到 appLog 对应的 LayerZero 包
+//
+// 同一交易内 OApp 的第 k 条应用事件（topic 属于 appTopics）对应
+// 该 OApp 的第 k 个包：源链为 sender 等于 OApp 的 PacketSent，
+// 目标链为 receiver 等于 OApp 的 PacketDelivered（localEid 为本链 EID）。
+func findPacketForLog(receiptLogs []*types.Log, appLog types.Log, appTopics []common.Hash, localEid uint32) (LZPacket, bool) {
+	app := common.BytesToHash(appLog.Address.Bytes())
+	isAppTopic := func(t common.Hash) bool {
+		for _, at := range appTopics {
+			if t == at {
+				return true
+			}
+		}
+		return false
+	}
+
+	k := -1
+	n := 0
+	var packets []LZPacket
+	for _, l := range receiptLogs {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		switch {
+		case l.Address == appLog.Address && isAppTopic(l.Topics[0]):
+			if l.Index == appLog.Index {
+				k = n
+			}
+			n++
+		case l.Topics[0] == packetSentTopic:
+			if p, err := decodePacketSent(*l); err == nil && p.Sender == app {
+				packets = append(packets, p)
+			}
+		case l.Topics[0] == packetDeliveredTopic:
+			if p, err := decodePacketDelivered(*l, localEid); err == nil && p.Receiver == app {
+				packets = append(packets, p)
+			}
+		}
+	}
+	if k < 0 || k >= len(packets) {
+		return LZPacket{}, false
+	}
+	return packets[k], true
+}
+
+// --------------------------- Solana lz_receive ---------------------------
+
+// lzPacketFromInstruction 从解码后的 OApp lz_receive 指令中取出消息标识（参数为 LzReceiveParams）
+//
+// receiver 为 lz_receive 的 store 账户（OApp Store PDA）。
+func lzPacketFromInstruction(ix *AnchorInstruction, localEid uint32) (LZPacket, error) {
+	if ix.Name != "lz_receive" {
+		return LZPacket{}, fmt.Errorf("not an lz_receive instruction: %s", ix.Name)
+	}
+	params, ok := ix.Args["params"].(map[string]interface{})
+	if !ok {
+		return LZPacket{}, fmt.Errorf("lz_receive: missing params")
+	}
+	srcEid, ok1 := params["src_eid"].(uint32)
+	sender, ok2 := params["sender"].(hexutil.Bytes)
+	nonce, ok3 := params["nonce"].(uint64)
+	guid, ok4 := params["guid"].(hexutil.Bytes)
+	message, ok5 := params["message"].(hexutil.Bytes)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 {
+		return LZPacket{}, fmt.Errorf("lz_receive: unexpected params layout")
+	}
+	p := LZPacket{
+		SrcEid:  srcEid,
+		Sender:  common.BytesToHash(sender),
+		Nonce:   nonce,
+		GUID:    common.BytesToHash(guid),
+		DstEid:  localEid,
+		Message: message,
+	}
+	if store, ok := ix.Accounts["store"]; ok {
+		p.Receiver = common.BytesToHash(store.Bytes())
+	}
+	return p, nil
+}
@@ -0,0 +1,765 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// --------------------------- 版本化迁移 ---------------------------
+
+// migration 一次带版本号的 schema 变更；up / down 各在单个事务中执行，并同时更新 schema_migrations
+//
+// SQL 按 SQLite 书写，由方言的 ddl 转换为 PostgreSQL（DATETIME、自增主键、默认时间）。
+// 早于版本化迁移的 SQLite 数据库没有 schema_migrations，其中的表 / 字段 / 索引可能已部分存在，
+// 因此 up 对已存在的对象保持幂等（IF NOT EXISTS、addColumns），旧库从版本 1 起依次补齐。
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sqlTx) error
+	down    func(tx *sqlTx) error
+}
+
+// migrations 按版本号递增排列；已发布的迁移不可修改，schema 变更只能追加新版本
+var migrations = []migration{
+	{1, "initial", func(tx *sqlTx) error {
+		return execDDL(tx, `
+			CREATE TABLE IF NOT EXISTS events (
+				tx_hash TEXT NOT NULL,
+				log_index INTEGER NOT NULL,
+				block_number BIGINT NOT NULL,
+				raw_log TEXT NOT NULL, -- 原始 Log 的 JSON 字符串
+				parsed INTEGER DEFAULT 0,
+				PRIMARY KEY (tx_hash, log_index)
+			);
+			CREATE INDEX IF NOT EXISTS idx_events_parsed ON events(parsed);
+
+			CREATE TABLE IF NOT EXISTS payouts (
+				tx_hash TEXT PRIMARY KEY,
+				block_number BIGINT NOT NULL,
+				timestamp DATETIME NOT NULL,
+				dst_eid BIGINT NOT NULL,
+				payer TEXT NOT NULL,
+				merchant TEXT NOT NULL,
+				src_token TEXT NOT NULL,
+				dst_token TEXT NOT NULL,
+				gross_amount TEXT NOT NULL,
+				net_amount TEXT NOT NULL,
+				status TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_payouts_merchant ON payouts(merchant);
+
+			-- 按 (链, 合约/程序) 记录已完整处理到的区块高度（Solana 为 slot）
+			CREATE TABLE IF NOT EXISTS checkpoints (
+				chain TEXT NOT NULL,
+				contract TEXT NOT NULL,
+				block_number BIGINT NOT NULL,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (chain, contract)
+			);
+		`)
+	}, func(tx *sqlTx) error {
+		return execDDL(tx, `
+			DROP TABLE IF EXISTS checkpoints;
+			DROP TABLE IF EXISTS payouts;
+			DROP TABLE IF EXISTS events;
+		`)
+	}},
+
+	{2, "reorg_tracking", func(tx *sqlTx) error {
+		if err := addColumns(tx, "events", "chain TEXT DEFAULT ''", "block_hash TEXT DEFAULT ''", "reorged INTEGER DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := addColumns(tx, "payouts", "block_hash TEXT DEFAULT ''", "finalized INTEGER DEFAULT 0"); err != nil {
+			return err
+		}
+		if err := addColumns(tx, "checkpoints", "block_hash TEXT DEFAULT ''", "signature TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+		return execDDL(tx, `
+			CREATE INDEX IF NOT EXISTS idx_events_chain_block ON events(chain, block_number);
+
+			-- 重组审计：每条被回滚的事件一行
+			CREATE TABLE IF NOT EXISTS reorg_audit (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				chain TEXT NOT NULL,
+				block_number BIGINT NOT NULL,
+				old_block_hash TEXT NOT NULL,
+				new_block_hash TEXT DEFAULT '',
+				tx_hash TEXT NOT NULL,
+				log_index INTEGER NOT NULL,
+				previous_status TEXT DEFAULT '',
+				reason TEXT NOT NULL, -- "removed" | "parent_hash_mismatch"
+				detected_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_reorg_audit_tx ON reorg_audit(tx_hash);
+		`)
+	}, func(tx *sqlTx) error {
+		if err := execDDL(tx, `
+			DROP TABLE IF EXISTS reorg_audit;
+			DROP INDEX IF EXISTS idx_events_chain_block;
+		`); err != nil {
+			return err
+		}
+		if err := dropColumns(tx, "checkpoints", "block_hash", "signature"); err != nil {
+			return err
+		}
+		if err := dropColumns(tx, "payouts", "block_hash", "finalized"); err != nil {
+			return err
+		}
+		return dropColumns(tx, "events", "chain", "block_hash", "reorged")
+	}},
+
+	{3, "delivery_tracking", func(tx *sqlTx) error {
+		if err := addColumns(tx, "payouts",
+			"dst_tx_hash TEXT DEFAULT ''", "delivered_at DATETIME", "guid TEXT DEFAULT ''", "failure_reason TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+		// 目标链执行记录（EVM TokenPayoutExecuted / Solana transfer_out）
+		if err := execDDL(tx, `
+			CREATE TABLE IF NOT EXISTS deliveries (
+				dst_tx_hash TEXT NOT NULL,
+				log_index INTEGER NOT NULL, -- EVM 日志序号；Solana 为指令序号
+				dst_chain TEXT NOT NULL,
+				dst_eid BIGINT NOT NULL,
+				block_number BIGINT NOT NULL,
+				merchant TEXT NOT NULL, -- EVM 为 0x 地址，Solana 为 Base58 公钥
+				token TEXT NOT NULL,
+				amount TEXT NOT NULL,
+				delivered_at DATETIME NOT NULL,
+				src_tx_hash TEXT DEFAULT '', -- 匹配到的源链 payout，空表示尚未匹配
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (dst_tx_hash, log_index)
+			);
+			CREATE INDEX IF NOT EXISTS idx_deliveries_unmatched ON deliveries(src_tx_hash);
+			CREATE INDEX IF NOT EXISTS idx_payouts_dst_tx ON payouts(dst_tx_hash);
+		`); err != nil {
+			return err
+		}
+		// failed：目标链执行失败（EVM LzReceiveAlert / Solana 交易报错）
+		if err := addColumns(tx, "deliveries", "guid TEXT DEFAULT ''", "failed INTEGER DEFAULT 0", "error TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+		return removeDeliveryLegPayouts(tx)
+	}, func(tx *sqlTx) error {
+		if err := execDDL(tx, `
+			DROP TABLE IF EXISTS deliveries;
+			DROP INDEX IF EXISTS idx_payouts_dst_tx;
+		`); err != nil {
+			return err
+		}
+		return dropColumns(tx, "payouts", "dst_tx_hash", "delivered_at", "guid", "failure_reason")
+	}},
+
+	{4, "fees", func(tx *sqlTx) error {
+		// fee_amount 为 NULL 表示在记录手续费之前索引的旧数据
+		if err := addColumns(tx, "payouts", "fee_amount TEXT", "fee_bps INTEGER DEFAULT -1", "fee_issue TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+		return backfillDerivedFees(tx)
+	}, func(tx *sqlTx) error {
+		return dropColumns(tx, "payouts", "fee_amount", "fee_bps", "fee_issue")
+	}},
+
+	// 只修正数据：回滚后规范化的地址仍可被旧版本读取，无需还原
+	{5, "chain_addresses", func(tx *sqlTx) error {
+		return migrateChainAddresses(tx)
+	}, func(tx *sqlTx) error {
+		return nil
+	}},
+
+	{6, "lz_messages", func(tx *sqlTx) error {
+		return execDDL(tx, `
+			CREATE TABLE IF NOT EXISTS lz_messages (
+				guid TEXT PRIMARY KEY,
+				src_eid BIGINT NOT NULL,
+				dst_eid BIGINT NOT NULL,
+				nonce BIGINT NOT NULL,
+				sender TEXT NOT NULL,   -- bytes32
+				receiver TEXT NOT NULL, -- bytes32
+				src_chain TEXT DEFAULT '',
+				src_tx_hash TEXT DEFAULT '',
+				dst_chain TEXT DEFAULT '',
+				dst_tx_hash TEXT DEFAULT '',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_lz_messages_src_tx ON lz_messages(src_tx_hash);
+			CREATE INDEX IF NOT EXISTS idx_lz_messages_dst_tx ON lz_messages(dst_tx_hash);
+			CREATE INDEX IF NOT EXISTS idx_payouts_guid ON payouts(guid);
+		`)
+	}, func(tx *sqlTx) error {
+		return execDDL(tx, `
+			DROP INDEX IF EXISTS idx_payouts_guid;
+			DROP TABLE IF EXISTS lz_messages;
+		`)
+	}},
+
+	{7, "payout_routes", func(tx *sqlTx) error {
+		if err := addColumns(tx, "payouts", "src_eid BIGINT DEFAULT 0", "src_contract TEXT DEFAULT ''", "dst_contract TEXT DEFAULT ''"); err != nil {
+			return err
+		}
+		if err := execDDL(tx, `CREATE INDEX IF NOT EXISTS idx_payouts_route ON payouts(src_eid, dst_eid)`); err != nil {
+			return err
+		}
+		return backfillPayoutRoutes(tx)
+	}, func(tx *sqlTx) error {
+		if err := execDDL(tx, `DROP INDEX IF EXISTS idx_payouts_route`); err != nil {
+			return err
+		}
+		return dropColumns(tx, "payouts", "src_eid", "src_contract", "dst_contract")
+	}},
+
+	{8, "tokens", func(tx *sqlTx) error {
+		// 链上读取的代币元数据（配置中的代币不入库）
+		return execDDL(tx, `
+			CREATE TABLE IF NOT EXISTS tokens (
+				eid BIGINT NOT NULL,
+				address TEXT NOT NULL, -- EVM 校验和地址 / Solana mint
+				symbol TEXT DEFAULT '',
+				decimals INTEGER NOT NULL,
+				peg TEXT DEFAULT '',
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (eid, address)
+			);
+		`)
+	}, func(tx *sqlTx) error {
+		return execDDL(tx, `DROP TABLE IF EXISTS tokens`)
+	}},
+
+	{9, "solana_instructions", func(tx *sqlTx) error {
+		// 按 Anchor IDL 解码的 Solana 指令与事件
+		return execDDL(tx, `
+			CREATE TABLE IF NOT EXISTS solana_instructions (
+				signature TEXT NOT NULL,
+				kind TEXT NOT NULL, -- instruction / inner_instruction / event
+				idx INTEGER NOT NULL, -- 顶层指令序号 / 内部指令在交易中的序号 / 事件在日志中的序号
+				chain TEXT NOT NULL,
+				slot BIGINT NOT NULL,
+				block_time DATETIME,
+				program TEXT NOT NULL, -- IDL 中的程序名
+				name TEXT NOT NULL,
+				data TEXT NOT NULL, -- 解码后的参数与账户（JSON）
+				PRIMARY KEY (signature, kind, idx)
+			);
+			CREATE INDEX IF NOT EXISTS idx_solana_instructions_name ON solana_instructions(program, name);
+		`)
+	}, func(tx *sqlTx) error {
+		return execDDL(tx, `DROP TABLE IF EXISTS solana_instructions`)
+	}},
+
+	{10, "payouts_block_index", func(tx *sqlTx) error {
+		// payout 列表按 block_number 倒序分页，避免每次查询都对整张表排序
+		return execDDL(tx, `CREATE INDEX IF NOT EXISTS idx_payouts_block ON payouts(block_number)`)
+	}, func(tx *sqlTx) error {
+		return execDDL(tx, `DROP INDEX IF EXISTS idx_payouts_block`)
+	}},
+
+	{11, "events_block_time", func(tx *sqlTx) error {
+		// 原始事件的区块时间：重新索引时不再需要通过 RPC 读取区块头
+		return addColumns(tx, "events", "block_time DATETIME")
+	}, func(tx *sqlTx) error {
+		return dropColumns(tx, "events", "block_time")
+	}},
+
+	{12, "dead_letters", func(tx *sqlTx) error {
+		// 处理失败的事件：由重试协程按指数退避重新处理，或由管理员重试 / 丢弃
+		return execDDL(tx, `
+			CREATE TABLE IF NOT EXISTS dead_letters (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				chain TEXT NOT NULL,
+				tx_hash TEXT NOT NULL, -- EVM 交易哈希 / Solana 签名
+				log_index INTEGER NOT NULL, -- EVM 日志序号；Solana 为 0
+				block_number BIGINT NOT NULL,
+				block_hash TEXT DEFAULT '', -- 重组回滚该区块时一并丢弃
+				payload TEXT NOT NULL DEFAULT '', -- EVM 日志 JSON / Solana getTransaction 结果（未取到交易时为空）
+				error_class TEXT NOT NULL, -- decode / rpc / storage / other
+				error TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 1,
+				status TEXT NOT NULL, -- pending / exhausted / resolved / discarded
+				next_retry_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_dead_letters_event ON dead_letters(chain, tx_hash, log_index);
+			CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, next_retry_at);
+		`)
+	}, func(tx *sqlTx) error {
+		return execDDL(tx, `DROP TABLE IF EXISTS dead_letters`)
+	}},
+}
+
+// migrate 将 schema 升级到最新版本（OpenStore 时执行）
+func (s *Store) migrate() error {
+	if _, err := s.MigrateUp(0); err != nil {
+		return err
+	}
+	log.Printf("Store: database schema at version %d (%s).", latestMigration(), s.Driver())
+	return nil
+}
+
+// latestMigration 当前代码对应的 schema 版本
+func latestMigration() int {
+	return migrations[len(migrations)-1].version
+}
+
+// MigrationState 一个迁移的应用状态
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // 未应用时为零值
+}
+
+// ensureMigrationsTable 创建 schema_migrations（不属于任何迁移）
+func (s *Store) ensureMigrationsTable() error {
+	_, err := s.db.Exec(s.db.dialect.ddl(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`))
+	return err
+}
+
+// MigrationStatus 列出所有迁移及其状态（按版本号）；数据库中存在代码未知的版本时返回错误
+func (s *Store) MigrationStatus() ([]MigrationState, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at.UTC()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := applied[m.version]
+		states = append(states, MigrationState{Version: m.version, Name: m.name, Applied: ok, AppliedAt: at})
+		delete(applied, m.version)
+	}
+	if len(applied) > 0 {
+		var unknown []int
+		for v := range applied {
+			unknown = append(unknown, v)
+		}
+		sort.Ints(unknown)
+		return states, fmt.Errorf("database has migration(s) %v newer than this build (latest %d)", unknown, latestMigration())
+	}
+	return states, nil
+}
+
+// MigrateUp 依次应用未执行的迁移，直到版本 target（0 表示最新），返回本次应用的迁移
+func (s *Store) MigrateUp(target int) ([]MigrationState, error) {
+	if target == 0 {
+		target = latestMigration()
+	}
+	states, err := s.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []MigrationState
+	for i, st := range states {
+		if st.Applied || st.Version > target {
+			continue
+		}
+		if err := s.runMigration(migrations[i], true); err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", st.Version, st.Name, err)
+		}
+		log.Printf("Store: applied migration %d_%s", st.Version, st.Name)
+		done = append(done, st)
+	}
+	return done, nil
+}
+
+// MigrateDown 按版本号倒序回滚最近 steps 个已应用的迁移，返回本次回滚的迁移
+func (s *Store) MigrateDown(steps int) ([]MigrationState, error) {
+	states, err := s.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []MigrationState
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		st := states[i]
+		if !st.Applied {
+			continue
+		}
+		if err := s.runMigration(migrations[i], false); err != nil {
+			return done, fmt.Errorf("rolling back migration %d_%s: %w", st.Version, st.Name, err)
+		}
+		log.Printf("Store: rolled back migration %d_%s", st.Version, st.Name)
+		done = append(done, st)
+	}
+	return done, nil
+}
+
+// runMigration 在同一事务中执行迁移并更新 schema_migrations
+func (s *Store) runMigration(m migration, up bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if up {
+		if err := m.up(tx); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name)
+	} else {
+		if err := m.down(tx); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runMigrateCommand `migrate up [版本] | down [步数] | status`（使用 DB_DRIVER / DB_PATH / DATABASE_URL）
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up [version] | down [steps] | status")
+	}
+	n := 0
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid argument %q", args[1])
+		}
+		n = v
+	}
+
+	driver, dsn := storageConfigFromEnv()
+	s, err := openStore(driver, dsn, false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	switch args[0] {
+	case "up":
+		done, err := s.MigrateUp(n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", len(done))
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		done, err := s.MigrateDown(n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d migration(s)\n", len(done))
+	case "status":
+		states, err := s.MigrationStatus()
+		for _, st := range states {
+			applied := "pending"
+			if st.Applied {
+				applied = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-24s %s\n", st.Version, st.Name, applied)
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, down or status)", args[0])
+	}
+	return nil
+}
+
+// --------------------------- 迁移辅助 ---------------------------
+
+// sqlExecer sqlDB 与 sqlTx 的共同方法（数据修正在事务内外均可执行）
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	sqlDialect() dialect
+}
+
+// execDDL 按方言转换并执行 DDL（可包含多条语句）
+func execDDL(tx *sqlTx, stmts string) error {
+	_, err := tx.Exec(tx.dialect.ddl(stmts))
+	return err
+}
+
+// hasColumn 表中是否已有该字段
+func hasColumn(db sqlExecer, table, column string) (bool, error) {
+	var n int
+	err := db.QueryRow(db.sqlDialect().columnExistsQuery(), table, column).Scan(&n)
+	return n > 0, err
+}
+
+// addColumns 添加字段（形如 "name TYPE DEFAULT ..."），已存在的字段跳过
+func addColumns(tx *sqlTx, table string, defs ...string) error {
+	for _, def := range defs {
+		column := strings.Fields(def)[0]
+		ok, err := hasColumn(tx, table, column)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		if err := execDDL(tx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s`, table, def)); err != nil {
+			return fmt.Errorf("adding %s.%s column: %w", table, column, err)
+		}
+	}
+	return nil
+}
+
+// dropColumns 删除字段（不存在的字段跳过；SQLite 要求先删除引用该字段的索引）
+func dropColumns(tx *sqlTx, table string, columns ...string) error {
+	for _, column := range columns {
+		ok, err := hasColumn(tx, table, column)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := execDDL(tx, fmt.Sprintf(`ALTER TABLE %s DROP COLUMN %s`, table, column)); err != nil {
+			return fmt.Errorf("dropping %s.%s column: %w", table, column, err)
+		}
+	}
+	return nil
+}
+
+// --------------------------- 历史数据修正 ---------------------------
+
+// removeDeliveryLegPayouts 删除旧版 Solana 监听器以签名为键写入的 Delivered payout
+//
+// 这些行与源链 payout 重复计数；对应的执行已记录在 deliveries 中，由匹配逻辑关联到源链 payout。
+// 没有执行记录的旧行保留并告警（重新回填 Solana 后即可删除）。
+func removeDeliveryLegPayouts(db sqlExecer) error {
+	res, err := db.Exec(`
+		DELETE FROM payouts
+		WHERE tx_hash NOT LIKE '0x%' AND tx_hash IN (SELECT dst_tx_hash FROM deliveries)
+	`)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Store: removed %d Solana delivery payout(s) now tracked as deliveries", n)
+	}
+	var legacy int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM payouts WHERE tx_hash NOT LIKE '0x%'`).Scan(&legacy); err != nil {
+		return err
+	}
+	if legacy > 0 {
+		log.Printf("Store: WARNING %d legacy Solana payout(s) without delivery records; re-run the Solana backfill", legacy)
+	}
+	return nil
+}
+
+// migrateChainAddresses 将 payouts 中的地址统一为 ChainAddress.Key 形式（可重复执行）
+//
+//  1. solana_merchant / solana_payer 中的 Base58 原文写回 merchant / payer（旧版只存后 20 字节的伪 EVM 地址）；
+//  2. EVM 地址统一小写；
+//  3. Solana 目标链 payout 的 dst_token 由原始日志 data[32:64] 还原为完整 mint。
+//
+// 早于 solana_merchant 字段的 Solana payout 无法区分目标链类型，保持原样。
+func migrateChainAddresses(db sqlExecer) error {
+	// solana_merchant / solana_payer 只存在于版本化迁移之前建立的数据库
+	var moved int64
+	legacy, err := hasColumn(db, "payouts", "solana_merchant")
+	if err != nil {
+		return err
+	}
+	if legacy {
+		res, err := db.Exec(`
+			UPDATE payouts SET
+				merchant = CASE WHEN COALESCE(solana_merchant, '') != '' THEN solana_merchant ELSE merchant END,
+				payer = CASE WHEN COALESCE(solana_payer, '') != '' THEN solana_payer ELSE payer END,
+				solana_merchant = '', solana_payer = ''
+			WHERE COALESCE(solana_merchant, '') != '' OR COALESCE(solana_payer, '') != ''
+		`)
+		if err != nil {
+			return err
+		}
+		moved, _ = res.RowsAffected()
+	}
+
+	for _, col := range []string{"payer", "merchant", "dst_token"} {
+		if _, err := db.Exec(fmt.Sprintf(`UPDATE payouts SET %[1]s = LOWER(%[1]s) WHERE %[1]s LIKE '0x%%' AND %[1]s != LOWER(%[1]s)`, col)); err != nil {
+			return err
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT p.tx_hash, e.raw_log FROM payouts p
+		JOIN events e ON e.tx_hash = p.tx_hash
+		WHERE p.merchant NOT LIKE '0x%' AND p.dst_token LIKE '0x%'
+	`)
+	if err != nil {
+		return err
+	}
+	tokens := make(map[string]string)
+	for rows.Next() {
+		var txHash, raw string
+		if err := rows.Scan(&txHash, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		var vLog types.Log
+		if json.Unmarshal([]byte(raw), &vLog) != nil || len(vLog.Topics) < 4 || len(vLog.Data) < 64 ||
+			vLog.Topics[0] != payoutTopicByABIVersion[ABIVersionV2] {
+			continue
+		}
+		tokens[txHash] = ChainAddressFromBytes32(AddressNamespaceSolana, common.BytesToHash(vLog.Data[32:64])).Key()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for txHash, token := range tokens {
+		if _, err := db.Exec(`UPDATE payouts SET dst_token = ? WHERE tx_hash = ?`, token, txHash); err != nil {
+			return err
+		}
+	}
+	if moved > 0 || len(tokens) > 0 {
+		log.Printf("Store: migrated %d Solana merchant/payer address(es) and %d Solana dst_token(s) to canonical form", moved, len(tokens))
+	}
+	return nil
+}
+
+// backfillPayoutRoutes 为旧 payout 补齐源链 / 目标链信息（可重复执行）
+//
+//   - src_eid、dst_contract 取自同一 GUID 的 PacketSent（receiver 按 merchant 的地址命名空间解析）；
+//   - src_contract 取自原始日志中 TokenPayoutRequested 的发出合约。
+//
+// 没有 LayerZero 消息的旧数据由 BackfillPayoutSrcEIDs 按源链名称补齐 src_eid。
+func backfillPayoutRoutes(db sqlExecer) error {
+	if _, err := db.Exec(`
+		UPDATE payouts SET src_eid = (SELECT m.src_eid FROM lz_messages m WHERE m.guid = payouts.guid)
+		WHERE src_eid = 0 AND EXISTS (SELECT 1 FROM lz_messages m WHERE m.guid = payouts.guid)
+	`); err != nil {
+		return err
+	}
+
+	dstContracts := make(map[string]string) // tx_hash -> dst_contract
+	rows, err := db.Query(`
+		SELECT p.tx_hash, p.merchant, m.receiver FROM payouts p
+		JOIN lz_messages m ON m.guid = p.guid
+		WHERE COALESCE(p.dst_contract, '') = ''
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var txHash, merchant, receiver string
+		if err := rows.Scan(&txHash, &merchant, &receiver); err != nil {
+			rows.Close()
+			return err
+		}
+		if ns := storedChainAddress(merchant).Namespace(); ns != "" {
+			dstContracts[txHash] = ChainAddressFromBytes32(ns, common.HexToHash(receiver)).Key()
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	srcContracts := make(map[string]string) // tx_hash -> src_contract
+	rows, err = db.Query(`
+		SELECT p.tx_hash, e.raw_log FROM payouts p
+		JOIN events e ON e.tx_hash = p.tx_hash
+		WHERE COALESCE(p.src_contract, '') = ''
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var txHash, raw string
+		if err := rows.Scan(&txHash, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		var vLog types.Log
+		if json.Unmarshal([]byte(raw), &vLog) != nil || len(vLog.Topics) == 0 ||
+			(vLog.Topics[0] != payoutTopicByABIVersion[ABIVersionV1] && vLog.Topics[0] != payoutTopicByABIVersion[ABIVersionV2]) {
+			continue
+		}
+		srcContracts[txHash] = EVMChainAddress(vLog.Address).Key()
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for column, values := range map[string]map[string]string{"dst_contract": dstContracts, "src_contract": srcContracts} {
+		for txHash, v := range values {
+			if _, err := db.Exec(fmt.Sprintf(`UPDATE payouts SET %s = ? WHERE tx_hash = ?`, column), v, txHash); err != nil {
+				return err
+			}
+		}
+	}
+	if len(dstContracts) > 0 || len(srcContracts) > 0 {
+		log.Printf("Store: backfilled src_contract for %d and dst_contract for %d payout(s)", len(srcContracts), len(dstContracts))
+	}
+	return nil
+}
+
+// backfillDerivedFees 旧数据没有 fee_amount，按 gross - net 补齐（FEE_BPS 记为未知）
+func backfillDerivedFees(db sqlExecer) error {
+	rows, err := db.Query(`SELECT tx_hash, gross_amount, net_amount FROM payouts WHERE fee_amount IS NULL`)
+	if err != nil {
+		return err
+	}
+	fees := make(map[string]string)
+	for rows.Next() {
+		var txHash, grossStr, netStr string
+		if err := rows.Scan(&txHash, &grossStr, &netStr); err != nil {
+			rows.Close()
+			return err
+		}
+		gross, ok1 := new(big.Int).SetString(grossStr, 10)
+		net, ok2 := new(big.Int).SetString(netStr, 10)
+		fee := "0"
+		if ok1 && ok2 && gross.Cmp(net) >= 0 {
+			fee = new(big.Int).Sub(gross, net).String()
+		}
+		fees[txHash] = fee
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for txHash, fee := range fees {
+		if _, err := db.Exec(`UPDATE payouts SET fee_amount = ? WHERE tx_hash = ?`, fee, txHash); err != nil {
+			return err
+		}
+	}
+	if len(fees) > 0 {
+		log.Printf("Store: derived fee_amount for %d payouts indexed before fee tracking", len(fees))
+	}
+	return nil
+}
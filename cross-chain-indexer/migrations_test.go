@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func appliedVersions(t *testing.T, s *Store) []int {
+	t.Helper()
+	states, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	var applied []int
+	for _, st := range states {
+		if st.Applied {
+			if st.AppliedAt.IsZero() {
+				t.Errorf("migration %d applied without timestamp", st.Version)
+			}
+			applied = append(applied, st.Version)
+		}
+	}
+	return applied
+}
+
+// testMigrateDownUp 迁移可以完整回滚并重新应用（两个方言使用同一组迁移）
+func testMigrateDownUp(t *testing.T, s *Store) {
+	if got := appliedVersions(t, s); len(got) != len(migrations) {
+		t.Fatalf("applied = %v, want all %d", got, len(migrations))
+	}
+	insertTestPayout(t, s, "Base Sepolia", "0x01", 100, "0xblock100")
+
+	// 回滚最近一个迁移，再升级到最新
+	if done, err := s.MigrateDown(1); err != nil || len(done) != 1 || done[0].Version != latestMigration() {
+		t.Fatalf("MigrateDown(1) = %+v, %v", done, err)
+	}
+	if done, err := s.MigrateUp(0); err != nil || len(done) != 1 {
+		t.Fatalf("MigrateUp(0) = %+v, %v", done, err)
+	}
+
+	// 全部回滚后表被删除
+	if done, err := s.MigrateDown(len(migrations)); err != nil || len(done) != len(migrations) {
+		t.Fatalf("MigrateDown(all) = %d, %v", len(done), err)
+	}
+	if got := appliedVersions(t, s); len(got) != 0 {
+		t.Fatalf("applied after down = %v", got)
+	}
+	if _, err := s.GetEventCount(); err == nil {
+		t.Error("events table still exists after rolling back all migrations")
+	}
+
+	// 升级到指定版本，再到最新
+	if done, err := s.MigrateUp(3); err != nil || len(done) != 3 {
+		t.Fatalf("MigrateUp(3) = %d, %v", len(done), err)
+	}
+	if got := appliedVersions(t, s); len(got) != 3 || got[2] != 3 {
+		t.Fatalf("applied = %v, want [1 2 3]", got)
+	}
+	if _, err := s.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	insertTestPayout(t, s, "Base Sepolia", "0x01", 100, "0xblock100")
+	if p := payoutByTx(t, s, "0x01"); p.GrossAmount.Int64() != 100 || p.BlockHash != "0xblock100" {
+		t.Errorf("payout after re-migration = %+v", p)
+	}
+
+	// 数据库中有更新版本的迁移时拒绝升级
+	if _, err := s.db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, latestMigration()+1, "future"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigrateUp(0); err == nil {
+		t.Error("expected error for unknown migration version")
+	}
+}
+
+// TestMigrateLegacyDatabase 版本化迁移之前建立的 SQLite 数据库（无 schema_migrations、字段不全）
+func TestMigrateLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE events (
+			tx_hash TEXT NOT NULL, log_index INTEGER NOT NULL, block_number INTEGER NOT NULL,
+			raw_log TEXT NOT NULL, parsed INTEGER DEFAULT 0, chain TEXT DEFAULT '',
+			PRIMARY KEY (tx_hash, log_index)
+		);
+		CREATE TABLE payouts (
+			tx_hash TEXT PRIMARY KEY, block_number INTEGER NOT NULL, timestamp DATETIME NOT NULL,
+			dst_eid INTEGER NOT NULL, payer TEXT NOT NULL, merchant TEXT NOT NULL, src_token TEXT NOT NULL,
+			dst_token TEXT NOT NULL, gross_amount TEXT NOT NULL, net_amount TEXT NOT NULL, status TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			solana_merchant TEXT DEFAULT '', solana_payer TEXT DEFAULT '', block_hash TEXT DEFAULT ''
+		);
+		INSERT INTO payouts (tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token,
+			gross_amount, net_amount, status, solana_merchant)
+		VALUES ('0xa1', 1, '2026-01-01 00:00:00', 40168, '0x1A9C0A66CB68D92C598B0D2F10DE3C755EB6D438', '0x0', '0x0', '0x0',
+			'100', '97', 'Pending', '8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore on legacy database: %v", err)
+	}
+	defer s.Close()
+	if got := appliedVersions(t, s); len(got) != len(migrations) {
+		t.Fatalf("applied = %v, want all %d", got, len(migrations))
+	}
+	p := payoutByTx(t, s, "0xa1")
+	if p.Merchant.String() != "8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq" || p.FeeAmount.Int64() != 3 || p.FeeBps != -1 {
+		t.Errorf("legacy payout = %+v", p)
+	}
+}
@@ -6,33 +6,42 @@ import (
 	"fmt"           // 新增
 	"log"
 	"math/big"
+	"strings"
 	"time"
 
 	"cross-chain-indexer/contract"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-// Processor 负责解析 raw logs -> 业务记录，然后写入 Store（SQLite）
+// Processor 负责解析 raw logs -> 业务记录，然后写入 Storage
 type Processor struct {
-	client *ethclient.Client
-	store  *Store
+	chain  string
+	eid    uint32 // 源链 EID
+	client *EVMPool
+	store  Storage
+	fees   *FeeBpsReader
+
+	// packetSent 查找同一交易中的 PacketSent（与 payout 在同一事务中写入）；为空时不查找
+	packetSent func(ctx context.Context, vLog types.Log) (*LZMessage, error)
 }
 
-// NewProcessor 返回一个 Processor 实例
-func NewProcessor(client *ethclient.Client, store *Store) *Processor {
+// NewProcessor 返回一个 Processor 实例（chain 为源链名称，写入 events 表；eid 为源链 EID）
+func NewProcessor(chain string, eid uint32, client *EVMPool, store Storage, fees *FeeBpsReader) *Processor {
 	return &Processor{
+		chain:  chain,
+		eid:    eid,
 		client: client,
 		store:  store,
+		fees:   fees,
 	}
 }
 
 // ParseAndPersist:
-// 1) 将 raw log 写入 events 表（若已存在则跳过）
+// 1) 已处理过的 log（重放 / 重复推送）直接跳过
 // 2) 使用合约 binding 解析 TokenPayoutRequested 事件
-// 3) 将解析得到的业务记录 upsert 到 payouts 表
-// 4) 将 events 标记为 parsed
+// 3) 将 raw log、解析得到的 payout 与 PacketSent 在同一事务中写入，并将 events 标记为 parsed
 func (p *Processor) ParseAndPersist(ctx context.Context, vLog types.Log) error {
 	// 防御：必须有 topic
 	if len(vLog.Topics) == 0 {
@@ -40,63 +49,128 @@ func (p *Processor) ParseAndPersist(ctx context.Context, vLog types.Log) error {
 		return nil // 忽略无 topic 的 log
 	}
 
-	// 1) 序列化 Log 为 JSON 字符串，作为原始数据存储
-	rawLogBytes, err := json.Marshal(vLog)
+	// 1) 已处理过则无需重复解析（也省去下面的 RPC 调用）
+	if done, err := p.store.EventProcessed(vLog.TxHash.Hex(), vLog.Index); err != nil || done {
+		return classify(ErrorClassStorage, err)
+	}
+
+	// 2) 解析事件
+	rec, err := decodePayoutV1(vLog, p.eid)
 	if err != nil {
-		return fmt.Errorf("failed to marshal log to json: %w", err)
+		// 解析失败：只保存原始事件（parsed = 0），由调用方放入死信队列
+		if _, ierr := insertRawLog(p.store, p.chain, vLog); ierr != nil {
+			return classify(ErrorClassStorage, ierr)
+		}
+		return classify(ErrorClassDecode, err)
+	}
+
+	// 获取区块时间戳
+	header, err := p.client.HeaderByNumber(ctx, new(big.Int).SetUint64(vLog.BlockNumber))
+	var blockTime time.Time
+	if err != nil || header == nil {
+		// 取不到区块头时使用当前时间（并记录日志；原始事件不记录区块时间）
+		log.Printf("processor: warning couldn't get header for block %d: %v", vLog.BlockNumber, err)
+		rec.Timestamp = time.Now().UTC()
+	} else {
+		blockTime = time.Unix(int64(header.Time), 0).UTC()
+		rec.Timestamp = blockTime
+	}
+	rec.FeeBps, rec.FeeIssue = validateFee(ctx, p.fees, vLog.Address, rec.GrossAmount, rec.NetAmount, rec.FeeAmount, rec.TxHash)
+
+	var packet *LZMessage
+	if p.packetSent != nil {
+		if packet, err = p.packetSent(ctx, vLog); err != nil {
+			return err
+		}
+	}
+
+	// 3) raw log + payout + PacketSent 同一事务写入
+	if _, err := persistLog(p.store, p.chain, vLog, blockTime, EventEffects{Payout: &rec, PacketSent: packet}); err != nil {
+		return classify(ErrorClassStorage, err)
 	}
-	rawLog := string(rawLogBytes)
+	return nil
+}
 
-	// 2) 将原始 log 写入 events 表（若已存在则跳过）
-	inserted, err := p.store.InsertEventIfNotExists(
-		vLog.TxHash.Hex(),
-		vLog.Index,
-		vLog.BlockNumber,
-		rawLog,
-	)
+// rawLogEvent 序列化 Log 为 JSON 字符串，作为原始数据写入 events 表（blockTime 未知时为零值）
+func rawLogEvent(chain string, vLog types.Log, blockTime time.Time) (EventRecord, error) {
+	rawLogBytes, err := json.Marshal(vLog)
 	if err != nil {
-		return fmt.Errorf("insert event failed: %w", err)
+		return EventRecord{}, fmt.Errorf("failed to marshal log to json: %w", err)
 	}
+	return EventRecord{
+		Chain:       chain,
+		TxHash:      vLog.TxHash.Hex(),
+		LogIndex:    vLog.Index,
+		BlockNumber: vLog.BlockNumber,
+		BlockHash:   vLog.BlockHash.Hex(),
+		BlockTime:   blockTime,
+		RawLog:      string(rawLogBytes),
+	}, nil
+}
 
-	// 如果 log 已经存在（被跳过），则无需重复解析和处理
-	if !inserted {
-		return nil
+// persistLog 将 raw log 与派生记录在同一事务中写入（已处理过的 log 不重复写入）
+func persistLog(store Storage, chain string, vLog types.Log, blockTime time.Time, fx EventEffects) (EventResult, error) {
+	ev, err := rawLogEvent(chain, vLog, blockTime)
+	if err != nil {
+		return EventResult{}, err
+	}
+	res, err := store.PersistEvent(ev, fx)
+	if err != nil {
+		return res, fmt.Errorf("persist event failed: %w", err)
 	}
+	return res, nil
+}
 
-	// 3) 解析事件
-	event, err := p.parseEvent(vLog)
+// insertRawLog 只写入 raw log（解析失败时保存原始数据，parsed = 0）
+func insertRawLog(store Storage, chain string, vLog types.Log) (bool, error) {
+	ev, err := rawLogEvent(chain, vLog, time.Time{})
+	if err != nil {
+		return false, err
+	}
+	inserted, err := store.InsertEventIfNotExists(ev.Chain, ev.TxHash, ev.LogIndex, ev.BlockNumber, ev.BlockHash, ev.RawLog)
 	if err != nil {
-		// 解析失败，但原始事件已存。继续处理下一个 log。
-		log.Printf("processor: failed to parse log (tx=%s, idx=%d): %v", vLog.TxHash.Hex(), vLog.Index, err)
-		return nil
+		return false, fmt.Errorf("insert event failed: %w", err)
 	}
+	return inserted, nil
+}
 
-	// 4) 获取区块时间戳
-	header, err := p.client.HeaderByNumber(ctx, new(big.Int).SetUint64(vLog.BlockNumber))
-	var ts time.Time
-	if err != nil || header == nil {
-		// 取不到区块头时使用当前时间（并记录日志）
-		log.Printf("processor: warning couldn't get header for block %d: %v", vLog.BlockNumber, err)
-		ts = time.Now().UTC()
-	} else {
-		ts = time.Unix(int64(header.Time), 0).UTC()
+// decodePayoutLog 按合约 ABI 版本将 TokenPayoutRequested 日志解码为 payout（不访问 RPC）
+//
+// 返回的记录不含区块时间与 FeeBps / FeeIssue，由调用方补齐。
+func decodePayoutLog(vLog types.Log, abiVersion string, srcEID uint32) (PayoutRecord, error) {
+	if abiVersion == ABIVersionV1 {
+		return decodePayoutV1(vLog, srcEID)
+	}
+	return decodePayoutV2(vLog, srcEID)
+}
+
+// decodePayoutV1 使用合约 binding 解析旧版 TokenPayoutRequested（merchant / dstToken 均为 EVM 地址）
+func decodePayoutV1(vLog types.Log, srcEID uint32) (PayoutRecord, error) {
+	filterer, err := contract.NewMyOAppFilterer(vLog.Address, nil)
+	if err != nil {
+		return PayoutRecord{}, fmt.Errorf("failed to instantiate contract: %w", err)
+	}
+	event, err := filterer.ParseTokenPayoutRequested(vLog)
+	if err != nil {
+		return PayoutRecord{}, fmt.Errorf("failed to parse TokenPayoutRequested event: %w", err)
 	}
 
-	// 5) 构造 PayoutRecord
 	rec := PayoutRecord{
 		TxHash:      vLog.TxHash.Hex(),
 		BlockNumber: int64(vLog.BlockNumber),
+		SrcEid:      int64(srcEID),
+		SrcContract: EVMChainAddress(vLog.Address),
 		DstEid:      int64(event.DstEid),
-		Payer:       event.Payer,
-		Merchant:    event.Merchant,
+		Payer:       EVMChainAddress(event.Payer),
+		Merchant:    EVMChainAddress(event.Merchant),
 		SrcToken:    event.SrcToken,
-		DstToken:    event.DstToken,
+		DstToken:    EVMChainAddress(event.DstToken),
 		GrossAmount: event.GrossAmount,
 		NetAmount:   event.NetAmount,
-		Status:      "Pending",
-		Timestamp:   ts,
+		FeeAmount:   event.FeeAmount,
+		Status:      PayoutStatusPending,
+		BlockHash:   vLog.BlockHash.Hex(),
 	}
-
 	// safety: if NetAmount nil, still proceed but log
 	if rec.NetAmount == nil {
 		log.Printf("processor: warning net amount nil for tx %s", rec.TxHash)
@@ -105,37 +179,48 @@ func (p *Processor) ParseAndPersist(ctx context.Context, vLog types.Log) error {
 	if rec.GrossAmount == nil {
 		rec.GrossAmount = big.NewInt(0)
 	}
-
-	// 6) Upsert payout 到 DB
-	if err := p.store.UpsertPayout(rec); err != nil {
-		log.Printf("processor: failed to upsert payout for tx %s: %v", rec.TxHash, err)
-		return fmt.Errorf("upsert payout failed: %w", err)
-	}
-
-	// 7) 标记 events 表中的 log 为已解析
-	if err := p.store.MarkEventAsParsed(vLog.TxHash.Hex(), vLog.Index); err != nil {
-		log.Printf("processor: failed to mark event as parsed for tx %s: %v", vLog.TxHash.Hex(), err)
-	}
-
-	return nil
+	return rec, nil
 }
 
-// parseEvent 解析具体的 TokenPayoutRequested 事件
-func (p *Processor) parseEvent(vLog types.Log) (*contract.MyOAppTokenPayoutRequested, error) {
-	// ContractAddress hardcode，但在 main.go 中统一配置可能更好
-	oappAddr := vLog.Address
-
-	// 实例化合约绑定
-	oapp, err := contract.NewMyOApp(oappAddr, p.client)
-	if err != nil {
-		return nil, fmt.Errorf("failed to instantiate contract: %w", err)
+// decodePayoutV2 解析新版 TokenPayoutRequested（merchant / dstToken 为 bytes32）
+//
+//	event TokenPayoutRequested(
+//	    uint32 indexed dstEid,
+//	    address indexed payer,
+//	    bytes32 indexed merchant,
+//	    address srcToken,
+//	    bytes32 dstToken,
+//	    uint256 grossAmount,
+//	    uint256 netAmount,
+//	    uint256 feeAmount
+//	)
+func decodePayoutV2(vLog types.Log, srcEID uint32) (PayoutRecord, error) {
+	if len(vLog.Topics) < 4 {
+		return PayoutRecord{}, fmt.Errorf("invalid log topics length: %d", len(vLog.Topics))
 	}
-
-	// 解析事件
-	event, err := oapp.ParseTokenPayoutRequested(vLog)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse TokenPayoutRequested event: %w", err)
+	// data = (srcToken, dstToken, grossAmount, netAmount, feeAmount)
+	if len(vLog.Data) < 160 { // 5 * 32 bytes
+		return PayoutRecord{}, fmt.Errorf("invalid log data length: %d", len(vLog.Data))
 	}
 
-	return event, nil
+	dstEid := uint32(vLog.Topics[1].Big().Uint64())
+	// merchant / dstToken 为 bytes32：按目标链的地址命名空间解析（EVM 取后 20 字节，Solana 为完整公钥）
+	dstNamespace := addressNamespaceForEID(int64(dstEid))
+
+	return PayoutRecord{
+		TxHash:      strings.ToLower(vLog.TxHash.Hex()),
+		BlockNumber: int64(vLog.BlockNumber),
+		SrcEid:      int64(srcEID),
+		SrcContract: EVMChainAddress(vLog.Address),
+		DstEid:      int64(dstEid),
+		Payer:       EVMChainAddress(common.BytesToAddress(vLog.Topics[2].Bytes())),
+		Merchant:    ChainAddressFromBytes32(dstNamespace, vLog.Topics[3]),
+		SrcToken:    common.BytesToAddress(vLog.Data[0:32]),
+		DstToken:    ChainAddressFromBytes32(dstNamespace, common.BytesToHash(vLog.Data[32:64])),
+		GrossAmount: new(big.Int).SetBytes(vLog.Data[64:96]),
+		NetAmount:   new(big.Int).SetBytes(vLog.Data[96:128]),
+		FeeAmount:   new(big.Int).SetBytes(vLog.Data[128:160]),
+		Status:      PayoutStatusPending,
+		BlockHash:   vLog.BlockHash.Hex(),
+	}, nil
 }
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gagliardetto/solana-go"
+)
+
+// 网络类型
+const (
+	NetworkTypeEVM    = "evm"
+	NetworkTypeSolana = "solana"
+)
+
+// Solana 程序角色
+const (
+	ProgramRoleTransfer = "transfer" // transfer_contract（transfer_out 出金）
+	ProgramRoleOApp     = "oapp"     // my_oapp（LayerZero OApp）
+)
+
+// 默认配置文件路径（可通过 CHAIN_CONFIG 环境变量覆盖）
+const defaultChainConfigPath = "config/chains.json"
+
+// 默认送达 SLA：超过该时长仍未送达的 payout 标记为 Stuck
+const defaultDeliverySLA = 30 * time.Minute
+
+// RPCConfig RPC 端点：主端点与备用端点组成 RPC 池，每次调用按健康状况选择端点
+type RPCConfig struct {
+	WSS   string `json:"wss,omitempty"`
+	HTTPS string `json:"https"`
+	// RequestsPerSecond HTTPS 端点的请求预算（默认 10）
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	// Fallbacks 备用端点（未配置 requests_per_second 时沿用主端点的预算）
+	Fallbacks []RPCEndpoint `json:"fallbacks,omitempty"`
+	// MaxHeadLag 端点落后最高端点超过该区块 / slot 数时视为不健康（默认 EVM 64、Solana 150）
+	MaxHeadLag uint64 `json:"max_head_lag,omitempty"`
+}
+
+// Endpoints 主端点在前、备用端点在后的端点列表
+func (r RPCConfig) Endpoints() []RPCEndpoint {
+	eps := []RPCEndpoint{{HTTPS: r.HTTPS, WSS: r.WSS, RequestsPerSecond: r.RequestsPerSecond}}
+	for _, fb := range r.Fallbacks {
+		if fb.RequestsPerSecond == 0 {
+			fb.RequestsPerSecond = r.RequestsPerSecond
+		}
+		eps = append(eps, fb)
+	}
+	return eps
+}
+
+// ContractConfig EVM 合约配置
+type ContractConfig struct {
+	Name       string `json:"name,omitempty"`
+	Address    string `json:"address"`
+	ABIVersion string `json:"abi_version"`
+	StartBlock uint64 `json:"start_block,omitempty"`
+}
+
+// ProgramConfig Solana 程序配置
+type ProgramConfig struct {
+	Name      string `json:"name,omitempty"`
+	ProgramID string `json:"program_id"`
+	Role      string `json:"role"`
+	StartSlot uint64 `json:"start_slot,omitempty"`
+	IDL       string `json:"idl,omitempty"` // Anchor IDL 路径（为空时使用内置 IDL）
+}
+
+// TokenConfig 代币配置（address 为 EVM 合约地址或 Solana mint）
+type TokenConfig struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+	Peg      string `json:"peg,omitempty"` // 锚定的法币（如 "USD"），非稳定币留空
+}
+
+// NetworkConfig 单个网络配置
+type NetworkConfig struct {
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`
+	EID           uint32            `json:"eid"`
+	ChainID       uint64            `json:"chain_id,omitempty"`
+	Enabled       *bool             `json:"enabled,omitempty"`
+	RPC           RPCConfig         `json:"rpc"`
+	BackfillDepth uint64            `json:"backfill_depth,omitempty"`
+	Confirmations uint64            `json:"confirmations,omitempty"`
+	Backfill      BackfillOptions   `json:"backfill,omitempty"`
+	Processing    ProcessingOptions `json:"processing,omitempty"`
+	Endpoint      string            `json:"endpoint,omitempty"` // LayerZero EndpointV2 地址（EVM，用于捕获 LzReceiveAlert）
+	Contracts     []ContractConfig  `json:"contracts,omitempty"`
+	Programs      []ProgramConfig   `json:"programs,omitempty"`
+	Tokens        []TokenConfig     `json:"tokens,omitempty"`
+}
+
+// IsEnabled 未显式配置 enabled 时默认启用
+func (n NetworkConfig) IsEnabled() bool {
+	return n.Enabled == nil || *n.Enabled
+}
+
+// IsSolana 是否为 Solana 网络
+func (n NetworkConfig) IsSolana() bool {
+	return n.Type == NetworkTypeSolana
+}
+
+// Program 按角色查找 Solana 程序
+func (n NetworkConfig) Program(role string) (ProgramConfig, bool) {
+	for _, p := range n.Programs {
+		if p.Role == role {
+			return p, true
+		}
+	}
+	return ProgramConfig{}, false
+}
+
+// EVMChainConfig 转换为 EVM 监听器配置
+func (n NetworkConfig) EVMChainConfig() EVMChainConfig {
+	cfg := EVMChainConfig{
+		Name:          n.Name,
+		EID:           n.EID,
+		RPC:           n.RPC.Endpoints(),
+		MaxHeadLag:    n.RPC.MaxHeadLag,
+		BackfillDepth: n.BackfillDepth,
+		Confirmations: n.Confirmations,
+		Backfill:      n.Backfill,
+		Processing:    n.Processing,
+	}
+	if n.Endpoint != "" {
+		cfg.Endpoint = common.HexToAddress(n.Endpoint)
+	}
+	for _, c := range n.Contracts {
+		cfg.Contracts = append(cfg.Contracts, EVMContract{
+			Address:    common.HexToAddress(c.Address),
+			ABIVersion: c.ABIVersion,
+			StartBlock: c.StartBlock,
+		})
+	}
+	return cfg
+}
+
+// SolanaChainConfig 转换为 Solana 监听器配置
+func (n NetworkConfig) SolanaChainConfig() SolanaChainConfig {
+	program, _ := n.Program(ProgramRoleTransfer)
+	oapp, _ := n.Program(ProgramRoleOApp)
+	return SolanaChainConfig{
+		Name:          n.Name,
+		EID:           n.EID,
+		RPC:           n.RPC.Endpoints(),
+		MaxHeadLag:    n.RPC.MaxHeadLag,
+		Program:       program,
+		OApp:          oapp,
+		BackfillDepth: n.BackfillDepth,
+		Backfill:      n.Backfill,
+		Processing:    n.Processing,
+	}
+}
+
+// Duration JSON 中以字符串表示的时长（如 "15m"）
+type Duration time.Duration
+
+// UnmarshalJSON 解析 time.ParseDuration 格式的字符串
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON 输出字符串形式
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// RouteSLA 单条路由 (srcEid -> dstEid) 的送达时限
+type RouteSLA struct {
+	SrcEid  uint32   `json:"src_eid"`
+	DstEid  uint32   `json:"dst_eid"`
+	Timeout Duration `json:"timeout"`
+}
+
+// SLAConfig 送达 SLA 配置
+type SLAConfig struct {
+	Default Duration   `json:"default,omitempty"` // 未单独配置的路由使用（默认 30m）
+	Routes  []RouteSLA `json:"routes,omitempty"`
+}
+
+// ChainRegistry 网络与合约注册表（所有监听器、API 与 Dashboard 共用）
+type ChainRegistry struct {
+	Networks []NetworkConfig `json:"networks"`
+	SLA      SLAConfig       `json:"sla,omitempty"`
+
+	byEID map[uint32]int
+}
+
+// 全局注册表（在 main 中加载）
+var chainRegistry *ChainRegistry
+
+// LoadChainRegistry 从 JSON 文件加载并校验注册表
+func LoadChainRegistry(path string) (*ChainRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read chain config %s: %w", path, err)
+	}
+	return ParseChainRegistry(data)
+}
+
+// ParseChainRegistry 解析并校验注册表
+func ParseChainRegistry(data []byte) (*ChainRegistry, error) {
+	var reg ChainRegistry
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&reg); err != nil {
+		return nil, fmt.Errorf("parse chain config: %w", err)
+	}
+	if err := reg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid chain config: %w", err)
+	}
+	return &reg, nil
+}
+
+// validate 校验配置并建立索引
+func (r *ChainRegistry) validate() error {
+	if len(r.Networks) == 0 {
+		return fmt.Errorf("no networks configured")
+	}
+	r.byEID = make(map[uint32]int, len(r.Networks))
+	names := make(map[string]bool, len(r.Networks))
+
+	for i, n := range r.Networks {
+		if n.Name == "" {
+			return fmt.Errorf("networks[%d]: name is required", i)
+		}
+		if names[n.Name] {
+			return fmt.Errorf("network %q: duplicate name", n.Name)
+		}
+		names[n.Name] = true
+		if n.EID == 0 {
+			return fmt.Errorf("network %q: eid is required", n.Name)
+		}
+		if _, dup := r.byEID[n.EID]; dup {
+			return fmt.Errorf("network %q: duplicate eid %d", n.Name, n.EID)
+		}
+		r.byEID[n.EID] = i
+
+		for _, t := range n.Tokens {
+			if _, ok := canonicalTokenAddress(n, t.Address); !ok {
+				return fmt.Errorf("network %q: invalid token address %q", n.Name, t.Address)
+			}
+			if t.Symbol == "" {
+				return fmt.Errorf("network %q: token %s: symbol is required", n.Name, t.Address)
+			}
+			if t.Decimals > maxTokenDecimals {
+				return fmt.Errorf("network %q: token %s: decimals %d out of range", n.Name, t.Address, t.Decimals)
+			}
+		}
+
+		if !n.IsEnabled() {
+			continue
+		}
+		if n.RPC.HTTPS == "" {
+			return fmt.Errorf("network %q: rpc.https is required", n.Name)
+		}
+		if n.RPC.RequestsPerSecond < 0 {
+			return fmt.Errorf("network %q: rpc.requests_per_second must not be negative", n.Name)
+		}
+		for i, fb := range n.RPC.Fallbacks {
+			if fb.HTTPS == "" {
+				return fmt.Errorf("network %q: rpc.fallbacks[%d].https is required", n.Name, i)
+			}
+			if fb.RequestsPerSecond < 0 {
+				return fmt.Errorf("network %q: rpc.fallbacks[%d].requests_per_second must not be negative", n.Name, i)
+			}
+		}
+		if n.Backfill.Concurrency < 0 || n.Backfill.MaxRetries < 0 {
+			return fmt.Errorf("network %q: backfill concurrency and max_retries must not be negative", n.Name)
+		}
+		if n.Processing.Workers < 0 || n.Processing.QueueSize < 0 {
+			return fmt.Errorf("network %q: processing workers and queue_size must not be negative", n.Name)
+		}
+
+		switch n.Type {
+		case NetworkTypeEVM:
+			if n.Endpoint != "" && !common.IsHexAddress(n.Endpoint) {
+				return fmt.Errorf("network %q: invalid endpoint address %q", n.Name, n.Endpoint)
+			}
+			if len(n.Contracts) == 0 {
+				return fmt.Errorf("network %q: at least one contract is required", n.Name)
+			}
+			for _, c := range n.Contracts {
+				if !common.IsHexAddress(c.Address) {
+					return fmt.Errorf("network %q: invalid contract address %q", n.Name, c.Address)
+				}
+				if _, ok := payoutTopicByABIVersion[c.ABIVersion]; !ok {
+					return fmt.Errorf("network %q: contract %s has unsupported abi_version %q", n.Name, c.Address, c.ABIVersion)
+				}
+			}
+		case NetworkTypeSolana:
+			if len(n.Programs) == 0 {
+				return fmt.Errorf("network %q: at least one program is required", n.Name)
+			}
+			for _, p := range n.Programs {
+				if _, err := solana.PublicKeyFromBase58(p.ProgramID); err != nil {
+					return fmt.Errorf("network %q: invalid program_id %q: %v", n.Name, p.ProgramID, err)
+				}
+				if p.Role != ProgramRoleTransfer && p.Role != ProgramRoleOApp {
+					return fmt.Errorf("network %q: program %s has unsupported role %q", n.Name, p.ProgramID, p.Role)
+				}
+				if _, err := loadProgramIDL(p); err != nil {
+					return fmt.Errorf("network %q: %w", n.Name, err)
+				}
+			}
+			if _, ok := n.Program(ProgramRoleTransfer); !ok {
+				return fmt.Errorf("network %q: a %q program is required", n.Name, ProgramRoleTransfer)
+			}
+		default:
+			return fmt.Errorf("network %q: unsupported type %q", n.Name, n.Type)
+		}
+	}
+
+	if r.SLA.Default < 0 {
+		return fmt.Errorf("sla.default must not be negative")
+	}
+	for _, route := range r.SLA.Routes {
+		if _, ok := r.byEID[route.SrcEid]; !ok {
+			return fmt.Errorf("sla route %d->%d: unknown src_eid", route.SrcEid, route.DstEid)
+		}
+		if _, ok := r.byEID[route.DstEid]; !ok {
+			return fmt.Errorf("sla route %d->%d: unknown dst_eid", route.SrcEid, route.DstEid)
+		}
+		if route.Timeout <= 0 {
+			return fmt.Errorf("sla route %d->%d: timeout must be positive", route.SrcEid, route.DstEid)
+		}
+	}
+	return nil
+}
+
+// RouteSLA 路由 (srcEid -> dstEid) 的送达时限
+func (r *ChainRegistry) RouteSLA(srcEid, dstEid uint32) time.Duration {
+	if r != nil {
+		for _, route := range r.SLA.Routes {
+			if route.SrcEid == srcEid && route.DstEid == dstEid {
+				return time.Duration(route.Timeout)
+			}
+		}
+		if r.SLA.Default > 0 {
+			return time.Duration(r.SLA.Default)
+		}
+	}
+	return defaultDeliverySLA
+}
+
+// NetworkByEID 按 LayerZero EID 查找网络
+func (r *ChainRegistry) NetworkByEID(eid uint32) (NetworkConfig, bool) {
+	if r == nil {
+		return NetworkConfig{}, false
+	}
+	i, ok := r.byEID[eid]
+	if !ok {
+		return NetworkConfig{}, false
+	}
+	return r.Networks[i], true
+}
+
+// EnabledNetworks 返回所有启用的网络
+func (r *ChainRegistry) EnabledNetworks() []NetworkConfig {
+	var out []NetworkConfig
+	for _, n := range r.Networks {
+		if n.IsEnabled() {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseChainRegistry(t *testing.T) {
+	valid := `{
+		"networks": [
+			{"name": "Base Sepolia", "type": "evm", "eid": 40245,
+			 "rpc": {"https": "https://base-sepolia.example", "requests_per_second": 5,
+			         "fallbacks": [{"https": "https://base-backup.example", "wss": "wss://base-backup.example"}]},
+			 "contracts": [{"address": "0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6", "abi_version": "v2"}]},
+			{"name": "Solana Devnet", "type": "solana", "eid": 40168,
+			 "rpc": {"https": "https://solana-devnet.example"},
+			 "programs": [{"program_id": "GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1", "role": "transfer"}]}
+		]
+	}`
+
+	reg, err := ParseChainRegistry([]byte(valid))
+	if err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	n, ok := reg.NetworkByEID(40168)
+	if !ok || n.Name != "Solana Devnet" || !n.IsSolana() {
+		t.Errorf("NetworkByEID(40168) = %+v, %v", n, ok)
+	}
+	if _, ok := reg.NetworkByEID(1); ok {
+		t.Error("unknown EID should not resolve")
+	}
+	base, _ := reg.NetworkByEID(40245)
+	eps := base.EVMChainConfig().RPC
+	if len(eps) != 2 || eps[0].HTTPS != "https://base-sepolia.example" || eps[1].WSS != "wss://base-backup.example" || eps[1].RequestsPerSecond != 5 {
+		t.Errorf("rpc endpoints = %+v", eps)
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "DuplicateEID",
+			config:  `{"networks":[{"name":"A","type":"evm","eid":1,"rpc":{"https":"x"},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}]},{"name":"B","type":"evm","eid":1,"rpc":{"https":"x"},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}]}]}`,
+			wantErr: "duplicate eid",
+		},
+		{
+			name:    "BadABIVersion",
+			config:  `{"networks":[{"name":"A","type":"evm","eid":1,"rpc":{"https":"x"},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v9"}]}]}`,
+			wantErr: "unsupported abi_version",
+		},
+		{
+			name:    "BadContractAddress",
+			config:  `{"networks":[{"name":"A","type":"evm","eid":1,"rpc":{"https":"x"},"contracts":[{"address":"0x1234","abi_version":"v2"}]}]}`,
+			wantErr: "invalid contract address",
+		},
+		{
+			name:    "MissingTransferProgram",
+			config:  `{"networks":[{"name":"S","type":"solana","eid":2,"rpc":{"https":"x"},"programs":[{"program_id":"GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1","role":"oapp"}]}]}`,
+			wantErr: "program is required",
+		},
+		{
+			name:    "MissingIDL",
+			config:  `{"networks":[{"name":"S","type":"solana","eid":2,"rpc":{"https":"x"},"programs":[{"program_id":"GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1","role":"transfer","idl":"testdata/missing_idl.json"}]}]}`,
+			wantErr: "read idl",
+		},
+		{
+			name:    "BadTokenAddress",
+			config:  `{"networks":[{"name":"S","type":"solana","eid":2,"rpc":{"https":"x"},"programs":[{"program_id":"GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1","role":"transfer"}],"tokens":[{"address":"0x036CbD53842c5426634e7929541eC2318f3dCF7e","symbol":"USDC","decimals":6}]}]}`,
+			wantErr: "invalid token address",
+		},
+		{
+			name:    "BadSLARoute",
+			config:  `{"networks":[{"name":"A","type":"evm","eid":2,"rpc":{"https":"x"},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}]}],"sla":{"routes":[{"src_eid":1,"dst_eid":2,"timeout":"10m"}]}}`,
+			wantErr: "unknown src_eid",
+		},
+		{
+			name:    "BadSLADuration",
+			config:  `{"networks":[],"sla":{"default":"soon"}}`,
+			wantErr: "invalid duration",
+		},
+		{
+			name:    "NegativeWorkers",
+			config:  `{"networks":[{"name":"A","type":"evm","eid":1,"rpc":{"https":"x"},"processing":{"workers":-1},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}]}]}`,
+			wantErr: "processing workers",
+		},
+		{
+			name:    "FallbackWithoutHTTPS",
+			config:  `{"networks":[{"name":"A","type":"evm","eid":1,"rpc":{"https":"x","fallbacks":[{"wss":"wss://y"}]},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}]}]}`,
+			wantErr: "rpc.fallbacks[0].https is required",
+		},
+		{
+			name:    "UnknownField",
+			config:  `{"networks":[],"rpc_url":"x"}`,
+			wantErr: "unknown field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseChainRegistry([]byte(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRouteSLA(t *testing.T) {
+	reg, err := ParseChainRegistry([]byte(`{
+		"networks": [
+			{"name": "Base Sepolia", "type": "evm", "eid": 40245, "rpc": {"https": "x"},
+			 "contracts": [{"address": "0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6", "abi_version": "v2"}]},
+			{"name": "Arbitrum Sepolia", "type": "evm", "eid": 40231, "rpc": {"https": "x"},
+			 "endpoint": "0x6EDCE65403992e310A62460808c4b910D972f10f",
+			 "contracts": [{"address": "0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438", "abi_version": "v2"}]}
+		],
+		"sla": {"default": "10m", "routes": [{"src_eid": 40245, "dst_eid": 40231, "timeout": "1h30m"}]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reg.RouteSLA(40245, 40231); got != 90*time.Minute {
+		t.Errorf("RouteSLA(40245, 40231) = %s, want 1h30m", got)
+	}
+	if got := reg.RouteSLA(40231, 40245); got != 10*time.Minute {
+		t.Errorf("RouteSLA(40231, 40245) = %s, want default 10m", got)
+	}
+
+	empty := &ChainRegistry{}
+	if got := empty.RouteSLA(1, 2); got != defaultDeliverySLA {
+		t.Errorf("RouteSLA without config = %s, want %s", got, defaultDeliverySLA)
+	}
+}
+
+func TestShippedChainConfigIsValid(t *testing.T) {
+	if _, err := LoadChainRegistry(defaultChainConfigPath); err != nil {
+		t.Fatalf("config/chains.json: %v", err)
+	}
+}
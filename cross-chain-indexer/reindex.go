@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// --------------------------- 重新索引 ---------------------------
+
+// reindexPageSize 每次从 events 读取的原始事件数
+const reindexPageSize = 500
+
+// ReindexOptions 重新索引的范围（均为空表示全部）
+type ReindexOptions struct {
+	Chain     string `json:"chain"`
+	Contract  string `json:"contract"` // EVM 合约地址或 Solana 程序 ID
+	FromBlock uint64 `json:"from_block"`
+	ToBlock   uint64 `json:"to_block"` // Solana 为 slot；0 表示不限
+	DryRun    bool   `json:"dry_run"`
+}
+
+// ReindexReport 重新索引的结果；DryRun 时 Changes 为将要发生的变化，不写入数据库
+type ReindexReport struct {
+	DryRun    bool           `json:"dry_run"`
+	Scanned   int            `json:"scanned"`   // 范围内的原始事件
+	Decoded   int            `json:"decoded"`   // 重新解码的事件（payout 请求日志与 Solana 交易）
+	Skipped   int            `json:"skipped"`   // 不属于指定合约、或不派生 payout 的 EVM 日志（执行 / 告警）
+	Unchanged int            `json:"unchanged"` // 解码结果与现有 payout 相同
+	Written   int            `json:"written"`   // 重新写入的事件（DryRun 时为将要写入的）
+	Changes   []PayoutChange `json:"changes"`
+	Errors    []ReindexError `json:"errors,omitempty"`
+}
+
+// PayoutChange 一条 payout 的变化（Action 为 create 时 Fields 为空）
+type PayoutChange struct {
+	Chain    string        `json:"chain"`
+	TxHash   string        `json:"tx_hash"`
+	LogIndex uint          `json:"log_index"`
+	Action   string        `json:"action"` // create | update
+	Fields   []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange payout 的一个字段的新旧值
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// 后台重新索引任务状态
+const (
+	ReindexJobRunning = "running"
+	ReindexJobDone    = "done"
+	ReindexJobFailed  = "failed"
+)
+
+// errReindexRunning 已有重新索引任务在执行（同一时间只允许一个，避免两次重放交错写入）
+var errReindexRunning = errors.New("a reindex is already running")
+
+// ReindexJob 后台重新索引任务（POST /admin/reindex 启动，GET /admin/reindex 查询）
+type ReindexJob struct {
+	ID         int64          `json:"id"`
+	Status     string         `json:"status"` // running | done | failed
+	Options    ReindexOptions `json:"options"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Report     *ReindexReport `json:"report,omitempty"` // 完成后返回
+	Error      string         `json:"error,omitempty"`
+}
+
+// ReindexError 无法重新解码的原始事件
+type ReindexError struct {
+	Chain    string `json:"chain"`
+	TxHash   string `json:"tx_hash"`
+	LogIndex uint   `json:"log_index"`
+	Error    string `json:"error"`
+}
+
+// Reindexer 对 events 中保存的原始事件重新运行解码器，重新生成派生记录（不访问 RPC）
+//
+// EVM 的 TokenPayoutRequested 日志重新生成 payout：解码字段被覆盖，状态、送达信息、区块时间与
+// FeeBps 保留（新 payout 使用原始事件的区块时间）。Solana 交易重新生成解码后的指令与送达记录。
+// 执行与告警日志依赖同一交易的回执，不重新解码。
+type Reindexer struct {
+	store    Storage
+	networks map[string]NetworkConfig
+	solana   map[string]*SolanaListener // 只用于按 IDL 解码，不连接 RPC
+
+	jobMu sync.Mutex
+	job   *ReindexJob    // 最近一次后台任务
+	jobs  sync.WaitGroup // 正在执行的后台任务
+}
+
+// NewReindexer 按网络注册表构造 Reindexer（包括未启用的网络，它们的历史事件同样可以重新索引）
+func NewReindexer(store Storage, registry *ChainRegistry) (*Reindexer, error) {
+	r := &Reindexer{
+		store:    store,
+		networks: make(map[string]NetworkConfig, len(registry.Networks)),
+		solana:   make(map[string]*SolanaListener),
+	}
+	for _, n := range registry.Networks {
+		r.networks[n.Name] = n
+		if n.IsSolana() {
+			decoder, err := NewSolanaListener(n.SolanaChainConfig(), store)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", n.Name, err)
+			}
+			r.solana[n.Name] = decoder
+		}
+	}
+	return r, nil
+}
+
+// Validate 检查网络名称与区块范围
+func (r *Reindexer) Validate(opts ReindexOptions) error {
+	if opts.Chain != "" {
+		if _, ok := r.networks[opts.Chain]; !ok {
+			return fmt.Errorf("unknown network %q", opts.Chain)
+		}
+	}
+	if opts.ToBlock > 0 && opts.ToBlock < opts.FromBlock {
+		return fmt.Errorf("to_block %d is before from_block %d", opts.ToBlock, opts.FromBlock)
+	}
+	return nil
+}
+
+// Start 在后台按 opts 重新索引并返回任务（ctx 取消时任务中止）；已有任务在执行时返回该任务与 errReindexRunning
+func (r *Reindexer) Start(ctx context.Context, opts ReindexOptions) (ReindexJob, error) {
+	if err := r.Validate(opts); err != nil {
+		return ReindexJob{}, err
+	}
+	r.jobMu.Lock()
+	defer r.jobMu.Unlock()
+	if r.job != nil && r.job.Status == ReindexJobRunning {
+		return *r.job, errReindexRunning
+	}
+	job := &ReindexJob{Status: ReindexJobRunning, Options: opts, StartedAt: time.Now().UTC()}
+	if r.job != nil {
+		job.ID = r.job.ID
+	}
+	job.ID++
+	r.job = job
+
+	r.jobs.Add(1)
+	go func() {
+		defer r.jobs.Done()
+		report, err := r.Run(ctx, opts)
+		finished := time.Now().UTC()
+
+		r.jobMu.Lock()
+		defer r.jobMu.Unlock()
+		job.FinishedAt = &finished
+		if err != nil {
+			log.Printf("Reindex: job #%d failed: %v", job.ID, err)
+			job.Status, job.Error = ReindexJobFailed, err.Error()
+			return
+		}
+		job.Status, job.Report = ReindexJobDone, &report
+	}()
+	return *job, nil
+}
+
+// Job 最近一次后台任务（ok 为 false 表示尚未启动过）
+func (r *Reindexer) Job() (job ReindexJob, ok bool) {
+	r.jobMu.Lock()
+	defer r.jobMu.Unlock()
+	if r.job == nil {
+		return ReindexJob{}, false
+	}
+	return *r.job, true
+}
+
+// Wait 等待后台任务结束（关闭 store 前调用）
+func (r *Reindexer) Wait() {
+	r.jobs.Wait()
+}
+
+// Run 按 opts 重新索引；单条事件解码失败记入 report.Errors，不中断；ctx 取消时在当前事件处理完后返回
+func (r *Reindexer) Run(ctx context.Context, opts ReindexOptions) (ReindexReport, error) {
+	report := ReindexReport{DryRun: opts.DryRun, Changes: []PayoutChange{}}
+	if err := r.Validate(opts); err != nil {
+		return report, err
+	}
+
+	rng := EventRange{Chain: opts.Chain, FromBlock: opts.FromBlock, ToBlock: opts.ToBlock}
+	var after EventRecord
+	for {
+		events, err := r.store.ListStoredEvents(rng, after, reindexPageSize)
+		if err != nil {
+			return report, fmt.Errorf("list events: %w", err)
+		}
+		for _, ev := range events {
+			if err := ctx.Err(); err != nil {
+				return report, fmt.Errorf("interrupted after %d event(s): %w", report.Scanned, err)
+			}
+			report.Scanned++
+			if err := r.reindexEvent(ev, opts, &report); err != nil {
+				report.Errors = append(report.Errors, ReindexError{Chain: ev.Chain, TxHash: ev.TxHash, LogIndex: ev.LogIndex, Error: err.Error()})
+			}
+		}
+		if len(events) < reindexPageSize {
+			break
+		}
+		after = events[len(events)-1].EventRecord
+	}
+
+	log.Printf("Reindex: chain=%q contract=%q blocks=[%d - %d] dry_run=%v: scanned %d, decoded %d, changed %d, written %d, errors %d",
+		opts.Chain, opts.Contract, opts.FromBlock, opts.ToBlock, opts.DryRun,
+		report.Scanned, report.Decoded, len(report.Changes), report.Written, len(report.Errors))
+	return report, nil
+}
+
+func (r *Reindexer) reindexEvent(ev StoredEvent, opts ReindexOptions, report *ReindexReport) error {
+	network, ok := r.networks[ev.Chain]
+	if !ok {
+		return fmt.Errorf("unknown network %q", ev.Chain)
+	}
+	if network.IsSolana() {
+		return r.reindexSolanaTx(ev, opts, report)
+	}
+	return r.reindexEVMLog(network, ev, opts, report)
+}
+
+// reindexEVMLog 重新解码 TokenPayoutRequested 日志并与现有 payout 比较
+func (r *Reindexer) reindexEVMLog(network NetworkConfig, ev StoredEvent, opts ReindexOptions, report *ReindexReport) error {
+	var vLog types.Log
+	if err := json.Unmarshal([]byte(ev.RawLog), &vLog); err != nil {
+		return fmt.Errorf("decode raw log: %w", err)
+	}
+	if opts.Contract != "" && !strings.EqualFold(vLog.Address.Hex(), opts.Contract) {
+		report.Skipped++
+		return nil
+	}
+	version, ok := "", false
+	for _, c := range network.Contracts {
+		if common.HexToAddress(c.Address) == vLog.Address {
+			version, ok = c.ABIVersion, true
+		}
+	}
+	if !ok || (len(vLog.Topics) > 0 && vLog.Topics[0] == tokenPayoutExecutedTopic) {
+		report.Skipped++ // EndpointV2 告警、执行记录或已移出配置的合约
+		return nil
+	}
+
+	rec, err := decodePayoutLog(vLog, version, network.EID)
+	if err != nil {
+		return err
+	}
+	report.Decoded++
+
+	existing, found, err := r.store.GetPayout(rec.TxHash)
+	if err != nil {
+		return err
+	}
+	change := PayoutChange{Chain: ev.Chain, TxHash: rec.TxHash, LogIndex: ev.LogIndex, Action: "create"}
+	if found {
+		// 重新解码不访问 RPC：区块时间与合约 FEE_BPS 沿用已有记录
+		rec.Timestamp, rec.FeeBps = existing.Timestamp, existing.FeeBps
+		change.Action, change.Fields = "update", diffPayout(existing, rec)
+	} else {
+		if ev.BlockTime.IsZero() {
+			return fmt.Errorf("block time unknown (event indexed before block times were stored); backfill this range instead")
+		}
+		rec.Timestamp, rec.FeeBps = ev.BlockTime, feeBpsUnknown
+	}
+	rec.FeeIssue = checkFee(rec.GrossAmount, rec.NetAmount, rec.FeeAmount, rec.FeeBps)
+
+	if found && len(change.Fields) == 0 {
+		report.Unchanged++
+		if ev.Parsed {
+			return nil
+		}
+	} else {
+		report.Changes = append(report.Changes, change)
+	}
+	return r.replay(ev, EventEffects{Payout: &rec}, opts, report)
+}
+
+// reindexSolanaTx 按 IDL 重新解码保存的 Solana 交易，重新写入指令与送达记录
+func (r *Reindexer) reindexSolanaTx(ev StoredEvent, opts ReindexOptions, report *ReindexReport) error {
+	var tx rpc.GetTransactionResult
+	if err := json.Unmarshal([]byte(ev.RawLog), &tx); err != nil {
+		return fmt.Errorf("decode raw transaction: %w", err)
+	}
+	if tx.Meta == nil || tx.Transaction == nil {
+		return fmt.Errorf("raw transaction has no meta")
+	}
+	if opts.Contract != "" && !invokesProgram(tx.Meta.LogMessages, opts.Contract) {
+		report.Skipped++
+		return nil
+	}
+	blockTime := ev.BlockTime
+	if blockTime.IsZero() && tx.BlockTime != nil {
+		blockTime = tx.BlockTime.Time().UTC()
+	}
+
+	fx, err := r.solana[ev.Chain].decodeTransaction(&tx, ev.TxHash, ev.BlockNumber, blockTime)
+	if err != nil && !isIrrelevantSolanaTx(err) {
+		return err
+	}
+	report.Decoded++
+	return r.replay(ev, fx, opts, report)
+}
+
+// replay 写入重新生成的派生记录（DryRun 时只计数）
+func (r *Reindexer) replay(ev StoredEvent, fx EventEffects, opts ReindexOptions, report *ReindexReport) error {
+	if !opts.DryRun {
+		if _, err := r.store.ReplayEvent(ev.EventRecord, fx); err != nil {
+			return err
+		}
+	}
+	report.Written++
+	return nil
+}
+
+// invokesProgram 交易日志中是否调用了 program
+func invokesProgram(logs []string, program string) bool {
+	prefix := "Program " + program + " invoke"
+	for _, line := range logs {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffPayout 比较由原始事件解码出的字段（状态、送达、区块时间等不由解码决定的字段不比较）
+func diffPayout(before, after PayoutRecord) []FieldChange {
+	var changes []FieldChange
+	field := func(name, a, b string) {
+		if a != b {
+			changes = append(changes, FieldChange{Field: name, Old: a, New: b})
+		}
+	}
+	amount := func(v *big.Int) string {
+		if v == nil {
+			return "0"
+		}
+		return v.String()
+	}
+	field("block_number", fmt.Sprint(before.BlockNumber), fmt.Sprint(after.BlockNumber))
+	field("block_hash", before.BlockHash, after.BlockHash)
+	field("src_eid", fmt.Sprint(before.SrcEid), fmt.Sprint(after.SrcEid))
+	field("src_contract", before.SrcContract.Key(), after.SrcContract.Key())
+	field("dst_eid", fmt.Sprint(before.DstEid), fmt.Sprint(after.DstEid))
+	field("payer", before.Payer.Key(), after.Payer.Key())
+	field("merchant", before.Merchant.Key(), after.Merchant.Key())
+	field("src_token", strings.ToLower(before.SrcToken.Hex()), strings.ToLower(after.SrcToken.Hex()))
+	field("dst_token", before.DstToken.Key(), after.DstToken.Key())
+	field("gross_amount", amount(before.GrossAmount), amount(after.GrossAmount))
+	field("net_amount", amount(before.NetAmount), amount(after.NetAmount))
+	field("fee_amount", amount(before.FeeAmount), amount(after.FeeAmount))
+	return changes
+}
+
+// runReindexCommand `reindex [-chain 名称] [-contract 地址] [-from 区块] [-to 区块] [-dry-run]`
+func runReindexCommand(args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	var opts ReindexOptions
+	fs.StringVar(&opts.Chain, "chain", "", "network name (default: all networks)")
+	fs.StringVar(&opts.Contract, "contract", "", "EVM contract address or Solana program ID")
+	fs.Uint64Var(&opts.FromBlock, "from", 0, "first block (Solana: slot)")
+	fs.Uint64Var(&opts.ToBlock, "to", 0, "last block (Solana: slot), 0 for no limit")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "print the payout changes without writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	registry, err := LoadChainRegistry(getEnvOrDefault("CHAIN_CONFIG", defaultChainConfigPath))
+	if err != nil {
+		return err
+	}
+	driver, dsn := storageConfigFromEnv()
+	store, err := OpenStore(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	reindexer, err := NewReindexer(store, registry)
+	if err != nil {
+		return err
+	}
+	report, err := reindexer.Run(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range report.Changes {
+		if c.Action == "create" {
+			fmt.Printf("+ %s %s#%d (new payout)\n", c.Chain, c.TxHash, c.LogIndex)
+			continue
+		}
+		fmt.Printf("~ %s %s#%d\n", c.Chain, c.TxHash, c.LogIndex)
+		for _, f := range c.Fields {
+			fmt.Printf("    %s: %s -> %s\n", f.Field, f.Old, f.New)
+		}
+	}
+	for _, e := range report.Errors {
+		fmt.Printf("! %s %s#%d: %s\n", e.Chain, e.TxHash, e.LogIndex, e.Error)
+	}
+	verb := "written"
+	if report.DryRun {
+		verb = "would be written (dry run)"
+	}
+	fmt.Printf("scanned %d event(s): %d decoded, %d skipped, %d unchanged, %d payout change(s), %d %s, %d error(s)\n",
+		report.Scanned, report.Decoded, report.Skipped, report.Unchanged, len(report.Changes), report.Written, verb, len(report.Errors))
+	return nil
+}
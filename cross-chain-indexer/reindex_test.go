@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const reindexTestRegistry = `{
+	"networks": [
+		{"name": "Base Sepolia", "type": "evm", "eid": 40245,
+		 "rpc": {"https": "https://base-sepolia.example"},
+		 "contracts": [{"address": "0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6", "abi_version": "v2"}]},
+		{"name": "Solana Devnet", "type": "solana", "eid": 40168,
+		 "rpc": {"https": "https://solana-devnet.example"},
+		 "programs": [{"program_id": "GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1", "role": "transfer"}]}
+	]
+}`
+
+func newTestReindexer(t *testing.T, s *Store) *Reindexer {
+	t.Helper()
+	reg, err := ParseChainRegistry([]byte(reindexTestRegistry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReindexer(s, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// v2PayoutLog 构造 Base Sepolia 合约的 TokenPayoutRequested（v2）日志
+func v2PayoutLog(txHash string, block uint64, merchant common.Address, gross, net int64) types.Log {
+	data := make([]byte, 160)
+	copy(data[12:32], common.HexToAddress("0x036CbD53842c5426634e7929541eC2318f3dCF7e").Bytes())
+	copy(data[44:64], common.HexToAddress("0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d").Bytes())
+	big.NewInt(gross).FillBytes(data[64:96])
+	big.NewInt(net).FillBytes(data[96:128])
+	big.NewInt(gross - net).FillBytes(data[128:160])
+	return types.Log{
+		Address: common.HexToAddress("0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6"),
+		Topics: []common.Hash{payoutTopicByABIVersion[ABIVersionV2], common.BigToHash(big.NewInt(40231)),
+			common.HexToHash("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438"), common.BytesToHash(merchant.Bytes())},
+		Data:        data,
+		BlockNumber: block,
+		TxHash:      common.HexToHash(txHash),
+		BlockHash:   common.HexToHash(fmt.Sprintf("0xb%d", block)),
+	}
+}
+
+// TestReindexEVMPayouts 修复解码后按保存的原始日志重新生成 payout：dry-run 只给出差异，写入时保留状态
+func TestReindexEVMPayouts(t *testing.T) {
+	s := newTestStore(t)
+	r := newTestReindexer(t, s)
+	blockTime := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	merchant := common.HexToAddress("0x77ed7f6455fe291728a48785090292e3d10f53bb")
+
+	// 0xa1：已索引，但 payout 是按有缺陷的解码写入的（商户与净额错误），并已送达
+	logA := v2PayoutLog("0xa1", 100, merchant, 1000, 990)
+	bad, err := decodePayoutV2(logA, 40245)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Merchant, bad.NetAmount, bad.Timestamp = EVMChainAddress(common.HexToAddress("0x01")), big.NewInt(1), blockTime
+	if _, err := persistLog(s, "Base Sepolia", logA, blockTime, EventEffects{Payout: &bad}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdatePayoutStatus(bad.TxHash, PayoutStatusDelivered); err != nil {
+		t.Fatal(err)
+	}
+	// 0xa2：当时解码失败，只保存了原始日志
+	logB := v2PayoutLog("0xa2", 101, merchant, 500, 495)
+	evB, _ := rawLogEvent("Base Sepolia", logB, blockTime.Add(time.Minute))
+	if _, err := s.InsertEventIfNotExists(evB.Chain, evB.TxHash, evB.LogIndex, evB.BlockNumber, evB.BlockHash, evB.RawLog); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`UPDATE events SET block_time = ? WHERE tx_hash = ?`, "2026-01-01 12:01:00", evB.TxHash); err != nil {
+		t.Fatal(err)
+	}
+	// 其他合约的日志不参与
+	other := v2PayoutLog("0xa3", 102, merchant, 1, 1)
+	other.Address = common.HexToAddress("0x02")
+	if _, err := insertRawLog(s, "Base Sepolia", other); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := r.Run(context.Background(), ReindexOptions{Chain: "Base Sepolia", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 3 || report.Decoded != 2 || report.Skipped != 1 || report.Written != 2 || len(report.Errors) != 0 || len(report.Changes) != 2 {
+		t.Fatalf("dry run report = %+v", report)
+	}
+	update, create := report.Changes[0], report.Changes[1]
+	if update.Action != "update" || len(update.Fields) != 2 || update.Fields[0].Field != "merchant" ||
+		update.Fields[1].Field != "net_amount" || update.Fields[1].Old != "1" || update.Fields[1].New != "990" {
+		t.Errorf("update change = %+v", update)
+	}
+	if create.Action != "create" || create.TxHash != evB.TxHash {
+		t.Errorf("create change = %+v", create)
+	}
+	if p := payoutByTx(t, s, bad.TxHash); p.NetAmount.Int64() != 1 {
+		t.Error("dry run modified the payout")
+	}
+
+	if report, err = r.Run(context.Background(), ReindexOptions{Chain: "Base Sepolia", Contract: "0xa1d91cdcbd933c3385d7dea34d87357f5e62f6d6"}); err != nil || report.Written != 2 {
+		t.Fatalf("reindex = %+v, %v", report, err)
+	}
+	p := payoutByTx(t, s, bad.TxHash)
+	if p.Merchant != EVMChainAddress(merchant) || p.NetAmount.Int64() != 990 || p.Status != PayoutStatusDelivered || !p.Timestamp.Equal(blockTime) {
+		t.Errorf("reindexed payout = %+v", p)
+	}
+	p = payoutByTx(t, s, evB.TxHash)
+	if p.NetAmount.Int64() != 495 || p.Status != PayoutStatusPending || !p.Timestamp.Equal(blockTime.Add(time.Minute)) {
+		t.Errorf("created payout = %+v", p)
+	}
+	if done, err := s.EventProcessed(evB.TxHash, 0); err != nil || !done {
+		t.Errorf("reindexed event not marked parsed: %v, %v", done, err)
+	}
+
+	// 再次运行没有变化
+	if report, err = r.Run(context.Background(), ReindexOptions{}); err != nil || len(report.Changes) != 0 || report.Unchanged != 2 || report.Written != 0 {
+		t.Errorf("second reindex = %+v, %v", report, err)
+	}
+	// 区块范围
+	if report, err = r.Run(context.Background(), ReindexOptions{FromBlock: 101, ToBlock: 101, DryRun: true}); err != nil || report.Scanned != 1 {
+		t.Errorf("block range reindex = %+v, %v", report, err)
+	}
+	if _, err := r.Run(context.Background(), ReindexOptions{Chain: "Nowhere"}); err == nil {
+		t.Error("expected error for unknown network")
+	}
+}
+
+// TestReindexSolanaTransaction 保存的 getTransaction 结果可以重新解码出 transfer_out 的送达记录
+func TestReindexSolanaTransaction(t *testing.T) {
+	t.Chdir(t.TempDir()) // 解码日志写入 solana_log.txt
+	s := newTestStore(t)
+	r := newTestReindexer(t, s)
+
+	wallet := func() solana.PublicKey { return solana.NewWallet().PublicKey() }
+	authority, config, vaultAuthority, vaultAccount, recipientAccount, mint, merchant := wallet(), wallet(), wallet(), wallet(), wallet(), wallet(), wallet()
+	program := solana.MustPublicKeyFromBase58("GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1")
+	outDisc := anchorDiscriminator("global", "transfer_out")
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{1, 2, 3}},
+		Message: solana.Message{
+			Header:      solana.MessageHeader{NumRequiredSignatures: 1},
+			AccountKeys: solana.PublicKeySlice{authority, program, config, vaultAuthority, vaultAccount, recipientAccount, mint, solana.TokenProgramID},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 1, Accounts: []uint16{2, 0, 3, 4, 5, 6, 7}, Data: binary.LittleEndian.AppendUint64(outDisc[:], 2500000)},
+			},
+		},
+	}
+	bin, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope rpc.TransactionResultEnvelope
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`[%q, "base64"]`, base64.StdEncoding.EncodeToString(bin))), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	blockTime := solana.UnixTimeSeconds(1767268800)
+	result := &rpc.GetTransactionResult{Slot: 500, BlockTime: &blockTime, Transaction: &envelope, Meta: &rpc.TransactionMeta{
+		LogMessages:       []string{"Program " + program.String() + " invoke [1]"},
+		PostTokenBalances: []rpc.TokenBalance{{AccountIndex: 5, Owner: &merchant, Mint: mint}},
+	}}
+
+	// 只保存了原始交易（例如当时解码失败）
+	signature := tx.Signatures[0].String()
+	ev, err := solanaTransactionEvent("Solana Devnet", signature, 500, blockTime.Time().UTC(), result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertEventIfNotExists(ev.Chain, ev.TxHash, 0, ev.BlockNumber, "", ev.RawLog); err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err := r.Run(context.Background(), ReindexOptions{Contract: wallet().String()}); err != nil || report.Skipped != 1 || report.Written != 0 {
+		t.Fatalf("reindex other program = %+v, %v", report, err)
+	}
+	report, err := r.Run(context.Background(), ReindexOptions{Chain: "Solana Devnet", Contract: program.String()})
+	if err != nil || report.Decoded != 1 || report.Written != 1 || len(report.Errors) != 0 {
+		t.Fatalf("reindex = %+v, %v", report, err)
+	}
+	unmatched, err := s.ListUnmatchedDeliveries(10, 0)
+	if err != nil || len(unmatched) != 1 {
+		t.Fatalf("deliveries = %+v, %v", unmatched, err)
+	}
+	if d := unmatched[0]; d.DstTxHash != signature || d.Merchant != merchant.String() || d.Token != mint.String() || d.Amount.Int64() != 2500000 {
+		t.Errorf("delivery = %+v", d)
+	}
+	recs, err := s.ListSolanaInstructions("", "transfer_out", 10, 0)
+	if err != nil || len(recs) != 1 || recs[0].Signature != signature {
+		t.Errorf("instructions = %+v, %v", recs, err)
+	}
+	if done, err := s.EventProcessed(signature, 0); err != nil || !done {
+		t.Errorf("event not marked parsed: %v, %v", done, err)
+	}
+}
+
+// TestReindexJob 后台任务：同一时间只允许一个，完成后可查询报告
+func TestReindexJob(t *testing.T) {
+	s := newTestStore(t)
+	r := newTestReindexer(t, s)
+	if _, ok := r.Job(); ok {
+		t.Fatal("job reported before any reindex started")
+	}
+	if _, err := r.Start(context.Background(), ReindexOptions{Chain: "Nowhere"}); err == nil || errors.Is(err, errReindexRunning) {
+		t.Fatalf("Start(unknown network) = %v, want validation error", err)
+	}
+
+	// 已有任务在执行：拒绝并返回正在执行的任务
+	r.job = &ReindexJob{ID: 7, Status: ReindexJobRunning}
+	if job, err := r.Start(context.Background(), ReindexOptions{DryRun: true}); !errors.Is(err, errReindexRunning) || job.ID != 7 {
+		t.Fatalf("Start while running = %+v, %v", job, err)
+	}
+	r.job.Status = ReindexJobDone
+
+	if _, err := insertRawLog(s, "Base Sepolia", v2PayoutLog("0xa1", 100, common.HexToAddress("0x01"), 1000, 990)); err != nil {
+		t.Fatal(err)
+	}
+	job, err := r.Start(context.Background(), ReindexOptions{Chain: "Base Sepolia", DryRun: true})
+	if err != nil || job.ID != 8 || job.Status != ReindexJobRunning {
+		t.Fatalf("Start = %+v, %v", job, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == ReindexJobRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("reindex job did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+		job, _ = r.Job()
+	}
+	if job.Status != ReindexJobDone || job.FinishedAt == nil || job.Report == nil || job.Report.Scanned != 1 {
+		t.Errorf("finished job = %+v", job)
+	}
+
+	// 关闭时取消根 context：任务中止，Wait 等到它返回
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Start(ctx, ReindexOptions{DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	r.Wait()
+	if job, _ := r.Job(); job.Status != ReindexJobFailed || !strings.Contains(job.Error, "context canceled") {
+		t.Errorf("cancelled job = %+v", job)
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	solanarpc "github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"golang.org/x/time/rate"
+)
+
+// RPC 池参数
+const (
+	rpcProbeInterval      = 15 * time.Second // 探测各端点最新高度的周期
+	rpcCooldownAfter      = 3                // 连续故障该次数后暂停使用端点
+	rpcBaseCooldown       = 30 * time.Second // 首次暂停时长，之后每次翻倍
+	rpcMaxCooldown        = 5 * time.Minute
+	rpcLatencyWeight      = 0.2  // 延迟 EWMA 中新样本的权重
+	rpcErrorWeight        = 0.1  // 错误率 EWMA 中新样本的权重
+	rpcMaxErrorRate       = 0.5  // 错误率超过该值视为不健康
+	rpcErrorPenaltyMillis = 1000 // 评分时错误率折算的延迟（毫秒，乘以错误率）
+	rpcLagPenaltyMillis   = 50   // 评分时每落后一个区块 / slot 折算的延迟（毫秒）
+)
+
+// 默认允许的最新高度落后量（超过视为不健康）
+const (
+	defaultEVMMaxHeadLag    = 64  // 区块
+	defaultSolanaMaxHeadLag = 150 // slot，约 1 分钟
+)
+
+var (
+	// errRPCFailover 订阅所在端点不再健康，已切换到更健康的端点（调用方应立即重新订阅）
+	errRPCFailover = errors.New("rpc endpoint unhealthy, failing over")
+	errNoEndpoint  = errors.New("no rpc endpoint configured")
+	errNoWSS       = errors.New("no websocket endpoint configured")
+)
+
+// endpointFaultCodes 表示端点自身问题（限流、超时、内部错误、节点落后）的 JSON-RPC 错误码；
+// 其他错误码是请求本身的问题，换端点重试没有意义
+var endpointFaultCodes = map[int]bool{
+	-32005: true, // limit exceeded / Solana: node is behind
+	-32002: true, // geth: request timed out
+	-32603: true, // internal error
+}
+
+// RPCEndpoint 一个 RPC 端点（对应 chains.json 中的 rpc 与 rpc.fallbacks 条目）
+type RPCEndpoint struct {
+	HTTPS string `json:"https"`
+	WSS   string `json:"wss,omitempty"`
+	// RequestsPerSecond 该端点的请求预算（同一 URL 的调用方共享）
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+}
+
+// EndpointHealth 端点健康状况（用于 /health；端点只显示 scheme 与主机名，不泄露路径或参数中的 API key）
+type EndpointHealth struct {
+	Endpoint      string     `json:"endpoint"`
+	Healthy       bool       `json:"healthy"`
+	Active        bool       `json:"active"`     // 实时订阅当前使用的端点
+	LatencyMs     float64    `json:"latency_ms"` // 成功调用的平均延迟（EWMA）
+	ErrorRate     float64    `json:"error_rate"` // 端点故障比例（EWMA）
+	Head          uint64     `json:"head"`       // 最近一次探测到的最新区块 / slot
+	HeadLag       uint64     `json:"head_lag"`   // 落后于所有端点中最高高度的数量
+	Requests      uint64     `json:"requests"`
+	Errors        uint64     `json:"errors"`
+	LastError     string     `json:"last_error,omitempty"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+}
+
+// poolEndpoint 池内端点及其健康统计（统计字段由 rpcPool.mu 保护）
+type poolEndpoint struct {
+	index   int
+	cfg     RPCEndpoint
+	name    string // 脱敏后的名称
+	limiter *rate.Limiter
+
+	latency       float64 // 毫秒，0 表示尚未测量
+	errRate       float64
+	head          uint64
+	requests      uint64
+	errors        uint64
+	consecutive   int // 连续故障次数
+	cooldown      time.Duration
+	cooldownUntil time.Time
+	lastError     string
+}
+
+// rpcPool 一条链的多端点 RPC 池
+//
+// 记录每个端点的延迟、错误率与最新高度落后量，每次调用选择评分最好的健康端点，
+// 端点故障（连接失败、限流、5xx 等）时换下一个端点重试；连续故障的端点暂停使用一段时间，
+// 由周期探测恢复。订阅通过 watch 在所在端点不再健康时切换。EVMPool / SolanaPool 在此之上包装具体客户端。
+type rpcPool struct {
+	chain      string
+	maxHeadLag uint64
+	endpoints  []*poolEndpoint
+	// head 探测端点的最新区块 / slot
+	head func(ctx context.Context, ep *poolEndpoint) (uint64, error)
+
+	mu     sync.Mutex
+	active *poolEndpoint
+	probed chan struct{} // 每轮探测结束后关闭并替换
+}
+
+// newRPCPool 创建 RPC 池（端点按配置顺序，评分相同时靠前的优先）
+func newRPCPool(chain string, endpoints []RPCEndpoint, maxHeadLag uint64) *rpcPool {
+	p := &rpcPool{chain: chain, maxHeadLag: maxHeadLag, probed: make(chan struct{})}
+	for i, cfg := range endpoints {
+		p.endpoints = append(p.endpoints, &poolEndpoint{
+			index:   i,
+			cfg:     cfg,
+			name:    redactEndpoint(cfg.HTTPS),
+			limiter: endpointLimiter(cfg.HTTPS, cfg.RequestsPerSecond),
+		})
+	}
+	return p
+}
+
+// redactEndpoint 端点的展示名称：只保留 scheme 与主机名
+func redactEndpoint(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "invalid endpoint"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// HasWSS 是否有端点配置了 WebSocket
+func (p *rpcPool) HasWSS() bool {
+	for _, ep := range p.endpoints {
+		if ep.cfg.WSS != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Run 立即探测一次各端点，之后每 rpcProbeInterval 探测一次，直到 ctx 结束
+func (p *rpcPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(rpcProbeInterval)
+	defer ticker.Stop()
+	for {
+		p.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe 并发获取各端点的最新高度（计入延迟与错误统计），结束后通知 watch
+func (p *rpcPool) probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ep.limiter.Wait(ctx); err != nil {
+				return
+			}
+			start := time.Now()
+			head, err := p.head(ctx, ep)
+			if ctx.Err() != nil {
+				return
+			}
+			p.record(ep, time.Since(start), err)
+			if err == nil {
+				p.mu.Lock()
+				ep.head = head
+				p.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	close(p.probed)
+	p.probed = make(chan struct{})
+	p.mu.Unlock()
+}
+
+// call 在评分最好的端点上执行 fn；端点故障时依次换其他端点重试，其他错误（未找到、合约 revert 等）直接返回
+//
+// 返回的错误信息中端点 URL 已脱敏（监听器会把它展示在 /health 上）。
+func (p *rpcPool) call(ctx context.Context, fn func(ep *poolEndpoint) error) error {
+	tried := make(map[*poolEndpoint]bool, len(p.endpoints))
+	lastErr := errNoEndpoint
+	for {
+		ep := p.pick(tried, false)
+		if ep == nil {
+			return lastErr
+		}
+		tried[ep] = true
+		if err := ep.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := fn(ep)
+		if ctx.Err() != nil {
+			return p.wrapError(ep, err)
+		}
+		p.record(ep, time.Since(start), err)
+		if err == nil || !isEndpointFault(err) {
+			return p.wrapError(ep, err)
+		}
+		lastErr = p.wrapError(ep, err)
+		if len(tried) < len(p.endpoints) {
+			log.Printf("RPCPool[%s]: %s failed: %s (trying next endpoint)", p.chain, ep.name, p.redactError(ep, err))
+		}
+	}
+}
+
+// record 记录一次调用的结果；只有端点故障计入错误率，latency 为 0 时不更新延迟（如 WebSocket 连接）
+func (p *rpcPool) record(ep *poolEndpoint, latency time.Duration, err error) {
+	fault := err != nil && isEndpointFault(err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep.requests++
+	sample := 0.0
+	if fault {
+		sample = 1
+	}
+	ep.errRate = ep.errRate*(1-rpcErrorWeight) + sample*rpcErrorWeight
+
+	if !fault {
+		if err == nil && latency > 0 {
+			ms := float64(latency) / float64(time.Millisecond)
+			if ep.latency == 0 {
+				ep.latency = ms
+			} else {
+				ep.latency = ep.latency*(1-rpcLatencyWeight) + ms*rpcLatencyWeight
+			}
+		}
+		ep.consecutive = 0
+		ep.cooldown = 0
+		ep.cooldownUntil = time.Time{}
+		return
+	}
+
+	ep.errors++
+	ep.consecutive++
+	ep.lastError = p.redactError(ep, err)
+	if ep.consecutive >= rpcCooldownAfter {
+		if ep.cooldown == 0 {
+			ep.cooldown = rpcBaseCooldown
+		} else if ep.cooldown *= 2; ep.cooldown > rpcMaxCooldown {
+			ep.cooldown = rpcMaxCooldown
+		}
+		ep.cooldownUntil = time.Now().Add(ep.cooldown)
+		log.Printf("RPCPool[%s]: %s failed %d times in a row, cooling down for %s: %s",
+			p.chain, ep.name, ep.consecutive, ep.cooldown, ep.lastError)
+	}
+}
+
+// redactError 错误信息中的端点 URL 替换为脱敏名称（部分客户端的错误信息包含完整 URL）
+func (p *rpcPool) redactError(ep *poolEndpoint, err error) string {
+	msg := err.Error()
+	for _, u := range []string{ep.cfg.HTTPS, ep.cfg.WSS} {
+		if u != "" {
+			msg = strings.ReplaceAll(msg, u, ep.name)
+		}
+	}
+	return msg
+}
+
+// redactedError 信息已脱敏的 RPC 错误；errors.Is / As 仍按原错误判断
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// wrapError 将 err 包装为信息已脱敏的错误（err 为 nil 时返回 nil）
+func (p *rpcPool) wrapError(ep *poolEndpoint, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{msg: p.redactError(ep, err), err: err}
+}
+
+// redactURLs 将文本中的 URL 替换为只含 scheme 与主机名的形式（路径与查询参数中常带 API key）
+func redactURLs(msg string) string {
+	return urlPattern.ReplaceAllStringFunc(msg, redactEndpoint)
+}
+
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// pick 选择评分最好的端点（跳过 exclude；wss 为 true 时只选配置了 WebSocket 的端点）：
+// 健康端点优先，其次是落后或错误率高的端点，最后是暂停中的端点（最早恢复的优先）
+func (p *rpcPool) pick(exclude map[*poolEndpoint]bool, wss bool) *poolEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pickLocked(exclude, wss, time.Now())
+}
+
+func (p *rpcPool) pickLocked(exclude map[*poolEndpoint]bool, wss bool, now time.Time) *poolEndpoint {
+	maxHead := p.maxHeadLocked()
+	var best *poolEndpoint
+	var bestTier int
+	var bestScore float64
+	for _, ep := range p.endpoints {
+		if exclude[ep] || (wss && ep.cfg.WSS == "") {
+			continue
+		}
+		tier, score := p.rankLocked(ep, now, maxHead)
+		if best == nil || tier < bestTier || (tier == bestTier && score < bestScore) {
+			best, bestTier, bestScore = ep, tier, score
+		}
+	}
+	return best
+}
+
+// rankLocked 端点的层级（0 健康、1 降级、2 暂停中）与层内评分（越小越好）
+func (p *rpcPool) rankLocked(ep *poolEndpoint, now time.Time, maxHead uint64) (int, float64) {
+	if now.Before(ep.cooldownUntil) {
+		return 2, float64(ep.cooldownUntil.Sub(now))
+	}
+	lag := lagBehind(ep.head, maxHead)
+	score := ep.latency*(1+4*ep.errRate) + ep.errRate*rpcErrorPenaltyMillis + float64(lag)*rpcLagPenaltyMillis
+	if ep.errRate > rpcMaxErrorRate || lag > p.maxHeadLag {
+		return 1, score
+	}
+	return 0, score
+}
+
+func (p *rpcPool) healthyLocked(ep *poolEndpoint, now time.Time, maxHead uint64) bool {
+	tier, _ := p.rankLocked(ep, now, maxHead)
+	return tier == 0
+}
+
+func (p *rpcPool) maxHeadLocked() uint64 {
+	var highest uint64
+	for _, ep := range p.endpoints {
+		if ep.head > highest {
+			highest = ep.head
+		}
+	}
+	return highest
+}
+
+func lagBehind(head, maxHead uint64) uint64 {
+	if head >= maxHead {
+		return 0
+	}
+	return maxHead - head
+}
+
+// watch 将 ep 标记为订阅使用的端点，返回的 context 在 ep 不再健康且有健康的 WebSocket 端点时
+// 以 errRPCFailover 取消（每轮探测后检查）；订阅结束后调用 stop
+func (p *rpcPool) watch(ctx context.Context, ep *poolEndpoint) (watchCtx context.Context, stop func()) {
+	watchCtx, cancel := context.WithCancelCause(ctx)
+	p.mu.Lock()
+	p.active = ep
+	p.mu.Unlock()
+
+	go func() {
+		for {
+			p.mu.Lock()
+			probed := p.probed
+			p.mu.Unlock()
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-probed:
+			}
+			if next := p.failoverTarget(ep); next != nil {
+				log.Printf("RPCPool[%s]: %s is unhealthy, moving subscription to %s", p.chain, ep.name, next.name)
+				cancel(errRPCFailover)
+				return
+			}
+		}
+	}()
+
+	return watchCtx, func() {
+		cancel(context.Canceled)
+		p.mu.Lock()
+		if p.active == ep {
+			p.active = nil
+		}
+		p.mu.Unlock()
+	}
+}
+
+// failoverTarget ep 不健康时返回应切换到的健康 WebSocket 端点（没有时返回 nil，继续使用 ep）
+func (p *rpcPool) failoverTarget(ep *poolEndpoint) *poolEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	maxHead := p.maxHeadLocked()
+	if p.healthyLocked(ep, now, maxHead) {
+		return nil
+	}
+	next := p.pickLocked(map[*poolEndpoint]bool{ep: true}, true, now)
+	if next == nil || !p.healthyLocked(next, now, maxHead) {
+		return nil
+	}
+	return next
+}
+
+// Health 各端点的健康状况（按配置顺序）
+func (p *rpcPool) Health() []EndpointHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	maxHead := p.maxHeadLocked()
+	out := make([]EndpointHealth, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		h := EndpointHealth{
+			Endpoint:  ep.name,
+			Healthy:   p.healthyLocked(ep, now, maxHead),
+			Active:    p.active == ep,
+			LatencyMs: ep.latency,
+			ErrorRate: ep.errRate,
+			Head:      ep.head,
+			HeadLag:   lagBehind(ep.head, maxHead),
+			Requests:  ep.requests,
+			Errors:    ep.errors,
+			LastError: ep.lastError,
+		}
+		if now.Before(ep.cooldownUntil) {
+			until := ep.cooldownUntil.UTC()
+			h.CooldownUntil = &until
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// isEndpointFault 错误是否由端点本身引起（换端点可能成功）
+//
+// 连接失败、超时、HTTP 错误状态与限流 / 内部错误码属于端点故障；未找到、参数错误、合约 revert 等
+// JSON-RPC 错误是请求本身的问题。
+func isEndpointFault(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ethereum.NotFound) || errors.Is(err, solanarpc.ErrNotFound) {
+		return false
+	}
+	var gethHTTP gethrpc.HTTPError
+	var solanaHTTP *jsonrpc.HTTPError
+	if errors.As(err, &gethHTTP) || errors.As(err, &solanaHTTP) {
+		return true
+	}
+	var solanaErr *jsonrpc.RPCError
+	if errors.As(err, &solanaErr) {
+		return endpointFaultCodes[solanaErr.Code]
+	}
+	var gethErr gethrpc.Error
+	if errors.As(err, &gethErr) {
+		return endpointFaultCodes[gethErr.ErrorCode()]
+	}
+	return true
+}
+
+// String 池的简要描述（日志用）
+func (p *rpcPool) String() string {
+	names := make([]string, len(p.endpoints))
+	for i, ep := range p.endpoints {
+		names[i] = ep.name
+	}
+	return fmt.Sprintf("%d endpoint(s): %s", len(p.endpoints), strings.Join(names, ", "))
+}
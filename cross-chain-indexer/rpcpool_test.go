@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// rpcStub 本地 JSON-RPC 端点：按方法名返回固定结果；status 非零时所有请求返回该 HTTP 状态
+type rpcStub struct {
+	*httptest.Server
+	mu      sync.Mutex
+	results map[string]any
+	status  int
+	calls   map[string]int
+}
+
+func newRPCStub(t *testing.T, results map[string]any) *rpcStub {
+	t.Helper()
+	s := &rpcStub{results: results, calls: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.calls[req.Method]++
+		status := s.status
+		result, ok := s.results[req.Method]
+		s.mu.Unlock()
+
+		if status != 0 {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		if ok {
+			resp["result"] = result
+		} else {
+			resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *rpcStub) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func testHeader(number int64) *types.Header {
+	return &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(0), Time: 1700000000}
+}
+
+func TestEVMPoolFailover(t *testing.T) {
+	down := newRPCStub(t, nil)
+	down.status = http.StatusServiceUnavailable
+	up := newRPCStub(t, map[string]any{
+		"eth_getBlockByNumber":      testHeader(5),
+		"eth_getTransactionReceipt": nil,
+	})
+
+	pool, err := NewEVMPool("test", []RPCEndpoint{{HTTPS: down.URL}, {HTTPS: up.URL}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 主端点故障：同一次调用换到备用端点
+	h, err := pool.HeaderByNumber(ctx, big.NewInt(5))
+	if err != nil || h.Number.Int64() != 5 {
+		t.Fatalf("HeaderByNumber = %v, %v", h, err)
+	}
+	// 之后优先使用备用端点
+	if _, err := pool.HeaderByNumber(ctx, big.NewInt(5)); err != nil {
+		t.Fatal(err)
+	}
+	if n := down.count("eth_getBlockByNumber"); n != 1 {
+		t.Errorf("failed endpoint called %d times, want 1", n)
+	}
+
+	// 未找到不是端点故障：不换端点、不计错误
+	if _, err := pool.TransactionReceipt(ctx, common.Hash{1}); !errors.Is(err, ethereum.NotFound) {
+		t.Fatalf("TransactionReceipt = %v, want NotFound", err)
+	}
+	if n := down.count("eth_getTransactionReceipt"); n != 0 {
+		t.Errorf("not-found response failed over %d times", n)
+	}
+
+	health := pool.Health()
+	if health[0].Errors != 1 || health[0].LastError == "" || health[1].Errors != 0 || health[1].Requests != 3 {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestRPCPoolCooldown(t *testing.T) {
+	down := newRPCStub(t, nil)
+	down.status = http.StatusTooManyRequests
+	pool, err := NewEVMPool("test", []RPCEndpoint{{HTTPS: down.URL}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rpcCooldownAfter; i++ {
+		if _, err := pool.BlockNumber(context.Background()); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	h := pool.Health()[0]
+	if h.Healthy || h.CooldownUntil == nil || time.Until(*h.CooldownUntil) > rpcBaseCooldown {
+		t.Fatalf("after %d failures: %+v", rpcCooldownAfter, h)
+	}
+
+	// 唯一的端点暂停中仍然使用；探测成功后恢复
+	down.mu.Lock()
+	down.status = 0
+	down.results = map[string]any{"eth_blockNumber": "0x10"}
+	down.mu.Unlock()
+	pool.probe(context.Background())
+	if h := pool.Health()[0]; h.CooldownUntil != nil || h.Head != 16 {
+		t.Errorf("after successful probe: %+v", h)
+	}
+}
+
+func TestRPCPoolHeadLag(t *testing.T) {
+	behind := newRPCStub(t, map[string]any{"eth_blockNumber": "0x64"}) // 100
+	ahead := newRPCStub(t, map[string]any{"eth_blockNumber": "0xc8"})  // 200
+	pool, err := NewEVMPool("test", []RPCEndpoint{
+		{HTTPS: behind.URL, WSS: "ws://behind.invalid"},
+		{HTTPS: ahead.URL, WSS: "ws://ahead.invalid"},
+	}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 订阅在主端点上：探测发现它落后后以 errRPCFailover 取消
+	watchCtx, stop := pool.watch(context.Background(), pool.endpoints[0])
+	defer stop()
+	if !pool.Health()[0].Active {
+		t.Error("watched endpoint should be active")
+	}
+	pool.probe(context.Background())
+
+	select {
+	case <-watchCtx.Done():
+		if cause := context.Cause(watchCtx); !errors.Is(cause, errRPCFailover) {
+			t.Errorf("cause = %v, want errRPCFailover", cause)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription on lagging endpoint was not failed over")
+	}
+
+	health := pool.Health()
+	if health[0].Healthy || health[0].HeadLag != 100 || !health[1].Healthy || health[1].HeadLag != 0 {
+		t.Errorf("health = %+v", health)
+	}
+	if n, err := pool.BlockNumber(context.Background()); err != nil || n != 200 {
+		t.Errorf("BlockNumber = %d, %v; want 200 from the endpoint that is not behind", n, err)
+	}
+}
+
+func TestSolanaPoolFailover(t *testing.T) {
+	limited := newRPCStub(t, nil)
+	limited.status = http.StatusTooManyRequests
+	up := newRPCStub(t, map[string]any{"getSlot": 1234})
+
+	pool, err := NewSolanaPool("test", []RPCEndpoint{{HTTPS: limited.URL + "/secret-api-key"}, {HTTPS: up.URL}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, err := pool.GetSlot(context.Background(), rpc.CommitmentFinalized)
+	if err != nil || slot != 1234 {
+		t.Fatalf("GetSlot = %d, %v", slot, err)
+	}
+
+	// /health 不泄露路径中的 API key
+	h := pool.Health()[0]
+	if h.Errors != 1 || h.LastError == "" {
+		t.Errorf("health = %+v", h)
+	}
+	if strings.Contains(h.Endpoint, "secret") || strings.Contains(h.LastError, "secret") {
+		t.Errorf("endpoint health leaks the URL path: %+v", h)
+	}
+	if want := strings.TrimPrefix(limited.URL, "http://"); !strings.HasSuffix(h.Endpoint, want) {
+		t.Errorf("endpoint = %q, want host %s", h.Endpoint, want)
+	}
+}
+
+func TestIsEndpointFault(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("dial tcp: connection refused"), true},
+		{gethrpc.HTTPError{StatusCode: 502}, true},
+		{jsonrpc.NewHTTPError(429, errors.New("too many requests")), true},
+		{&jsonrpc.RPCError{Code: -32005, Message: "Node is behind by 200 slots"}, true},
+		{&jsonrpc.RPCError{Code: -32602, Message: "invalid params"}, false},
+		{fmt.Errorf("get transaction: %w", rpc.ErrNotFound), false},
+		{ethereum.NotFound, false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := isEndpointFault(tt.err); got != tt.want {
+			t.Errorf("isEndpointFault(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestHealthRedactsRPCURLs 监听器最近的错误（/health 的 last_error）不泄露端点 URL 的路径与查询参数
+func TestHealthRedactsRPCURLs(t *testing.T) {
+	down := newRPCStub(t, nil)
+	down.status = http.StatusServiceUnavailable
+	endpoint := down.URL + "/v2/secret-key?api-key=secret-token"
+	pool, err := NewSolanaPool("Solana Devnet", []RPCEndpoint{{HTTPS: endpoint}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestSolanaListener(t, pool, newTestStore(t))
+	sv := NewListenerSupervisor()
+	if err := sv.Add(l); err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{listeners: sv}
+	health := func() string {
+		rec := httptest.NewRecorder()
+		server.handleHealth(rec, httptest.NewRequest("GET", "/health", nil))
+		return rec.Body.String()
+	}
+
+	// 经过 RPC 池的调用失败：返回的错误已脱敏，errors.As 仍可判断
+	_, err = pool.GetSlot(context.Background(), rpc.CommitmentConfirmed)
+	var httpErr *jsonrpc.HTTPError
+	if err == nil || strings.Contains(err.Error(), "secret") || !errors.As(err, &httpErr) {
+		t.Errorf("GetSlot error = %v", err)
+	}
+	l.pollForNewTransactions(context.Background(), 0)
+	body := health()
+	if !strings.Contains(body, `"last_error":"`) {
+		t.Fatalf("listener error not reported: %s", body)
+	}
+	if strings.Contains(body, "secret") {
+		t.Errorf("/health leaks the endpoint URL: %s", body)
+	}
+
+	// 不经过 RPC 池的错误（如 WebSocket 断开）
+	l.state.setError(fmt.Errorf("websocket: read %s: connection reset", strings.Replace(endpoint, "http", "ws", 1)))
+	if body := health(); strings.Contains(body, "secret") || !strings.Contains(body, strings.Replace(down.URL, "http", "ws", 1)) {
+		t.Errorf("/health leaks the endpoint URL: %s", body)
+	}
+}
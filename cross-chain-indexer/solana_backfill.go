@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// getSignaturesForAddress 单页上限
+const solanaSignaturePageSize = 1000
+
+// solanaRPC 监听器用到的 Solana RPC 方法（SolanaPool 实现，测试中可替换）
+type solanaRPC interface {
+	splAccountReader
+	GetSignaturesForAddressWithOpts(ctx context.Context, account solana.PublicKey, opts *rpc.GetSignaturesForAddressOpts) ([]*rpc.TransactionSignature, error)
+	GetTransaction(ctx context.Context, sig solana.Signature, opts *rpc.GetTransactionOpts) (*rpc.GetTransactionResult, error)
+	GetSlot(ctx context.Context, commitment rpc.CommitmentType) (uint64, error)
+}
+
+// signatureRange 签名分页的边界：until 之后（不含）、slot >= minSlot 的签名
+type signatureRange struct {
+	until   solana.Signature // 零值表示不限
+	minSlot uint64
+	maxSlot uint64 // 0 表示不限
+}
+
+// Backfill 回填 slot 区间 [fromSlot, toSlot] 内的交易（toSlot 为 0 表示不设上限，不移动检查点）
+func (l *SolanaListener) Backfill(ctx context.Context, fromSlot, toSlot uint64) error {
+	log.Printf("Solana backfill[%s]: slots [%d - %d]", l.cfg.Name, fromSlot, toSlot)
+	sigs, err := l.listSignatures(ctx, signatureRange{minSlot: fromSlot, maxSlot: toSlot})
+	if err != nil {
+		return err
+	}
+	return l.processSignatures(ctx, sigs, l.handleSignature, nil)
+}
+
+// BackfillHistoricalTransactions 从检查点继续回填：向前分页直到检查点签名，
+// 再从旧到新处理并推进检查点（签名 + slot）
+//
+// 无检查点时从 start_slot 开始；未配置 start_slot 时回填最近 BackfillDepth 个 slot（0 表示全部历史）。
+func (l *SolanaListener) BackfillHistoricalTransactions(ctx context.Context) error {
+	program := l.programAddr.String()
+	cp, ok, err := l.store.GetCheckpoint(l.cfg.Name, program)
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+
+	if ok {
+		l.restorePosition(cp)
+	}
+
+	var r signatureRange
+	switch {
+	case ok && cp.Signature != "":
+		if r.until, err = solana.SignatureFromBase58(cp.Signature); err != nil {
+			return fmt.Errorf("invalid checkpoint signature %q: %w", cp.Signature, err)
+		}
+		// 检查点签名若已不在 RPC 节点的历史中，以 slot 兜底
+		r.minSlot = cp.Block
+	case l.cfg.Program.StartSlot > 0:
+		r.minSlot = l.cfg.Program.StartSlot
+	case l.cfg.BackfillDepth > 0:
+		latest, err := l.client.GetSlot(ctx, rpc.CommitmentFinalized)
+		if err != nil {
+			return fmt.Errorf("get slot: %w", err)
+		}
+		if latest > l.cfg.BackfillDepth {
+			r.minSlot = latest - l.cfg.BackfillDepth
+		}
+	}
+	sigs, err := l.listSignatures(ctx, r)
+	if err != nil {
+		return err
+	}
+	if len(sigs) > 0 {
+		log.Printf("Solana backfill[%s]: %d signature(s) after %q (min slot %d), program %s", l.cfg.Name, len(sigs), cp.Signature, r.minSlot, program)
+	}
+	return l.processSignatures(ctx, sigs, l.handleSignature, l.commitPosition)
+}
+
+// listSignatures 从最新签名向前（before）分页，直到 until、低于 minSlot 或历史耗尽；
+// 返回按从旧到新排列的签名
+func (l *SolanaListener) listSignatures(ctx context.Context, r signatureRange) ([]*rpc.TransactionSignature, error) {
+	limit := solanaSignaturePageSize
+	opts := &rpc.GetSignaturesForAddressOpts{
+		Limit:      &limit,
+		Until:      r.until,
+		Commitment: rpc.CommitmentFinalized,
+	}
+
+	var sigs []*rpc.TransactionSignature
+	for {
+		page, err := l.client.GetSignaturesForAddressWithOpts(ctx, l.programAddr, opts)
+		if err != nil {
+			return nil, fmt.Errorf("get signatures before %s: %w", opts.Before, err)
+		}
+
+		done := len(page) < limit
+		for _, sig := range page {
+			if sig.Slot < r.minSlot {
+				done = true
+				break
+			}
+			if r.maxSlot == 0 || sig.Slot <= r.maxSlot {
+				sigs = append(sigs, sig)
+			}
+		}
+		if len(page) > 0 {
+			opts.Before = page[len(page)-1].Signature
+		}
+		if done || len(page) == 0 {
+			break
+		}
+		log.Printf("Solana backfill[%s]: listed %d signatures (down to slot %d)", l.cfg.Name, len(sigs), page[len(page)-1].Slot)
+	}
+
+	for i, j := 0, len(sigs)-1; i < j; i, j = i+1, j-1 {
+		sigs[i], sigs[j] = sigs[j], sigs[i]
+	}
+	return sigs, nil
+}
+
+// processSignatures 以有限并发拉取交易，按从旧到新的顺序交给 handle；
+// 每批处理完后以批内最后一笔调用 commit（为 nil 时不提交检查点）
+//
+// 拉取失败（重试耗尽）或写入死信失败时立即返回、不提交该批次，已提交的进度保留。
+func (l *SolanaListener) processSignatures(ctx context.Context, sigs []*rpc.TransactionSignature,
+	handle func(*rpc.TransactionSignature, *rpc.GetTransactionResult) error, commit func(*rpc.TransactionSignature) error) error {
+	concurrency := l.cfg.Backfill.Concurrency
+	batchSize := concurrency * 8
+
+	indexed := 0
+	for start := 0; start < len(sigs); start += batchSize {
+		batch := sigs[start:min(start+batchSize, len(sigs))]
+		txs := make([]*rpc.GetTransactionResult, len(batch))
+		errs := make([]error, len(batch))
+
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, sig := range batch {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int, sig solana.Signature) {
+				defer func() { <-sem; wg.Done() }()
+				txs[i], errs[i] = l.fetchTransaction(ctx, sig)
+			}(i, sig.Signature)
+		}
+		wg.Wait()
+
+		for i, sig := range batch {
+			if errs[i] != nil {
+				return fmt.Errorf("get transaction %s: %w", sig.Signature, errs[i])
+			}
+			if txs[i] == nil || txs[i].Meta == nil {
+				log.Printf("Solana backfill[%s]: transaction %s not available, moved to dead-letter queue", l.cfg.Name, sig.Signature)
+				if err := l.deadLetter(sig, "", classify(ErrorClassRPC, errSolanaTxUnavailable)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := handle(sig, txs[i]); err == nil {
+				indexed++
+			} else if errors.Is(err, errDeadLetterWrite) {
+				return err
+			}
+			l.state.observeBlock(sig.Slot)
+		}
+		if commit != nil {
+			if err := commit(batch[len(batch)-1]); err != nil {
+				return fmt.Errorf("commit checkpoint: %w", err)
+			}
+		}
+		log.Printf("Solana backfill[%s]: processed %d/%d, indexed: %d", l.cfg.Name, start+len(batch), len(sigs), indexed)
+	}
+	return nil
+}
+
+// handleSignature 解析并保存一笔交易；处理失败（不相关的交易除外）时放入死信队列，
+// 写入死信也失败时返回 errDeadLetterWrite（调用方不得推进检查点）
+func (l *SolanaListener) handleSignature(sig *rpc.TransactionSignature, tx *rpc.GetTransactionResult) error {
+	err := l.parseAndStore(tx, sig)
+	if err == nil || isIrrelevantSolanaTx(err) {
+		return err
+	}
+	log.Printf("Solana backfill[%s]: failed to process tx %s (%s), moved to dead-letter queue: %v", l.cfg.Name, sig.Signature, errorClass(err), err)
+	l.state.setError(err)
+	payload, merr := json.Marshal(tx)
+	if merr != nil {
+		payload = nil // 重试时重新拉取交易
+	}
+	if derr := l.deadLetter(sig, string(payload), err); derr != nil {
+		return derr
+	}
+	return err
+}
+
+// errSolanaTxUnavailable RPC 节点（暂时）返回不了交易详情
+var errSolanaTxUnavailable = errors.New("transaction not available")
+
+// deadLetter 将处理失败的交易放入死信队列（payload 为空时重试会重新拉取交易）
+func (l *SolanaListener) deadLetter(sig *rpc.TransactionSignature, payload string, cause error) error {
+	return addDeadLetter(l.store, DeadLetter{
+		Chain:       l.cfg.Name,
+		TxHash:      sig.Signature.String(),
+		BlockNumber: sig.Slot,
+		Payload:     payload,
+	}, cause)
+}
+
+// RetryDeadLetter 重新处理一条死信：按保存的交易重新解析，未保存交易时重新拉取
+func (l *SolanaListener) RetryDeadLetter(ctx context.Context, dl DeadLetter) error {
+	sig, err := solana.SignatureFromBase58(dl.TxHash)
+	if err != nil {
+		return classify(ErrorClassDecode, fmt.Errorf("invalid signature: %v", err))
+	}
+	var tx *rpc.GetTransactionResult
+	if dl.Payload != "" {
+		tx = new(rpc.GetTransactionResult)
+		if err := json.Unmarshal([]byte(dl.Payload), tx); err != nil {
+			return classify(ErrorClassDecode, fmt.Errorf("invalid transaction payload: %v", err))
+		}
+	} else {
+		if tx, err = l.fetchTransaction(ctx, sig); err != nil {
+			return classify(ErrorClassRPC, err)
+		}
+		if tx == nil || tx.Meta == nil {
+			return classify(ErrorClassRPC, errSolanaTxUnavailable)
+		}
+	}
+	err = l.parseAndStore(tx, &rpc.TransactionSignature{Signature: sig, Slot: tx.Slot, BlockTime: tx.BlockTime})
+	if isIrrelevantSolanaTx(err) {
+		return nil
+	}
+	return err
+}
+
+// fetchTransaction 拉取交易详情（限速；失败时按指数退避重试 MaxRetries 次）
+func (l *SolanaListener) fetchTransaction(ctx context.Context, sig solana.Signature) (*rpc.GetTransactionResult, error) {
+	maxVer := uint64(0)
+	opts := &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentFinalized,
+		MaxSupportedTransactionVersion: &maxVer,
+	}
+	backoff := 1 * time.Second
+	for attempt := 0; ; attempt++ {
+		tx, err := l.client.GetTransaction(ctx, sig, opts)
+		if err == nil || errors.Is(err, rpc.ErrNotFound) {
+			return tx, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= l.cfg.Backfill.MaxRetries {
+			return nil, err
+		}
+		if !sleepCtx(ctx, backoff) {
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// fakeSolanaRPC 按 before/until/limit 语义分页的内存签名历史（sigs 从新到旧）
+type fakeSolanaRPC struct {
+	sigs  []*rpc.TransactionSignature
+	slot  uint64
+	pages int32
+
+	inFlight, maxInFlight int32
+	mu                    sync.Mutex
+	fetched               []solana.Signature
+
+	tx *rpc.GetTransactionResult // 非空时所有签名都返回该交易
+}
+
+func newFakeSolanaRPC(n int, firstSlot uint64) *fakeSolanaRPC {
+	f := &fakeSolanaRPC{slot: firstSlot + uint64(n)}
+	for i := n - 1; i >= 0; i-- {
+		var sig solana.Signature
+		sig[0], sig[1], sig[2] = byte(i>>8), byte(i), 1
+		bt := solana.UnixTimeSeconds(1700000000 + i)
+		f.sigs = append(f.sigs, &rpc.TransactionSignature{Signature: sig, Slot: firstSlot + uint64(i), BlockTime: &bt})
+	}
+	return f
+}
+
+func (f *fakeSolanaRPC) GetSignaturesForAddressWithOpts(_ context.Context, _ solana.PublicKey, opts *rpc.GetSignaturesForAddressOpts) ([]*rpc.TransactionSignature, error) {
+	atomic.AddInt32(&f.pages, 1)
+	start := 0
+	if !opts.Before.IsZero() {
+		for i, s := range f.sigs {
+			if s.Signature == opts.Before {
+				start = i + 1
+			}
+		}
+	}
+	var page []*rpc.TransactionSignature
+	for _, s := range f.sigs[start:] {
+		if s.Signature == opts.Until || len(page) == *opts.Limit {
+			break
+		}
+		page = append(page, s)
+	}
+	return page, nil
+}
+
+func (f *fakeSolanaRPC) GetTransaction(_ context.Context, sig solana.Signature, _ *rpc.GetTransactionOpts) (*rpc.GetTransactionResult, error) {
+	n := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&f.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&f.maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	f.mu.Lock()
+	f.fetched = append(f.fetched, sig)
+	f.mu.Unlock()
+	if f.tx != nil {
+		return f.tx, nil
+	}
+	return nil, rpc.ErrNotFound
+}
+
+func (f *fakeSolanaRPC) GetAccountInfo(context.Context, solana.PublicKey) (*rpc.GetAccountInfoResult, error) {
+	return nil, rpc.ErrNotFound
+}
+
+func (f *fakeSolanaRPC) GetSlot(context.Context, rpc.CommitmentType) (uint64, error) {
+	return f.slot, nil
+}
+
+func newTestSolanaListener(t *testing.T, client solanaRPC, store *Store) *SolanaListener {
+	t.Helper()
+	cfg := SolanaChainConfig{Name: "Solana Devnet", EID: 40168, Program: ProgramConfig{ProgramID: "GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1"}}
+	cfg.Backfill = BackfillOptions{Concurrency: 3, MaxRetries: 1}.withDefaults()
+	return &SolanaListener{
+		cfg:         cfg,
+		client:      client,
+		programAddr: solana.MustPublicKeyFromBase58(cfg.Program.ProgramID),
+		store:       store,
+		queue:       NewWorkQueue(ProcessingOptions{}),
+		state:       newListenerState(cfg.Name, cfg.EID),
+	}
+}
+
+func TestListSignaturesPaging(t *testing.T) {
+	f := newFakeSolanaRPC(2500, 1000)
+	l := newTestSolanaListener(t, f, nil)
+
+	sigs, err := l.listSignatures(context.Background(), signatureRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 2500 || f.pages != 3 {
+		t.Fatalf("got %d signatures in %d pages, want 2500 in 3", len(sigs), f.pages)
+	}
+	for i := 1; i < len(sigs); i++ {
+		if sigs[i].Slot <= sigs[i-1].Slot {
+			t.Fatalf("signatures not oldest-first at %d", i)
+		}
+	}
+
+	// until：只返回检查点签名之后的
+	f.pages = 0
+	sigs, _ = l.listSignatures(context.Background(), signatureRange{until: f.sigs[1200].Signature})
+	if len(sigs) != 1200 || sigs[0].Signature != f.sigs[1199].Signature || f.pages != 2 {
+		t.Errorf("until: got %d signatures in %d pages", len(sigs), f.pages)
+	}
+
+	// minSlot / maxSlot：低于 minSlot 即停止分页
+	f.pages = 0
+	sigs, _ = l.listSignatures(context.Background(), signatureRange{minSlot: 3300, maxSlot: 3400})
+	if len(sigs) != 101 || sigs[0].Slot != 3300 || sigs[100].Slot != 3400 || f.pages != 1 {
+		t.Errorf("slot range: got %d signatures in %d pages", len(sigs), f.pages)
+	}
+}
+
+func TestProcessSignaturesOrderAndCommit(t *testing.T) {
+	s := newTestStore(t)
+	f := newFakeSolanaRPC(50, 1)
+	l := newTestSolanaListener(t, f, s)
+	sigs, _ := l.listSignatures(context.Background(), signatureRange{})
+
+	var commits []uint64
+	err := l.processSignatures(context.Background(), sigs, nil, func(sig *rpc.TransactionSignature) error {
+		commits = append(commits, sig.Slot)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 批大小 = 并发 × 8 = 24
+	if len(commits) != 3 || commits[0] != 24 || commits[1] != 48 || commits[2] != 50 {
+		t.Errorf("commits = %v, want [24 48 50]", commits)
+	}
+	if len(f.fetched) != 50 || f.maxInFlight > 3 {
+		t.Errorf("fetched %d, max in flight %d", len(f.fetched), f.maxInFlight)
+	}
+	// 取不到的交易进入死信队列，不阻塞检查点
+	if counts, err := s.CountDeadLetters(); err != nil || counts[DeadLetterPending] != 50 {
+		t.Errorf("dead letters = %v, %v", counts, err)
+	}
+}
+
+// failingDeadLetterStore 处理交易与写入死信都失败的存储
+type failingDeadLetterStore struct{ *Store }
+
+func (failingDeadLetterStore) EventProcessed(string, uint) (bool, error) {
+	return false, errors.New("database is locked")
+}
+
+func (failingDeadLetterStore) AddDeadLetter(DeadLetter) error { return errors.New("disk full") }
+
+// TestSolanaDeadLetterFailureKeepsCheckpoint 处理失败且写入死信失败的交易既未索引也未入队：检查点不推进
+func TestSolanaDeadLetterFailureKeepsCheckpoint(t *testing.T) {
+	s := newTestStore(t)
+	f := newFakeSolanaRPC(5, 100)
+	f.tx = &rpc.GetTransactionResult{Meta: &rpc.TransactionMeta{}}
+	l := newTestSolanaListener(t, f, s)
+	l.store = failingDeadLetterStore{s}
+	program := l.programAddr.String()
+
+	start := f.sigs[len(f.sigs)-1]
+	if err := s.SetCheckpoint(l.cfg.Name, program, Checkpoint{Block: start.Slot, Signature: start.Signature.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.BackfillHistoricalTransactions(context.Background()); !errors.Is(err, errDeadLetterWrite) {
+		t.Fatalf("backfill error = %v, want errDeadLetterWrite", err)
+	}
+	if cp, _, err := s.GetCheckpoint(l.cfg.Name, program); err != nil || cp.Block != start.Slot {
+		t.Errorf("checkpoint = %+v, %v; want it to stay at slot %d", cp, err, start.Slot)
+	}
+
+	// 实时通知同样不返回用于推进检查点的位置
+	if sig, err := l.handleLogNotification(context.Background(), f.sigs[0].Signature); !errors.Is(err, errDeadLetterWrite) || sig != nil {
+		t.Errorf("handleLogNotification = %v, %v; want errDeadLetterWrite", sig, err)
+	}
+}
+
+func TestBackfillHistoricalResumesFromCheckpoint(t *testing.T) {
+	s := newTestStore(t)
+	f := newFakeSolanaRPC(30, 500)
+	l := newTestSolanaListener(t, f, s)
+	program := l.programAddr.String()
+
+	// 已处理到第 10 笔
+	done := f.sigs[len(f.sigs)-10]
+	if err := s.SetCheckpoint(l.cfg.Name, program, Checkpoint{Block: done.Slot, Signature: done.Signature.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.BackfillHistoricalTransactions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.fetched) != 20 {
+		t.Errorf("fetched %d transactions, want 20", len(f.fetched))
+	}
+
+	// 检查点推进到最新签名，签名未被小写化
+	cp, ok, err := s.GetCheckpoint(l.cfg.Name, program)
+	if err != nil || !ok || cp.Block != 529 || cp.Signature != f.sigs[0].Signature.String() {
+		t.Errorf("checkpoint = %+v, %v, %v", cp, ok, err)
+	}
+
+	// 再次运行无新签名
+	f.fetched = nil
+	if err := l.BackfillHistoricalTransactions(context.Background()); err != nil || len(f.fetched) != 0 {
+		t.Errorf("second run fetched %d, err %v", len(f.fetched), err)
+	}
+}
+
+func TestSolanaPollingCatchUpAfterGap(t *testing.T) {
+	s := newTestStore(t)
+	f := newFakeSolanaRPC(40, 100)
+	all := f.sigs
+	f.sigs = all[10:] // 断线前已落地的 30 笔
+	l := newTestSolanaListener(t, f, s)
+
+	l.pollForNewTransactions(context.Background(), 0)
+	if slot, sig := l.lastPosition(); slot != 129 || sig != all[10].Signature {
+		t.Fatalf("position = %d %s, want 129", slot, sig)
+	}
+
+	// 断线期间又落地 10 笔：下一次追赶只处理这 10 笔
+	f.sigs, f.fetched = all, nil
+	l.pollForNewTransactions(context.Background(), 0)
+	if len(f.fetched) != 10 {
+		t.Errorf("fetched %d after gap, want 10", len(f.fetched))
+	}
+	if l.Status().State != ListenerStatePolling {
+		t.Errorf("state = %s, want %s", l.Status().State, ListenerStatePolling)
+	}
+
+	// 缓冲的较旧通知不回退检查点
+	if err := l.commitPosition(all[20]); err != nil {
+		t.Fatal(err)
+	}
+	cp, _, _ := s.GetCheckpoint(l.cfg.Name, l.programAddr.String())
+	if cp.Block != 139 || cp.Signature != all[0].Signature.String() {
+		t.Errorf("checkpoint regressed to %+v", cp)
+	}
+
+	// 重启后从持久化的检查点恢复位置
+	l2 := newTestSolanaListener(t, f, s)
+	f.fetched = nil
+	if err := l2.BackfillHistoricalTransactions(context.Background()); err != nil || len(f.fetched) != 0 {
+		t.Errorf("restart fetched %d, err %v", len(f.fetched), err)
+	}
+	if slot, _ := l2.lastPosition(); slot != 139 {
+		t.Errorf("restored slot %d, want 139", slot)
+	}
+}
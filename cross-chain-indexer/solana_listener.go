@@ -2,19 +2,18 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
-	"github.com/gagliardetto/solana-go/rpc/ws"
 )
 
 // Solana 日志文件
@@ -51,192 +50,336 @@ func logToFile(message string) {
 	}
 }
 
+// SolanaChainConfig 一条 Solana 链的监听配置
+type SolanaChainConfig struct {
+	Name string
+	EID  uint32
+	// RPC 端点（第一个为主端点，其余为备用；WSS 为空时由 HTTPS 推导）
+	RPC []RPCEndpoint
+	// MaxHeadLag 端点落后最高端点超过该 slot 数时视为不健康（0 使用默认值）
+	MaxHeadLag uint64
+	Program    ProgramConfig // transfer_contract
+	OApp       ProgramConfig // my_oapp（未配置时为零值）
+	// BackfillDepth 无检查点且未配置 start_slot 时回填的 slot 数（0 表示回填全部历史）
+	BackfillDepth uint64
+	Backfill      BackfillOptions
+	// Processing 实时通知处理队列
+	Processing ProcessingOptions
+}
+
+const (
+	solanaPollInterval    = 15 * time.Second // 轮询模式的追赶周期
+	solanaWSRetryInterval = 5 * time.Minute  // 轮询模式下重试 WebSocket 的间隔
+)
+
+// errSolanaWSUnavailable WebSocket 连接或订阅失败（退化为轮询）
+var errSolanaWSUnavailable = errors.New("WebSocket unavailable")
+
 // SolanaListener 负责监听 Solana 程序的交易
 type SolanaListener struct {
-	rpcURL      string
+	cfg         SolanaChainConfig
+	client      solanaRPC   // 通常即 rpc；测试中可替换
+	rpc         *SolanaPool // 多端点 RPC 池（按端点限速；测试中为 nil）
 	programAddr solana.PublicKey
-	store       *Store
-}
-
-// TransferOutInstruction transfer_out 指令数据结构
-type TransferOutInstruction struct {
-	Discriminator [8]byte // Anchor 指令 discriminator
-	Amount        uint64  // 转账金额
+	oappProgram solana.PublicKey // my_oapp 程序（零值表示不限定程序，按 lz_receive discriminator 识别）
+	transferIDL *AnchorProgram   // transfer_contract 指令 / 事件解码器
+	oappIDL     *AnchorProgram   // my_oapp 指令 / 事件解码器
+	store       Storage
+	queue       *WorkQueue // 实时通知处理队列
+
+	state *listenerState
+
+	// 最后处理（并写入检查点）的位置
+	posMu    sync.Mutex
+	lastSlot uint64
+	lastSig  solana.Signature
+
+	runMu     sync.Mutex
+	cancel    context.CancelFunc
+	queueDone chan struct{} // 处理队列停止后关闭
 }
 
 // NewSolanaListener 创建 Solana 监听器
-func NewSolanaListener(rpcURL string, programAddrStr string, store *Store) (*SolanaListener, error) {
-	programAddr, err := solana.PublicKeyFromBase58(programAddrStr)
+//
+// 两个程序的 Anchor IDL 在此加载（配置了 idl 路径时读取文件，否则使用内置 IDL）。
+func NewSolanaListener(cfg SolanaChainConfig, store Storage) (*SolanaListener, error) {
+	programAddr, err := solana.PublicKeyFromBase58(cfg.Program.ProgramID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid Solana program address: %w", err)
 	}
+	var oappProgram solana.PublicKey
+	if cfg.OApp.ProgramID != "" {
+		if oappProgram, err = solana.PublicKeyFromBase58(cfg.OApp.ProgramID); err != nil {
+			return nil, fmt.Errorf("invalid Solana OApp program address: %w", err)
+		}
+	}
+	if cfg.Program.Role == "" {
+		cfg.Program.Role = ProgramRoleTransfer
+	}
+	if cfg.OApp.Role == "" {
+		cfg.OApp.Role = ProgramRoleOApp
+	}
+	transferIDL, err := loadProgramIDL(cfg.Program)
+	if err != nil {
+		return nil, err
+	}
+	oappIDL, err := loadProgramIDL(cfg.OApp)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := NewSolanaPool(cfg.Name, cfg.RPC, cfg.MaxHeadLag)
+	if err != nil {
+		return nil, fmt.Errorf("Solana listener[%s]: %w", cfg.Name, err)
+	}
+	cfg.Backfill = cfg.Backfill.withDefaults()
 
 	return &SolanaListener{
-		rpcURL:      rpcURL,
+		cfg:         cfg,
+		client:      pool,
+		rpc:         pool,
 		programAddr: programAddr,
+		oappProgram: oappProgram,
+		transferIDL: transferIDL,
+		oappIDL:     oappIDL,
 		store:       store,
+		queue:       NewWorkQueue(cfg.Processing),
+		state:       newListenerState(cfg.Name, cfg.EID),
 	}, nil
 }
 
-// BackfillHistoricalTransactions 回填历史交易
-func (l *SolanaListener) BackfillHistoricalTransactions(ctx context.Context, limit int) error {
-	log.Printf("Solana backfill: starting (limit: %d), program: %s", limit, l.programAddr.String())
+// Name 链名称
+func (l *SolanaListener) Name() string { return l.cfg.Name }
 
-	client := rpc.New(l.rpcURL)
-
-	// 获取程序的签名列表
-	sigs, err := client.GetSignaturesForAddress(ctx, l.programAddr)
-	if err != nil {
-		log.Printf("Solana backfill ERROR: failed to get signatures: %v", err)
-		return fmt.Errorf("failed to get signatures: %w", err)
+// Status 当前状态快照（含处理队列指标与 RPC 端点健康状况）
+func (l *SolanaListener) Status() ListenerStatus {
+	st := l.state.snapshot()
+	q := l.queue.Stats()
+	st.Queue = &q
+	if l.rpc != nil {
+		st.Endpoints = l.rpc.Health()
 	}
+	return st
+}
 
-	log.Printf("Solana backfill: found %d total transactions", len(sigs))
+// Start 启动追赶与 WebSocket 实时监听（非阻塞，断线自动重连，WebSocket 不可用时轮询）
+func (l *SolanaListener) Start(ctx context.Context) error {
+	l.runMu.Lock()
+	defer l.runMu.Unlock()
+	if l.cancel != nil {
+		return fmt.Errorf("Solana listener %s already running", l.cfg.Name)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	l.cancel = cancel
+	queueDone := make(chan struct{})
+	l.queueDone = queueDone
+	go func() {
+		defer close(queueDone)
+		l.queue.Run(runCtx)
+	}()
+	go l.rpc.Run(runCtx)
+
+	log.Printf("Solana listener[%s]: starting, rpc %s", l.cfg.Name, l.rpc)
+	go l.run(runCtx)
+	return nil
+}
 
-	successCount := 0
-	errorCount := 0
-	parsedCount := 0
+// Stop 停止所有后台协程，并等待正在处理的交易结束（其 context 已取消）
+func (l *SolanaListener) Stop() error {
+	l.runMu.Lock()
+	defer l.runMu.Unlock()
+	if l.cancel != nil {
+		l.cancel()
+		l.cancel = nil
+		<-l.queueDone
+	}
+	l.state.setState(ListenerStateStopped)
+	return nil
+}
 
-	// 处理每个交易
-	for i, sig := range sigs {
-		if i >= limit {
-			break
+// run 实时监听主循环：每次（重新）订阅后先从检查点追赶；
+// WebSocket 连接或订阅失败时退化为轮询，solanaWSRetryInterval 后再尝试 WebSocket
+func (l *SolanaListener) run(ctx context.Context) {
+	for {
+		l.state.setState(ListenerStateConnecting)
+		err := l.ListenForNewTransactions(ctx)
+		if ctx.Err() != nil {
+			return
 		}
-
-		if sig.Err != nil {
-			// 跳过失败的交易
-			errorCount++
+		// 端点不再健康：立即连接更健康的端点并从检查点追赶
+		if errors.Is(err, errRPCFailover) {
+			log.Printf("Solana listener[%s]: %v, reconnecting", l.cfg.Name, err)
 			continue
 		}
-
-		// 获取交易详情
-		maxVer := uint64(0)
-		tx, err := client.GetTransaction(ctx, sig.Signature, &rpc.GetTransactionOpts{
-			Encoding:                       solana.EncodingBase64,
-			MaxSupportedTransactionVersion: &maxVer,
-		})
+		l.state.setState(ListenerStateDisconnected)
 		if err != nil {
-			log.Printf("Solana backfill: failed to get transaction %s: %v", sig.Signature, err)
-			errorCount++
-			continue
+			l.state.setError(err)
 		}
-
-		if tx == nil || tx.Meta == nil {
-			errorCount++
+		if errors.Is(err, errSolanaWSUnavailable) {
+			log.Printf("Solana listener[%s]: %v, polling for %s", l.cfg.Name, err, solanaWSRetryInterval)
+			l.pollForNewTransactions(ctx, solanaWSRetryInterval)
 			continue
 		}
-
-		// 解析交易并保存
-		if err := l.parseAndStore(tx, sig); err != nil {
-			if err.Error() != "not a relevant transaction" {
-				log.Printf("Solana backfill: parse error tx %s: %v", sig.Signature, err)
-			}
-			continue
-		}
-
-		parsedCount++
-		successCount++
-
-		// 进度显示
-		if (i+1)%10 == 0 {
-			log.Printf("Solana backfill: processed %d/%d, indexed: %d", i+1, len(sigs), parsedCount)
+		log.Printf("Solana listener[%s]: %v, reconnecting in 5s...", l.cfg.Name, err)
+		if !sleepCtx(ctx, 5*time.Second) {
+			return
 		}
 	}
-
-	log.Printf("Solana backfill: completed! Total: %d, Indexed: %d, Errors: %d", len(sigs), parsedCount, errorCount)
-	return nil
 }
 
-// ListenForNewTransactions 实时监听新交易
+// ListenForNewTransactions 订阅程序日志并实时处理新交易
+//
+// 订阅建立后才从检查点追赶：断线期间以及追赶过程中落地的交易要么由追赶补上，
+// 要么缓冲在订阅中，不会遗漏。通知交给处理队列并发拉取、处理，按到达顺序推进检查点；
+// 队列满时停止从订阅接收。
 func (l *SolanaListener) ListenForNewTransactions(ctx context.Context) error {
-	log.Println("Solana listener: starting WebSocket connection")
-
-	// 将 HTTPS URL 转换为 WSS URL
-	wsURL := convertToWebSocketURL(l.rpcURL)
-	log.Printf("Solana listener: connecting to %s", wsURL)
-
-	// 创建 WebSocket 客户端
-	wsClient, err := ws.Connect(ctx, wsURL)
+	wsClient, subCtx, stop, err := l.rpc.ConnectWS(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to connect WebSocket: %w", err)
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("%w: connect: %v", errSolanaWSUnavailable, err)
 	}
+	defer stop()
 	defer wsClient.Close()
 
-	// 订阅程序日志
 	sub, err := wsClient.LogsSubscribeMentions(l.programAddr, rpc.CommitmentFinalized)
 	if err != nil {
-		return fmt.Errorf("failed to subscribe logs: %w", err)
+		return fmt.Errorf("%w: subscribe logs: %v", errSolanaWSUnavailable, err)
 	}
 	defer sub.Unsubscribe()
 
-	log.Println("Solana listener: subscribed to program logs")
+	if err := l.BackfillHistoricalTransactions(ctx); err != nil {
+		return fmt.Errorf("catch-up: %w", err)
+	}
+	slot, sig := l.lastPosition()
+	log.Printf("Solana listener[%s]: subscribed to program logs, caught up to slot %d (%s)", l.cfg.Name, slot, sig)
+	l.state.setState(ListenerStateConnected)
+
+	// 返回前等待已接收的通知处理完成（并清除失败状态），下一次追赶才从检查点开始
+	defer func() { _ = l.queue.Flush(ctx) }()
 
-	// 接收循环
 	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case result := <-sub.Response():
-			if result == nil {
-				continue
+		// Recv 而非 Response()：后者每次调用都起一个取走一条通知的协程，select 未选中时通知会丢失
+		result, err := sub.Recv(subCtx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
 			}
-
-			// 处理日志
-			go l.handleLogNotification(result)
-		case err := <-sub.Err():
+			if cause := context.Cause(subCtx); errors.Is(cause, errRPCFailover) {
+				return cause
+			}
+			return fmt.Errorf("subscription error: %w", err)
+		}
+		if result == nil {
+			continue
+		}
+		var sigInfo *rpc.TransactionSignature
+		err = l.queue.Submit(ctx, func(ctx context.Context) (err error) {
+			sigInfo, err = l.handleLogNotification(ctx, result.Value.Signature)
+			return err
+		}, func(err error) error {
+			// 拉取失败时断开重连，由追赶从检查点补上
 			if err != nil {
-				log.Printf("Solana listener: subscription error: %v", err)
 				return err
 			}
+			l.state.observeBlock(sigInfo.Slot)
+			return l.commitPosition(sigInfo)
+		})
+		if err != nil {
+			return err
 		}
 	}
 }
 
-// handleLogNotification 处理实时日志通知
-func (l *SolanaListener) handleLogNotification(result *ws.LogResult) {
-	if result.Value.Err != nil {
-		// 跳过失败的交易
-		return
-	}
+// pollForNewTransactions 轮询模式：每 solanaPollInterval 从检查点追赶一次，持续 d 后返回
+func (l *SolanaListener) pollForNewTransactions(ctx context.Context, d time.Duration) {
+	l.state.setState(ListenerStatePolling)
+	deadline := time.Now().Add(d)
 
-	// 获取交易签名
-	sig := result.Value.Signature
+	ticker := time.NewTicker(solanaPollInterval)
+	defer ticker.Stop()
 
-	// 获取交易详情
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	for {
+		if err := l.BackfillHistoricalTransactions(ctx); err != nil {
+			log.Printf("Solana listener[%s] poll: %v", l.cfg.Name, err)
+			l.state.setError(err)
+		}
+		if !time.Now().Before(deadline) {
+			return
+		}
 
-	client := rpc.New(l.rpcURL)
-	maxVer := uint64(0)
-	tx, err := client.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
-		Encoding:                       solana.EncodingBase64,
-		MaxSupportedTransactionVersion: &maxVer,
-	})
-	if err != nil {
-		log.Printf("Solana listener: failed to get transaction %s: %v", sig, err)
-		return
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	if tx == nil {
-		return
+// handleLogNotification 拉取并处理实时通知中的交易（失败的交易同样处理：lz_receive / transfer_out 执行失败），
+// 返回用于推进检查点的签名信息（写入死信失败时返回错误）
+func (l *SolanaListener) handleLogNotification(ctx context.Context, sig solana.Signature) (*rpc.TransactionSignature, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	tx, err := l.fetchTransaction(fetchCtx, sig)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction %s: %w", sig, err)
+	}
+	if tx == nil || tx.Meta == nil {
+		return nil, fmt.Errorf("transaction %s not available yet", sig)
 	}
 
-	// 解析并保存
 	sigInfo := &rpc.TransactionSignature{
 		Signature: sig,
 		BlockTime: tx.BlockTime,
 		Slot:      tx.Slot,
 	}
+	// 处理失败的交易已放入死信队列；写入死信也失败时不推进检查点，断开重连后由追赶重新处理
+	if err := l.handleSignature(sigInfo, tx); errors.Is(err, errDeadLetterWrite) {
+		return nil, err
+	}
+	return sigInfo, nil
+}
+
+// lastPosition 最后处理的 slot 与签名
+func (l *SolanaListener) lastPosition() (uint64, solana.Signature) {
+	l.posMu.Lock()
+	defer l.posMu.Unlock()
+	return l.lastSlot, l.lastSig
+}
 
-	if err := l.parseAndStore(tx, sigInfo); err != nil {
-		log.Printf("Solana listener: failed to parse tx %s: %v", sig, err)
+// restorePosition 以持久化的检查点初始化最后位置（不回退）
+func (l *SolanaListener) restorePosition(cp Checkpoint) {
+	sig, err := solana.SignatureFromBase58(cp.Signature)
+	if err != nil {
+		return
+	}
+	l.posMu.Lock()
+	defer l.posMu.Unlock()
+	if cp.Block > l.lastSlot {
+		l.lastSlot, l.lastSig = cp.Block, sig
 	}
 }
 
+// commitPosition 记录最后处理的签名并写入检查点（slot 只增不减：
+// 追赶期间缓冲的较旧通知不会把检查点拉回）
+func (l *SolanaListener) commitPosition(sig *rpc.TransactionSignature) error {
+	l.posMu.Lock()
+	defer l.posMu.Unlock()
+	if sig.Slot < l.lastSlot {
+		return nil
+	}
+	if err := l.store.SetCheckpoint(l.cfg.Name, l.programAddr.String(), Checkpoint{Block: sig.Slot, Signature: sig.Signature.String()}); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	l.lastSlot, l.lastSig = sig.Slot, sig.Signature
+	return nil
+}
+
 // parseAndStore 解析 Solana 交易并存储到数据库
 func (l *SolanaListener) parseAndStore(tx *rpc.GetTransactionResult, sig *rpc.TransactionSignature) error {
-	if tx == nil || tx.Meta == nil {
-		return fmt.Errorf("invalid transaction data")
+	if tx == nil || tx.Meta == nil || sig.BlockTime == nil {
+		return classify(ErrorClassDecode, fmt.Errorf("invalid transaction data"))
 	}
 
 	// 提取基本信息
@@ -244,165 +387,156 @@ func (l *SolanaListener) parseAndStore(tx *rpc.GetTransactionResult, sig *rpc.Tr
 	blockTime := time.Unix(int64(*sig.BlockTime), 0).UTC()
 	slot := sig.Slot
 
+	// 已处理过的交易（重放 / 重复通知）直接跳过
+	if done, err := l.store.EventProcessed(txHash, 0); err != nil || done {
+		return classify(ErrorClassStorage, err)
+	}
+
 	logMsg := fmt.Sprintf("Processing tx %s (slot: %d)", txHash[:min(20, len(txHash))], slot)
 	log.Println("Solana: " + logMsg)
 	logToFile(logMsg)
 
-	// 解析交易数据
-	txParsed, err := tx.Transaction.GetTransaction()
+	// 完整交易作为原始事件保存，与派生记录在同一事务中写入
+	ev, err := solanaTransactionEvent(l.cfg.Name, txHash, slot, blockTime, tx)
 	if err != nil {
-		return fmt.Errorf("failed to parse transaction: %w", err)
-	}
-	if txParsed == nil {
-		return fmt.Errorf("transaction is nil")
+		return classify(ErrorClassDecode, err)
 	}
 
-	// 遍历所有指令，查找 transfer_out
-	message := txParsed.Message
-	accounts := message.AccountKeys
-
-	var transferOutFound bool
-	var authority string
-	var recipient string
-	var mint string
-	var amount uint64
-
-	// 解析指令
-	for idx, instruction := range message.Instructions {
-		// 检查是否是我们的程序
-		if int(instruction.ProgramIDIndex) >= len(accounts) {
-			continue
-		}
-		programID := accounts[instruction.ProgramIDIndex]
-		if programID.String() != l.programAddr.String() {
-			continue
+	fx, err := l.decodeTransaction(tx, txHash, slot, blockTime)
+	if err != nil && !isIrrelevantSolanaTx(err) {
+		// 解码失败：只保存原始交易（parsed = 0），修复解码后可重新索引
+		if _, ierr := l.store.InsertEventIfNotExists(ev.Chain, ev.TxHash, 0, slot, "", ev.RawLog); ierr != nil {
+			return classify(ErrorClassStorage, ierr)
 		}
+		return classify(ErrorClassDecode, err)
+	}
+	if fx.Delivery != nil {
+		l.resolveToken(fx.Delivery.Token)
+	}
+	res, perr := l.store.PersistEvent(ev, fx)
+	if perr != nil {
+		return classify(ErrorClassStorage, fmt.Errorf("failed to save transaction: %w", perr))
+	}
+	if err != nil || res.Duplicate {
+		return err // 不相关的交易只保存原始交易与解码后的指令
+	}
 
-		// 解析指令数据
-		instructionData := instruction.Data
-		if len(instructionData) < 16 {
-			// transfer_out 指令至少需要 8字节 discriminator + 8字节 amount
-			continue
+	d := fx.Delivery
+	if d.Failed {
+		logMsg := fmt.Sprintf("execution failed in tx %s guid=%s: %s", txHash[:min(20, len(txHash))], d.GUID[:min(10, len(d.GUID))]+"...", d.Error)
+		log.Println("Solana: " + logMsg)
+		logToFile(logMsg)
+		if res.SrcTxHash != "" {
+			failed := *d
+			failed.SrcTxHash = res.SrcTxHash
+			alertDeliveryFailed(failed)
 		}
+		return nil
+	}
 
-		// 检查是否是 transfer_out 指令
-		// Anchor 的 transfer_out discriminator 可以从 IDL 计算，或通过日志识别
-		// 这里我们先通过日志消息确认
-		isTransferOut := false
-		for _, logLine := range tx.Meta.LogMessages {
-			if strings.Contains(logLine, "Instruction: TransferOut") ||
-				strings.Contains(logLine, "Program log: transfer_out") {
-				isTransferOut = true
-				break
-			}
-		}
+	if res.SrcTxHash != "" {
+		logMsg = fmt.Sprintf("Matched transfer_out %s to source payout %s", txHash[:min(20, len(txHash))], res.SrcTxHash)
+	} else {
+		logMsg = fmt.Sprintf("transfer_out %s has no source payout yet, kept as unmatched delivery", txHash[:min(20, len(txHash))])
+	}
+	log.Println("Solana: " + logMsg)
+	logToFile(logMsg)
 
-		if !isTransferOut {
-			// 也可以通过检查账户数量和结构来判断
-			// transfer_out 需要 7 个账户
-			if len(instruction.Accounts) == 7 {
-				// 可能是 transfer_out
-				isTransferOut = true
-			} else {
-				continue
-			}
-		}
+	logMsg = fmt.Sprintf("✅ Indexed transfer_out: tx=%s, recipient=%s, amount=%s, slot=%d",
+		txHash[:min(20, len(txHash))], d.Merchant[:min(10, len(d.Merchant))], d.Amount, slot)
+	log.Println("Solana: " + logMsg)
+	logToFile(logMsg)
 
-		transferOutFound = true
+	return nil
+}
 
-		// 解析金额（跳过 8 字节 discriminator）
-		if len(instructionData) >= 16 {
-			amount = binary.LittleEndian.Uint64(instructionData[8:16])
-		}
+// 不需要记录送达的交易（decodeTransaction 返回，原始交易与指令照常保存）
+var (
+	errNotRelevantTx  = errors.New("not a relevant transaction")
+	errNotTransferOut = errors.New("not a transfer_out transaction")
+	errNoRecipient    = errors.New("no recipient found")
+)
 
-		// 解析账户（按照 TransferOut 结构）
-		// 0: config (PDA)
-		// 1: authority (Signer) - 调用方
-		// 2: vault_authority (PDA)
-		// 3: vault_token_account (mut)
-		// 4: recipient_token_account (mut)
-		// 5: mint
-		// 6: token_program
-
-		if len(instruction.Accounts) >= 7 {
-			authorityIdx := instruction.Accounts[1]
-			recipientTokenAccountIdx := instruction.Accounts[4]
-			mintIdx := instruction.Accounts[5]
-
-			if int(authorityIdx) < len(accounts) {
-				authority = accounts[authorityIdx].String()
-			}
-			if int(mintIdx) < len(accounts) {
-				mint = accounts[mintIdx].String()
-			}
+// isIrrelevantSolanaTx 是否为不需要记录送达的交易
+func isIrrelevantSolanaTx(err error) bool {
+	return errors.Is(err, errNotRelevantTx) || errors.Is(err, errNotTransferOut) || errors.Is(err, errNoRecipient)
+}
 
-			// recipient 是 recipient_token_account 的 owner
-			// 需要从 Token Balance 中获取
-			if tx.Meta.PostTokenBalances != nil {
-				for _, bal := range tx.Meta.PostTokenBalances {
-					if bal.AccountIndex == uint16(recipientTokenAccountIdx) {
-						if bal.Owner != nil {
-							recipient = bal.Owner.String()
-						}
-						// 如果指令数据中的金额为0，从 balance 变化中获取
-						if amount == 0 && bal.UiTokenAmount.Amount != "" {
-							if amt, ok := new(big.Int).SetString(bal.UiTokenAmount.Amount, 10); ok {
-								amount = amt.Uint64()
-							}
-						}
-						break
-					}
-				}
-			}
-		}
+// decodeTransaction 按 IDL 解码一笔交易，得到与原始交易一起写入的派生记录（不访问 RPC，重新索引时复用）
+//
+// 成功的交易：解码后的指令与事件，以及 transfer_out 的送达记录（含 lz_receive 的 GUID）；
+// 失败的交易：若其中包含 OApp lz_receive 或 transfer_out，为一条失败的执行记录（匹配到的源链 payout 置为 Failed）。
+// 不需要记录送达的交易返回 errNotTransferOut 等，同时返回其余派生记录。
+func (l *SolanaListener) decodeTransaction(tx *rpc.GetTransactionResult, txHash string, slot uint64, blockTime time.Time) (EventEffects, error) {
+	// 解析交易数据
+	txParsed, err := tx.Transaction.GetTransaction()
+	if err != nil {
+		return EventEffects{}, fmt.Errorf("failed to parse transaction: %w", err)
+	}
+	if txParsed == nil {
+		return EventEffects{}, fmt.Errorf("transaction is nil")
+	}
 
-		logMsg := fmt.Sprintf("Found transfer_out instruction #%d: amount=%d, authority=%s, recipient=%s, mint=%s",
-			idx, amount, authority[:min(10, len(authority))], recipient[:min(10, len(recipient))], mint[:min(10, len(mint))])
-		log.Println("Solana: " + logMsg)
-		logToFile(logMsg)
+	// 完整账户表（含地址查找表）与按执行顺序展开的指令（含 CPI）
+	message := txParsed.Message
+	keys := transactionAccountKeys(message, tx.Meta)
+	ixs := flattenInstructions(message, tx.Meta, keys)
 
-		break // 只处理第一个 transfer_out 指令
+	// 按 IDL 解码 transfer_contract 与 my_oapp 的指令
+	decoded := l.decodeInstructions(ixs)
+	if tx.Meta.Err != nil {
+		return l.decodeFailedExecution(tx, keys, decoded, txHash, slot, blockTime)
+	}
+	events := decodeAnchorEvents(tx.Meta.LogMessages, l.transferIDL, l.oappIDL)
+	recs, err := l.decodedRecords(txHash, slot, blockTime, decoded, events)
+	if err != nil {
+		return EventEffects{}, fmt.Errorf("failed to encode decoded instructions: %w", err)
 	}
+	fx := EventEffects{Instructions: recs}
 
-	if !transferOutFound {
-		return fmt.Errorf("not a transfer_out transaction")
+	transferOut := l.findTransferOut(decoded)
+	if transferOut == nil {
+		return fx, errNotTransferOut
 	}
+	transferOutIdx := transferOut.Index
 
-	// 验证必需字段
-	if recipient == "" {
-		// 尝试从 Token Balance 变化中推断 recipient
-		if tx.Meta.PreTokenBalances != nil && tx.Meta.PostTokenBalances != nil {
-			for i, postBal := range tx.Meta.PostTokenBalances {
-				if i < len(tx.Meta.PreTokenBalances) {
-					preBal := tx.Meta.PreTokenBalances[i]
-					if postBal.UiTokenAmount.UiAmount != nil && preBal.UiTokenAmount.UiAmount != nil {
-						diff := *postBal.UiTokenAmount.UiAmount - *preBal.UiTokenAmount.UiAmount
-						if diff > 0 && postBal.Owner != nil {
-							// 余额增加的账户就是接收方
-							recipient = postBal.Owner.String()
-							if amount == 0 && postBal.UiTokenAmount.Amount != "" {
-								if amt, ok := new(big.Int).SetString(postBal.UiTokenAmount.Amount, 10); ok {
-									// 这里获取的是总余额，不是转账金额
-									// 需要计算差值
-									if preAmt, ok2 := new(big.Int).SetString(preBal.UiTokenAmount.Amount, 10); ok2 {
-										diff := new(big.Int).Sub(amt, preAmt)
-										amount = diff.Uint64()
-									}
-								}
-							}
-							break
-						}
-					}
-				}
+	var authority, recipient, mint string
+	amount, _ := transferOut.Args["amount"].(uint64)
+	if key, ok := transferOut.Accounts["authority"]; ok {
+		authority = key.String()
+	}
+	if key, ok := transferOut.Accounts["mint"]; ok {
+		mint = key.String()
+	}
+	if key, ok := transferOut.Accounts["recipient_token_account"]; ok {
+		// 实际到账以 transfer_out 发起的 SPL 转账为准
+		if t, ok := transferOut.splTransfer(splTransfers(ixs), key); ok {
+			if t.Amount != amount {
+				log.Printf("Solana: transfer_out amount %d differs from SPL transfer %d in tx %s", amount, t.Amount, txHash)
+				amount = t.Amount
 			}
+			if !t.Mint.IsZero() {
+				mint = t.Mint.String()
+			}
+		}
+		// recipient 是 recipient_token_account 的 owner，从 Token Balance 中获取
+		var accountMint string
+		recipient, accountMint = tokenAccountBalance(tx.Meta, keys, key)
+		if mint == "" {
+			mint = accountMint
 		}
 	}
 
+	logMsg := fmt.Sprintf("Found transfer_out instruction #%d: amount=%d, authority=%s, recipient=%s, mint=%s",
+		transferOutIdx, amount, authority[:min(10, len(authority))], recipient[:min(10, len(recipient))], mint[:min(10, len(mint))])
+	log.Println("Solana: " + logMsg)
+	logToFile(logMsg)
+
 	if recipient == "" {
 		logMsg := fmt.Sprintf("Cannot extract recipient from tx %s", txHash[:min(20, len(txHash))])
 		log.Println("Solana: " + logMsg)
 		logToFile(logMsg)
-		return fmt.Errorf("no recipient found")
+		return fx, errNoRecipient
 	}
 
 	if amount == 0 {
@@ -411,125 +545,212 @@ func (l *SolanaListener) parseAndStore(tx *rpc.GetTransactionResult, sig *rpc.Tr
 		logToFile(logMsg)
 	}
 
-	// 将 Solana 地址转换为伪 EVM 地址（用于存储）
-	merchantAddr := solanaAddressToEVMAddress(recipient)
-	payerAddr := solanaAddressToEVMAddress(authority)
-
-	// 金额转换
-	amountBig := big.NewInt(0)
-	if amount > 0 {
-		amountBig.SetUint64(amount)
-	}
-
-	// 构造 PayoutRecord
-	rec := PayoutRecord{
-		TxHash:         txHash,
-		BlockNumber:    int64(slot),
-		DstEid:         EID_SOLANA_DEVNET,
-		Payer:          payerAddr,
-		Merchant:       merchantAddr,
-		SrcToken:       common.HexToAddress("0x036CbD53842c5426634e7929541eC2318f3dCF7e"), // Base USDC
-		DstToken:       common.HexToAddress(mint),                                         // Solana token mint
-		GrossAmount:    amountBig,
-		NetAmount:      amountBig,
-		Status:         "Delivered",
-		Timestamp:      blockTime,
-		SolanaMerchant: recipient, // 保存原始 Solana 地址
-		SolanaPayer:    authority, // 保存原始 Solana 地址
-	}
-
-	// 保存到数据库
-	if err := l.store.UpsertPayout(rec); err != nil {
-		logMsg := fmt.Sprintf("Failed to save tx %s: %v", txHash[:min(20, len(txHash))], err)
-		log.Println("Solana: " + logMsg)
-		logToFile(logMsg)
-		return fmt.Errorf("failed to upsert payout: %w", err)
+	// 同一交易中的 OApp lz_receive 给出 LayerZero 消息 GUID
+	var guid string
+	if packet, ok := l.findLzReceive(decoded); ok {
+		guid = packet.GUID.Hex()
+		fx.PacketDelivered = &LZMessage{
+			GUID:      guid,
+			SrcEid:    packet.SrcEid,
+			DstEid:    packet.DstEid,
+			Nonce:     packet.Nonce,
+			Sender:    packet.Sender.Hex(),
+			Receiver:  packet.Receiver.Hex(),
+			DstChain:  l.cfg.Name,
+			DstTxHash: txHash,
+		}
 	}
 
-	logMsg = fmt.Sprintf("✅ Indexed transfer_out: tx=%s, recipient=%s, amount=%d, slot=%d",
-		txHash[:min(20, len(txHash))], recipient[:min(10, len(recipient))], amount, slot)
-	log.Println("Solana: " + logMsg)
-	logToFile(logMsg)
+	// 记录为源链 payout 的送达（不单独写 payout，避免重复计数）：按 GUID 或 商户 / mint / 金额 / 时间窗口匹配
+	fx.Delivery = &Delivery{
+		GUID:        guid,
+		DstTxHash:   txHash,
+		LogIndex:    uint(transferOutIdx),
+		DstChain:    l.cfg.Name,
+		DstEid:      int64(l.cfg.EID),
+		BlockNumber: slot,
+		Merchant:    recipient,
+		Token:       mint,
+		Amount:      new(big.Int).SetUint64(amount),
+		DeliveredAt: blockTime,
+	}
+	return fx, nil
+}
 
+// findTransferOut 查找 transfer_out（只处理第一个；可能是顶层指令，也可能由 lz_receive CPI 调用）
+func (l *SolanaListener) findTransferOut(decoded []decodedInstruction) *decodedInstruction {
+	for i := range decoded {
+		if decoded[i].program == l.transferIDL && decoded[i].Name == "transfer_out" {
+			return &decoded[i]
+		}
+	}
 	return nil
 }
 
-// solanaAddressToEVMAddress 将 Solana 地址转换为伪 EVM 地址
-// 使用 Solana 地址的哈希值作为 EVM 地址
-func solanaAddressToEVMAddress(solAddr string) common.Address {
-	if solAddr == "" {
-		return common.HexToAddress("0x0000000000000000000000000000000000000000")
+// decodeFailedExecution 处理执行失败的交易，返回一条失败的执行记录：
+// 包含 OApp lz_receive 时取其中的 payout 消息（含 GUID）；否则取直接调用的 transfer_out 的参数与收款账户
+func (l *SolanaListener) decodeFailedExecution(tx *rpc.GetTransactionResult, keys solana.PublicKeySlice, decoded []decodedInstruction, txHash string, slot uint64, blockTime time.Time) (EventEffects, error) {
+	failed := &Delivery{
+		DstTxHash:   txHash,
+		DstChain:    l.cfg.Name,
+		DstEid:      int64(l.cfg.EID),
+		BlockNumber: slot,
+		DeliveredAt: blockTime,
+		Failed:      true,
+		Error:       fmt.Sprintf("transaction failed: %v", tx.Meta.Err),
 	}
-
-	// 解析 Solana 地址
-	pubkey, err := solana.PublicKeyFromBase58(solAddr)
-	if err != nil {
-		return common.HexToAddress("0x0000000000000000000000000000000000000000")
+	if packet, ok := l.findLzReceive(decoded); ok {
+		dstToken, merchant, amount, err := decodeTokenPayoutMessage(packet.Message)
+		if err != nil {
+			return EventEffects{}, fmt.Errorf("failed lz_receive %s: %w", txHash, err)
+		}
+		failed.GUID = packet.GUID.Hex()
+		failed.Merchant = solana.PublicKeyFromBytes(merchant.Bytes()).String()
+		failed.Token = solana.PublicKeyFromBytes(dstToken.Bytes()).String()
+		failed.Amount = amount
+		return EventEffects{Delivery: failed}, nil
 	}
 
-	// 使用公钥的前20字节作为 EVM 地址
-	var evmAddr common.Address
-	copy(evmAddr[:], pubkey[:20])
+	transferOut := l.findTransferOut(decoded)
+	if transferOut == nil {
+		return EventEffects{}, errNotRelevantTx
+	}
+	// 交易失败时没有 SPL 转账：金额取指令参数，收款人取收款账户的 owner（Token Balance 中仍有记录）
+	key, ok := transferOut.Accounts["recipient_token_account"]
+	if !ok {
+		return EventEffects{}, errNoRecipient
+	}
+	recipient, mint := tokenAccountBalance(tx.Meta, keys, key)
+	if recipient == "" {
+		return EventEffects{}, errNoRecipient
+	}
+	if key, ok := transferOut.Accounts["mint"]; ok {
+		mint = key.String()
+	}
+	amount, _ := transferOut.Args["amount"].(uint64)
+	failed.LogIndex = uint(transferOut.Index)
+	failed.Merchant = recipient
+	failed.Token = mint
+	failed.Amount = new(big.Int).SetUint64(amount)
+	return EventEffects{Delivery: failed}, nil
+}
 
-	return evmAddr
+// resolveToken 确保 mint 已登记到代币注册表（读取 mint 账户的精度）；失败只记录日志
+func (l *SolanaListener) resolveToken(mint string) {
+	if mint == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := tokenRegistry.Resolve(ctx, l.cfg.EID, mint, func(ctx context.Context, addr string) (TokenInfo, error) {
+		pk, err := solana.PublicKeyFromBase58(addr)
+		if err != nil {
+			return TokenInfo{}, err
+		}
+		return fetchSPLMintMetadata(ctx, l.client, pk)
+	})
+	if err != nil {
+		log.Printf("Solana: %v", err)
+	}
 }
 
-// SolanaTransactionInfo 解析后的 Solana 交易信息
-type SolanaTransactionInfo struct {
-	Signature   string
-	Slot        uint64
-	BlockTime   time.Time
-	Payer       string
-	Merchant    string
-	Amount      *big.Int
-	Token       string
-	Status      string
-	LogMessages []string
+// decodedInstruction 按 IDL 解码成功的指令（顶层或 CPI）
+type decodedInstruction struct {
+	*AnchorInstruction
+	Index   int // 顶层指令序号（CPI 为发起它的顶层指令）
+	Inner   int // 在交易全部内部指令中的序号，-1 表示顶层
+	program *AnchorProgram
 }
 
-// ParseSolanaLogs 解析 Solana 程序日志
-// 这个函数需要根据你的 Solana 程序的实际日志格式来实现
-func ParseSolanaLogs(logs []string) (*SolanaTransactionInfo, error) {
-	info := &SolanaTransactionInfo{
-		LogMessages: logs,
+// splTransfer 查找该指令发起的、转入 destination 的 SPL 转账（同一顶层指令内、在其之后执行）
+func (ix decodedInstruction) splTransfer(transfers []splTransfer, destination solana.PublicKey) (splTransfer, bool) {
+	for _, t := range transfers {
+		if t.Outer == ix.Index && t.Inner > ix.Inner && t.Destination.Equals(destination) {
+			return t, true
+		}
 	}
+	return splTransfer{}, false
+}
 
-	// TODO: 根据实际的 Solana 程序日志格式解析
-	// 示例：
-	// - 查找包含 "Transfer" 的日志
-	// - 提取金额、发送方、接收方等信息
-	// - 解析 base64 编码的数据
-
-	for _, logMsg := range logs {
-		// 示例解析逻辑
-		// if strings.Contains(logMsg, "Program log: Transfer") {
-		//     // 解析转账信息
-		// }
+// decodeInstructions 按 IDL 解码 transfer_contract 与 my_oapp 的指令（含 CPI），其他程序的指令忽略
+//
+// 未配置 my_oapp 程序 ID 时，其余程序的指令均尝试按 my_oapp 的 discriminator 匹配。
+func (l *SolanaListener) decodeInstructions(ixs []txInstruction) []decodedInstruction {
+	var out []decodedInstruction
+	for _, instruction := range ixs {
+		var program *AnchorProgram
+		switch {
+		case instruction.Program.IsZero():
+			continue
+		case instruction.Program.Equals(l.programAddr):
+			program = l.transferIDL
+		case l.oappProgram.IsZero() || instruction.Program.Equals(l.oappProgram):
+			program = l.oappIDL
+		default:
+			continue
+		}
 
-		// 这里需要根据你的合约定义具体实现
-		_ = logMsg
+		ix, err := program.DecodeInstruction(instruction.Program, instruction.Data, instruction.Accounts)
+		if err != nil {
+			if !l.oappProgram.IsZero() || program == l.transferIDL {
+				log.Printf("Solana: instruction #%d/%d: %v", instruction.Outer, instruction.Inner, err)
+			}
+			continue
+		}
+		out = append(out, decodedInstruction{AnchorInstruction: ix, Index: instruction.Outer, Inner: instruction.Inner, program: program})
 	}
-
-	return info, nil
+	return out
 }
 
-// DecodeSolanaInstruction 解码 Solana 指令数据
-func DecodeSolanaInstruction(data []byte) (map[string]interface{}, error) {
-	// 根据你的 Solana 程序的指令格式解码
-	// 这需要知道程序的 IDL (Interface Definition Language)
-
-	if len(data) == 0 {
-		return nil, fmt.Errorf("empty instruction data")
+// decodedRecords 将解码后的指令与事件转换为 solana_instructions 记录
+func (l *SolanaListener) decodedRecords(txHash string, slot uint64, blockTime time.Time, decoded []decodedInstruction, events []AnchorEvent) ([]SolanaInstructionRecord, error) {
+	recs := make([]SolanaInstructionRecord, 0, len(decoded)+len(events))
+	for _, ix := range decoded {
+		fields := map[string]interface{}{"args": ix.Args, "accounts": ix.Accounts}
+		kind, idx := SolanaKindInstruction, ix.Index
+		if ix.Inner >= 0 {
+			// CPI：记录发起它的顶层指令
+			kind, idx, fields["outer"] = SolanaKindInnerInstruction, ix.Inner, ix.Index
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, SolanaInstructionRecord{Signature: txHash, Kind: kind, Index: idx, Chain: l.cfg.Name,
+			Slot: slot, BlockTime: blockTime, Program: ix.Program, Name: ix.Name, Data: data})
 	}
+	for i, ev := range events {
+		data, err := json.Marshal(ev.Fields)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, SolanaInstructionRecord{Signature: txHash, Kind: SolanaKindEvent, Index: i, Chain: l.cfg.Name,
+			Slot: slot, BlockTime: blockTime, Program: ev.Program, Name: ev.Name, Data: data})
+	}
+	return recs, nil
+}
 
-	result := make(map[string]interface{})
-
-	// TODO: 实现具体的解码逻辑
-	// 示例：
-	// - 第一个字节通常是指令类型
-	// - 后续字节是参数
-	result["instruction_type"] = data[0]
-	result["data"] = base64.StdEncoding.EncodeToString(data)
+// solanaTransactionEvent 将 getTransaction 结果作为一条原始事件（签名为 tx_hash，slot 为区块号）
+func solanaTransactionEvent(chain, signature string, slot uint64, blockTime time.Time, tx *rpc.GetTransactionResult) (EventRecord, error) {
+	raw, err := json.Marshal(tx)
+	if err != nil {
+		return EventRecord{}, fmt.Errorf("failed to marshal transaction %s: %w", signature, err)
+	}
+	return EventRecord{Chain: chain, TxHash: signature, BlockNumber: slot, BlockTime: blockTime, RawLog: string(raw)}, nil
+}
 
-	return result, nil
+// findLzReceive 在解码后的指令中查找 OApp 的 lz_receive 并取出消息标识
+func (l *SolanaListener) findLzReceive(decoded []decodedInstruction) (LZPacket, bool) {
+	for _, ix := range decoded {
+		if ix.program != l.oappIDL || ix.Name != "lz_receive" {
+			continue
+		}
+		packet, err := lzPacketFromInstruction(ix.AnchorInstruction, l.cfg.EID)
+		if err != nil {
+			log.Printf("Solana: %v", err)
+			continue
+		}
+		return packet, true
+	}
+	return LZPacket{}, false
 }
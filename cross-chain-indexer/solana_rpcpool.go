@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// SolanaPool 一条 Solana 链的 RPC 池：实现 solanaRPC 与代币元数据查询，
+// 每次调用路由到最健康的 HTTPS 端点，WebSocket 连接最健康的端点
+type SolanaPool struct {
+	*rpcPool
+	clients []*rpc.Client // 与 endpoints 一一对应
+}
+
+// NewSolanaPool 创建 Solana RPC 池（未配置 WSS 的端点由 HTTPS 推导；maxHeadLag 为 0 时使用默认值）
+func NewSolanaPool(chain string, endpoints []RPCEndpoint, maxHeadLag uint64) (*SolanaPool, error) {
+	if len(endpoints) == 0 {
+		return nil, errNoEndpoint
+	}
+	if maxHeadLag == 0 {
+		maxHeadLag = defaultSolanaMaxHeadLag
+	}
+	eps := make([]RPCEndpoint, len(endpoints))
+	for i, ep := range endpoints {
+		if ep.WSS == "" {
+			ep.WSS = convertToWebSocketURL(ep.HTTPS)
+		}
+		eps[i] = ep
+	}
+	p := &SolanaPool{rpcPool: newRPCPool(chain, eps, maxHeadLag)}
+	for _, ep := range p.endpoints {
+		p.clients = append(p.clients, rpc.New(ep.cfg.HTTPS))
+	}
+	p.head = func(ctx context.Context, ep *poolEndpoint) (uint64, error) {
+		return p.clients[ep.index].GetSlot(ctx, rpc.CommitmentConfirmed)
+	}
+	return p, nil
+}
+
+// do 在最健康的端点上执行 fn（端点故障时换端点重试）
+func (p *SolanaPool) do(ctx context.Context, fn func(c *rpc.Client) error) error {
+	return p.call(ctx, func(ep *poolEndpoint) error {
+		return fn(p.clients[ep.index])
+	})
+}
+
+// GetSignaturesForAddressWithOpts 地址相关的交易签名（分页）
+func (p *SolanaPool) GetSignaturesForAddressWithOpts(ctx context.Context, account solana.PublicKey, opts *rpc.GetSignaturesForAddressOpts) (out []*rpc.TransactionSignature, err error) {
+	err = p.do(ctx, func(c *rpc.Client) (err error) {
+		out, err = c.GetSignaturesForAddressWithOpts(ctx, account, opts)
+		return err
+	})
+	return out, err
+}
+
+// GetTransaction 交易详情
+func (p *SolanaPool) GetTransaction(ctx context.Context, sig solana.Signature, opts *rpc.GetTransactionOpts) (tx *rpc.GetTransactionResult, err error) {
+	err = p.do(ctx, func(c *rpc.Client) (err error) {
+		tx, err = c.GetTransaction(ctx, sig, opts)
+		return err
+	})
+	return tx, err
+}
+
+// GetSlot 最新 slot
+func (p *SolanaPool) GetSlot(ctx context.Context, commitment rpc.CommitmentType) (slot uint64, err error) {
+	err = p.do(ctx, func(c *rpc.Client) (err error) {
+		slot, err = c.GetSlot(ctx, commitment)
+		return err
+	})
+	return slot, err
+}
+
+// GetAccountInfo 账户信息（SPL mint 元数据）
+func (p *SolanaPool) GetAccountInfo(ctx context.Context, account solana.PublicKey) (info *rpc.GetAccountInfoResult, err error) {
+	err = p.do(ctx, func(c *rpc.Client) (err error) {
+		info, err = c.GetAccountInfo(ctx, account)
+		return err
+	})
+	return info, err
+}
+
+// ConnectWS 连接最健康的 WebSocket 端点（失败时依次尝试其他端点）
+//
+// 返回的 context 在该端点不再健康且有健康的端点时以 errRPCFailover 取消，调用方据此断开并重新连接；
+// 连接关闭后调用 stop。
+func (p *SolanaPool) ConnectWS(ctx context.Context) (client *ws.Client, watchCtx context.Context, stop func(), err error) {
+	tried := make(map[*poolEndpoint]bool, len(p.endpoints))
+	lastErr := errNoWSS
+	for {
+		ep := p.pick(tried, true)
+		if ep == nil {
+			return nil, nil, nil, lastErr
+		}
+		tried[ep] = true
+
+		log.Printf("RPCPool[%s]: connecting to %s", p.chain, ep.name)
+		client, err := ws.Connect(ctx, ep.cfg.WSS)
+		if ctx.Err() != nil {
+			return nil, nil, nil, ctx.Err()
+		}
+		p.record(ep, 0, err)
+		if err == nil {
+			watchCtx, stop := p.watch(ctx, ep)
+			return client, watchCtx, stop, nil
+		}
+		lastErr = fmt.Errorf("%s: %s", ep.name, p.redactError(ep, err))
+		log.Printf("RPCPool[%s]: connect to %s failed: %s", p.chain, ep.name, p.redactError(ep, err))
+	}
+}
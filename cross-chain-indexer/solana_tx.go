@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// txInstruction 交易中的一条指令（顶层或 CPI），账户已按完整账户表解析
+type txInstruction struct {
+	Outer    int // 顶层指令序号（CPI 为发起它的顶层指令）
+	Inner    int // 在交易全部 innerInstructions 中的序号，-1 表示顶层
+	Program  solana.PublicKey
+	Accounts []solana.PublicKey
+	Data     []byte
+}
+
+// transactionAccountKeys 交易的完整账户表：静态账户 + 地址查找表加载的可写 / 只读账户（v0 交易）
+//
+// 指令与 token balance 中的账户索引都基于这张表。
+func transactionAccountKeys(message solana.Message, meta *rpc.TransactionMeta) solana.PublicKeySlice {
+	keys := append(solana.PublicKeySlice(nil), message.AccountKeys...)
+	if meta != nil {
+		keys = append(keys, meta.LoadedAddresses.Writable...)
+		keys = append(keys, meta.LoadedAddresses.ReadOnly...)
+	}
+	return keys
+}
+
+// flattenInstructions 按执行顺序展开顶层指令及其 CPI（每条顶层指令后紧跟它发起的内部指令）
+//
+// 超出账户表的索引以零值占位。
+func flattenInstructions(message solana.Message, meta *rpc.TransactionMeta, keys solana.PublicKeySlice) []txInstruction {
+	key := func(idx uint16) solana.PublicKey {
+		if int(idx) < len(keys) {
+			return keys[idx]
+		}
+		return solana.PublicKey{}
+	}
+	resolve := func(indices []uint16) []solana.PublicKey {
+		accounts := make([]solana.PublicKey, len(indices))
+		for i, idx := range indices {
+			accounts[i] = key(idx)
+		}
+		return accounts
+	}
+
+	inner := map[int][]rpc.CompiledInstruction{}
+	if meta != nil {
+		for _, in := range meta.InnerInstructions {
+			inner[int(in.Index)] = append(inner[int(in.Index)], in.Instructions...)
+		}
+	}
+
+	var out []txInstruction
+	seq := 0
+	for idx, ix := range message.Instructions {
+		out = append(out, txInstruction{Outer: idx, Inner: -1, Program: key(ix.ProgramIDIndex),
+			Accounts: resolve(ix.Accounts), Data: ix.Data})
+		for _, cpi := range inner[idx] {
+			out = append(out, txInstruction{Outer: idx, Inner: seq, Program: key(cpi.ProgramIDIndex),
+				Accounts: resolve(cpi.Accounts), Data: cpi.Data})
+			seq++
+		}
+	}
+	return out
+}
+
+// SPL Token 指令标签
+const (
+	splTokenTransfer        = 3
+	splTokenTransferChecked = 12
+)
+
+// splTransfer 一次 SPL Token（或 Token-2022）transfer / transferChecked
+type splTransfer struct {
+	Outer       int
+	Inner       int
+	Source      solana.PublicKey
+	Destination solana.PublicKey
+	Authority   solana.PublicKey
+	Mint        solana.PublicKey // 仅 transferChecked 携带
+	Amount      uint64
+}
+
+// splTransfers 找出交易中（含 CPI）全部 SPL Token 转账
+func splTransfers(ixs []txInstruction) []splTransfer {
+	var out []splTransfer
+	for _, ix := range ixs {
+		if !ix.Program.Equals(solana.TokenProgramID) && !ix.Program.Equals(solana.Token2022ProgramID) {
+			continue
+		}
+		if len(ix.Data) < 9 {
+			continue
+		}
+		t := splTransfer{Outer: ix.Outer, Inner: ix.Inner, Amount: binary.LittleEndian.Uint64(ix.Data[1:9])}
+		switch {
+		case ix.Data[0] == splTokenTransfer && len(ix.Accounts) >= 3:
+			t.Source, t.Destination, t.Authority = ix.Accounts[0], ix.Accounts[1], ix.Accounts[2]
+		case ix.Data[0] == splTokenTransferChecked && len(ix.Data) >= 10 && len(ix.Accounts) >= 4:
+			t.Source, t.Mint, t.Destination, t.Authority = ix.Accounts[0], ix.Accounts[1], ix.Accounts[2], ix.Accounts[3]
+		default:
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// tokenAccountBalance 在 token balance 中查找 token 账户的 owner 与 mint（先查 Post，再查 Pre）
+func tokenAccountBalance(meta *rpc.TransactionMeta, keys solana.PublicKeySlice, account solana.PublicKey) (owner, mint string) {
+	for _, balances := range [][]rpc.TokenBalance{meta.PostTokenBalances, meta.PreTokenBalances} {
+		for _, bal := range balances {
+			if int(bal.AccountIndex) >= len(keys) || !keys[bal.AccountIndex].Equals(account) {
+				continue
+			}
+			if bal.Owner != nil {
+				owner = bal.Owner.String()
+			}
+			return owner, bal.Mint.String()
+		}
+	}
+	return "", ""
+}
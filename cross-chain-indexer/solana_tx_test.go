@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// v0 交易：executor 顶层调用 lz_receive，transfer_out 与 SPL transferChecked 均为 CPI，
+// 收款 token 账户、transfer 程序与 mint 来自地址查找表
+func TestVersionedTransactionWithCPI(t *testing.T) {
+	l := newTestSolanaListener(t, nil, nil)
+	l.transferIDL = mustLoadIDL(t, ProgramRoleTransfer, l.programAddr.String())
+	l.oappIDL = mustLoadIDL(t, ProgramRoleOApp, "")
+	l.oappProgram = l.oappIDL.ID
+
+	wallet := func() solana.PublicKey { return solana.NewWallet().PublicKey() }
+	executor, store, peer := wallet(), wallet(), wallet()
+	vaultAccount, recipientAccount, config := wallet(), wallet(), wallet()
+	vaultAuthority, mint, merchant := wallet(), wallet(), wallet()
+
+	message := solana.Message{AccountKeys: solana.PublicKeySlice{executor, l.oappProgram, store, peer}}
+	meta := &rpc.TransactionMeta{
+		LoadedAddresses: rpc.LoadedAddresses{
+			Writable: solana.PublicKeySlice{vaultAccount, recipientAccount, config},
+			ReadOnly: solana.PublicKeySlice{l.programAddr, vaultAuthority, mint, solana.TokenProgramID},
+		},
+		PostTokenBalances: []rpc.TokenBalance{
+			{AccountIndex: 4, Owner: &vaultAuthority, Mint: mint},
+			{AccountIndex: 5, Owner: &merchant, Mint: mint},
+		},
+	}
+
+	lzDisc := anchorDiscriminator("global", "lz_receive")
+	lzData := binary.LittleEndian.AppendUint32(lzDisc[:], 40245)
+	lzData = append(lzData, common.LeftPadBytes([]byte{1}, 32)...)
+	lzData = binary.LittleEndian.AppendUint64(lzData, 9)
+	lzData = append(lzData, common.HexToHash(fixtureGUID).Bytes()...)
+	lzData = binary.LittleEndian.AppendUint32(lzData, 0) // message
+	lzData = binary.LittleEndian.AppendUint32(lzData, 0) // extra_data
+	message.Instructions = []solana.CompiledInstruction{
+		{ProgramIDIndex: 1, Accounts: []uint16{2, 3, 7, 6, 8, 4, 5, 9, 10}, Data: lzData},
+	}
+
+	outDisc := anchorDiscriminator("global", "transfer_out")
+	splData := binary.LittleEndian.AppendUint64([]byte{splTokenTransferChecked}, 2500000)
+	meta.InnerInstructions = []rpc.InnerInstruction{{Index: 0, Instructions: []rpc.CompiledInstruction{
+		{ProgramIDIndex: 7, Accounts: []uint16{6, 2, 8, 4, 5, 9, 10}, Data: binary.LittleEndian.AppendUint64(outDisc[:], 2500000)},
+		{ProgramIDIndex: 10, Accounts: []uint16{4, 9, 5, 8}, Data: append(splData, 6)},
+	}}}
+
+	keys := transactionAccountKeys(message, meta)
+	if len(keys) != 11 || !keys[5].Equals(recipientAccount) || !keys[10].Equals(solana.TokenProgramID) {
+		t.Fatalf("account keys %v", keys)
+	}
+	ixs := flattenInstructions(message, meta, keys)
+	if len(ixs) != 3 || ixs[0].Inner != -1 || ixs[1].Inner != 0 || ixs[2].Inner != 1 || !ixs[1].Program.Equals(l.programAddr) {
+		t.Fatalf("flattened %+v", ixs)
+	}
+
+	decoded := l.decodeInstructions(ixs)
+	if len(decoded) != 2 || decoded[0].Name != "lz_receive" || decoded[1].Name != "transfer_out" || decoded[1].Inner != 0 {
+		t.Fatalf("decoded %+v", decoded)
+	}
+	if packet, ok := l.findLzReceive(decoded); !ok || packet.Nonce != 9 || packet.Receiver != common.BytesToHash(store.Bytes()) {
+		t.Errorf("lz_receive packet %+v, %v", packet, ok)
+	}
+
+	transferOut := decoded[1]
+	dst := transferOut.Accounts["recipient_token_account"]
+	if !dst.Equals(recipientAccount) {
+		t.Fatalf("recipient_token_account = %s", dst)
+	}
+	tr, ok := transferOut.splTransfer(splTransfers(ixs), dst)
+	if !ok || tr.Amount != 2500000 || !tr.Mint.Equals(mint) || !tr.Source.Equals(vaultAccount) || !tr.Authority.Equals(vaultAuthority) {
+		t.Errorf("spl transfer %+v, %v", tr, ok)
+	}
+	if owner, m := tokenAccountBalance(meta, keys, dst); owner != merchant.String() || m != mint.String() {
+		t.Errorf("owner %s mint %s", owner, m)
+	}
+}
+
+func TestSplTransfers(t *testing.T) {
+	src, dst, auth, mint := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+	ixs := []txInstruction{
+		{Outer: 0, Inner: -1, Program: solana.TokenProgramID, Accounts: []solana.PublicKey{src, dst, auth},
+			Data: binary.LittleEndian.AppendUint64([]byte{splTokenTransfer}, 7)},
+		{Outer: 1, Inner: 0, Program: solana.Token2022ProgramID, Accounts: []solana.PublicKey{src, mint, dst, auth},
+			Data: append(binary.LittleEndian.AppendUint64([]byte{splTokenTransferChecked}, 8), 6)},
+		// 其他 SPL 指令（mintTo）与其他程序忽略
+		{Outer: 2, Inner: -1, Program: solana.TokenProgramID, Accounts: []solana.PublicKey{mint, dst, auth},
+			Data: binary.LittleEndian.AppendUint64([]byte{7}, 9)},
+		{Outer: 3, Inner: -1, Program: solana.SystemProgramID, Accounts: []solana.PublicKey{src, dst, auth},
+			Data: binary.LittleEndian.AppendUint64([]byte{splTokenTransfer}, 10)},
+	}
+	got := splTransfers(ixs)
+	if len(got) != 2 {
+		t.Fatalf("got %d transfers, want 2", len(got))
+	}
+	if got[0].Amount != 7 || !got[0].Destination.Equals(dst) || !got[0].Mint.IsZero() {
+		t.Errorf("transfer %+v", got[0])
+	}
+	if got[1].Amount != 8 || got[1].Inner != 0 || !got[1].Mint.Equals(mint) || !got[1].Authority.Equals(auth) {
+		t.Errorf("transferChecked %+v", got[1])
+	}
+}
+
+// 直接调用 transfer_out 的交易执行失败：匹配到的源链 payout 置为 Failed
+func TestFailedTransferOut(t *testing.T) {
+	t.Chdir(t.TempDir()) // 解码日志写入 solana_log.txt
+	s := newTestStore(t)
+	l := newTestReindexer(t, s).solana["Solana Devnet"]
+
+	wallet := func() solana.PublicKey { return solana.NewWallet().PublicKey() }
+	authority, config, vaultAuthority, vaultAccount, recipientAccount, mint, merchant := wallet(), wallet(), wallet(), wallet(), wallet(), wallet(), wallet()
+	program := solana.MustPublicKeyFromBase58("GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1")
+	outDisc := anchorDiscriminator("global", "transfer_out")
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{4, 5, 6}},
+		Message: solana.Message{
+			Header:      solana.MessageHeader{NumRequiredSignatures: 1},
+			AccountKeys: solana.PublicKeySlice{authority, program, config, vaultAuthority, vaultAccount, recipientAccount, mint, solana.TokenProgramID},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 1, Accounts: []uint16{2, 0, 3, 4, 5, 6, 7}, Data: binary.LittleEndian.AppendUint64(outDisc[:], 2500000)},
+			},
+		},
+	}
+	bin, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope rpc.TransactionResultEnvelope
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`[%q, "base64"]`, base64.StdEncoding.EncodeToString(bin))), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	blockTime := solana.UnixTimeSeconds(1767268800)
+	result := &rpc.GetTransactionResult{Slot: 500, BlockTime: &blockTime, Transaction: &envelope, Meta: &rpc.TransactionMeta{
+		Err:              map[string]interface{}{"InstructionError": []interface{}{0, map[string]interface{}{"Custom": 1}}},
+		LogMessages:      []string{"Program " + program.String() + " invoke [1]", "Program " + program.String() + " failed: custom program error: 0x1"},
+		PreTokenBalances: []rpc.TokenBalance{{AccountIndex: 5, Owner: &merchant, Mint: mint}},
+	}}
+
+	err = s.UpsertPayout(PayoutRecord{TxHash: "0xb1", DstEid: 40168, Merchant: MustParseChainAddress(merchant.String()),
+		DstToken: MustParseChainAddress(mint.String()), GrossAmount: big.NewInt(2500000), NetAmount: big.NewInt(2500000),
+		Status: PayoutStatusPending, Timestamp: blockTime.Time().UTC().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := tx.Signatures[0]
+	if err := l.parseAndStore(result, &rpc.TransactionSignature{Signature: signature, Slot: 500, BlockTime: &blockTime}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := payoutByTx(t, s, "0xb1")
+	if p.Status != PayoutStatusFailed || !strings.Contains(p.FailureReason, "transaction failed") || !strings.Contains(p.FailureReason, signature.String()) {
+		t.Errorf("payout = %s (%q), want Failed", p.Status, p.FailureReason)
+	}
+}
@@ -1,66 +1,93 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"time"
-
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-// statusUpdater 简化版状态更新器（跨链自动确认模式）
+// statusUpdater 送达状态机
+//
+// payout 只有在目标链上找到对应的执行记录后才会变为 Delivered：
+// - EVM 目标链：MyOApp 发出的 TokenPayoutExecuted 事件（由 EVMListener 捕获）
+// - Solana 目标链：transfer 程序的 transfer_out 指令（由 SolanaListener 捕获）
 //
-// 对于跨链场景，LayerZero 消息一旦在源链确认并被监听器捕获，
-// 基本都会成功到达目标链。因此：
-// - 交易被监听器捕获并写入数据库 = 源链已确认
-// - 等待一定时间后（默认2分钟），自动标记为 Delivered
+// 目标链执行失败（EndpointV2 LzReceiveAlert / Solana 交易报错）时置为 Failed；
+// 超过路由 (srcEid, dstEid) 的 SLA 仍未送达时置为 Stuck。两者都会触发告警，
+// 之后若目标链执行成功（例如 executor 重试）仍会转为 Delivered。
 //
-// 这样可以避免跨多条链查询交易状态的复杂性，
-// 同时也符合 LayerZero 的高可靠性特点。
+// 监听器在捕获执行记录时会立即尝试匹配；若当时源链事件尚未被索引
+// （例如源链回填落后于目标链），这里定期对未匹配的执行记录重试。直到 ctx 结束。
 // ------------------------------------------------------------------
-func statusUpdater(s *Store, _ *ethclient.Client, pollInterval time.Duration) {
+func statusUpdater(ctx context.Context, s Storage, pollInterval time.Duration) {
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
-	log.Println("StatusUpdater: started (auto-confirm mode, 2min delay)")
+	log.Println("StatusUpdater: started (matching destination executions, SLA checks)")
 
-	for range ticker.C {
-		// 1) 获取所有 Pending 状态的交易
-		pending, err := s.ListPendingPayouts(200)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("StatusUpdater: stopped")
+			return
+		case <-ticker.C:
+		}
+		matched, err := s.MatchDeliveries()
 		if err != nil {
-			log.Printf("StatusUpdater: ListPendingPayouts error: %v", err)
-			continue
+			log.Printf("StatusUpdater: MatchDeliveries error: %v", err)
 		}
-
-		if len(pending) == 0 {
-			// 没有待处理交易
-			continue
+		if len(matched) > 0 {
+			log.Printf("StatusUpdater: matched %d deliveries this round", len(matched))
 		}
-
-		// 2) 检查每笔交易的时间，超过阈值则自动确认
-		now := time.Now().UTC()
-		updatedCount := 0
-
-		for _, tx := range pending {
-			// 计算交易年龄（从时间戳到现在的时长）
-			age := now.Sub(tx.Timestamp)
-
-			// 如果交易已经超过 2 分钟，自动标记为 Delivered
-			if age > 2*time.Minute {
-				if err := s.UpdatePayoutStatus(tx.TxHash, "Delivered"); err != nil {
-					log.Printf("StatusUpdater: failed to update tx %s: %v", tx.TxHash, err)
-				} else {
-					updatedCount++
-					log.Printf("StatusUpdater: auto-confirmed tx %s (age: %v)",
-						tx.TxHash[:16]+"...", age.Round(time.Second))
-				}
+		for _, d := range matched {
+			if d.Failed {
+				alertDeliveryFailed(d)
 			}
 		}
 
-		if updatedCount > 0 {
-			log.Printf("StatusUpdater: auto-confirmed %d transactions this round", updatedCount)
+		checkDeliverySLA(s, time.Now().UTC())
+	}
+}
+
+// checkDeliverySLA 将超过路由 SLA 仍未送达的 payout 标记为 Stuck 并告警
+func checkDeliverySLA(s Storage, now time.Time) {
+	if chainRegistry == nil {
+		return
+	}
+	for _, src := range chainRegistry.EnabledNetworks() {
+		if src.IsSolana() {
+			continue // Solana 目前只作为目标链
+		}
+		for _, dst := range chainRegistry.Networks {
+			if dst.EID == src.EID {
+				continue
+			}
+			sla := chainRegistry.RouteSLA(src.EID, dst.EID)
+			reason := fmt.Sprintf("not delivered within %s", sla)
+			stuck, err := s.MarkStuck(int64(src.EID), int64(dst.EID), now.Add(-sla), reason)
+			if err != nil {
+				log.Printf("StatusUpdater: MarkStuck %s -> %s error: %v", src.Name, dst.Name, err)
+				continue
+			}
+			for _, p := range stuck {
+				alerter.Notify(Alert{
+					Kind:    AlertPayoutStuck,
+					TxHash:  p.TxHash,
+					Route:   src.Name + " -> " + dst.Name,
+					Message: fmt.Sprintf("payout %s %s (sent %s)", p.TxHash, reason, p.Timestamp.Format(time.RFC3339)),
+				})
+			}
 		}
 	}
 }
 
-// 注意：sourceChainClient 参数保留是为了保持函数签名兼容性，
-// 但在简化模式下不再使用（用 _ 忽略）
+// alertDeliveryFailed 目标链执行失败且已关联到源链 payout 时告警
+func alertDeliveryFailed(d Delivery) {
+	alerter.Notify(Alert{
+		Kind:    AlertPayoutFailed,
+		TxHash:  d.SrcTxHash,
+		Route:   "-> " + d.DstChain,
+		Message: fmt.Sprintf("destination execution %s failed: %s", d.DstTxHash, d.Error),
+	})
+}
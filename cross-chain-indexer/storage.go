@@ -0,0 +1,372 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Storage 监听器、Processor、状态更新器与 API 使用的全部持久化操作
+//
+// 由 Store 实现；SQLite 与 PostgreSQL 的差异由 SQL 方言（dialect）处理，见 OpenStore。
+type Storage interface {
+	PayoutStore
+	Close() error
+
+	// 原始事件与派生记录（同一事务写入，重复事件只处理一次）
+	PersistEvent(ev EventRecord, fx EventEffects) (EventResult, error)
+	ReplayEvent(ev EventRecord, fx EventEffects) (EventResult, error)
+	EventProcessed(txHash string, logIndex uint) (bool, error)
+	ListStoredEvents(r EventRange, after EventRecord, limit int) ([]StoredEvent, error)
+	InsertEventIfNotExists(chain, txHash string, logIndex uint, blockNumber uint64, blockHash, rawLog string) (bool, error)
+	UpsertPayout(rec PayoutRecord) error
+	GetPayout(txHash string) (PayoutRecord, bool, error)
+	ListPendingPayouts(limit int) ([]PayoutRecord, error)
+	UpdatePayoutStatus(txHash, status string) error
+	BackfillPayoutSrcEIDs(eidByChain map[string]uint32) (int64, error)
+
+	// 检查点与重组
+	GetCheckpoint(chain, contract string) (Checkpoint, bool, error)
+	SetCheckpoint(chain, contract string, cp Checkpoint) error
+	ListEventBlocks(chain string, fromBlock uint64) (map[uint64]string, error)
+	RollbackBlock(chain string, blockNumber uint64, oldHash, newHash, reason string) (int, error)
+	RollbackEvent(chain, txHash string, logIndex uint, blockHash, reason string) (int, error)
+	FinalizePayouts(chain string, uptoBlock uint64) (int64, error)
+
+	// 送达跟踪与 SLA
+	RecordDelivery(d Delivery) (string, error)
+	MatchDeliveries() ([]Delivery, error)
+	MarkStuck(srcEid, dstEid int64, cutoff time.Time, reason string) ([]PayoutRecord, error)
+
+	// LayerZero 消息
+	RecordPacketSent(m LZMessage) error
+	RecordPacketDelivered(m LZMessage) error
+
+	// 代币与 Solana 指令
+	UpsertToken(t TokenInfo) error
+	ListTokens() ([]TokenInfo, error)
+	SaveSolanaInstructions(recs []SolanaInstructionRecord) error
+
+	// 死信队列
+	AddDeadLetter(dl DeadLetter) error
+	UpdateDeadLetter(dl DeadLetter) error
+	GetDeadLetter(id int64) (DeadLetter, bool, error)
+	ListDeadLetters(f DeadLetterFilter, limit, offset int) ([]DeadLetter, error)
+	DueDeadLetters(now time.Time, limit int) ([]DeadLetter, error)
+	CountDeadLetters() (map[string]int, error)
+}
+
+var _ Storage = (*Store)(nil)
+
+// 存储后端
+const (
+	StorageDriverSQLite   = "sqlite"
+	StorageDriverPostgres = "postgres"
+)
+
+// storageTables 所有业务表（按依赖顺序，数据复制时使用）
+var storageTables = []string{
+	"events", "payouts", "checkpoints", "reorg_audit", "deliveries",
+	"lz_messages", "tokens", "solana_instructions", "dead_letters",
+}
+
+// storageConfigFromEnv 从环境变量读取存储配置：
+// DB_DRIVER=sqlite（默认，DB_PATH 为数据库文件）或 postgres（DATABASE_URL 为连接串）
+func storageConfigFromEnv() (driver, dsn string) {
+	driver = getEnvOrDefault("DB_DRIVER", StorageDriverSQLite)
+	if driver == StorageDriverPostgres {
+		return driver, os.Getenv("DATABASE_URL")
+	}
+	return driver, getEnvOrDefault("DB_PATH", "indexer.db")
+}
+
+// OpenStore 打开存储并执行数据库迁移
+//
+// driver 为 sqlite 时 dsn 是数据库文件路径，为 postgres 时 dsn 是 lib/pq 连接串。
+func OpenStore(driver, dsn string) (*Store, error) {
+	return openStore(driver, dsn, true)
+}
+
+// openStore 打开存储；migrate 为 false 时不执行迁移（migrate 子命令使用）
+func openStore(driver, dsn string, migrate bool) (*Store, error) {
+	var d dialect
+	switch driver {
+	case StorageDriverSQLite:
+		d = sqliteDialect{}
+	case StorageDriverPostgres:
+		if dsn == "" {
+			return nil, fmt.Errorf("postgres storage requires a connection string (DATABASE_URL)")
+		}
+		d = postgresDialect{}
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q (want %s or %s)", driver, StorageDriverSQLite, StorageDriverPostgres)
+	}
+
+	db, err := d.open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s := &Store{db: &sqlDB{DB: db, dialect: d}}
+	s.read = s.db
+
+	if migrate {
+		if err := s.migrate(); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("database migration failed: %w", err)
+		}
+	}
+
+	// 读连接池在建表之后打开（SQLite 只读连接不能创建数据库文件）
+	rdb, err := d.openReader(dsn)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("opening read pool: %w", err)
+	}
+	if rdb != nil {
+		s.read = &sqlDB{DB: rdb, dialect: d}
+	}
+	if d.singleWriter() {
+		s.writer = newBatchWriter(s.db, defaultWriteBatchSize)
+	}
+	return s, nil
+}
+
+// write 在写事务中执行 fn：SQLite 交给单写协程（与并发的写操作合并提交），PostgreSQL 直接开事务
+func (s *Store) write(fn func(tx *sqlTx) error) error {
+	if s.writer != nil {
+		return s.writer.do(fn)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close 停止写协程并关闭数据库连接
+func (s *Store) Close() error {
+	if s.writer != nil {
+		s.writer.close()
+	}
+	if s.read != s.db {
+		_ = s.read.Close()
+	}
+	return s.db.Close()
+}
+
+// Driver 返回存储后端（sqlite / postgres）
+func (s *Store) Driver() string {
+	return s.db.dialect.name()
+}
+
+// --------------------------- SQL 方言 ---------------------------
+
+// dialect 屏蔽 SQLite 与 PostgreSQL 的差异
+//
+// Store 与迁移中的 SQL 统一使用 ? 占位符与两者都支持的语法（ON CONFLICT ... DO UPDATE、COALESCE 等），
+// 由方言改写占位符、参数与建表语句；无法共用的表达式由方言分别提供。
+type dialect interface {
+	name() string
+	open(dsn string) (*sql.DB, error)       // 写连接（迁移与写事务）
+	openReader(dsn string) (*sql.DB, error) // 只读连接池；nil 表示读写共用 open 的连接池
+	singleWriter() bool                     // 只允许单个写连接，写操作由单写协程合并提交
+	rebind(query string) string
+	bindArgs(args []interface{}) []interface{}
+	ddl(stmts string) string       // 将按 SQLite 书写的 DDL 转换为本方言
+	columnExistsQuery() string     // 参数为 (表, 字段)，返回匹配的字段数
+	dateExpr(column string) string // 时间列的 YYYY-MM-DD 表达式
+}
+
+// sqliteDialect modernc.org/sqlite；时间以 "2006-01-02 15:04:05"（UTC）文本保存
+//
+// 使用 WAL 模式：单个写连接（由 batchWriter 串行使用）+ 只读连接池，读不会被写阻塞。
+type sqliteDialect struct{}
+
+// sqliteReadPoolSize SQLite 只读连接池大小
+var sqliteReadPoolSize = max(4, runtime.NumCPU())
+
+func (sqliteDialect) name() string { return StorageDriverSQLite }
+
+func (sqliteDialect) open(path string) (*sql.DB, error) {
+	// WAL 下 synchronous=NORMAL 只在检查点时 fsync，断电最多丢失最近提交的事务，不会损坏数据库
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"+
+		"&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func (sqliteDialect) openReader(path string) (*sql.DB, error) {
+	if sqliteInMemory(path) {
+		return nil, nil
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=query_only(1)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(sqliteReadPoolSize)
+	db.SetMaxIdleConns(sqliteReadPoolSize)
+	return db, nil
+}
+
+// sqliteInMemory 内存数据库每个连接各自独立，不能使用单独的读连接池
+func sqliteInMemory(path string) bool {
+	return path == ":memory:" || strings.Contains(path, "mode=memory")
+}
+
+func (sqliteDialect) singleWriter() bool { return true }
+
+func (sqliteDialect) rebind(query string) string                { return query }
+func (sqliteDialect) bindArgs(args []interface{}) []interface{} { return args }
+func (sqliteDialect) ddl(stmts string) string                   { return stmts }
+func (sqliteDialect) columnExistsQuery() string {
+	return `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+}
+func (sqliteDialect) dateExpr(column string) string {
+	return fmt.Sprintf("substr(%s, 1, 10)", column)
+}
+
+// postgresDialect github.com/lib/pq；占位符为 $n，时间列为 TIMESTAMP（UTC）
+type postgresDialect struct{}
+
+func (postgresDialect) name() string { return StorageDriverPostgres }
+
+func (postgresDialect) open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(16)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	return db, nil
+}
+
+// openReader PostgreSQL 连接池本身支持并发读写
+func (postgresDialect) openReader(string) (*sql.DB, error) { return nil, nil }
+func (postgresDialect) singleWriter() bool                 { return false }
+
+// rebind 将 ? 改写为 $1, $2, ...（跳过字符串字面量）
+func (postgresDialect) rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n, quoted := 0, false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// bindArgs 布尔值按 INTEGER 列写入 0/1，时间统一为 UTC（TIMESTAMP 列不带时区）
+func (postgresDialect) bindArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case bool:
+			out[i] = 0
+			if v {
+				out[i] = 1
+			}
+		case time.Time:
+			out[i] = v.UTC()
+		default:
+			out[i] = a
+		}
+	}
+	return out
+}
+
+// postgresDDL DATETIME 统一为不带时区的 TIMESTAMP（保存 UTC），自增主键为 BIGSERIAL
+var postgresDDL = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+	"DATETIME", "TIMESTAMP",
+	"DEFAULT CURRENT_TIMESTAMP", "DEFAULT (now() AT TIME ZONE 'utc')",
+)
+
+func (postgresDialect) ddl(stmts string) string { return postgresDDL.Replace(stmts) }
+
+func (postgresDialect) columnExistsQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`
+}
+
+func (postgresDialect) dateExpr(column string) string {
+	return fmt.Sprintf("to_char(%s, 'YYYY-MM-DD')", column)
+}
+
+// sqlDB 按方言改写 SQL 的 *sql.DB
+type sqlDB struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (db *sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), db.dialect.bindArgs(args)...)
+}
+
+func (db *sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), db.dialect.bindArgs(args)...)
+}
+
+func (db *sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), db.dialect.bindArgs(args)...)
+}
+
+func (db *sqlDB) sqlDialect() dialect { return db.dialect }
+
+func (db *sqlDB) Begin() (*sqlTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// sqlTx 按方言改写 SQL 的 *sql.Tx
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *sqlTx) sqlDialect() dialect { return tx.dialect }
+
+func (tx *sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), tx.dialect.bindArgs(args)...)
+}
+
+func (tx *sqlTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), tx.dialect.bindArgs(args)...)
+}
+
+func (tx *sqlTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), tx.dialect.bindArgs(args)...)
+}
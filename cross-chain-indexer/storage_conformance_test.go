@@ -0,0 +1,337 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// storageConformance Storage 一致性用例：每个用例在每个后端的全新空库上运行
+var storageConformance = []struct {
+	name string
+	fn   func(t *testing.T, s *Store)
+}{
+	{"Checkpoints", testCheckpoints},
+	{"ReorgRollbackAndFinality", testReorgRollbackAndFinality},
+	{"DeliveryMatching", testDeliveryMatching},
+	{"DeliveryMatchingByGUID", testDeliveryMatchingByGUID},
+	{"StuckAndFailed", testStuckAndFailed},
+	{"FeeRevenue", testFeeRevenue},
+	{"SolanaInstructions", testSolanaInstructions},
+	{"EventsAndPayoutFilters", testEventsAndPayoutFilters},
+	{"TokensAndLZMessages", testTokensAndLZMessages},
+	{"CopyFromSQLite", testCopyFromSQLite},
+	{"MigrateDownUp", testMigrateDownUp},
+	{"PersistEventExactlyOnce", testPersistEventExactlyOnce},
+	{"DeadLetters", testDeadLetters},
+}
+
+// storageBackends 参与一致性测试的后端
+//
+// PostgreSQL 使用 TEST_POSTGRES_DSN；未设置时若本机装有 initdb / pg_ctl，则在临时目录启动一个实例，否则跳过
+// （设置 TEST_POSTGRES_REQUIRED=1 时失败而不是跳过，CI 用它保证 PostgreSQL 用例确实运行）。
+var storageBackends = []struct {
+	name string
+	open func(t *testing.T) *Store
+}{
+	{StorageDriverSQLite, newTestStore},
+	{StorageDriverPostgres, newTestPostgresStore},
+}
+
+func TestStorageConformance(t *testing.T) {
+	for _, b := range storageBackends {
+		b := b
+		t.Run(b.name, func(t *testing.T) {
+			for _, c := range storageConformance {
+				c := c
+				t.Run(c.name, func(t *testing.T) { c.fn(t, b.open(t)) })
+			}
+		})
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	stopTestPostgres()
+	os.Exit(code)
+}
+
+// --------------------------- PostgreSQL 测试实例 ---------------------------
+
+var testPostgres struct {
+	once sync.Once
+	dsn  string
+	dir  string // 临时实例的数据目录（使用 TEST_POSTGRES_DSN 时为空）
+	ctl  string
+	err  error
+}
+
+// testPostgresDSN 返回可用的 PostgreSQL 连接串（不可用时跳过测试）
+func testPostgresDSN(t *testing.T) string {
+	t.Helper()
+	testPostgres.once.Do(func() {
+		if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+			testPostgres.dsn = dsn
+			return
+		}
+		testPostgres.dsn, testPostgres.err = startTestPostgres()
+	})
+	if testPostgres.err != nil {
+		if os.Getenv("TEST_POSTGRES_REQUIRED") != "" {
+			t.Fatalf("postgres unavailable (TEST_POSTGRES_REQUIRED is set): %v", testPostgres.err)
+		}
+		t.Skipf("postgres unavailable (set TEST_POSTGRES_DSN): %v", testPostgres.err)
+	}
+	return testPostgres.dsn
+}
+
+// findPostgresBin 在 PATH 与常见安装目录中查找 PostgreSQL 程序
+func findPostgresBin(name string) (string, error) {
+	if p, err := exec.LookPath(name); err == nil {
+		return p, nil
+	}
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql", "*", "bin", name))
+	if len(matches) == 0 {
+		return "", fmt.Errorf("%s not found", name)
+	}
+	return matches[len(matches)-1], nil
+}
+
+// startTestPostgres 用 initdb 在临时目录建立实例，只监听 unix socket
+func startTestPostgres() (string, error) {
+	initdb, err := findPostgresBin("initdb")
+	if err != nil {
+		return "", err
+	}
+	ctl, err := findPostgresBin("pg_ctl")
+	if err != nil {
+		return "", err
+	}
+	// unix socket 路径长度有限，不使用 t.TempDir
+	dir, err := os.MkdirTemp("", "indexer-pg")
+	if err != nil {
+		return "", err
+	}
+	data := filepath.Join(dir, "data")
+	if out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("initdb: %v: %s", err, out)
+	}
+	opts := fmt.Sprintf("-c listen_addresses='' -k %s -c fsync=off", dir)
+	if out, err := exec.Command(ctl, "-D", data, "-o", opts, "-l", filepath.Join(dir, "log"), "-w", "start").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("pg_ctl start: %v: %s", err, out)
+	}
+	testPostgres.dir, testPostgres.ctl = dir, ctl
+	return fmt.Sprintf("host=%s user=postgres dbname=postgres sslmode=disable", dir), nil
+}
+
+func stopTestPostgres() {
+	if testPostgres.dir == "" {
+		return
+	}
+	_ = exec.Command(testPostgres.ctl, "-D", filepath.Join(testPostgres.dir, "data"), "-m", "immediate", "stop").Run()
+	os.RemoveAll(testPostgres.dir)
+}
+
+// newTestPostgresStore 在独立 schema 中创建 PostgreSQL Store（测试结束后删除）
+func newTestPostgresStore(t *testing.T) *Store {
+	t.Helper()
+	dsn := testPostgresDSN(t)
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+
+	schema := fmt.Sprintf("conformance_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	// lib/pq 将未识别的参数作为会话参数发送
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+	s, err := OpenStore(StorageDriverPostgres, dsn)
+	if err != nil {
+		t.Fatalf("OpenStore(postgres): %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// --------------------------- 用例 ---------------------------
+
+func testEventsAndPayoutFilters(t *testing.T, s *Store) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	evmMerchant := MustParseChainAddress("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438")
+	solMerchant := MustParseChainAddress("8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq")
+	src := MustParseChainAddress("0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6")
+
+	// 重复插入同一事件不报错，也不会产生第二行
+	for i := 0; i < 2; i++ {
+		if _, err := s.InsertEventIfNotExists("Base Sepolia", "0xe1", 3, 7, "0xb7", `{"k":1}`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.MarkEventAsParsed("0xe1", 3); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.GetAllEvents(10, 0)
+	if err != nil || len(events) != 1 || !events[0].Parsed || events[0].LogIndex != 3 || events[0].BlockNumber != 7 {
+		t.Fatalf("GetAllEvents = %+v, %v", events, err)
+	}
+	if n, err := s.GetEventCount(); err != nil || n != 1 {
+		t.Fatalf("GetEventCount = %d, %v", n, err)
+	}
+
+	for i, p := range []PayoutRecord{
+		{TxHash: "0xe1", SrcEid: 40245, DstEid: 40168, Merchant: solMerchant, SrcContract: src},
+		{TxHash: "0xe2", SrcEid: 40245, DstEid: 40231, Merchant: evmMerchant, SrcContract: src},
+		{TxHash: "0xe3", SrcEid: 40231, DstEid: 40245, Merchant: evmMerchant},
+	} {
+		p.BlockNumber = int64(7 + i)
+		p.GrossAmount, p.NetAmount = big.NewInt(1000), big.NewInt(990)
+		p.FeeAmount, p.FeeBps = big.NewInt(10), 100
+		p.Payer = evmMerchant
+		p.Status = PayoutStatusPending
+		p.Timestamp = base.Add(time.Duration(i) * time.Minute)
+		if err := s.UpsertPayout(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.UpdatePayoutStatus("0xe3", PayoutStatusDelivered); err != nil {
+		t.Fatal(err)
+	}
+
+	p := payoutByTx(t, s, "0xe1")
+	if p.Merchant != solMerchant || p.Payer != evmMerchant || p.SrcContract != src || p.SrcEid != 40245 ||
+		!p.Timestamp.Equal(base) || p.NetAmount.Int64() != 990 || p.FeeAmount.Int64() != 10 || !p.DeliveredAt.IsZero() {
+		t.Errorf("payout round trip = %+v", p)
+	}
+
+	pending, err := s.ListPendingPayouts(10)
+	if err != nil || len(pending) != 2 {
+		t.Errorf("ListPendingPayouts = %d, %v; want 2", len(pending), err)
+	}
+	for _, c := range []struct {
+		filter PayoutFilter
+		want   []string
+	}{
+		{PayoutFilter{Merchant: solMerchant}, []string{"0xe1"}},
+		{PayoutFilter{Merchant: evmMerchant, Statuses: []string{PayoutStatusPending}}, []string{"0xe2"}},
+		{PayoutFilter{SrcEid: 40245}, []string{"0xe2", "0xe1"}},
+		{PayoutFilter{SrcContract: src, DstEid: 40231}, []string{"0xe2"}},
+		{PayoutFilter{Statuses: []string{PayoutStatusDelivered, PayoutStatusFailed}}, []string{"0xe3"}},
+	} {
+		list, err := s.ListPayoutsFiltered(c.filter, 10, 0)
+		if err != nil {
+			t.Fatalf("ListPayoutsFiltered(%+v): %v", c.filter, err)
+		}
+		var got []string
+		for _, p := range list {
+			got = append(got, p.TxHash)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("ListPayoutsFiltered(%+v) = %v, want %v", c.filter, got, c.want)
+		}
+	}
+}
+
+func testTokensAndLZMessages(t *testing.T, s *Store) {
+	for _, tok := range []TokenInfo{
+		{EID: 40245, Address: "0x036CbD53842c5426634e7929541eC2318f3dCF7e", Symbol: "USDC", Decimals: 6, Peg: "USD"},
+		{EID: 40168, Address: "4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU", Symbol: "", Decimals: 9},
+		{EID: 40168, Address: "4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU", Symbol: "DEVUSDC", Decimals: 6},
+	} {
+		if err := s.UpsertToken(tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokens, err := s.ListTokens()
+	if err != nil || len(tokens) != 2 {
+		t.Fatalf("ListTokens = %+v, %v", tokens, err)
+	}
+	for _, tok := range tokens {
+		if tok.EID == 40168 && (tok.Symbol != "DEVUSDC" || tok.Decimals != 6 || tok.Source != TokenSourceChain) {
+			t.Errorf("updated token = %+v", tok)
+		}
+	}
+
+	// 目标链先于源链被索引：两侧信息合并到同一条消息
+	msg := LZMessage{GUID: "0xguid", SrcEid: 40245, DstEid: 40231, Nonce: 1 << 40, Sender: "0xs", Receiver: "0xr"}
+	delivered := msg
+	delivered.DstChain, delivered.DstTxHash = "Arbitrum Sepolia", "0xd"
+	if err := s.RecordPacketDelivered(delivered); err != nil {
+		t.Fatal(err)
+	}
+	sent := msg
+	sent.SrcChain, sent.SrcTxHash = "Base Sepolia", "0xs1"
+	if err := s.RecordPacketSent(sent); err != nil {
+		t.Fatal(err)
+	}
+	m, ok, err := s.GetLZMessage("0xguid")
+	if err != nil || !ok || m.SrcTxHash != "0xs1" || m.DstTxHash != "0xd" || m.Nonce != 1<<40 {
+		t.Errorf("GetLZMessage = %+v, %v, %v", m, ok, err)
+	}
+	if _, ok, err := s.GetLZMessage("0xmissing"); ok || err != nil {
+		t.Errorf("missing message = %v, %v", ok, err)
+	}
+	if list, err := s.ListLZMessages(10, 0); err != nil || len(list) != 1 {
+		t.Errorf("ListLZMessages = %+v, %v", list, err)
+	}
+}
+
+// testCopyFromSQLite copy-to-postgres 使用的数据复制（目标为各后端），可重复执行
+func testCopyFromSQLite(t *testing.T, dst *Store) {
+	src := newTestStore(t)
+	insertTestPayout(t, src, "Base Sepolia", "0x01", 100, "0xblock100")
+	insertTestPayout(t, src, "Base Sepolia", "0x02", 110, "0xblock110")
+	if _, err := src.RollbackBlock("Base Sepolia", 110, "0xblock110", "0xnew110", "parent_hash_mismatch"); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetCheckpoint("Base Sepolia", "0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6", Checkpoint{Block: 120, BlockHash: "0xc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := copyStoreData(dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied["events"] != 2 || copied["payouts"] != 2 || copied["reorg_audit"] != 1 || copied["checkpoints"] != 1 {
+		t.Errorf("copied = %v", copied)
+	}
+	if again, err := copyStoreData(dst, src); err != nil || again["payouts"] != 0 {
+		t.Errorf("second copy = %v, %v; want nothing copied", again, err)
+	}
+
+	if p := payoutByTx(t, dst, "0x02"); p.Status != PayoutStatusReorged || p.BlockNumber != 110 || p.Timestamp.IsZero() {
+		t.Errorf("copied payout = %+v", p)
+	}
+	if cp, ok, err := dst.GetCheckpoint("Base Sepolia", "0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6"); err != nil || !ok || cp.Block != 120 {
+		t.Errorf("copied checkpoint = %+v, %v, %v", cp, ok, err)
+	}
+	// 复制后新的审计记录不与已复制的 id 冲突
+	insertTestPayout(t, dst, "Base Sepolia", "0x03", 130, "0xblock130")
+	if _, err := dst.RollbackBlock("Base Sepolia", 130, "0xblock130", "", "removed"); err != nil {
+		t.Fatal(err)
+	}
+	if audit, err := dst.ListReorgAudit(10, 0); err != nil || len(audit) != 2 || audit[0].TxHash != "0x03" {
+		t.Errorf("ListReorgAudit after copy = %+v, %v", audit, err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"math/big"
@@ -9,183 +10,283 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	_ "modernc.org/sqlite"
 )
 
+// Store 基于 database/sql 的 Storage 实现（SQLite / PostgreSQL）
 type Store struct {
-	db *sql.DB
+	db     *sqlDB       // 写连接（迁移与写事务；SQLite 为单连接）
+	read   *sqlDB       // 查询使用的连接池（SQLite 为只读连接池，PostgreSQL 与 db 相同）
+	writer *batchWriter // SQLite 单写协程（PostgreSQL 为 nil）
 }
 
 // PayoutRecord 为 store 层使用的业务记录结构
 type PayoutRecord struct {
-	TxHash         string
-	BlockNumber    int64
-	DstEid         int64
-	Payer          common.Address
-	Merchant       common.Address
-	SrcToken       common.Address
-	DstToken       common.Address
-	GrossAmount    *big.Int
-	NetAmount      *big.Int
-	Status         string
-	Timestamp      time.Time
-	SolanaMerchant string // Solana 原始地址（Base58 格式）
-	SolanaPayer    string // Solana 原始地址（Base58 格式）
-}
-
-// NewStore 构造 Store 实例，并执行数据库迁移
+	TxHash        string
+	BlockNumber   int64
+	SrcEid        int64        // 源链 EID（0 表示旧数据尚未回填）
+	SrcContract   ChainAddress // 发出 TokenPayoutRequested 的源链合约
+	DstEid        int64
+	DstContract   ChainAddress // 目标链 OApp（PacketSent 的 receiver，未知时为空）
+	Payer         ChainAddress // 源链付款人
+	Merchant      ChainAddress // 目标链商户（按 DstEid 的地址命名空间解析）
+	SrcToken      common.Address
+	DstToken      ChainAddress // 目标链代币（EVM 合约 / Solana mint）
+	GrossAmount   *big.Int
+	NetAmount     *big.Int
+	Status        string
+	Timestamp     time.Time
+	BlockHash     string    // 源链区块哈希（用于重组检测）
+	Finalized     bool      // 已达到源链确认深度，不会再被回滚
+	DstTxHash     string    // 目标链执行交易（匹配到 TokenPayoutExecuted / transfer_out 后写入）
+	DeliveredAt   time.Time // 目标链执行时间（未送达时为零值）
+	GUID          string    // LayerZero 消息 GUID（源链 PacketSent）
+	FailureReason string    // 目标链执行失败原因（Failed）或 SLA 超时说明（Stuck）
+	FeeAmount     *big.Int  // 源链收取的手续费（srcToken 计价）
+	FeeBps        int       // 索引时合约的 FEE_BPS（-1 表示未知）
+	FeeIssue      string    // 手续费校验问题（gross - net != fee 等），空表示通过
+}
+
+// Payout 状态
+const (
+	PayoutStatusPending   = "Pending"
+	PayoutStatusDelivered = "Delivered"
+	PayoutStatusFailed    = "Failed"
+	PayoutStatusReorged   = "Reorged" // 源链交易因重组被移出规范链
+	PayoutStatusStuck     = "Stuck"   // 超过路由 SLA 仍未送达（送达后仍可转为 Delivered）
+)
+
+// Checkpoint (链, 合约) 检查点
+type Checkpoint struct {
+	Block     uint64
+	BlockHash string // 检查点区块的哈希，追赶时用于校验 parentHash
+	Signature string // Solana：最后处理的交易签名（回填以此为 until 继续）
+}
+
+// NewStore 打开 SQLite 数据库文件并执行数据库迁移
 func NewStore(path string) (*Store, error) {
-	// sqlite3 DSN: 设置 busy timeout 与启用 foreign_keys
-	dsn := fmt.Sprintf("%s?_busy_timeout=5000&_foreign_keys=1", path)
-	db, err := sql.Open("sqlite", dsn)
-	if err != nil {
-		return nil, err
-	}
-	// 保守设置
-	db.SetMaxOpenConns(1)
+	return OpenStore(StorageDriverSQLite, path)
+}
 
-	if err := db.Ping(); err != nil {
-		_ = db.Close()
-		return nil, err
-	}
+// BackfillPayoutSrcEIDs 按源链名称（events.chain）为 src_eid 未知的旧 payout 补齐源链 EID
+func (s *Store) BackfillPayoutSrcEIDs(eidByChain map[string]uint32) (int64, error) {
+	var total int64
+	err := s.write(func(tx *sqlTx) error {
+		total = 0
+		for chain, eid := range eidByChain {
+			res, err := tx.Exec(`
+				UPDATE payouts SET src_eid = ?
+				WHERE src_eid = 0 AND tx_hash IN (SELECT tx_hash FROM events WHERE chain = ?)
+			`, eid, chain)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+		return nil
+	})
+	return total, err
+}
 
-	s := &Store{db: db}
+// --------------------------- 核心函数：CRUD 操作 ---------------------------
 
-	// 【新增】在初始化时执行数据库迁移
-	if err := s.migrate(); err != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("database migration failed: %w", err)
-	}
+// EventRecord 一条原始事件（events 表的一行）
+//
+// EVM 为一条日志（LogIndex 为日志序号）；Solana 为一笔交易（TxHash 为签名，LogIndex 为 0，
+// BlockNumber 为 slot，RawLog 为完整的 getTransaction 结果）。
+// BlockTime 为区块时间（未知时为零值），重新索引时代替区块头。
+type EventRecord struct {
+	Chain       string
+	TxHash      string
+	LogIndex    uint
+	BlockNumber uint64
+	BlockHash   string
+	BlockTime   time.Time
+	RawLog      string
+}
 
-	return s, nil
+// EventEffects 由一条原始事件派生、与它在同一事务中写入的记录（为空的不写入）
+type EventEffects struct {
+	Payout          *PayoutRecord             // 源链 TokenPayoutRequested
+	PacketSent      *LZMessage                // 同一交易中的 PacketSent（GUID 写入 payout）
+	PacketDelivered *LZMessage                // 目标链 PacketDelivered / lz_receive
+	Delivery        *Delivery                 // 目标链执行（成功或失败），写入后立即尝试匹配源链 payout
+	Instructions    []SolanaInstructionRecord // 按 IDL 解码的 Solana 指令与事件
 }
 
-// --------------------------- 核心函数：迁移 ---------------------------
+// EventResult PersistEvent 的结果
+type EventResult struct {
+	Duplicate bool   // 事件此前已处理过，本次未写入任何记录
+	SrcTxHash string // Delivery 匹配到的源链 payout（未匹配时为空）
+}
 
-// migrate: 数据库 schema 迁移
-func (s *Store) migrate() error {
-	// 1. events 原始日志记录表
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS events (
-			tx_hash TEXT NOT NULL,
-			log_index INTEGER NOT NULL,
-			block_number INTEGER NOT NULL,
-			raw_log TEXT NOT NULL, -- 原始 Log 的 JSON 字符串
-			parsed INTEGER DEFAULT 0,
-			PRIMARY KEY (tx_hash, log_index)
-		);
-		CREATE INDEX IF NOT EXISTS idx_events_parsed ON events(parsed);
-	`)
-	if err != nil {
-		return fmt.Errorf("migrating events table: %w", err)
-	}
-
-	// 2. payouts 交易记录表
-	// 确保所有字段类型（TEXT/INTEGER）与 SQL 兼容
-	_, err = s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS payouts (
-			tx_hash TEXT PRIMARY KEY,
-			block_number INTEGER NOT NULL,
-			timestamp DATETIME NOT NULL,
-			dst_eid INTEGER NOT NULL,
-			payer TEXT NOT NULL,
-			merchant TEXT NOT NULL,
-			src_token TEXT NOT NULL,
-			dst_token TEXT NOT NULL,
-			gross_amount TEXT NOT NULL,
-			net_amount TEXT NOT NULL,
-			status TEXT NOT NULL, -- "Pending", "Delivered", "Failed"
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-		-- 【你的要求】添加 merchant 索引，加速按商户地址的查询
-		CREATE INDEX IF NOT EXISTS idx_payouts_merchant ON payouts(merchant);
-	`)
-	if err != nil {
-		return fmt.Errorf("migrating payouts table: %w", err)
-	}
+// PersistEvent 在同一事务中写入原始事件及其派生记录，并将事件标记为已解析
+//
+// 事件是否已处理以 parsed 从 0 到 1 的变化判定（与派生记录同一事务），
+// 崩溃后重放、订阅重复推送或并发处理同一事件时，派生记录只会写入一次。
+// 已被重组回滚的事件再次出现时恢复为未解析，重新写入派生记录。
+// 事件在死信队列中时一并标记为已解决。
+func (s *Store) PersistEvent(ev EventRecord, fx EventEffects) (EventResult, error) {
+	var res EventResult
+	err := s.write(func(tx *sqlTx) error {
+		res = EventResult{}
+		if _, err := insertEventTx(tx, ev); err != nil {
+			return err
+		}
+		if err := resolveDeadLettersTx(tx, ev.TxHash, ev.LogIndex); err != nil {
+			return err
+		}
+		claim, err := tx.Exec(`UPDATE events SET parsed = 1 WHERE tx_hash = ? AND log_index = ? AND parsed = 0`,
+			ev.TxHash, ev.LogIndex)
+		if err != nil {
+			return err
+		}
+		if n, err := claim.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			res.Duplicate = true
+			return nil
+		}
+		res.SrcTxHash, err = applyEffectsTx(tx, fx)
+		return err
+	})
+	return res, err
+}
 
-	// 添加 Solana 原始地址字段（如果不存在）
-	_, err = s.db.Exec(`
-		ALTER TABLE payouts ADD COLUMN solana_merchant TEXT DEFAULT '';
-	`)
-	// 忽略 "duplicate column" 错误
-	if err != nil && !strings.Contains(err.Error(), "duplicate column") {
-		return fmt.Errorf("adding solana_merchant column: %w", err)
-	}
+// ReplayEvent 对已保存的原始事件重新写入派生记录（重新索引时使用），并将事件标记为已解析
+//
+// 与 PersistEvent 不同，已处理过的事件也会写入：payout 的解码字段被覆盖，状态与送达信息保留。
+func (s *Store) ReplayEvent(ev EventRecord, fx EventEffects) (EventResult, error) {
+	var res EventResult
+	err := s.write(func(tx *sqlTx) error {
+		res = EventResult{}
+		marked, err := tx.Exec(`UPDATE events SET parsed = 1 WHERE tx_hash = ? AND log_index = ? AND reorged = 0`,
+			ev.TxHash, ev.LogIndex)
+		if err != nil {
+			return err
+		}
+		if n, err := marked.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("event %s/%d not found", ev.TxHash, ev.LogIndex)
+		}
+		if err := resolveDeadLettersTx(tx, ev.TxHash, ev.LogIndex); err != nil {
+			return err
+		}
+		res.SrcTxHash, err = applyEffectsTx(tx, fx)
+		return err
+	})
+	return res, err
+}
 
-	_, err = s.db.Exec(`
-		ALTER TABLE payouts ADD COLUMN solana_payer TEXT DEFAULT '';
-	`)
-	// 忽略 "duplicate column" 错误
-	if err != nil && !strings.Contains(err.Error(), "duplicate column") {
-		return fmt.Errorf("adding solana_payer column: %w", err)
+// applyEffectsTx 写入派生记录，返回 Delivery 匹配到的源链 payout
+func applyEffectsTx(tx *sqlTx, fx EventEffects) (srcTxHash string, err error) {
+	if fx.Payout != nil {
+		if err := upsertPayoutTx(tx, *fx.Payout); err != nil {
+			return "", fmt.Errorf("upsert payout: %w", err)
+		}
 	}
-
-	// 3. processed_blocks 区块记录表 (用于记录已处理到的区块高度)
-	_, err = s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS processed_blocks (
-			chain_id INTEGER PRIMARY KEY,
-			block_number INTEGER NOT NULL
-		);
-	`)
-	if err != nil {
-		return fmt.Errorf("migrating processed_blocks table: %w", err)
+	if fx.PacketSent != nil {
+		if err := recordPacketSentTx(tx, *fx.PacketSent); err != nil {
+			return "", fmt.Errorf("record PacketSent: %w", err)
+		}
 	}
-
-	log.Println("Store: database migration successful.")
-	return nil
+	if fx.PacketDelivered != nil {
+		if err := recordPacketDeliveredTx(tx, *fx.PacketDelivered); err != nil {
+			return "", fmt.Errorf("record PacketDelivered: %w", err)
+		}
+	}
+	if fx.Delivery != nil {
+		if srcTxHash, err = recordDeliveryTx(tx, *fx.Delivery); err != nil {
+			return "", fmt.Errorf("record delivery: %w", err)
+		}
+	}
+	if err := saveSolanaInstructionsTx(tx, fx.Instructions); err != nil {
+		return "", fmt.Errorf("save solana instructions: %w", err)
+	}
+	return srcTxHash, nil
 }
 
-// Close 关闭数据库连接
-func (s *Store) Close() error {
-	return s.db.Close()
+// EventProcessed 事件是否已处理（已解析且未被重组回滚）；监听器据此跳过重复事件的 RPC 调用
+func (s *Store) EventProcessed(txHash string, logIndex uint) (bool, error) {
+	var n int
+	err := s.read.QueryRow(`SELECT COUNT(*) FROM events WHERE tx_hash = ? AND log_index = ? AND parsed = 1 AND reorged = 0`,
+		txHash, logIndex).Scan(&n)
+	return n > 0, err
 }
 
-// --------------------------- 核心函数：CRUD 操作 ---------------------------
+// InsertEventIfNotExists 只插入原始事件（不解析），基于 (tx_hash, log_index) 去重
+//
+// 返回 true 表示新插入，或已被重组回滚的事件再次出现（交易被重新打包）并恢复为有效。
+func (s *Store) InsertEventIfNotExists(chain, txHash string, logIndex uint, blockNumber uint64, blockHash, rawLog string) (bool, error) {
+	var inserted bool
+	err := s.write(func(tx *sqlTx) (err error) {
+		inserted, err = insertEventTx(tx, EventRecord{Chain: chain, TxHash: txHash, LogIndex: logIndex,
+			BlockNumber: blockNumber, BlockHash: blockHash, RawLog: rawLog})
+		return err
+	})
+	return inserted, err
+}
 
-// InsertEventIfNotExists 插入原始事件，基于 (tx_hash, log_index) 去重
-func (s *Store) InsertEventIfNotExists(txHash string, logIndex uint, blockNumber uint64, rawLog string) (bool, error) {
-	// ... (此函数内容不变，略去)
-	_, err := s.db.Exec(`
-		INSERT OR IGNORE INTO events (tx_hash, log_index, block_number, raw_log)
-		VALUES (?, ?, ?, ?)
-	`, txHash, logIndex, blockNumber, rawLog)
-
-	// 如果没有错误且影响行数为 0，则说明该行已存在（IGNORE生效）
-	// SQLite 在 INSERT OR IGNORE 成功插入时，返回 Result.RowsAffected 为 1
-	// 但 modernc.org/sqlite 驱动的 RowsAffected 可能不可靠，这里使用更可靠的 SELECT
-	if err != nil {
-		return false, err
+// insertEventTx 插入原始事件；已存在且有效时不修改（返回 false），已被重组回滚时恢复为有效的未解析事件
+func insertEventTx(tx *sqlTx, ev EventRecord) (bool, error) {
+	var blockTime interface{}
+	if !ev.BlockTime.IsZero() {
+		blockTime = ev.BlockTime.UTC().Format("2006-01-02 15:04:05")
 	}
-
-	var count int
-	err = s.db.QueryRow(`SELECT count(*) FROM events WHERE tx_hash = ? AND log_index = ?`, txHash, logIndex).Scan(&count)
+	res, err := tx.Exec(`
+		INSERT INTO events (tx_hash, log_index, block_number, raw_log, chain, block_hash, block_time)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(tx_hash, log_index) DO UPDATE SET
+			block_number = excluded.block_number,
+			block_hash = excluded.block_hash,
+			block_time = excluded.block_time,
+			raw_log = excluded.raw_log,
+			chain = excluded.chain,
+			reorged = 0,
+			parsed = 0
+		WHERE events.reorged = 1
+	`, ev.TxHash, ev.LogIndex, ev.BlockNumber, ev.RawLog, ev.Chain, ev.BlockHash, blockTime)
 	if err != nil {
 		return false, err
 	}
-	// 如果 count 是 1，说明 INSERT OR IGNORE 生效了
-	// 这里逻辑简化：只要没有错误就假设操作成功或忽略成功
-
-	return true, nil
+	// 冲突且 WHERE 不成立时不影响任何行
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
 // MarkEventAsParsed 标记事件为已解析（parsed = 1）
 func (s *Store) MarkEventAsParsed(txHash string, logIndex uint) error {
-	// ... (此函数内容不变，略去)
-	_, err := s.db.Exec(`
-		UPDATE events SET parsed = 1 WHERE tx_hash = ? AND log_index = ?
-	`, txHash, logIndex)
-	return err
+	return s.write(func(tx *sqlTx) error {
+		_, err := tx.Exec(`
+			UPDATE events SET parsed = 1 WHERE tx_hash = ? AND log_index = ?
+		`, txHash, logIndex)
+		return err
+	})
 }
 
 // UpsertPayout 插入或更新 PayoutRecord
+//
+// 重复写入（重新索引、重放）不会改变已有状态：Delivered / Failed / Stuck 不会回到 Pending，
+// 只有被重组回滚（Reorged）的 payout 重新上链时才恢复。
 func (s *Store) UpsertPayout(rec PayoutRecord) error {
+	return s.write(func(tx *sqlTx) error {
+		return upsertPayoutTx(tx, rec)
+	})
+}
+
+func upsertPayoutTx(tx *sqlTx, rec PayoutRecord) error {
 	grossStr := rec.GrossAmount.String()
 	netStr := rec.NetAmount.String()
+	feeStr := "0"
+	if rec.FeeAmount != nil {
+		feeStr = rec.FeeAmount.String()
+	}
 
-	_, err := s.db.Exec(`
-		INSERT INTO payouts (tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token, gross_amount, net_amount, status, solana_merchant, solana_payer)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	_, err := tx.Exec(`
+		INSERT INTO payouts (tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token, gross_amount, net_amount, status, block_hash,
+			fee_amount, fee_bps, fee_issue, src_eid, src_contract, dst_contract)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(tx_hash) DO UPDATE SET
 			block_number = excluded.block_number,
 			timestamp = excluded.timestamp,
@@ -196,31 +297,64 @@ func (s *Store) UpsertPayout(rec PayoutRecord) error {
 			dst_token = excluded.dst_token,
 			gross_amount = excluded.gross_amount,
 			net_amount = excluded.net_amount,
-			solana_merchant = excluded.solana_merchant,
-			solana_payer = excluded.solana_payer,
-			created_at = created_at
+			block_hash = excluded.block_hash,
+			fee_amount = excluded.fee_amount,
+			fee_bps = excluded.fee_bps,
+			fee_issue = excluded.fee_issue,
+			src_eid = excluded.src_eid,
+			src_contract = excluded.src_contract,
+			-- 目标链合约通常在 PacketSent 之后才写入，重新索引时不清空
+			dst_contract = CASE WHEN excluded.dst_contract != '' THEN excluded.dst_contract ELSE payouts.dst_contract END,
+			-- 被重组回滚的交易重新上链时恢复状态，其余情况保留已有状态
+			status = CASE
+				WHEN payouts.status != 'Reorged' THEN payouts.status
+				WHEN payouts.dst_tx_hash != '' THEN 'Delivered'
+				ELSE excluded.status
+			END,
+			created_at = payouts.created_at
 	`,
 		rec.TxHash,
 		rec.BlockNumber,
 		rec.Timestamp.Format("2006-01-02 15:04:05"),
 		rec.DstEid,
-		rec.Payer.Hex(),
-		rec.Merchant.Hex(),
+		rec.Payer.Key(),
+		rec.Merchant.Key(),
 		rec.SrcToken.Hex(),
-		rec.DstToken.Hex(),
+		rec.DstToken.Key(),
 		grossStr,
 		netStr,
 		rec.Status,
-		rec.SolanaMerchant,
-		rec.SolanaPayer,
+		rec.BlockHash,
+		feeStr,
+		rec.FeeBps,
+		rec.FeeIssue,
+		rec.SrcEid,
+		rec.SrcContract.Key(),
+		rec.DstContract.Key(),
 	)
 	return err
 }
 
+// payoutColumns listPayoutsByQuery 读取的字段（顺序与 Scan 一致）
+const payoutColumns = `tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token, gross_amount, net_amount, status,
+	COALESCE(block_hash, ''), COALESCE(finalized, 0),
+	COALESCE(dst_tx_hash, ''), delivered_at, COALESCE(guid, ''), COALESCE(failure_reason, ''),
+	COALESCE(fee_amount, '0'), COALESCE(fee_bps, -1), COALESCE(fee_issue, ''),
+	COALESCE(src_eid, 0), COALESCE(src_contract, ''), COALESCE(dst_contract, '')`
+
+// GetPayout 按源链交易哈希查询 payout；ok 为 false 表示不存在
+func (s *Store) GetPayout(txHash string) (PayoutRecord, bool, error) {
+	list, err := s.listPayoutsByQuery(`SELECT `+payoutColumns+` FROM payouts WHERE tx_hash = ?`, txHash)
+	if err != nil || len(list) == 0 {
+		return PayoutRecord{}, false, err
+	}
+	return list[0], true, nil
+}
+
 // ListPayouts 列出所有 Payouts
 func (s *Store) ListPayouts(limit, offset int) ([]PayoutRecord, error) {
 	return s.listPayoutsByQuery(`
-		SELECT tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token, gross_amount, net_amount, status, COALESCE(solana_merchant, ''), COALESCE(solana_payer, '')
+		SELECT `+payoutColumns+`
 		FROM payouts
 		ORDER BY block_number DESC
 		LIMIT ? OFFSET ?
@@ -229,65 +363,63 @@ func (s *Store) ListPayouts(limit, offset int) ([]PayoutRecord, error) {
 
 // ListMerchantPayouts 列出特定商家的 Payouts
 // 【新增函数】用于服务 /merchant/payouts 接口
-func (s *Store) ListMerchantPayouts(merchant common.Address, limit, offset int) ([]PayoutRecord, error) {
-	// 支持同时匹配 EVM 地址和 Solana 地址
-	merchantHex := strings.ToLower(merchant.Hex())
-	return s.listPayoutsByQuery(`
-		SELECT tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token, gross_amount, net_amount, status, COALESCE(solana_merchant, ''), COALESCE(solana_payer, '')
-		FROM payouts
-		WHERE LOWER(merchant) = LOWER(?) OR LOWER(solana_merchant) = LOWER(?)
-		ORDER BY block_number DESC
-		LIMIT ? OFFSET ?
-	`, merchantHex, merchantHex, limit, offset)
-}
-
-// ListMerchantPayoutsByString 通过字符串地址查询商家的 Payouts
-// 【新增函数】支持 Solana 地址查询
-func (s *Store) ListMerchantPayoutsByString(merchantAddr string, limit, offset int) ([]PayoutRecord, error) {
-	// 支持同时匹配 EVM 地址和 Solana 地址
-	merchantLower := strings.ToLower(merchantAddr)
+func (s *Store) ListMerchantPayouts(merchant ChainAddress, limit, offset int) ([]PayoutRecord, error) {
 	return s.listPayoutsByQuery(`
-		SELECT tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token, gross_amount, net_amount, status, COALESCE(solana_merchant, ''), COALESCE(solana_payer, '')
+		SELECT `+payoutColumns+`
 		FROM payouts
-		WHERE LOWER(merchant) = LOWER(?) OR LOWER(solana_merchant) = LOWER(?)
+		WHERE merchant = ?
 		ORDER BY block_number DESC
 		LIMIT ? OFFSET ?
-	`, merchantLower, merchantLower, limit, offset)
+	`, merchant.Key(), limit, offset)
 }
 
 // ListPendingPayouts 列出状态为 "Pending" 的 Payouts
 func (s *Store) ListPendingPayouts(limit int) ([]PayoutRecord, error) {
 	return s.listPayoutsByQuery(`
-		SELECT tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token, gross_amount, net_amount, status, COALESCE(solana_merchant, ''), COALESCE(solana_payer, '')
+		SELECT `+payoutColumns+`
 		FROM payouts
 		WHERE status = 'Pending'
 		LIMIT ?
 	`, limit)
 }
 
-// UpdatePayoutStatus 更新 Payout 状态
+// UpdatePayoutStatus 更新 Payout 状态（Delivered 为终态，不会被改回其他状态）
 func (s *Store) UpdatePayoutStatus(txHash, status string) error {
-	// ... (此函数内容不变，略去)
-	_, err := s.db.Exec(`
-		UPDATE payouts SET status = ? WHERE tx_hash = ?
-	`, status, txHash)
-	return err
+	return s.write(func(tx *sqlTx) error {
+		_, err := tx.Exec(`
+			UPDATE payouts SET status = ? WHERE tx_hash = ? AND (status != ? OR status = ?)
+		`, status, txHash, PayoutStatusDelivered, status)
+		return err
+	})
+}
+
+// storedChainAddress 解析数据库中的地址（无法解析的旧数据返回空地址）
+func storedChainAddress(s string) ChainAddress {
+	a, _ := ParseChainAddress(s)
+	return a
 }
 
 // listPayoutsByQuery 是内部辅助函数，用于执行查询并解析结果
 func (s *Store) listPayoutsByQuery(query string, args ...interface{}) ([]PayoutRecord, error) {
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.read.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	return scanPayouts(rows)
+}
+
+// scanPayouts 解析按 payoutColumns 顺序返回的行（并关闭 rows）
+func scanPayouts(rows *sql.Rows) ([]PayoutRecord, error) {
 	defer rows.Close()
 
 	var results []PayoutRecord
 	for rows.Next() {
 		// 直接使用普通类型，因为数据库字段不是 NULL
 		var txHashStr, payerStr, merchantStr, srcStr, dstStr, grossStr, netStr, statusStr string
-		var solanaMerchant, solanaPayer string
-		var blockNumber, dstEid int64
+		var blockHash, dstTxHash, guid, failureReason, feeStr, feeIssue, srcContract, dstContract string
+		var blockNumber, dstEid, srcEid int64
+		var finalized, feeBps int
+		var deliveredAt sql.NullTime
 		var timestamp time.Time
 
 		rec := PayoutRecord{}
@@ -296,7 +428,10 @@ func (s *Store) listPayoutsByQuery(query string, args ...interface{}) ([]PayoutR
 			&txHashStr, &blockNumber, &timestamp, &dstEid,
 			&payerStr, &merchantStr, &srcStr, &dstStr,
 			&grossStr, &netStr, &statusStr,
-			&solanaMerchant, &solanaPayer,
+			&blockHash, &finalized,
+			&dstTxHash, &deliveredAt, &guid, &failureReason,
+			&feeStr, &feeBps, &feeIssue,
+			&srcEid, &srcContract, &dstContract,
 		)
 		if err != nil {
 			log.Printf("Store: failed to scan payout row: %v", err)
@@ -307,10 +442,13 @@ func (s *Store) listPayoutsByQuery(query string, args ...interface{}) ([]PayoutR
 		rec.TxHash = txHashStr
 		rec.BlockNumber = blockNumber
 		rec.DstEid = dstEid
-		rec.Payer = common.HexToAddress(payerStr)
-		rec.Merchant = common.HexToAddress(merchantStr)
+		rec.SrcEid = srcEid
+		rec.SrcContract = storedChainAddress(srcContract)
+		rec.DstContract = storedChainAddress(dstContract)
+		rec.Payer = storedChainAddress(payerStr)
+		rec.Merchant = storedChainAddress(merchantStr)
 		rec.SrcToken = common.HexToAddress(srcStr)
-		rec.DstToken = common.HexToAddress(dstStr)
+		rec.DstToken = storedChainAddress(dstStr)
 
 		// 解析大整数（big.Int）
 		rec.GrossAmount = big.NewInt(0)
@@ -331,8 +469,20 @@ func (s *Store) listPayoutsByQuery(query string, args ...interface{}) ([]PayoutR
 
 		rec.Status = statusStr
 		rec.Timestamp = timestamp.UTC()
-		rec.SolanaMerchant = solanaMerchant
-		rec.SolanaPayer = solanaPayer
+		rec.BlockHash = blockHash
+		rec.Finalized = finalized == 1
+		rec.DstTxHash = dstTxHash
+		rec.GUID = guid
+		rec.FailureReason = failureReason
+		rec.FeeAmount = big.NewInt(0)
+		if b, ok := new(big.Int).SetString(feeStr, 10); ok {
+			rec.FeeAmount = b
+		}
+		rec.FeeBps = feeBps
+		rec.FeeIssue = feeIssue
+		if deliveredAt.Valid {
+			rec.DeliveredAt = deliveredAt.Time.UTC()
+		}
 
 		results = append(results, rec)
 	}
@@ -344,37 +494,897 @@ func (s *Store) listPayoutsByQuery(query string, args ...interface{}) ([]PayoutR
 	return results, nil
 }
 
-// GetLastProcessedBlock 获取最后处理的区块高度
-func (s *Store) GetLastProcessedBlock(chainID int) (uint64, error) {
-	// ... (此函数内容不变，略去)
-	var blockNum sql.NullInt64
-	err := s.db.QueryRow(`
-		SELECT block_number FROM processed_blocks WHERE chain_id = ?
-	`, chainID).Scan(&blockNum)
+// checkpointContractKey 检查点表中合约 / 程序的键：EVM 小写十六进制，Solana 程序 ID 保持 Base58 原样
+func checkpointContractKey(contract string) string {
+	if a, err := ParseChainAddress(contract); err == nil {
+		return a.Key()
+	}
+	return contract
+}
 
+// GetCheckpoint 获取 (chain, contract) 的检查点；ok 为 false 表示尚无检查点
+//
+// 旧版本把 Solana 程序 ID 小写后作为键；找不到时按小写键查找并改写为正确的键。
+func (s *Store) GetCheckpoint(chain, contract string) (cp Checkpoint, ok bool, err error) {
+	key := checkpointContractKey(contract)
+	query := `SELECT block_number, COALESCE(block_hash, ''), COALESCE(signature, '') FROM checkpoints WHERE chain = ? AND contract = ?`
+	var blockNum int64
+	err = s.read.QueryRow(query, chain, key).Scan(&blockNum, &cp.BlockHash, &cp.Signature)
+	if err == sql.ErrNoRows && key != strings.ToLower(key) {
+		err = s.read.QueryRow(query, chain, strings.ToLower(key)).Scan(&blockNum, &cp.BlockHash, &cp.Signature)
+		if err == nil {
+			if err := s.write(func(tx *sqlTx) error {
+				_, err := tx.Exec(`UPDATE checkpoints SET contract = ? WHERE chain = ? AND contract = ?`,
+					key, chain, strings.ToLower(key))
+				return err
+			}); err != nil {
+				return Checkpoint{}, false, err
+			}
+		}
+	}
 	if err == sql.ErrNoRows {
-		return 0, nil
+		return Checkpoint{}, false, nil
 	}
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	cp.Block = uint64(blockNum)
+	return cp, true, nil
+}
+
+// SetCheckpoint 设置 (chain, contract) 的检查点（调用方保证区块已完整处理）
+func (s *Store) SetCheckpoint(chain, contract string, cp Checkpoint) error {
+	return s.write(func(tx *sqlTx) error {
+		_, err := tx.Exec(`
+			INSERT INTO checkpoints (chain, contract, block_number, block_hash, signature, updated_at)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(chain, contract) DO UPDATE SET
+				block_number = excluded.block_number,
+				block_hash = excluded.block_hash,
+				signature = excluded.signature,
+				updated_at = excluded.updated_at
+		`, chain, checkpointContractKey(contract), cp.Block, cp.BlockHash, cp.Signature)
+		return err
+	})
+}
+
+// --------------------------- 重组处理 ---------------------------
+
+// ListEventBlocks 返回链上 fromBlock 及之后仍有效的事件所在区块及其哈希
+func (s *Store) ListEventBlocks(chain string, fromBlock uint64) (map[uint64]string, error) {
+	rows, err := s.read.Query(`
+		SELECT DISTINCT block_number, COALESCE(block_hash, '')
+		FROM events
+		WHERE chain = ? AND block_number >= ? AND reorged = 0 AND block_hash != ''
+	`, chain, fromBlock)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := make(map[uint64]string)
+	for rows.Next() {
+		var num int64
+		var hash string
+		if err := rows.Scan(&num, &hash); err != nil {
+			return nil, err
+		}
+		blocks[uint64(num)] = hash
+	}
+	return blocks, rows.Err()
+}
+
+// RollbackBlock 回滚链上某个区块（哈希为 oldHash）中的所有事件及其 payout
+func (s *Store) RollbackBlock(chain string, blockNumber uint64, oldHash, newHash, reason string) (int, error) {
+	return s.rollbackEvents(`e.chain = ? AND e.block_number = ? AND e.block_hash = ?`,
+		[]interface{}{chain, blockNumber, oldHash}, newHash, reason)
+}
+
+// RollbackEvent 回滚单条事件（订阅推送 Removed 日志时使用）
+func (s *Store) RollbackEvent(chain, txHash string, logIndex uint, blockHash, reason string) (int, error) {
+	return s.rollbackEvents(`e.chain = ? AND e.tx_hash = ? AND e.log_index = ? AND e.block_hash = ?`,
+		[]interface{}{chain, txHash, logIndex, blockHash}, "", reason)
+}
+
+// rollbackEvents 在同一事务中：标记事件为 reorged、将未最终确认的 payout 置为 Reorged、写入审计记录，
+// 并丢弃同一区块（或同一日志）尚未处理成功的死信
+func (s *Store) rollbackEvents(where string, args []interface{}, newHash, reason string) (int, error) {
+	var count int
+	err := s.write(func(tx *sqlTx) (err error) {
+		if count, err = rollbackEventsTx(tx, where, args, newHash, reason); err != nil {
+			return err
+		}
+		// 条件中的字段在 dead_letters 中同名
+		_, err = tx.Exec(`
+			UPDATE dead_letters SET status = ?, updated_at = ?
+			WHERE status IN (?, ?) AND id IN (SELECT e.id FROM dead_letters e WHERE `+where+`)
+		`, append([]interface{}{DeadLetterDiscarded, time.Now().UTC().Format("2006-01-02 15:04:05"),
+			DeadLetterPending, DeadLetterExhausted}, args...)...)
+		return err
+	})
+	return count, err
+}
+
+// rollbackEventsTx rollbackEvents 在写事务中的实现，返回回滚的事件数
+func rollbackEventsTx(tx *sqlTx, where string, args []interface{}, newHash, reason string) (int, error) {
+	rows, err := tx.Query(`
+		SELECT e.chain, e.block_number, e.block_hash, e.tx_hash, e.log_index, COALESCE(p.status, ''), COALESCE(p.finalized, 0)
+		FROM events e LEFT JOIN payouts p ON p.tx_hash = e.tx_hash
+		WHERE e.reorged = 0 AND `+where, args...)
 	if err != nil {
 		return 0, err
 	}
-	if blockNum.Valid {
-		return uint64(blockNum.Int64), nil
+	type affected struct {
+		chain, blockHash, txHash, status string
+		blockNumber                      int64
+		logIndex, finalized              int
+	}
+	var list []affected
+	for rows.Next() {
+		var a affected
+		if err := rows.Scan(&a.chain, &a.blockNumber, &a.blockHash, &a.txHash, &a.logIndex, &a.status, &a.finalized); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, a := range list {
+		if a.finalized == 1 {
+			log.Printf("Store: WARNING reorg beyond confirmation depth on %s block %d, tx %s is finalized; not rolled back",
+				a.chain, a.blockNumber, a.txHash)
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE events SET reorged = 1 WHERE tx_hash = ? AND log_index = ?`, a.txHash, a.logIndex); err != nil {
+			return 0, err
+		}
+		// 目标链执行（或失败记录）被回滚：解除与源 payout 的关联，payout 回到 Pending
+		if _, err := tx.Exec(`
+			UPDATE payouts SET status = ?, dst_tx_hash = '', delivered_at = NULL, failure_reason = ''
+			WHERE status IN (?, ?) AND tx_hash = (
+				SELECT src_tx_hash FROM deliveries WHERE dst_tx_hash = ? AND log_index = ? AND src_tx_hash != ''
+			)
+		`, PayoutStatusPending, PayoutStatusDelivered, PayoutStatusFailed, a.txHash, a.logIndex); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`DELETE FROM deliveries WHERE dst_tx_hash = ? AND log_index = ?`, a.txHash, a.logIndex); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`UPDATE lz_messages SET dst_chain = '', dst_tx_hash = '' WHERE dst_tx_hash = ?`, a.txHash); err != nil {
+			return 0, err
+		}
+		if a.status != "" {
+			if _, err := tx.Exec(`UPDATE payouts SET status = ? WHERE tx_hash = ?`, PayoutStatusReorged, a.txHash); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO reorg_audit (chain, block_number, old_block_hash, new_block_hash, tx_hash, log_index, previous_status, reason)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.chain, a.blockNumber, a.blockHash, newHash, a.txHash, a.logIndex, a.status, reason); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// FinalizePayouts 将链上 uptoBlock 及之前的 payout 标记为已最终确认
+func (s *Store) FinalizePayouts(chain string, uptoBlock uint64) (int64, error) {
+	var n int64
+	err := s.write(func(tx *sqlTx) error {
+		res, err := tx.Exec(`
+			UPDATE payouts SET finalized = 1
+			WHERE finalized = 0 AND status != ? AND tx_hash IN (
+				SELECT tx_hash FROM events WHERE chain = ? AND reorged = 0 AND block_number <= ?
+			)
+		`, PayoutStatusReorged, chain, uptoBlock)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// ReorgAuditEntry 重组审计记录
+type ReorgAuditEntry struct {
+	Chain          string    `json:"chain"`
+	BlockNumber    uint64    `json:"block_number"`
+	OldBlockHash   string    `json:"old_block_hash"`
+	NewBlockHash   string    `json:"new_block_hash,omitempty"`
+	TxHash         string    `json:"tx_hash"`
+	LogIndex       int       `json:"log_index"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Reason         string    `json:"reason"`
+	DetectedAt     time.Time `json:"detected_at"`
+}
+
+// ListReorgAudit 按时间倒序列出重组审计记录
+func (s *Store) ListReorgAudit(limit, offset int) ([]ReorgAuditEntry, error) {
+	rows, err := s.read.Query(`
+		SELECT chain, block_number, old_block_hash, COALESCE(new_block_hash, ''), tx_hash, log_index,
+			COALESCE(previous_status, ''), reason, detected_at
+		FROM reorg_audit
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ReorgAuditEntry
+	for rows.Next() {
+		var e ReorgAuditEntry
+		if err := rows.Scan(&e.Chain, &e.BlockNumber, &e.OldBlockHash, &e.NewBlockHash, &e.TxHash, &e.LogIndex,
+			&e.PreviousStatus, &e.Reason, &e.DetectedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// --------------------------- 送达跟踪 ---------------------------
+
+// Delivery 目标链上的一次执行（EVM TokenPayoutExecuted 或 Solana transfer_out）
+type Delivery struct {
+	DstTxHash   string    `json:"dst_tx_hash"` // EVM 交易哈希 / Solana 签名
+	LogIndex    uint      `json:"log_index"`   // EVM 日志序号；Solana 为指令序号
+	DstChain    string    `json:"dst_chain"`
+	DstEid      int64     `json:"dst_eid"`
+	BlockNumber uint64    `json:"block_number"` // EVM 区块 / Solana slot
+	Merchant    string    `json:"merchant"`     // EVM 0x 地址或 Solana Base58 公钥
+	Token       string    `json:"token"`        // EVM 代币地址或 Solana mint
+	Amount      *big.Int  `json:"amount"`
+	DeliveredAt time.Time `json:"delivered_at"`
+	SrcTxHash   string    `json:"src_tx_hash,omitempty"` // 匹配到的源链 payout
+	GUID        string    `json:"guid,omitempty"`        // LayerZero 消息 GUID（已知时按 GUID 精确匹配）
+	Failed      bool      `json:"failed,omitempty"`      // 执行失败（revert / 交易报错）
+	Error       string    `json:"error,omitempty"`       // 失败原因
+}
+
+// deliveryMatchKeys 将目标链执行中的商户 / 代币地址转换为 payouts 表中的存储形式（ChainAddress.Key）
+func deliveryMatchKeys(d Delivery) (merchant, token string, err error) {
+	m, err := ParseChainAddress(d.Merchant)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid merchant: %w", err)
+	}
+	t, err := ParseChainAddress(d.Token)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid token: %w", err)
+	}
+	return m.Key(), t.Key(), nil
+}
+
+// RecordDelivery 保存目标链执行记录，并尝试与源链 payout 匹配
+//
+// 成功的执行将 payout 置为 Delivered，失败的执行（d.Failed）置为 Failed。
+// 返回匹配到的源链交易哈希（未匹配时为空）；重复的执行记录不会重复匹配。
+func (s *Store) RecordDelivery(d Delivery) (string, error) {
+	var matched string
+	err := s.write(func(tx *sqlTx) (err error) {
+		matched, err = recordDeliveryTx(tx, d)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return matched, nil
+}
+
+func recordDeliveryTx(tx *sqlTx, d Delivery) (string, error) {
+	if _, err := tx.Exec(`
+		INSERT INTO deliveries (dst_tx_hash, log_index, dst_chain, dst_eid, block_number, merchant, token, amount, delivered_at, guid, failed, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(dst_tx_hash, log_index) DO NOTHING
+	`, d.DstTxHash, d.LogIndex, d.DstChain, d.DstEid, d.BlockNumber, d.Merchant, d.Token,
+		d.Amount.String(), d.DeliveredAt.UTC().Format("2006-01-02 15:04:05"), d.GUID, d.Failed, d.Error); err != nil {
+		return "", err
+	}
+
+	var matched string
+	if err := tx.QueryRow(`SELECT COALESCE(src_tx_hash, '') FROM deliveries WHERE dst_tx_hash = ? AND log_index = ?`,
+		d.DstTxHash, d.LogIndex).Scan(&matched); err != nil {
+		return "", err
+	}
+	if matched != "" {
+		return matched, nil
+	}
+	return matchDelivery(tx, d)
+}
+
+// deliveryMatchWindow 无 GUID 时，源链交易早于目标链执行的最长时间
+const deliveryMatchWindow = 7 * 24 * time.Hour
+
+// matchDelivery 将执行记录匹配到未送达的 payout：
+//   - 执行记录带 GUID 时，按 GUID 精确匹配；
+//   - 否则（或 GUID 对应的 payout 尚未索引到 GUID 时）按 (目标 EID, 商户, 代币, 净额)
+//     匹配最早的、GUID 未知的 payout，源链交易时间必须在目标链执行前 deliveryMatchWindow 之内。
+//
+// 成功的执行可匹配 Pending / Stuck / Failed（executor 重试成功）的 payout；
+// 失败的执行只匹配 Pending / Stuck 的 payout。
+func matchDelivery(tx *sqlTx, d Delivery) (string, error) {
+	deliveredAt := d.DeliveredAt.UTC().Format("2006-01-02 15:04:05")
+	statuses := []interface{}{PayoutStatusPending, PayoutStatusStuck, PayoutStatusFailed}
+	if d.Failed {
+		statuses = statuses[:2]
+	}
+	statusIn := "status IN (?" + strings.Repeat(", ?", len(statuses)-1) + ")"
+
+	var srcTxHash string
+	var err error
+	if d.GUID != "" {
+		err = tx.QueryRow(`
+			SELECT tx_hash FROM payouts
+			WHERE guid = ? AND `+statusIn+` AND COALESCE(dst_tx_hash, '') = ''
+		`, append([]interface{}{d.GUID}, statuses...)...).Scan(&srcTxHash)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+	if srcTxHash == "" {
+		merchant, token, err := deliveryMatchKeys(d)
+		if err != nil {
+			return "", err
+		}
+		args := append([]interface{}{d.DstEid}, statuses...)
+		windowStart := d.DeliveredAt.Add(-deliveryMatchWindow).UTC().Format("2006-01-02 15:04:05")
+		args = append(args, d.Amount.String(), merchant, token, windowStart, deliveredAt)
+		err = tx.QueryRow(`
+			SELECT tx_hash FROM payouts
+			WHERE dst_eid = ? AND `+statusIn+` AND COALESCE(dst_tx_hash, '') = '' AND COALESCE(guid, '') = ''
+				AND net_amount = ? AND merchant = ? AND dst_token = ? AND timestamp >= ? AND timestamp <= ?
+			ORDER BY timestamp ASC, block_number ASC
+			LIMIT 1
+		`, args...).Scan(&srcTxHash)
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if d.Failed {
+		_, err = tx.Exec(`UPDATE payouts SET status = ?, failure_reason = ? WHERE tx_hash = ?`,
+			PayoutStatusFailed, fmt.Sprintf("%s (tx %s)", d.Error, d.DstTxHash), srcTxHash)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE payouts SET status = ?, dst_tx_hash = ?, delivered_at = ?, failure_reason = '' WHERE tx_hash = ?
+		`, PayoutStatusDelivered, d.DstTxHash, deliveredAt, srcTxHash)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`UPDATE deliveries SET src_tx_hash = ? WHERE dst_tx_hash = ? AND log_index = ?`,
+		srcTxHash, d.DstTxHash, d.LogIndex); err != nil {
+		return "", err
+	}
+	return srcTxHash, nil
+}
+
+// MatchDeliveries 重新匹配尚未关联源链 payout 的执行记录，返回本次匹配成功的记录
+//
+// 目标链执行可能先于源链事件被索引（例如源链回填落后），因此需要周期性重试。
+//
+// 按 (delivered_at, dst_tx_hash, log_index) 翻页遍历全部未匹配记录：永远匹配不上的旧记录
+// （例如无关发送方的 Solana transfer_out）不会挡住较新的记录。
+func (s *Store) MatchDeliveries() ([]Delivery, error) {
+	var matched []Delivery
+	var last *Delivery
+	for {
+		where, args := `WHERE COALESCE(src_tx_hash, '') = ''`, []interface{}{}
+		if last != nil {
+			where += ` AND (delivered_at, dst_tx_hash, log_index) > (?, ?, ?)`
+			args = append(args, last.DeliveredAt.Format("2006-01-02 15:04:05"), last.DstTxHash, last.LogIndex)
+		}
+		unmatched, err := s.listDeliveries(where+` ORDER BY delivered_at, dst_tx_hash, log_index LIMIT ?`,
+			append(args, matchDeliveriesPageSize)...)
+		if err != nil {
+			return matched, err
+		}
+
+		for _, d := range unmatched {
+			var src string
+			if err := s.write(func(tx *sqlTx) error {
+				var err error
+				src, err = matchDelivery(tx, d)
+				return err
+			}); err != nil {
+				return matched, err
+			}
+			if src != "" {
+				d.SrcTxHash = src
+				matched = append(matched, d)
+			}
+		}
+		if len(unmatched) < matchDeliveriesPageSize {
+			return matched, nil
+		}
+		last = &unmatched[len(unmatched)-1]
+	}
+}
+
+// matchDeliveriesPageSize MatchDeliveries 每页读取的未匹配记录数
+const matchDeliveriesPageSize = 500
+
+// ListUnmatchedDeliveries 列出尚未关联源链 payout 的目标链执行（按执行时间倒序）
+//
+// 这类执行单独保存在 deliveries 中，不计入 payouts 与商户统计。
+func (s *Store) ListUnmatchedDeliveries(limit, offset int) ([]Delivery, error) {
+	return s.listDeliveries(`WHERE COALESCE(src_tx_hash, '') = '' ORDER BY delivered_at DESC LIMIT ? OFFSET ?`, limit, offset)
+}
+
+// listDeliveries 按条件读取执行记录
+func (s *Store) listDeliveries(where string, args ...interface{}) ([]Delivery, error) {
+	rows, err := s.read.Query(`
+		SELECT dst_tx_hash, log_index, dst_chain, dst_eid, block_number, merchant, token, amount, delivered_at,
+			COALESCE(src_tx_hash, ''), COALESCE(guid, ''), COALESCE(failed, 0), COALESCE(error, '')
+		FROM deliveries `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Delivery
+	for rows.Next() {
+		var d Delivery
+		var amount string
+		if err := rows.Scan(&d.DstTxHash, &d.LogIndex, &d.DstChain, &d.DstEid, &d.BlockNumber, &d.Merchant, &d.Token,
+			&amount, &d.DeliveredAt, &d.SrcTxHash, &d.GUID, &d.Failed, &d.Error); err != nil {
+			return nil, err
+		}
+		d.Amount = new(big.Int)
+		d.Amount.SetString(amount, 10)
+		d.DeliveredAt = d.DeliveredAt.UTC()
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// MarkStuck 将路由为 srcEid -> dstEid、源链时间早于 cutoff 仍未送达的 payout 置为 Stuck，
+// 返回本次新标记的 payout。
+func (s *Store) MarkStuck(srcEid, dstEid int64, cutoff time.Time, reason string) ([]PayoutRecord, error) {
+	where := `WHERE status = ? AND src_eid = ? AND dst_eid = ? AND timestamp < ?`
+	args := []interface{}{PayoutStatusPending, srcEid, dstEid, cutoff.UTC().Format("2006-01-02 15:04:05")}
+
+	// 更新与返回在同一语句中完成：只返回实际改为 Stuck 的 payout，已送达的不会被误报
+	var stuck []PayoutRecord
+	if err := s.write(func(tx *sqlTx) error {
+		rows, err := tx.Query(`UPDATE payouts SET status = ?, failure_reason = ? `+where+` RETURNING `+payoutColumns,
+			append([]interface{}{PayoutStatusStuck, reason}, args...)...)
+		if err != nil {
+			return err
+		}
+		stuck, err = scanPayouts(rows)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return stuck, nil
+}
+
+// PayoutFilter payout 列表过滤条件（零值字段不参与过滤）
+type PayoutFilter struct {
+	Statuses    []string
+	Merchant    ChainAddress
+	SrcEid      int64
+	DstEid      int64
+	SrcContract ChainAddress
+	DstContract ChainAddress
+}
+
+// where 生成 WHERE 子句及参数（无条件时为空）
+func (f PayoutFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if len(f.Statuses) > 0 {
+		conds = append(conds, `status IN (?`+strings.Repeat(", ?", len(f.Statuses)-1)+`)`)
+		for _, st := range f.Statuses {
+			args = append(args, st)
+		}
+	}
+	for _, c := range []struct {
+		column string
+		value  interface{}
+		set    bool
+	}{
+		{"merchant", f.Merchant.Key(), !f.Merchant.IsZero()},
+		{"src_eid", f.SrcEid, f.SrcEid != 0},
+		{"dst_eid", f.DstEid, f.DstEid != 0},
+		{"src_contract", f.SrcContract.Key(), !f.SrcContract.IsZero()},
+		{"dst_contract", f.DstContract.Key(), !f.DstContract.IsZero()},
+	} {
+		if c.set {
+			conds = append(conds, c.column+` = ?`)
+			args = append(args, c.value)
+		}
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ListPayoutsFiltered 按过滤条件列出 payout（按时间倒序；无条件时等同 ListPayouts）
+func (s *Store) ListPayoutsFiltered(f PayoutFilter, limit, offset int) ([]PayoutRecord, error) {
+	where, args := f.where()
+	if where == "" {
+		return s.ListPayouts(limit, offset)
+	}
+	return s.listPayoutsByQuery(`
+		SELECT `+payoutColumns+` FROM payouts
+		`+where+`
+		ORDER BY timestamp DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+}
+
+// --------------------------- 手续费 ---------------------------
+
+// 手续费汇总维度
+const (
+	FeeGroupDay      = "day"
+	FeeGroupChain    = "chain" // 源链（收取手续费的链）
+	FeeGroupToken    = "token" // 源链代币（手续费计价代币），按 (源链 EID, 地址) 区分
+	FeeGroupMerchant = "merchant"
+)
+
+// feeGroupColumns 维度 -> SQL 表达式
+var feeGroupColumns = map[string]string{
+	FeeGroupDay:      `p.timestamp`, // 由方言截取为 YYYY-MM-DD
+	FeeGroupChain:    `COALESCE((SELECT e.chain FROM events e WHERE e.tx_hash = p.tx_hash LIMIT 1), '')`,
+	FeeGroupToken:    `p.src_token`,
+	FeeGroupMerchant: `p.merchant`,
+}
+
+// FeeRevenue 一组 payout 的手续费汇总（未参与分组的维度为空）
+//
+// 不同链上的代币可能地址相同、精度不同，按 token 分组时同时按 TokenEid 区分。
+type FeeRevenue struct {
+	Day         string `json:"day,omitempty"`
+	Chain       string `json:"chain,omitempty"`
+	TokenEid    int64  `json:"token_eid,omitempty"` // 代币所在的源链 EID（0 表示旧数据尚未回填）
+	Token       string `json:"token,omitempty"`
+	Symbol      string `json:"symbol,omitempty"`   // 由 API 按代币注册表填写（未知代币为空）
+	Decimals    *uint8 `json:"decimals,omitempty"` // 同上
+	Merchant    string `json:"merchant,omitempty"`
+	Payouts     int    `json:"payouts"`
+	GrossAmount string `json:"gross_amount"`
+	FeeAmount   string `json:"fee_amount"`
+}
+
+// FeeRevenue 按维度汇总 [from, to) 内的手续费收入（不含被重组回滚的 payout）
+//
+// 金额为 uint256，在 Go 中用 big.Int 累加，避免数据库整数溢出。
+func (s *Store) FeeRevenue(groupBy []string, from, to time.Time) ([]FeeRevenue, error) {
+	exprs := make([]string, 0, 5)
+	for _, g := range []string{FeeGroupDay, FeeGroupChain, FeeGroupToken, FeeGroupMerchant} {
+		expr, tokenEid := "''", "0"
+		for _, want := range groupBy {
+			if want == g {
+				expr = feeGroupColumns[g]
+				if g == FeeGroupDay {
+					expr = s.db.dialect.dateExpr(expr)
+				}
+				if g == FeeGroupToken {
+					tokenEid = `COALESCE(p.src_eid, 0)`
+				}
+			}
+		}
+		if g == FeeGroupToken {
+			exprs = append(exprs, tokenEid)
+		}
+		exprs = append(exprs, expr)
+	}
+	for _, g := range groupBy {
+		if _, ok := feeGroupColumns[g]; !ok {
+			return nil, fmt.Errorf("unknown fee group %q", g)
+		}
+	}
+
+	where := []string{"p.status != ?"}
+	args := []interface{}{PayoutStatusReorged}
+	if !from.IsZero() {
+		where = append(where, "p.timestamp >= ?")
+		args = append(args, from.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !to.IsZero() {
+		where = append(where, "p.timestamp < ?")
+		args = append(args, to.UTC().Format("2006-01-02 15:04:05"))
+	}
+	rows, err := s.read.Query(`
+		SELECT `+strings.Join(exprs, ", ")+`, p.gross_amount, COALESCE(p.fee_amount, '0')
+		FROM payouts p
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY 1, 2, 3, 4, 5
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type sums struct{ gross, fee *big.Int }
+	var out []FeeRevenue
+	var totals []sums
+	index := make(map[FeeRevenue]int)
+	for rows.Next() {
+		var key FeeRevenue
+		var grossStr, feeStr string
+		if err := rows.Scan(&key.Day, &key.Chain, &key.TokenEid, &key.Token, &key.Merchant, &grossStr, &feeStr); err != nil {
+			return nil, err
+		}
+		if key.Merchant != "" {
+			key.Merchant = storedChainAddress(key.Merchant).String()
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, key)
+			totals = append(totals, sums{new(big.Int), new(big.Int)})
+		}
+		out[i].Payouts++
+		if v, ok := new(big.Int).SetString(grossStr, 10); ok {
+			totals[i].gross.Add(totals[i].gross, v)
+		}
+		if v, ok := new(big.Int).SetString(feeStr, 10); ok {
+			totals[i].fee.Add(totals[i].fee, v)
+		}
 	}
-	return 0, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].GrossAmount = totals[i].gross.String()
+		out[i].FeeAmount = totals[i].fee.String()
+	}
+	return out, nil
+}
+
+// ListFeeIssues 列出手续费校验未通过的 payout（按时间倒序）
+func (s *Store) ListFeeIssues(limit, offset int) ([]PayoutRecord, error) {
+	return s.listPayoutsByQuery(`
+		SELECT `+payoutColumns+` FROM payouts
+		WHERE COALESCE(fee_issue, '') != ''
+		ORDER BY timestamp DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+}
+
+// --------------------------- 代币 ---------------------------
+
+// UpsertToken 保存链上读取的代币元数据
+func (s *Store) UpsertToken(t TokenInfo) error {
+	return s.write(func(tx *sqlTx) error {
+		_, err := tx.Exec(`
+			INSERT INTO tokens (eid, address, symbol, decimals, peg) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(eid, address) DO UPDATE SET
+				symbol = excluded.symbol,
+				decimals = excluded.decimals,
+				peg = excluded.peg,
+				updated_at = CURRENT_TIMESTAMP
+		`, t.EID, t.Address, t.Symbol, t.Decimals, t.Peg)
+		return err
+	})
+}
+
+// ListTokens 列出已保存的代币元数据
+func (s *Store) ListTokens() ([]TokenInfo, error) {
+	rows, err := s.read.Query(`SELECT eid, address, COALESCE(symbol, ''), decimals, COALESCE(peg, '') FROM tokens`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []TokenInfo
+	for rows.Next() {
+		t := TokenInfo{Source: TokenSourceChain}
+		if err := rows.Scan(&t.EID, &t.Address, &t.Symbol, &t.Decimals, &t.Peg); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// --------------------------- Solana 指令 ---------------------------
+
+// Solana 解码记录类型
+const (
+	SolanaKindInstruction      = "instruction"
+	SolanaKindInnerInstruction = "inner_instruction" // CPI，data 中 outer 为发起它的顶层指令
+	SolanaKindEvent            = "event"
+)
+
+// SolanaInstructionRecord 一条按 IDL 解码的 Solana 指令或事件
+type SolanaInstructionRecord struct {
+	Signature string          `json:"signature"`
+	Kind      string          `json:"kind"`
+	Index     int             `json:"index"`
+	Chain     string          `json:"chain"`
+	Slot      uint64          `json:"slot"`
+	BlockTime time.Time       `json:"block_time"`
+	Program   string          `json:"program"`
+	Name      string          `json:"name"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// SaveSolanaInstructions 保存一笔交易解码出的指令与事件（重复处理时覆盖）
+func (s *Store) SaveSolanaInstructions(recs []SolanaInstructionRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	return s.write(func(tx *sqlTx) error {
+		return saveSolanaInstructionsTx(tx, recs)
+	})
+}
+
+func saveSolanaInstructionsTx(tx *sqlTx, recs []SolanaInstructionRecord) error {
+	for _, r := range recs {
+		if _, err := tx.Exec(`
+			INSERT INTO solana_instructions (signature, kind, idx, chain, slot, block_time, program, name, data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(signature, kind, idx) DO UPDATE SET
+				chain = excluded.chain,
+				slot = excluded.slot,
+				block_time = excluded.block_time,
+				program = excluded.program,
+				name = excluded.name,
+				data = excluded.data
+		`, r.Signature, r.Kind, r.Index, r.Chain, r.Slot, r.BlockTime, r.Program, r.Name, string(r.Data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSolanaInstructions 按程序 / 名称（为空表示不限）列出解码记录，按 slot 倒序
+func (s *Store) ListSolanaInstructions(program, name string, limit, offset int) ([]SolanaInstructionRecord, error) {
+	rows, err := s.read.Query(`
+		SELECT signature, kind, idx, chain, slot, block_time, program, name, data
+		FROM solana_instructions
+		WHERE (? = '' OR program = ?) AND (? = '' OR name = ?)
+		ORDER BY slot DESC, signature, kind, idx
+		LIMIT ? OFFSET ?
+	`, program, program, name, name, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SolanaInstructionRecord
+	for rows.Next() {
+		var (
+			r    SolanaInstructionRecord
+			data string
+		)
+		if err := rows.Scan(&r.Signature, &r.Kind, &r.Index, &r.Chain, &r.Slot, &r.BlockTime, &r.Program, &r.Name, &data); err != nil {
+			return nil, err
+		}
+		r.Data = json.RawMessage(data)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// --------------------------- LayerZero 消息 ---------------------------
+
+// LZMessage 一条 LayerZero 消息在源链与目标链上的关联
+type LZMessage struct {
+	GUID      string `json:"guid"`
+	SrcEid    uint32 `json:"src_eid"`
+	DstEid    uint32 `json:"dst_eid"`
+	Nonce     uint64 `json:"nonce"`
+	Sender    string `json:"sender"`
+	Receiver  string `json:"receiver"`
+	SrcChain  string `json:"src_chain,omitempty"`
+	SrcTxHash string `json:"src_tx_hash,omitempty"`
+	DstChain  string `json:"dst_chain,omitempty"`
+	DstTxHash string `json:"dst_tx_hash,omitempty"`
 }
 
-// SetLastProcessedBlock 设置最后处理的区块高度
-func (s *Store) SetLastProcessedBlock(chainID int, blockNum uint64) error {
-	// ... (此函数内容不变，略去)
-	_, err := s.db.Exec(`
-		INSERT INTO processed_blocks (chain_id, block_number)
-		VALUES (?, ?)
-		ON CONFLICT(chain_id) DO UPDATE SET block_number = excluded.block_number
-	`, chainID, blockNum)
+// RecordPacketSent 记录源链 PacketSent，并把 GUID 写入对应 payout
+func (s *Store) RecordPacketSent(m LZMessage) error {
+	return s.write(func(tx *sqlTx) error {
+		return recordPacketSentTx(tx, m)
+	})
+}
+
+func recordPacketSentTx(tx *sqlTx, m LZMessage) error {
+
+	if _, err := tx.Exec(`
+		INSERT INTO lz_messages (guid, src_eid, dst_eid, nonce, sender, receiver, src_chain, src_tx_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(guid) DO UPDATE SET
+			src_chain = excluded.src_chain,
+			src_tx_hash = excluded.src_tx_hash,
+			updated_at = CURRENT_TIMESTAMP
+	`, m.GUID, m.SrcEid, m.DstEid, m.Nonce, m.Sender, m.Receiver, m.SrcChain, m.SrcTxHash); err != nil {
+		return err
+	}
+	// receiver 即目标链 OApp，按 payout 商户的地址命名空间解析
+	ns := addressNamespaceForEID(int64(m.DstEid))
+	var merchant string
+	if err := tx.QueryRow(`SELECT merchant FROM payouts WHERE tx_hash = ?`, m.SrcTxHash).Scan(&merchant); err == nil {
+		if n := storedChainAddress(merchant).Namespace(); n != "" {
+			ns = n
+		}
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+	dstContract := ChainAddressFromBytes32(ns, common.HexToHash(m.Receiver))
+	if _, err := tx.Exec(`
+		UPDATE payouts SET guid = ?, dst_contract = ?, src_eid = CASE WHEN src_eid = 0 THEN ? ELSE src_eid END
+		WHERE tx_hash = ?
+	`, m.GUID, dstContract.Key(), m.SrcEid, m.SrcTxHash); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RecordPacketDelivered 记录目标链 PacketDelivered / lz_receive
+func (s *Store) RecordPacketDelivered(m LZMessage) error {
+	return s.write(func(tx *sqlTx) error {
+		return recordPacketDeliveredTx(tx, m)
+	})
+}
+
+func recordPacketDeliveredTx(tx *sqlTx, m LZMessage) error {
+	_, err := tx.Exec(`
+		INSERT INTO lz_messages (guid, src_eid, dst_eid, nonce, sender, receiver, dst_chain, dst_tx_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(guid) DO UPDATE SET
+			dst_chain = excluded.dst_chain,
+			dst_tx_hash = excluded.dst_tx_hash,
+			updated_at = CURRENT_TIMESTAMP
+	`, m.GUID, m.SrcEid, m.DstEid, m.Nonce, m.Sender, m.Receiver, m.DstChain, m.DstTxHash)
 	return err
 }
 
+// GetLZMessage 按 GUID 查询消息
+func (s *Store) GetLZMessage(guid string) (LZMessage, bool, error) {
+	list, err := s.listLZMessages(`WHERE guid = ?`, guid)
+	if err != nil || len(list) == 0 {
+		return LZMessage{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// ListLZMessages 按时间倒序列出消息
+func (s *Store) ListLZMessages(limit, offset int) ([]LZMessage, error) {
+	return s.listLZMessages(`ORDER BY created_at DESC, guid LIMIT ? OFFSET ?`, limit, offset)
+}
+
+func (s *Store) listLZMessages(where string, args ...interface{}) ([]LZMessage, error) {
+	rows, err := s.read.Query(`
+		SELECT guid, src_eid, dst_eid, nonce, sender, receiver,
+			COALESCE(src_chain, ''), COALESCE(src_tx_hash, ''), COALESCE(dst_chain, ''), COALESCE(dst_tx_hash, '')
+		FROM lz_messages `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []LZMessage
+	for rows.Next() {
+		var m LZMessage
+		if err := rows.Scan(&m.GUID, &m.SrcEid, &m.DstEid, &m.Nonce, &m.Sender, &m.Receiver,
+			&m.SrcChain, &m.SrcTxHash, &m.DstChain, &m.DstTxHash); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
 // RawEvent 原始事件记录
 type RawEvent struct {
 	TxHash      string `json:"tx_hash"`
@@ -393,7 +1403,7 @@ func (s *Store) GetAllEvents(limit, offset int) ([]RawEvent, error) {
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := s.db.Query(query, limit, offset)
+	rows, err := s.read.Query(query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -418,9 +1428,238 @@ func (s *Store) GetAllEvents(limit, offset int) ([]RawEvent, error) {
 	return events, nil
 }
 
+// EventRange 按链与区块范围（Solana 为 slot）选择原始事件；ToBlock 为 0 表示不限
+type EventRange struct {
+	Chain     string
+	FromBlock uint64
+	ToBlock   uint64
+}
+
+// StoredEvent 保存的原始事件（重新索引时读取）
+type StoredEvent struct {
+	EventRecord
+	Parsed bool
+}
+
+// ListStoredEvents 按 (block_number, tx_hash, log_index) 顺序分页读取范围内未被重组回滚的原始事件，
+// 从 after 之后开始（首页传零值）
+func (s *Store) ListStoredEvents(r EventRange, after EventRecord, limit int) ([]StoredEvent, error) {
+	where := []string{`reorged = 0`,
+		`(block_number > ? OR (block_number = ? AND (tx_hash > ? OR (tx_hash = ? AND log_index > ?))))`}
+	args := []interface{}{after.BlockNumber, after.BlockNumber, after.TxHash, after.TxHash, after.LogIndex}
+	if r.Chain != "" {
+		where = append(where, `chain = ?`)
+		args = append(args, r.Chain)
+	}
+	if r.FromBlock > 0 {
+		where = append(where, `block_number >= ?`)
+		args = append(args, r.FromBlock)
+	}
+	if r.ToBlock > 0 {
+		where = append(where, `block_number <= ?`)
+		args = append(args, r.ToBlock)
+	}
+	args = append(args, limit)
+
+	rows, err := s.read.Query(`
+		SELECT COALESCE(chain, ''), tx_hash, log_index, block_number, COALESCE(block_hash, ''), block_time, raw_log, parsed
+		FROM events
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY block_number, tx_hash, log_index
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []StoredEvent
+	for rows.Next() {
+		var e StoredEvent
+		var blockTime sql.NullTime
+		var parsed int
+		if err := rows.Scan(&e.Chain, &e.TxHash, &e.LogIndex, &e.BlockNumber, &e.BlockHash, &blockTime, &e.RawLog, &parsed); err != nil {
+			return nil, err
+		}
+		if blockTime.Valid {
+			e.BlockTime = blockTime.Time.UTC()
+		}
+		e.Parsed = parsed == 1
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
 // GetEventCount 获取事件总数
 func (s *Store) GetEventCount() (int, error) {
 	var count int
-	err := s.db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count)
+	err := s.read.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count)
 	return count, err
 }
+
+// --------------------------- 死信 ---------------------------
+
+// 死信状态
+const (
+	DeadLetterPending   = "pending"   // 等待自动重试
+	DeadLetterExhausted = "exhausted" // 自动重试次数用尽，等待管理员重试或丢弃
+	DeadLetterResolved  = "resolved"  // 重试成功，或事件已由其他途径（回填、重新索引）处理
+	DeadLetterDiscarded = "discarded" // 管理员丢弃，或所在区块被重组回滚
+)
+
+// DeadLetter 一条处理失败的链上事件
+type DeadLetter struct {
+	ID          int64     `json:"id"`
+	Chain       string    `json:"chain"`
+	TxHash      string    `json:"tx_hash"`   // EVM 交易哈希 / Solana 签名
+	LogIndex    uint      `json:"log_index"` // EVM 日志序号；Solana 为 0
+	BlockNumber uint64    `json:"block_number"`
+	BlockHash   string    `json:"block_hash,omitempty"`
+	Payload     string    `json:"payload,omitempty"` // EVM 日志 JSON / Solana getTransaction 结果（未取到交易时为空）
+	ErrorClass  string    `json:"error_class"`
+	Error       string    `json:"error"`
+	Attempts    int       `json:"attempts"` // 失败次数（含首次处理）
+	Status      string    `json:"status"`
+	NextRetryAt time.Time `json:"next_retry_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DeadLetterFilter 死信列表过滤条件（零值字段不参与过滤）
+type DeadLetterFilter struct {
+	Chain  string
+	Status string
+}
+
+func (f DeadLetterFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if f.Chain != "" {
+		conds = append(conds, `chain = ?`)
+		args = append(args, f.Chain)
+	}
+	if f.Status != "" {
+		conds = append(conds, `status = ?`)
+		args = append(args, f.Status)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// AddDeadLetter 记录一次处理失败（首次失败，attempts 为 1）
+//
+// 同一事件已在队列中时只更新错误信息；此前已解决的事件再次失败时重新进入等待重试。
+func (s *Store) AddDeadLetter(dl DeadLetter) error {
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	return s.write(func(tx *sqlTx) error {
+		_, err := tx.Exec(`
+			INSERT INTO dead_letters (chain, tx_hash, log_index, block_number, block_hash, payload, error_class, error,
+				attempts, status, next_retry_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+			ON CONFLICT(chain, tx_hash, log_index) DO UPDATE SET
+				block_number = excluded.block_number,
+				block_hash = excluded.block_hash,
+				payload = CASE WHEN excluded.payload != '' THEN excluded.payload ELSE dead_letters.payload END,
+				error_class = excluded.error_class,
+				error = excluded.error,
+				attempts = CASE WHEN dead_letters.status = ? THEN 1 ELSE dead_letters.attempts END,
+				next_retry_at = CASE WHEN dead_letters.status = ? THEN excluded.next_retry_at ELSE dead_letters.next_retry_at END,
+				status = CASE WHEN dead_letters.status = ? THEN excluded.status ELSE dead_letters.status END,
+				updated_at = excluded.updated_at
+		`, dl.Chain, dl.TxHash, dl.LogIndex, dl.BlockNumber, dl.BlockHash, dl.Payload, dl.ErrorClass, dl.Error,
+			DeadLetterPending, dl.NextRetryAt.UTC().Format("2006-01-02 15:04:05"), now, now,
+			DeadLetterResolved, DeadLetterResolved, DeadLetterResolved)
+		return err
+	})
+}
+
+// UpdateDeadLetter 保存一次重试（或管理员操作）后的错误、次数、状态与下次重试时间
+func (s *Store) UpdateDeadLetter(dl DeadLetter) error {
+	return s.write(func(tx *sqlTx) error {
+		_, err := tx.Exec(`
+			UPDATE dead_letters SET error_class = ?, error = ?, attempts = ?, status = ?, next_retry_at = ?, updated_at = ?
+			WHERE id = ?
+		`, dl.ErrorClass, dl.Error, dl.Attempts, dl.Status, dl.NextRetryAt.UTC().Format("2006-01-02 15:04:05"),
+			time.Now().UTC().Format("2006-01-02 15:04:05"), dl.ID)
+		return err
+	})
+}
+
+// resolveDeadLettersTx 事件已成功处理：将它的死信标记为已解决
+func resolveDeadLettersTx(tx *sqlTx, txHash string, logIndex uint) error {
+	_, err := tx.Exec(`
+		UPDATE dead_letters SET status = ?, updated_at = ?
+		WHERE tx_hash = ? AND log_index = ? AND status IN (?, ?)
+	`, DeadLetterResolved, time.Now().UTC().Format("2006-01-02 15:04:05"), txHash, logIndex, DeadLetterPending, DeadLetterExhausted)
+	return err
+}
+
+const deadLetterColumns = `id, chain, tx_hash, log_index, block_number, COALESCE(block_hash, ''), payload, error_class, error,
+	attempts, status, next_retry_at, created_at, updated_at`
+
+// GetDeadLetter 按 ID 查询死信；ok 为 false 表示不存在
+func (s *Store) GetDeadLetter(id int64) (DeadLetter, bool, error) {
+	list, err := s.listDeadLetters(`WHERE id = ?`, id)
+	if err != nil || len(list) == 0 {
+		return DeadLetter{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// ListDeadLetters 按过滤条件列出死信（新的在前）
+func (s *Store) ListDeadLetters(f DeadLetterFilter, limit, offset int) ([]DeadLetter, error) {
+	where, args := f.where()
+	return s.listDeadLetters(where+` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+}
+
+// DueDeadLetters 到期需要自动重试的死信（按重试时间先后）
+func (s *Store) DueDeadLetters(now time.Time, limit int) ([]DeadLetter, error) {
+	return s.listDeadLetters(`WHERE status = ? AND next_retry_at <= ? ORDER BY next_retry_at, id LIMIT ?`,
+		DeadLetterPending, now.UTC().Format("2006-01-02 15:04:05"), limit)
+}
+
+// CountDeadLetters 按状态统计死信数量
+func (s *Store) CountDeadLetters() (map[string]int, error) {
+	rows, err := s.read.Query(`SELECT status, COUNT(*) FROM dead_letters GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// listDeadLetters 按条件读取死信
+func (s *Store) listDeadLetters(where string, args ...interface{}) ([]DeadLetter, error) {
+	rows, err := s.read.Query(`SELECT `+deadLetterColumns+` FROM dead_letters `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []DeadLetter
+	for rows.Next() {
+		var dl DeadLetter
+		var nextRetry sql.NullTime
+		if err := rows.Scan(&dl.ID, &dl.Chain, &dl.TxHash, &dl.LogIndex, &dl.BlockNumber, &dl.BlockHash, &dl.Payload,
+			&dl.ErrorClass, &dl.Error, &dl.Attempts, &dl.Status, &nextRetry, &dl.CreatedAt, &dl.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if nextRetry.Valid {
+			dl.NextRetryAt = nextRetry.Time.UTC()
+		}
+		dl.CreatedAt, dl.UpdatedAt = dl.CreatedAt.UTC(), dl.UpdatedAt.UTC()
+		list = append(list, dl)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,759 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// newTestStore 在临时目录中创建 SQLite Store
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := NewStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func testCheckpoints(t *testing.T, s *Store) {
+	const contract = "0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6"
+
+	if _, ok, err := s.GetCheckpoint("Base Sepolia", contract); err != nil || ok {
+		t.Fatalf("expected no checkpoint, got ok=%v err=%v", ok, err)
+	}
+
+	if err := s.SetCheckpoint("Base Sepolia", contract, Checkpoint{Block: 100, BlockHash: "0xaa"}); err != nil {
+		t.Fatalf("SetCheckpoint: %v", err)
+	}
+	if err := s.SetCheckpoint("Base Sepolia", contract, Checkpoint{Block: 250, BlockHash: "0xbb"}); err != nil {
+		t.Fatalf("SetCheckpoint: %v", err)
+	}
+
+	// 合约地址大小写不敏感
+	cp, ok, err := s.GetCheckpoint("Base Sepolia", "0xa1d91cdcbd933c3385d7dea34d87357f5e62f6d6")
+	if err != nil || !ok || cp.Block != 250 || cp.BlockHash != "0xbb" {
+		t.Errorf("GetCheckpoint = %+v, %v, %v; want block 250 hash 0xbb", cp, ok, err)
+	}
+
+	// 不同链互不影响
+	if _, ok, _ := s.GetCheckpoint("Arbitrum Sepolia", contract); ok {
+		t.Error("checkpoint leaked across chains")
+	}
+
+	// Solana 程序 ID 大小写敏感；旧版本写入的小写键在读取时改写为原样
+	const program = "GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1"
+	if _, err := s.db.Exec(`INSERT INTO checkpoints (chain, contract, block_number) VALUES (?, ?, ?)`,
+		"Solana Devnet", "gspmsxkxd5qr5hg4fhud5cbrvkwnjwi6pwufqnymtec1", 42); err != nil {
+		t.Fatal(err)
+	}
+	if cp, ok, err := s.GetCheckpoint("Solana Devnet", program); err != nil || !ok || cp.Block != 42 {
+		t.Fatalf("legacy Solana checkpoint = %+v, %v, %v", cp, ok, err)
+	}
+	var key string
+	if err := s.db.QueryRow(`SELECT contract FROM checkpoints WHERE chain = ?`, "Solana Devnet").Scan(&key); err != nil || key != program {
+		t.Errorf("checkpoint key = %q, %v; want %s", key, err, program)
+	}
+}
+
+// insertTestPayout 写入一条源链事件及对应的 payout
+func insertTestPayout(t *testing.T, s *Store, chain, txHash string, block uint64, blockHash string) {
+	t.Helper()
+	if _, err := s.InsertEventIfNotExists(chain, txHash, 0, block, blockHash, "{}"); err != nil {
+		t.Fatalf("InsertEventIfNotExists: %v", err)
+	}
+	err := s.UpsertPayout(PayoutRecord{
+		TxHash:      txHash,
+		BlockNumber: int64(block),
+		DstEid:      40231,
+		GrossAmount: big.NewInt(100),
+		NetAmount:   big.NewInt(99),
+		Status:      PayoutStatusPending,
+		Timestamp:   time.Now().UTC(),
+		BlockHash:   blockHash,
+	})
+	if err != nil {
+		t.Fatalf("UpsertPayout: %v", err)
+	}
+}
+
+func payoutByTx(t *testing.T, s *Store, txHash string) PayoutRecord {
+	t.Helper()
+	list, err := s.ListPayouts(100, 0)
+	if err != nil {
+		t.Fatalf("ListPayouts: %v", err)
+	}
+	for _, p := range list {
+		if p.TxHash == txHash {
+			return p
+		}
+	}
+	t.Fatalf("payout %s not found", txHash)
+	return PayoutRecord{}
+}
+
+func testReorgRollbackAndFinality(t *testing.T, s *Store) {
+	const chain = "Base Sepolia"
+
+	insertTestPayout(t, s, chain, "0x01", 100, "0xblock100")
+	insertTestPayout(t, s, chain, "0x02", 110, "0xblock110")
+	insertTestPayout(t, s, chain, "0x03", 120, "0xblock120")
+
+	// 区块 100 达到确认深度
+	if n, err := s.FinalizePayouts(chain, 105); err != nil || n != 1 {
+		t.Fatalf("FinalizePayouts = %d, %v; want 1", n, err)
+	}
+
+	// 区块 110 被重组替换；状态已被标记为 Delivered 也要回滚
+	if err := s.UpdatePayoutStatus("0x02", PayoutStatusDelivered); err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.RollbackBlock(chain, 110, "0xblock110", "0xnew110", "parent_hash_mismatch")
+	if err != nil || n != 1 {
+		t.Fatalf("RollbackBlock = %d, %v; want 1", n, err)
+	}
+	if p := payoutByTx(t, s, "0x02"); p.Status != PayoutStatusReorged {
+		t.Errorf("status = %s, want Reorged", p.Status)
+	}
+
+	// 订阅推送 Removed 日志
+	if n, err := s.RollbackEvent(chain, "0x03", 0, "0xblock120", "removed"); err != nil || n != 1 {
+		t.Fatalf("RollbackEvent = %d, %v; want 1", n, err)
+	}
+
+	// 已最终确认的 payout 不会被回滚
+	if n, _ := s.RollbackBlock(chain, 100, "0xblock100", "0xnew100", "parent_hash_mismatch"); n != 0 {
+		t.Errorf("finalized payout was rolled back")
+	}
+	if p := payoutByTx(t, s, "0x01"); p.Status != PayoutStatusPending || !p.Finalized {
+		t.Errorf("finalized payout = %+v", p)
+	}
+
+	audit, err := s.ListReorgAudit(10, 0)
+	if err != nil || len(audit) != 2 {
+		t.Fatalf("ListReorgAudit = %d entries, %v; want 2", len(audit), err)
+	}
+	if audit[1].TxHash != "0x02" || audit[1].PreviousStatus != PayoutStatusDelivered || audit[1].NewBlockHash != "0xnew110" {
+		t.Errorf("unexpected audit entry: %+v", audit[1])
+	}
+
+	// 回滚后的区块不再参与重组校验
+	blocks, err := s.ListEventBlocks(chain, 0)
+	if err != nil || len(blocks) != 1 || blocks[100] != "0xblock100" {
+		t.Errorf("ListEventBlocks = %v, %v", blocks, err)
+	}
+
+	// 交易被重新打包到新区块后恢复为 Pending
+	insertTestPayout(t, s, chain, "0x02", 111, "0xblock111")
+	if p := payoutByTx(t, s, "0x02"); p.Status != PayoutStatusPending || p.BlockHash != "0xblock111" {
+		t.Errorf("re-included payout = %s/%s, want Pending/0xblock111", p.Status, p.BlockHash)
+	}
+}
+
+func testDeliveryMatching(t *testing.T, s *Store) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	const (
+		merchant = "0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438"
+		token    = "0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d"
+		mint     = "4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU"
+		owner    = "8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq"
+	)
+
+	payouts := []PayoutRecord{
+		// EVM 目标链：两笔相同金额，按时间先后匹配
+		{TxHash: "0xa1", DstEid: 40231, Merchant: MustParseChainAddress(merchant), DstToken: MustParseChainAddress(token),
+			NetAmount: big.NewInt(970), Timestamp: base},
+		{TxHash: "0xa2", DstEid: 40231, Merchant: MustParseChainAddress(merchant), DstToken: MustParseChainAddress(token),
+			NetAmount: big.NewInt(970), Timestamp: base.Add(time.Minute)},
+	}
+	save := func(p PayoutRecord) {
+		p.GrossAmount = p.NetAmount
+		p.Status = PayoutStatusPending
+		if err := s.UpsertPayout(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range payouts {
+		save(p)
+	}
+
+	evm := Delivery{DstTxHash: "0xd1", DstChain: "Arbitrum Sepolia", DstEid: 40231, BlockNumber: 10,
+		Merchant: merchant, Token: token, Amount: big.NewInt(970), DeliveredAt: base.Add(30 * time.Second)}
+	if src, err := s.RecordDelivery(evm); err != nil || src != "0xa1" {
+		t.Fatalf("RecordDelivery = %q, %v; want 0xa1", src, err)
+	}
+	// 重复的执行记录不会再匹配第二笔
+	if src, err := s.RecordDelivery(evm); err != nil || src != "0xa1" {
+		t.Fatalf("duplicate RecordDelivery = %q, %v; want 0xa1", src, err)
+	}
+	if p := payoutByTx(t, s, "0xa2"); p.Status != PayoutStatusPending {
+		t.Errorf("0xa2 status = %s, want Pending", p.Status)
+	}
+	p := payoutByTx(t, s, "0xa1")
+	if p.Status != PayoutStatusDelivered || p.DstTxHash != "0xd1" || !p.DeliveredAt.Equal(evm.DeliveredAt) {
+		t.Errorf("0xa1 = %s/%s/%v, want Delivered/0xd1/%v", p.Status, p.DstTxHash, p.DeliveredAt, evm.DeliveredAt)
+	}
+
+	// 执行早于源链交易（0xa2 在 base+1min）时不匹配
+	early := evm
+	early.DstTxHash, early.DeliveredAt = "0xd2", base.Add(45*time.Second)
+	if src, err := s.RecordDelivery(early); err != nil || src != "" {
+		t.Fatalf("early RecordDelivery = %q, %v; want no match", src, err)
+	}
+
+	// Solana 执行先于源链事件被索引，由 MatchDeliveries 补匹配
+	sol := Delivery{DstTxHash: "5sig", LogIndex: 1, DstChain: "Solana Devnet", DstEid: 40168, BlockNumber: 99,
+		Merchant: owner, Token: mint, Amount: big.NewInt(500), DeliveredAt: base.Add(time.Minute)}
+	if src, err := s.RecordDelivery(sol); err != nil || src != "" {
+		t.Fatalf("RecordDelivery = %q, %v; want no match", src, err)
+	}
+	save(PayoutRecord{TxHash: "0xb1", DstEid: 40168, Merchant: MustParseChainAddress(owner), DstToken: MustParseChainAddress(mint),
+		NetAmount: big.NewInt(500), Timestamp: base})
+	if matched, err := s.MatchDeliveries(); err != nil || len(matched) != 1 || matched[0].SrcTxHash != "0xb1" {
+		t.Fatalf("MatchDeliveries = %+v, %v; want 0xb1", matched, err)
+	}
+	if p := payoutByTx(t, s, "0xb1"); p.Status != PayoutStatusDelivered || p.DstTxHash != "5sig" {
+		t.Errorf("0xb1 = %s/%s, want Delivered/5sig", p.Status, p.DstTxHash)
+	}
+
+	// 目标链执行被重组回滚后，payout 回到 Pending
+	if _, err := s.InsertEventIfNotExists("Arbitrum Sepolia", "0xd1", 0, 10, "0xblock10", "{}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RollbackBlock("Arbitrum Sepolia", 10, "0xblock10", "0xnew10", "parent_hash_mismatch"); err != nil {
+		t.Fatal(err)
+	}
+	if p := payoutByTx(t, s, "0xa1"); p.Status != PayoutStatusPending || p.DstTxHash != "" {
+		t.Errorf("0xa1 after reorg = %s/%s, want Pending with no dst tx", p.Status, p.DstTxHash)
+	}
+}
+
+// TestMatchDeliveriesPastStaleRows 超过一页的永远匹配不上的旧执行记录不会挡住较新的记录
+func TestMatchDeliveriesPastStaleRows(t *testing.T) {
+	s := newTestStore(t)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	const (
+		mint  = "4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU"
+		owner = "8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq"
+	)
+	stale := Delivery{DstChain: "Solana Devnet", DstEid: 40168, BlockNumber: 90, Merchant: owner, Token: mint, Amount: big.NewInt(1)}
+	for i := 0; i < matchDeliveriesPageSize+20; i++ {
+		stale.DstTxHash, stale.DeliveredAt = fmt.Sprintf("5stale%d", i), base.Add(-time.Duration(i%7)*time.Hour)
+		if _, err := s.RecordDelivery(stale); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fresh := stale
+	fresh.DstTxHash, fresh.Amount, fresh.DeliveredAt = "5fresh", big.NewInt(500), base.Add(time.Minute)
+	if src, err := s.RecordDelivery(fresh); err != nil || src != "" {
+		t.Fatalf("RecordDelivery = %q, %v; want no match", src, err)
+	}
+	err := s.UpsertPayout(PayoutRecord{TxHash: "0xb1", DstEid: 40168, Merchant: MustParseChainAddress(owner),
+		DstToken: MustParseChainAddress(mint), GrossAmount: big.NewInt(500), NetAmount: big.NewInt(500),
+		Status: PayoutStatusPending, Timestamp: base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matched, err := s.MatchDeliveries(); err != nil || len(matched) != 1 || matched[0].DstTxHash != "5fresh" {
+		t.Fatalf("MatchDeliveries = %d matched, %v; want 5fresh", len(matched), err)
+	}
+}
+
+func TestSolanaDeliveryLeg(t *testing.T) {
+	s := newTestStore(t)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	const (
+		mint  = "4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU"
+		owner = "8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq"
+	)
+	err := s.UpsertPayout(PayoutRecord{TxHash: "0xb1", DstEid: 40168, Merchant: MustParseChainAddress(owner),
+		DstToken:    MustParseChainAddress(mint),
+		GrossAmount: big.NewInt(500), NetAmount: big.NewInt(500), Status: PayoutStatusPending, Timestamp: base})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 超出时间窗口的执行不匹配，保留为未匹配的执行记录
+	late := Delivery{DstTxHash: "5late", DstChain: "Solana Devnet", DstEid: 40168, BlockNumber: 90,
+		Merchant: owner, Token: mint, Amount: big.NewInt(500), DeliveredAt: base.Add(deliveryMatchWindow + time.Hour)}
+	if src, err := s.RecordDelivery(late); err != nil || src != "" {
+		t.Fatalf("RecordDelivery outside window = %q, %v; want no match", src, err)
+	}
+	unmatched, err := s.ListUnmatchedDeliveries(10, 0)
+	if err != nil || len(unmatched) != 1 || unmatched[0].DstTxHash != "5late" {
+		t.Fatalf("ListUnmatchedDeliveries = %+v, %v", unmatched, err)
+	}
+
+	// 旧版监听器写入的 Solana 侧 payout 在迁移时删除，执行记录关联到源链 payout
+	sol := Delivery{DstTxHash: "5sig", DstChain: "Solana Devnet", DstEid: 40168, BlockNumber: 99,
+		Merchant: owner, Token: mint, Amount: big.NewInt(500), DeliveredAt: base.Add(time.Minute)}
+	err = s.UpsertPayout(PayoutRecord{TxHash: sol.DstTxHash, DstEid: 40168, Merchant: MustParseChainAddress(owner),
+		GrossAmount: big.NewInt(500), NetAmount: big.NewInt(500), Status: PayoutStatusDelivered, Timestamp: sol.DeliveredAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src, err := s.RecordDelivery(sol); err != nil || src != "0xb1" {
+		t.Fatalf("RecordDelivery = %q, %v; want 0xb1", src, err)
+	}
+	if err := removeDeliveryLegPayouts(s.db); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.ListPayouts(10, 0)
+	if err != nil || len(list) != 1 || list[0].TxHash != "0xb1" || list[0].Status != PayoutStatusDelivered || list[0].DstTxHash != "5sig" {
+		t.Errorf("payouts = %+v, %v; want only delivered 0xb1", list, err)
+	}
+}
+
+func TestMigrateChainAddresses(t *testing.T) {
+	s := newTestStore(t)
+	const (
+		payer = "0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438"
+		mint  = "4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU"
+		owner = "8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq"
+		txSol = "0x00000000000000000000000000000000000000000000000000000000000000b1"
+		txEVM = "0x00000000000000000000000000000000000000000000000000000000000000a1"
+	)
+	ownerKey, mintKey := MustParseChainAddress(owner), MustParseChainAddress(mint)
+
+	// 旧版数据：merchant / dst_token 为 bytes32 的后 20 字节，Solana 商户另存 solana_merchant
+	if _, err := s.db.Exec(`ALTER TABLE payouts ADD COLUMN solana_merchant TEXT DEFAULT ''; ALTER TABLE payouts ADD COLUMN solana_payer TEXT DEFAULT ''`); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 160)
+	copy(data[32:64], mintKey.Bytes())
+	raw, _ := json.Marshal(types.Log{
+		Topics: []common.Hash{payoutTopicByABIVersion[ABIVersionV2], common.BigToHash(big.NewInt(40168)),
+			common.HexToHash(payer), common.BytesToHash(ownerKey.Bytes())},
+		Data:   data,
+		TxHash: common.HexToHash(txSol),
+	})
+	if _, err := s.InsertEventIfNotExists("Base Sepolia", txSol, 0, 1, "0xb", string(raw)); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{
+		{txSol, 40168, payer, common.BytesToAddress(ownerKey.Bytes()).Hex(), common.BytesToAddress(mintKey.Bytes()).Hex(), owner},
+		{txEVM, 40231, payer, payer, "0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d", ""},
+	} {
+		_, err := s.db.Exec(`
+			INSERT INTO payouts (tx_hash, block_number, timestamp, dst_eid, payer, merchant, src_token, dst_token,
+				gross_amount, net_amount, status, solana_merchant)
+			VALUES (?, 1, '2026-01-01 00:00:00', ?, ?, ?, '0x0000000000000000000000000000000000000000', ?, '1', '1', 'Pending', ?)
+		`, row...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ { // 可重复执行
+		if err := migrateChainAddresses(s.db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := s.ListMerchantPayouts(ownerKey, 10, 0)
+	if err != nil || len(list) != 1 || list[0].TxHash != txSol || list[0].DstToken != mintKey || list[0].Payer != MustParseChainAddress(payer) {
+		t.Fatalf("Solana merchant payouts = %+v, %v", list, err)
+	}
+	// EVM 地址大小写不敏感
+	list, err = s.ListMerchantPayouts(MustParseChainAddress("0x1A9C0A66CB68D92C598B0D2F10DE3C755EB6D438"), 10, 0)
+	if err != nil || len(list) != 1 || list[0].TxHash != txEVM || list[0].DstToken.String() != "0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d" {
+		t.Fatalf("EVM merchant payouts = %+v, %v", list, err)
+	}
+	// 旧版伪 EVM 地址不再能查到 Solana 商户的 payout
+	if list, _ := s.ListMerchantPayouts(EVMChainAddress(common.BytesToAddress(ownerKey.Bytes())), 10, 0); len(list) != 0 {
+		t.Errorf("truncated address matched %d payouts", len(list))
+	}
+}
+
+func TestPayoutRoutes(t *testing.T) {
+	s := newTestStore(t)
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	legacy := MustParseChainAddress("0x6689F160b47CbfEBf389c55ae34959296Ef56B8D")
+	current := MustParseChainAddress("0xA1D91CdcBD933c3385D7dea34D87357f5E62f6d6")
+	program := MustParseChainAddress("GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1")
+	for i, p := range []PayoutRecord{
+		{TxHash: "0xa1", SrcEid: 40245, SrcContract: current, DstEid: 40168,
+			Merchant: MustParseChainAddress("8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq")},
+		{TxHash: "0xa2", SrcEid: 40245, SrcContract: legacy, DstEid: 40231,
+			Merchant: MustParseChainAddress("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438")},
+		{TxHash: "0xa3", SrcEid: 40231, SrcContract: MustParseChainAddress("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438"), DstEid: 40245,
+			Merchant: MustParseChainAddress("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438")},
+	} {
+		p.GrossAmount, p.NetAmount, p.Status, p.Timestamp = big.NewInt(1), big.NewInt(1), PayoutStatusPending, base.Add(time.Duration(i)*time.Minute)
+		if err := s.UpsertPayout(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// PacketSent 的 receiver（bytes32）按目标链解析为 Solana 程序
+	err := s.RecordPacketSent(LZMessage{GUID: "0xguid1", SrcEid: 40245, DstEid: 40168, Nonce: 1,
+		Sender: "0xsender", Receiver: common.BytesToHash(program.Bytes()).Hex(), SrcTxHash: "0xa1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重新索引不清空已知的目标链合约
+	if err := s.UpsertPayout(PayoutRecord{TxHash: "0xa1", SrcEid: 40245, SrcContract: current, DstEid: 40168,
+		Merchant:    MustParseChainAddress("8Wq6tmDXbYfVYtAqPWMdhUCgsVfE1ikGWjdUoE9gygGq"),
+		GrossAmount: big.NewInt(1), NetAmount: big.NewInt(1), Status: PayoutStatusPending, Timestamp: base}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter PayoutFilter
+		want   []string
+	}{
+		{"route", PayoutFilter{SrcEid: 40245, DstEid: 40168}, []string{"0xa1"}},
+		{"source chain", PayoutFilter{SrcEid: 40245}, []string{"0xa2", "0xa1"}},
+		{"legacy contract", PayoutFilter{SrcContract: legacy}, []string{"0xa2"}},
+		{"destination program", PayoutFilter{DstContract: program}, []string{"0xa1"}},
+		{"route and status", PayoutFilter{SrcEid: 40231, DstEid: 40245, Statuses: []string{PayoutStatusDelivered}}, nil},
+	} {
+		list, err := s.ListPayoutsFiltered(tc.filter, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range list {
+			got = append(got, p.TxHash)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if p := payoutByTx(t, s, "0xa1"); p.DstContract != program || p.SrcContract != current || p.SrcEid != 40245 {
+		t.Errorf("0xa1 route = %d %s -> %s", p.SrcEid, p.SrcContract, p.DstContract)
+	}
+
+	// 旧数据：src_contract 取自原始日志，src_eid 按源链名称补齐
+	raw, _ := json.Marshal(types.Log{Address: legacy.EVM(), Topics: []common.Hash{payoutTopicByABIVersion[ABIVersionV1]}})
+	if _, err := s.InsertEventIfNotExists("Base Sepolia", "0xb1", 0, 1, "0xb", string(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpsertPayout(PayoutRecord{TxHash: "0xb1", DstEid: 40231, GrossAmount: big.NewInt(1), NetAmount: big.NewInt(1),
+		Status: PayoutStatusPending, Timestamp: base}); err != nil {
+		t.Fatal(err)
+	}
+	if err := backfillPayoutRoutes(s.db); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.BackfillPayoutSrcEIDs(map[string]uint32{"Base Sepolia": 40245, "Arbitrum Sepolia": 40231}); err != nil || n != 1 {
+		t.Fatalf("BackfillPayoutSrcEIDs = %d, %v", n, err)
+	}
+	if p := payoutByTx(t, s, "0xb1"); p.SrcEid != 40245 || p.SrcContract != legacy {
+		t.Errorf("legacy payout route = %d %s", p.SrcEid, p.SrcContract)
+	}
+}
+
+func testDeliveryMatchingByGUID(t *testing.T, s *Store) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	merchant := MustParseChainAddress("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438")
+	token := MustParseChainAddress("0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d")
+
+	// 同一商户两笔相同金额的付款
+	for i, tx := range []string{"0xa1", "0xa2"} {
+		err := s.UpsertPayout(PayoutRecord{TxHash: tx, DstEid: 40231, Merchant: merchant, DstToken: token,
+			GrossAmount: big.NewInt(970), NetAmount: big.NewInt(970), Status: PayoutStatusPending,
+			Timestamp: base.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.RecordPacketSent(LZMessage{GUID: fmt.Sprintf("0xguid%d", i+1), SrcEid: 40245, DstEid: 40231, Nonce: uint64(i + 1),
+			Sender: "0xsender", Receiver: "0xreceiver", SrcChain: "Base Sepolia", SrcTxHash: tx})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第二笔先送达：按 GUID 匹配，而不是最早的一笔
+	err := s.RecordPacketDelivered(LZMessage{GUID: "0xguid2", SrcEid: 40245, DstEid: 40231, Nonce: 2,
+		Sender: "0xsender", Receiver: "0xreceiver", DstChain: "Arbitrum Sepolia", DstTxHash: "0xd2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := s.RecordDelivery(Delivery{DstTxHash: "0xd2", DstChain: "Arbitrum Sepolia", DstEid: 40231, GUID: "0xguid2",
+		Merchant: merchant.String(), Token: token.String(), Amount: big.NewInt(970), DeliveredAt: base.Add(time.Minute)})
+	if err != nil || src != "0xa2" {
+		t.Fatalf("RecordDelivery = %q, %v; want 0xa2", src, err)
+	}
+	if p := payoutByTx(t, s, "0xa1"); p.Status != PayoutStatusPending || p.GUID != "0xguid1" {
+		t.Errorf("0xa1 = %s/%s, want Pending/0xguid1", p.Status, p.GUID)
+	}
+
+	m, ok, err := s.GetLZMessage("0xguid2")
+	if err != nil || !ok || m.SrcTxHash != "0xa2" || m.DstTxHash != "0xd2" || m.Nonce != 2 {
+		t.Errorf("GetLZMessage = %+v, %v, %v", m, ok, err)
+	}
+}
+
+func testStuckAndFailed(t *testing.T, s *Store) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	merchant := MustParseChainAddress("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438")
+	token := MustParseChainAddress("0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d")
+
+	// 0xc1 / 0xc2 由 Base Sepolia（40245）发出，0xc3 由 Optimism Sepolia（40232）发出；按 src_eid 选择路由，不依赖 events
+	for _, p := range []struct {
+		tx     string
+		srcEid int64
+		at     time.Time
+	}{
+		{"0xc1", 40245, base},
+		{"0xc2", 40245, base.Add(40 * time.Minute)},
+		{"0xc3", 40232, base},
+	} {
+		err := s.UpsertPayout(PayoutRecord{TxHash: p.tx, SrcEid: p.srcEid, DstEid: 40231, Merchant: merchant, DstToken: token,
+			GrossAmount: big.NewInt(970), NetAmount: big.NewInt(970), Status: PayoutStatusPending, Timestamp: p.at})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 只有超过 SLA 且源链匹配的 payout 被标记为 Stuck
+	stuck, err := s.MarkStuck(40245, 40231, base.Add(30*time.Minute), "not delivered within 30m0s")
+	if err != nil || len(stuck) != 1 || stuck[0].TxHash != "0xc1" {
+		t.Fatalf("MarkStuck = %+v, %v; want [0xc1]", stuck, err)
+	}
+	if stuck[0].Status != PayoutStatusStuck || stuck[0].FailureReason != "not delivered within 30m0s" || stuck[0].Timestamp.IsZero() {
+		t.Errorf("returned payout = %+v; want the updated row", stuck[0])
+	}
+	if again, err := s.MarkStuck(40245, 40231, base.Add(30*time.Minute), "x"); err != nil || len(again) != 0 {
+		t.Errorf("second MarkStuck = %+v, %v; want none", again, err)
+	}
+	if p := payoutByTx(t, s, "0xc3"); p.Status != PayoutStatusPending {
+		t.Errorf("0xc3 status = %s, want Pending", p.Status)
+	}
+	list, err := s.ListPayoutsFiltered(PayoutFilter{Statuses: []string{PayoutStatusStuck, PayoutStatusFailed}}, 10, 0)
+	if err != nil || len(list) != 1 || list[0].FailureReason != "not delivered within 30m0s" {
+		t.Errorf("ListPayoutsFiltered = %+v, %v", list, err)
+	}
+
+	// 目标链执行失败：Stuck -> Failed
+	failed := Delivery{DstTxHash: "0xf1", DstChain: "Arbitrum Sepolia", DstEid: 40231, BlockNumber: 20,
+		Merchant: merchant.String(), Token: token.String(), Amount: big.NewInt(970), DeliveredAt: base.Add(time.Hour),
+		Failed: true, Error: "lzReceive reverted: insufficient vault balance"}
+	if src, err := s.RecordDelivery(failed); err != nil || src != "0xc1" {
+		t.Fatalf("failed RecordDelivery = %q, %v; want 0xc1", src, err)
+	}
+	p := payoutByTx(t, s, "0xc1")
+	if p.Status != PayoutStatusFailed || p.FailureReason != "lzReceive reverted: insufficient vault balance (tx 0xf1)" {
+		t.Errorf("0xc1 = %s/%q, want Failed with reason", p.Status, p.FailureReason)
+	}
+
+	// executor 重试成功：Failed -> Delivered
+	retry := failed
+	retry.DstTxHash, retry.Failed, retry.Error = "0xd1", false, ""
+	retry.DeliveredAt = base.Add(2 * time.Hour)
+	if src, err := s.RecordDelivery(retry); err != nil || src != "0xc1" {
+		t.Fatalf("retry RecordDelivery = %q, %v; want 0xc1", src, err)
+	}
+	if p := payoutByTx(t, s, "0xc1"); p.Status != PayoutStatusDelivered || p.DstTxHash != "0xd1" || p.FailureReason != "" {
+		t.Errorf("0xc1 = %s/%s/%q, want Delivered/0xd1 with no reason", p.Status, p.DstTxHash, p.FailureReason)
+	}
+}
+
+func testFeeRevenue(t *testing.T, s *Store) {
+	day1 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	usdc := common.HexToAddress("0x036CbD53842c5426634e7929541eC2318f3dCF7e")
+	m1 := MustParseChainAddress("0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438")
+	m2 := MustParseChainAddress("0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d")
+
+	// uint256 手续费超出 int64 范围时仍能正确累加
+	huge, _ := new(big.Int).SetString("10000000000000000000", 10)
+	// 两条源链上的代币地址相同
+	for i, p := range []struct {
+		tx, chain string
+		srcEid    int64
+		merchant  ChainAddress
+		at        time.Time
+		fee       *big.Int
+		status    string
+	}{
+		{"0xf1", "Base Sepolia", 40245, m1, day1, big.NewInt(30000), PayoutStatusDelivered},
+		{"0xf2", "Base Sepolia", 40245, m2, day1.Add(time.Hour), huge, PayoutStatusPending},
+		{"0xf3", "Arbitrum Sepolia", 40231, m1, day2, big.NewInt(600), PayoutStatusPending},
+		{"0xf4", "Base Sepolia", 40245, m1, day2, big.NewInt(999), PayoutStatusReorged},
+	} {
+		if _, err := s.InsertEventIfNotExists(p.chain, p.tx, 0, uint64(i+1), "0xb", "{}"); err != nil {
+			t.Fatal(err)
+		}
+		gross := new(big.Int).Mul(p.fee, big.NewInt(100))
+		err := s.UpsertPayout(PayoutRecord{TxHash: p.tx, SrcEid: p.srcEid, DstEid: 40231, Merchant: p.merchant, SrcToken: usdc,
+			GrossAmount: gross, NetAmount: new(big.Int).Sub(gross, p.fee), FeeAmount: p.fee, FeeBps: 100,
+			Status: p.status, Timestamp: p.at})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byDayChain, err := s.FeeRevenue([]string{FeeGroupDay, FeeGroupChain}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FeeRevenue{
+		{Day: "2026-01-01", Chain: "Base Sepolia", Payouts: 2, FeeAmount: "10000000000000030000"},
+		{Day: "2026-01-02", Chain: "Arbitrum Sepolia", Payouts: 1, FeeAmount: "600"},
+	}
+	if len(byDayChain) != len(want) {
+		t.Fatalf("FeeRevenue = %+v, want %d groups", byDayChain, len(want))
+	}
+	for i, w := range want {
+		g := byDayChain[i]
+		if g.Day != w.Day || g.Chain != w.Chain || g.Payouts != w.Payouts || g.FeeAmount != w.FeeAmount || g.Token != "" {
+			t.Errorf("group %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	// 按 token 分组时按 (源链 EID, 地址) 区分，不把两条链上的代币加在一起
+	byToken, err := s.FeeRevenue([]string{FeeGroupToken}, time.Time{}, time.Time{})
+	if err != nil || len(byToken) != 2 {
+		t.Fatalf("FeeRevenue by token = %+v, %v; want 2 groups", byToken, err)
+	}
+	if g := byToken[0]; g.TokenEid != 40231 || !strings.EqualFold(g.Token, usdc.Hex()) || g.FeeAmount != "600" {
+		t.Errorf("token group 0 = %+v", g)
+	}
+	if g := byToken[1]; g.TokenEid != 40245 || !strings.EqualFold(g.Token, usdc.Hex()) || g.FeeAmount != "10000000000000030000" {
+		t.Errorf("token group 1 = %+v", g)
+	}
+
+	byMerchant, err := s.FeeRevenue([]string{FeeGroupMerchant}, day2, time.Time{})
+	if err != nil || len(byMerchant) != 1 || byMerchant[0].Merchant != m1.String() || byMerchant[0].FeeAmount != "600" {
+		t.Errorf("FeeRevenue by merchant from day2 = %+v, %v", byMerchant, err)
+	}
+	if _, err := s.FeeRevenue([]string{"week"}, time.Time{}, time.Time{}); err == nil {
+		t.Error("expected error for unknown group")
+	}
+
+	if p := payoutByTx(t, s, "0xf3"); p.FeeAmount.Int64() != 600 || p.FeeBps != 100 || p.FeeIssue != "" {
+		t.Errorf("0xf3 fee = %v/%d/%q", p.FeeAmount, p.FeeBps, p.FeeIssue)
+	}
+}
+
+func testSolanaInstructions(t *testing.T, s *Store) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	recs := []SolanaInstructionRecord{
+		{Signature: "sig1", Kind: SolanaKindInstruction, Index: 0, Chain: "Solana Devnet", Slot: 10, BlockTime: at,
+			Program: "transfer_contract", Name: "transfer_out", Data: json.RawMessage(`{"args":{"amount":1}}`)},
+		{Signature: "sig2", Kind: SolanaKindEvent, Index: 0, Chain: "Solana Devnet", Slot: 11, BlockTime: at,
+			Program: "my_oapp", Name: "RelaySendEvent", Data: json.RawMessage(`{"dst_eid":40245}`)},
+	}
+	if err := s.SaveSolanaInstructions(recs); err != nil {
+		t.Fatal(err)
+	}
+	// 重复处理同一交易覆盖原记录
+	if err := s.SaveSolanaInstructions(recs[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.ListSolanaInstructions("", "", 10, 0)
+	if err != nil || len(all) != 2 || all[0].Signature != "sig2" {
+		t.Fatalf("ListSolanaInstructions = %+v, %v", all, err)
+	}
+	outs, err := s.ListSolanaInstructions("transfer_contract", "transfer_out", 10, 0)
+	if err != nil || len(outs) != 1 || string(outs[0].Data) != `{"args":{"amount":1}}` || !outs[0].BlockTime.Equal(at) {
+		t.Errorf("filtered = %+v, %v", outs, err)
+	}
+}
+
+// testPersistEventExactlyOnce 原始事件与派生记录同一事务写入；重放不重复写入、不回退状态
+func testPersistEventExactlyOnce(t *testing.T, s *Store) {
+	const chain = "Base Sepolia"
+	ev := EventRecord{Chain: chain, TxHash: "0xa1", LogIndex: 2, BlockNumber: 100, BlockHash: "0xblock100", RawLog: `{"k":1}`}
+	payout := PayoutRecord{
+		TxHash:      "0xa1",
+		BlockNumber: 100,
+		DstEid:      40231,
+		GrossAmount: big.NewInt(100),
+		NetAmount:   big.NewInt(99),
+		Status:      PayoutStatusPending,
+		Timestamp:   time.Now().UTC(),
+		BlockHash:   "0xblock100",
+	}
+
+	if done, err := s.EventProcessed(ev.TxHash, ev.LogIndex); err != nil || done {
+		t.Fatalf("EventProcessed before persist = %v, %v", done, err)
+	}
+	if res, err := s.PersistEvent(ev, EventEffects{Payout: &payout}); err != nil || res.Duplicate {
+		t.Fatalf("PersistEvent = %+v, %v", res, err)
+	}
+	if done, err := s.EventProcessed(ev.TxHash, ev.LogIndex); err != nil || !done {
+		t.Fatalf("EventProcessed after persist = %v, %v", done, err)
+	}
+	if inserted, err := s.InsertEventIfNotExists(chain, ev.TxHash, ev.LogIndex, 100, "0xblock100", "{}"); err != nil || inserted {
+		t.Errorf("InsertEventIfNotExists on duplicate = %v, %v", inserted, err)
+	}
+
+	// 送达后重放同一事件：识别为重复，payout 保持 Delivered
+	if err := s.UpdatePayoutStatus("0xa1", PayoutStatusDelivered); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := s.PersistEvent(ev, EventEffects{Payout: &payout}); err != nil || !res.Duplicate {
+		t.Fatalf("replayed PersistEvent = %+v, %v", res, err)
+	}
+	if err := s.UpsertPayout(payout); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdatePayoutStatus("0xa1", PayoutStatusPending); err != nil {
+		t.Fatal(err)
+	}
+	if p := payoutByTx(t, s, "0xa1"); p.Status != PayoutStatusDelivered {
+		t.Errorf("status after replay = %s, want Delivered", p.Status)
+	}
+	if n, err := s.GetEventCount(); err != nil || n != 1 {
+		t.Errorf("GetEventCount = %d, %v", n, err)
+	}
+
+	// 派生记录写入失败时原始事件与 payout 都不落库
+	bad := EventRecord{Chain: chain, TxHash: "0xa2", BlockNumber: 101, BlockHash: "0xblock101", RawLog: "{}"}
+	badPayout := payout
+	badPayout.TxHash = "0xa2"
+	packet := LZMessage{GUID: "0xguid", SrcTxHash: "0xa2", SrcChain: chain}
+	if _, err := s.db.Exec(`ALTER TABLE lz_messages RENAME TO lz_messages_off`); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.PersistEvent(bad, EventEffects{Payout: &badPayout, PacketSent: &packet})
+	if _, rerr := s.db.Exec(`ALTER TABLE lz_messages_off RENAME TO lz_messages`); rerr != nil {
+		t.Fatal(rerr)
+	}
+	if err == nil {
+		t.Fatal("expected error when lz_messages is missing")
+	}
+	if n, err := s.GetEventCount(); err != nil || n != 1 {
+		t.Errorf("GetEventCount after failed persist = %d, %v", n, err)
+	}
+	if list, err := s.ListPayouts(10, 0); err != nil || len(list) != 1 {
+		t.Errorf("payouts after failed persist = %d, %v", len(list), err)
+	}
+
+	// 被重组回滚的事件重新出现时恢复并重新处理
+	if n, err := s.RollbackEvent(chain, "0xa3", 0, "0xblock102", "test"); err != nil || n != 0 {
+		t.Fatalf("RollbackEvent on missing event = %d, %v", n, err)
+	}
+	reorged := EventRecord{Chain: chain, TxHash: "0xa3", BlockNumber: 102, BlockHash: "0xblock102", RawLog: "{}"}
+	p3 := payout
+	p3.TxHash, p3.BlockNumber, p3.BlockHash = "0xa3", 102, "0xblock102"
+	if _, err := s.PersistEvent(reorged, EventEffects{Payout: &p3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RollbackEvent(chain, "0xa3", 0, "0xblock102", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := s.EventProcessed("0xa3", 0); err != nil || done {
+		t.Errorf("EventProcessed after rollback = %v, %v", done, err)
+	}
+	reorged.BlockNumber, reorged.BlockHash = 103, "0xblock103"
+	p3.BlockNumber, p3.BlockHash = 103, "0xblock103"
+	if res, err := s.PersistEvent(reorged, EventEffects{Payout: &p3}); err != nil || res.Duplicate {
+		t.Fatalf("PersistEvent after reorg = %+v, %v", res, err)
+	}
+	if p := payoutByTx(t, s, "0xa3"); p.Status != PayoutStatusPending || p.BlockHash != "0xblock103" {
+		t.Errorf("payout after reorg replay = %s %s", p.Status, p.BlockHash)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// defaultWriteBatchSize 单写协程每个事务最多合并的写操作数
+const defaultWriteBatchSize = 256
+
+var errStoreClosed = errors.New("store is closed")
+
+// batchWriter SQLite 单写协程
+//
+// 所有写操作交给同一个协程执行：同时到达的写操作合并到一个事务中提交，调用方阻塞到所在事务提交后返回。
+// 写操作可能因同批其它操作失败而被重新执行，fn 对外部变量只能赋值、不能累加。
+type batchWriter struct {
+	db       *sqlDB
+	maxBatch int
+	reqs     chan writeRequest // 无缓冲：只有写协程正在接收时才能提交，关闭后不会遗留请求
+	closing  chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+type writeRequest struct {
+	fn     func(tx *sqlTx) error
+	result chan error
+}
+
+func newBatchWriter(db *sqlDB, maxBatch int) *batchWriter {
+	if maxBatch <= 0 {
+		maxBatch = defaultWriteBatchSize
+	}
+	w := &batchWriter{
+		db:       db,
+		maxBatch: maxBatch,
+		reqs:     make(chan writeRequest),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// do 在写事务中执行 fn，返回 fn 或事务提交的错误
+func (w *batchWriter) do(fn func(tx *sqlTx) error) error {
+	req := writeRequest{fn: fn, result: make(chan error, 1)}
+	select {
+	case w.reqs <- req:
+	case <-w.closing:
+		return errStoreClosed
+	}
+	return <-req.result
+}
+
+// close 停止写协程（等待正在执行的事务结束）
+func (w *batchWriter) close() {
+	w.once.Do(func() { close(w.closing) })
+	<-w.done
+}
+
+func (w *batchWriter) run() {
+	defer close(w.done)
+	batch := make([]writeRequest, 0, w.maxBatch)
+	for {
+		select {
+		case req := <-w.reqs:
+			batch = append(batch[:0], req)
+		case <-w.closing:
+			return
+		}
+		// 让出 CPU，使刚拿到上一批结果的调用方有机会提交下一个写操作，再合并所有已在等待的写操作
+		runtime.Gosched()
+	collect:
+		for len(batch) < w.maxBatch {
+			select {
+			case req := <-w.reqs:
+				batch = append(batch, req)
+			default:
+				break collect
+			}
+		}
+		w.commit(batch)
+	}
+}
+
+// commit 在一个事务中执行 batch，并把结果分别返回给调用方
+//
+// 任一操作失败时整批回滚，再逐个单独重试，使失败只影响它自己（失败很少见，
+// 比每个操作一个 SAVEPOINT 开销小）。
+func (w *batchWriter) commit(batch []writeRequest) {
+	if len(batch) > 1 {
+		if err := w.runTx(batch); err == nil {
+			for _, req := range batch {
+				req.result <- nil
+			}
+			return
+		}
+	}
+	for _, req := range batch {
+		req.result <- w.runTx([]writeRequest{req})
+	}
+}
+
+// runTx 在一个事务中依次执行 batch，任一操作失败则回滚并返回其错误
+func (w *batchWriter) runTx(batch []writeRequest) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, req := range batch {
+		if err := req.fn(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSQLiteWALAndReadPool SQLite 使用 WAL，查询走只读连接池
+func TestSQLiteWALAndReadPool(t *testing.T) {
+	s := newTestStore(t)
+	var mode string
+	if err := s.read.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal_mode = %q, %v", mode, err)
+	}
+	if s.read == s.db {
+		t.Fatal("expected a separate read pool")
+	}
+	if _, err := s.read.Exec(`DELETE FROM events`); err == nil {
+		t.Error("read pool accepted a write")
+	}
+
+	// 写事务未提交时读不被阻塞，且看不到未提交的数据
+	tx, err := s.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO events (tx_hash, log_index, block_number, raw_log) VALUES ('0xa', 0, 1, '{}')`); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.GetEventCount(); err != nil || n != 0 {
+		t.Errorf("count during open write tx = %d, %v", n, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.GetEventCount(); err != nil || n != 1 {
+		t.Errorf("count after commit = %d, %v", n, err)
+	}
+}
+
+// TestBatchWriterIsolatesFailures 同一事务中的失败操作只回滚自己
+func TestBatchWriterIsolatesFailures(t *testing.T) {
+	s := newTestStore(t)
+	w := &batchWriter{db: s.db}
+	insert := func(hash string) func(tx *sqlTx) error {
+		return func(tx *sqlTx) error {
+			_, err := tx.Exec(`INSERT INTO events (tx_hash, log_index, block_number, raw_log) VALUES (?, 0, 1, '{}')`, hash)
+			return err
+		}
+	}
+	errBoom := errors.New("boom")
+	batch := []writeRequest{
+		{fn: insert("0x1"), result: make(chan error, 1)},
+		{fn: func(tx *sqlTx) error {
+			if err := insert("0x2")(tx); err != nil {
+				return err
+			}
+			return errBoom
+		}, result: make(chan error, 1)},
+		{fn: insert("0x1"), result: make(chan error, 1)}, // 主键冲突
+		{fn: insert("0x3"), result: make(chan error, 1)},
+	}
+	w.commit(batch)
+
+	if err := <-batch[0].result; err != nil {
+		t.Errorf("op 0: %v", err)
+	}
+	if err := <-batch[1].result; !errors.Is(err, errBoom) {
+		t.Errorf("op 1 = %v, want boom", err)
+	}
+	if err := <-batch[2].result; err == nil {
+		t.Error("op 2: expected constraint error")
+	}
+	if err := <-batch[3].result; err != nil {
+		t.Errorf("op 3: %v", err)
+	}
+	events, err := s.GetAllEvents(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for _, e := range events {
+		hashes = append(hashes, e.TxHash)
+	}
+	sort.Strings(hashes)
+	if fmt.Sprint(hashes) != "[0x1 0x3]" {
+		t.Errorf("committed events = %v, want [0x1 0x3]", hashes)
+	}
+}
+
+// TestBatchWriterConcurrentWrites 并发写入全部提交，关闭后拒绝写入
+func TestBatchWriterConcurrentWrites(t *testing.T) {
+	s := newTestStore(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := s.InsertEventIfNotExists("Base Sepolia", fmt.Sprintf("0x%x", i), 0, uint64(i), "0xb", "{}"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n, err := s.GetEventCount(); err != nil || n != 200 {
+		t.Fatalf("count = %d, %v", n, err)
+	}
+
+	s.writer.close()
+	if err := s.UpdatePayoutStatus("0x1", PayoutStatusDelivered); !errors.Is(err, errStoreClosed) {
+		t.Errorf("write after close = %v", err)
+	}
+}
+
+// BenchmarkBackfill100k 回填 10 万个事件（原始事件 + payout + 标记已解析）的吞吐
+//
+//	go test -run '^$' -bench Backfill100k -benchtime 1x
+//
+// sequential 为单个回填按顺序写入；concurrent 为 4 条链同时回填（unbatched 每个写操作单独提交，作为对照）；
+// +reads 回填的同时每 5ms 分页查询一次 payout（模拟看板轮询），报告查询的 p99 延迟。
+func BenchmarkBackfill100k(b *testing.B) {
+	const events = 100_000
+	for _, bc := range []struct {
+		name     string
+		workers  int
+		maxBatch int
+		reads    bool
+	}{
+		{"sequential", 1, defaultWriteBatchSize, false},
+		{"concurrent/batched", 4, defaultWriteBatchSize, false},
+		{"concurrent/unbatched", 4, 1, false},
+		{"concurrent/batched+reads", 4, defaultWriteBatchSize, true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				s, err := NewStore(filepath.Join(b.TempDir(), "bench.db"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				s.writer.close()
+				s.writer = newBatchWriter(s.db, bc.maxBatch)
+				b.StartTimer()
+
+				start := time.Now()
+				readLatency := runBackfillBenchmark(b, s, events, bc.workers, bc.reads)
+				elapsed := time.Since(start)
+
+				b.StopTimer()
+				b.ReportMetric(float64(events)/elapsed.Seconds(), "events/s")
+				if bc.reads {
+					b.ReportMetric(float64(readLatency.Microseconds())/1000, "p99-read-ms")
+				}
+				_ = s.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// runBackfillBenchmark workers 个协程分担 n 个事件；reads 时另有一个协程定期分页查询 payout，返回查询的 p99 延迟
+func runBackfillBenchmark(b *testing.B, s *Store, n, workers int, reads bool) time.Duration {
+	stop := make(chan struct{})
+	var latencies []time.Duration
+	var readers sync.WaitGroup
+	if reads {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				t0 := time.Now()
+				if _, err := s.ListPayouts(50, 0); err != nil {
+					b.Error(err)
+					return
+				}
+				latencies = append(latencies, time.Since(t0))
+				time.Sleep(5 * time.Millisecond)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			chain := fmt.Sprintf("chain-%d", w)
+			for i := w; i < n; i += workers {
+				txHash := fmt.Sprintf("0x%064x", i)
+				if _, err := s.InsertEventIfNotExists(chain, txHash, 0, uint64(i), "0xblock", `{"data":"0x"}`); err != nil {
+					b.Error(err)
+					return
+				}
+				if err := s.UpsertPayout(PayoutRecord{
+					TxHash:      txHash,
+					BlockNumber: int64(i),
+					DstEid:      40231,
+					GrossAmount: big.NewInt(100),
+					NetAmount:   big.NewInt(99),
+					Status:      PayoutStatusPending,
+					Timestamp:   time.Unix(1700000000+int64(i), 0).UTC(),
+					BlockHash:   "0xblock",
+				}); err != nil {
+					b.Error(err)
+					return
+				}
+				if err := s.MarkEventAsParsed(txHash, 0); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[len(latencies)*99/100]
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// 代币精度上限（超出视为异常数据）
+const maxTokenDecimals = 36
+
+// 链上查询失败后的重试间隔
+const tokenRetryInterval = 10 * time.Minute
+
+// 代币元数据来源
+const (
+	TokenSourceConfig = "config"
+	TokenSourceChain  = "chain"
+)
+
+// usdStablecoins 链上发现的代币按符号推断锚定 USD（配置中的 peg 优先）
+var usdStablecoins = map[string]bool{"USDC": true, "USDT": true, "USDC.e": true, "DAI": true, "PYUSD": true}
+
+// TokenInfo 代币元数据
+type TokenInfo struct {
+	EID      uint32 `json:"eid"`
+	Address  string `json:"address"` // EVM 为校验和地址，Solana 为 Base58 mint
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+	Peg      string `json:"peg,omitempty"` // 锚定的法币（如 "USD"）
+	Source   string `json:"source"`
+}
+
+// canonicalTokenAddress 按网络类型规范化代币地址
+func canonicalTokenAddress(n NetworkConfig, addr string) (string, bool) {
+	if n.IsSolana() {
+		mint, err := solana.PublicKeyFromBase58(addr)
+		if err != nil {
+			return "", false
+		}
+		return mint.String(), true
+	}
+	if !common.IsHexAddress(addr) {
+		return "", false
+	}
+	return common.HexToAddress(addr).Hex(), true
+}
+
+// tokenKey 注册表键：EVM 地址统一小写；Solana 为 Base58 mint
+type tokenKey struct {
+	eid  uint32
+	addr string
+}
+
+func newTokenKey(eid uint32, addr string) tokenKey {
+	if strings.HasPrefix(addr, "0x") || strings.HasPrefix(addr, "0X") {
+		addr = strings.ToLower(addr)
+	}
+	return tokenKey{eid: eid, addr: addr}
+}
+
+// TokenMetadataFetcher 从链上读取代币元数据（由各链监听器提供）
+type TokenMetadataFetcher func(ctx context.Context, address string) (TokenInfo, error)
+
+// TokenRegistry 代币注册表，按 (EID, 地址/mint) 索引
+//
+// 启动时从 config/chains.json 与 tokens 表加载；监听器遇到未知代币时
+// 通过 Resolve 从链上读取（ERC-20 decimals()/symbol()、SPL mint 账户）并持久化。
+type TokenRegistry struct {
+	store Storage
+
+	mu     sync.RWMutex
+	tokens map[tokenKey]TokenInfo
+	// Solana mint 在 payouts 中只保存后 20 字节（0x 形式），登记为别名
+	aliases map[tokenKey]tokenKey
+	// 不知道所在链时按地址查找（payout 的源链代币）
+	byAddr map[string]tokenKey
+	failed map[tokenKey]time.Time
+}
+
+// 全局代币注册表（在 main 中加载）
+var tokenRegistry = NewTokenRegistry(nil)
+
+// NewTokenRegistry 创建代币注册表；store 为 nil 时不持久化链上查询结果
+func NewTokenRegistry(store Storage) *TokenRegistry {
+	return &TokenRegistry{
+		store:   store,
+		tokens:  make(map[tokenKey]TokenInfo),
+		aliases: make(map[tokenKey]tokenKey),
+		byAddr:  make(map[string]tokenKey),
+		failed:  make(map[tokenKey]time.Time),
+	}
+}
+
+// Load 加载已持久化的代币与配置中的代币（配置优先）
+func (r *TokenRegistry) Load(reg *ChainRegistry) error {
+	if r.store != nil {
+		tokens, err := r.store.ListTokens()
+		if err != nil {
+			return fmt.Errorf("load tokens: %w", err)
+		}
+		for _, t := range tokens {
+			r.add(t)
+		}
+	}
+	if reg != nil {
+		for _, n := range reg.Networks {
+			for _, t := range n.Tokens {
+				addr, _ := canonicalTokenAddress(n, t.Address)
+				r.add(TokenInfo{EID: n.EID, Address: addr, Symbol: t.Symbol, Decimals: t.Decimals, Peg: t.Peg, Source: TokenSourceConfig})
+			}
+		}
+	}
+	return nil
+}
+
+func (r *TokenRegistry) add(t TokenInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := newTokenKey(t.EID, t.Address)
+	r.tokens[key] = t
+	delete(r.failed, key)
+	if _, ok := r.byAddr[key.addr]; !ok {
+		r.byAddr[key.addr] = key
+	}
+	if mint, err := solana.PublicKeyFromBase58(t.Address); err == nil && !common.IsHexAddress(t.Address) {
+		alias := newTokenKey(t.EID, common.BytesToAddress(mint.Bytes()).Hex())
+		r.aliases[alias] = key
+		if _, ok := r.byAddr[alias.addr]; !ok {
+			r.byAddr[alias.addr] = key
+		}
+	}
+}
+
+// Lookup 按 (EID, 地址/mint) 查找；Solana 也接受 mint 后 20 字节的 0x 形式
+func (r *TokenRegistry) Lookup(eid uint32, addr string) (TokenInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key := newTokenKey(eid, addr)
+	if alias, ok := r.aliases[key]; ok {
+		key = alias
+	}
+	t, ok := r.tokens[key]
+	return t, ok
+}
+
+// LookupAny 只按地址查找（不知道代币所在链时使用）
+func (r *TokenRegistry) LookupAny(addr string) (TokenInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.byAddr[newTokenKey(0, addr).addr]
+	if !ok {
+		return TokenInfo{}, false
+	}
+	t, ok := r.tokens[key]
+	return t, ok
+}
+
+// List 所有已知代币
+func (r *TokenRegistry) List() []TokenInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]TokenInfo, 0, len(r.tokens))
+	for _, t := range r.tokens {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Resolve 返回代币元数据；未知时通过 fetch 从链上读取并持久化
+//
+// 查询失败的代币在 tokenRetryInterval 内不会重复请求。
+func (r *TokenRegistry) Resolve(ctx context.Context, eid uint32, addr string, fetch TokenMetadataFetcher) (TokenInfo, error) {
+	if t, ok := r.Lookup(eid, addr); ok {
+		return t, nil
+	}
+	key := newTokenKey(eid, addr)
+	r.mu.RLock()
+	failedAt, failed := r.failed[key]
+	r.mu.RUnlock()
+	if failed && time.Since(failedAt) < tokenRetryInterval {
+		return TokenInfo{}, fmt.Errorf("token %s metadata unavailable", addr)
+	}
+
+	t, err := fetch(ctx, addr)
+	if err != nil {
+		r.mu.Lock()
+		r.failed[key] = time.Now()
+		r.mu.Unlock()
+		return TokenInfo{}, fmt.Errorf("fetch token %s metadata: %w", addr, err)
+	}
+	if t.Decimals > maxTokenDecimals {
+		return TokenInfo{}, fmt.Errorf("token %s: decimals %d out of range", addr, t.Decimals)
+	}
+	t.EID = eid
+	t.Source = TokenSourceChain
+	if t.Peg == "" && usdStablecoins[t.Symbol] {
+		t.Peg = "USD"
+	}
+	if r.store != nil {
+		if err := r.store.UpsertToken(t); err != nil {
+			log.Printf("TokenRegistry: failed to persist token %s: %v", t.Address, err)
+		}
+	}
+	r.add(t)
+	log.Printf("TokenRegistry: resolved %s on eid %d: symbol=%q decimals=%d", t.Address, eid, t.Symbol, t.Decimals)
+	return t, nil
+}
+
+// FormatAmount 日志用：按代币精度格式化金额（未知代币输出原始值）
+func (r *TokenRegistry) FormatAmount(eid uint32, addr string, amount *big.Int) string {
+	if amount == nil {
+		return "N/A"
+	}
+	t, ok := r.Lookup(eid, addr)
+	if !ok {
+		return amount.String() + " (raw)"
+	}
+	return formatTokenAmount(amount, t.Decimals) + " " + t.Symbol
+}
+
+// formatTokenAmount 按精度将原始整数金额格式化为十进制字符串（精确，去掉末尾的 0）
+func formatTokenAmount(amount *big.Int, decimals uint8) string {
+	if amount == nil {
+		return "0"
+	}
+	s := new(big.Int).Abs(amount).String()
+	if decimals > 0 {
+		if len(s) <= int(decimals) {
+			s = strings.Repeat("0", int(decimals)-len(s)+1) + s
+		}
+		point := len(s) - int(decimals)
+		frac := strings.TrimRight(s[point:], "0")
+		s = s[:point]
+		if frac != "" {
+			s += "." + frac
+		}
+	}
+	if amount.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// formatFiat 按 2 位小数格式化锚定法币的代币金额
+func formatFiat(amount *big.Int, decimals uint8) string {
+	if amount == nil {
+		return "0.00"
+	}
+	f := new(big.Float).SetInt(amount)
+	f.Quo(f, new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)))
+	return fmt.Sprintf("%.2f", f)
+}
+
+// --------------------------- 链上元数据 ---------------------------
+
+// ERC-20 方法选择器
+var (
+	erc20DecimalsSelector = common.FromHex("0x313ce567") // decimals()
+	erc20SymbolSelector   = common.FromHex("0x95d89b41") // symbol()
+)
+
+// fetchERC20Metadata 调用 ERC-20 的 decimals() 与 symbol()
+//
+// symbol() 兼容返回 bytes32 的旧合约（如 MKR）。
+func fetchERC20Metadata(ctx context.Context, caller ethereum.ContractCaller, token common.Address) (TokenInfo, error) {
+	out, err := caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: erc20DecimalsSelector}, nil)
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("decimals(): %w", err)
+	}
+	if len(out) < 32 {
+		return TokenInfo{}, fmt.Errorf("decimals(): unexpected return data %x", out)
+	}
+	decimals := new(big.Int).SetBytes(out[:32])
+	if !decimals.IsUint64() || decimals.Uint64() > maxTokenDecimals {
+		return TokenInfo{}, fmt.Errorf("decimals(): out of range %s", decimals)
+	}
+
+	info := TokenInfo{Address: token.Hex(), Decimals: uint8(decimals.Uint64())}
+	out, err = caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: erc20SymbolSelector}, nil)
+	if err != nil {
+		log.Printf("TokenRegistry: symbol() of %s failed: %v", token.Hex(), err)
+		return info, nil
+	}
+	if len(out) == 32 {
+		info.Symbol = strings.TrimRight(string(out), "\x00")
+	} else if sym, err := abiBytesArg(out, 0); err == nil {
+		info.Symbol = string(sym)
+	}
+	return info, nil
+}
+
+// SPL Mint 账户布局：mint_authority COption<Pubkey>(36) | supply u64 | decimals u8 | ...
+const (
+	splMintDecimalsOffset = 44
+	splMintMinLength      = 82
+)
+
+// splAccountReader 读取 mint 账户的 RPC 方法（*rpc.Client / SolanaPool 实现）
+type splAccountReader interface {
+	GetAccountInfo(ctx context.Context, account solana.PublicKey) (*rpc.GetAccountInfoResult, error)
+}
+
+// fetchSPLMintMetadata 读取 SPL / Token-2022 mint 账户的精度
+//
+// mint 账户不含符号；符号需在配置中指定。
+func fetchSPLMintMetadata(ctx context.Context, client splAccountReader, mint solana.PublicKey) (TokenInfo, error) {
+	res, err := client.GetAccountInfo(ctx, mint)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	if res == nil || res.Value == nil {
+		return TokenInfo{}, fmt.Errorf("mint account %s not found", mint)
+	}
+	if !res.Value.Owner.Equals(solana.TokenProgramID) && !res.Value.Owner.Equals(solana.Token2022ProgramID) {
+		return TokenInfo{}, fmt.Errorf("account %s is not a token mint (owner %s)", mint, res.Value.Owner)
+	}
+	data := res.GetBinary()
+	if len(data) < splMintMinLength {
+		return TokenInfo{}, fmt.Errorf("mint account %s too short: %d bytes", mint, len(data))
+	}
+	return TokenInfo{Address: mint.String(), Decimals: data[splMintDecimalsOffset]}, nil
+}
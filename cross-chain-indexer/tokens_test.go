@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestFormatTokenAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{"1000000", 6, "1"},
+		{"1234567", 6, "1.234567"},
+		{"1500000", 6, "1.5"},
+		{"1", 6, "0.000001"},
+		{"0", 6, "0"},
+		{"-2500000", 6, "-2.5"},
+		{"1000000000000000000", 18, "1"},
+		{"123", 0, "123"},
+	}
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+		if got := formatTokenAmount(amount, tt.decimals); got != tt.want {
+			t.Errorf("formatTokenAmount(%s, %d) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+	if got := formatFiat(big.NewInt(1234567), 6); got != "1.23" {
+		t.Errorf("formatFiat = %q, want 1.23", got)
+	}
+}
+
+func TestTokenRegistryLookup(t *testing.T) {
+	reg, err := ParseChainRegistry([]byte(`{"networks":[
+		{"name":"A","type":"evm","eid":1,"rpc":{"https":"x"},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}],
+		 "tokens":[{"address":"0x036cbd53842c5426634e7929541ec2318f3dcf7e","symbol":"USDC","decimals":6,"peg":"USD"}]},
+		{"name":"S","type":"solana","eid":2,"rpc":{"https":"x"},"programs":[{"program_id":"GSPmsxkxd5qR5HG4fhUd5cBrVkWNJWi6pWUFQnYmTEc1","role":"transfer"}],
+		 "tokens":[{"address":"4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU","symbol":"USDC","decimals":6,"peg":"USD"}]}]}`))
+	if err != nil {
+		t.Fatalf("ParseChainRegistry: %v", err)
+	}
+	r := NewTokenRegistry(nil)
+	if err := r.Load(reg); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	evm, ok := r.Lookup(1, "0x036CbD53842c5426634e7929541eC2318f3dCF7e")
+	if !ok || evm.Symbol != "USDC" || evm.Decimals != 6 || evm.Address != "0x036CbD53842c5426634e7929541eC2318f3dCF7e" {
+		t.Errorf("EVM lookup = %+v, %v", evm, ok)
+	}
+	if _, ok := r.Lookup(2, "0x036CbD53842c5426634e7929541eC2318f3dCF7e"); ok {
+		t.Error("token should be scoped to its chain")
+	}
+
+	// payouts 中 Solana mint 只保存后 20 字节
+	mint := solana.MustPublicKeyFromBase58("4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU")
+	alias := common.BytesToAddress(mint.Bytes()).Hex()
+	if sol, ok := r.Lookup(2, alias); !ok || sol.Address != mint.String() {
+		t.Errorf("alias lookup = %+v, %v", sol, ok)
+	}
+	if tok, ok := r.LookupAny("0x036cbd53842c5426634e7929541ec2318f3dcf7e"); !ok || tok.EID != 1 {
+		t.Errorf("LookupAny = %+v, %v", tok, ok)
+	}
+	if got := r.FormatAmount(1, evm.Address, big.NewInt(2500000)); got != "2.5 USDC" {
+		t.Errorf("FormatAmount = %q", got)
+	}
+}
+
+// useSharedAddressTokens 替换全局代币注册表：eid 1 与 eid 3 上同一地址分别是 USDC（6 位）与 DAI（18 位）
+func useSharedAddressTokens(t *testing.T) {
+	t.Helper()
+	reg, err := ParseChainRegistry([]byte(`{"networks":[
+		{"name":"A","type":"evm","eid":1,"rpc":{"https":"x"},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}],
+		 "tokens":[{"address":"0x036cbd53842c5426634e7929541ec2318f3dcf7e","symbol":"USDC","decimals":6,"peg":"USD"}]},
+		{"name":"B","type":"evm","eid":3,"rpc":{"https":"x"},"contracts":[{"address":"0x1a9C0a66Cb68D92c598B0D2f10de3C755Eb6D438","abi_version":"v2"}],
+		 "tokens":[{"address":"0x036cbd53842c5426634e7929541ec2318f3dcf7e","symbol":"DAI","decimals":18,"peg":"USD"}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewTokenRegistry(nil)
+	if err := r.Load(reg); err != nil {
+		t.Fatal(err)
+	}
+	saved := tokenRegistry
+	tokenRegistry = r
+	t.Cleanup(func() { tokenRegistry = saved })
+}
+
+// TestPayoutResponseSourceToken 同一地址在多条链上是不同代币时按 payout 的源链换算金额
+func TestPayoutResponseSourceToken(t *testing.T) {
+	useSharedAddressTokens(t)
+
+	amount, _ := new(big.Int).SetString("1000000000000000000", 10)
+	payout := PayoutRecord{
+		SrcEid:      3,
+		SrcToken:    common.HexToAddress("0x036cbd53842c5426634e7929541ec2318f3dcf7e"),
+		GrossAmount: amount,
+		NetAmount:   amount,
+	}
+	if resp := convertPayoutToResponse(payout); resp.TokenSymbol != "DAI" || resp.GrossAmountFmt != "1" {
+		t.Errorf("SrcEid 3: symbol %q, gross %q; want DAI, 1", resp.TokenSymbol, resp.GrossAmountFmt)
+	}
+	// 旧数据未回填源链：按地址查找
+	payout.SrcEid = 0
+	if resp := convertPayoutToResponse(payout); resp.TokenSymbol != "USDC" {
+		t.Errorf("legacy payout: symbol %q, want USDC", resp.TokenSymbol)
+	}
+}
+
+// TestFeeRevenueTokenDecimals 手续费按代币汇总时每组附上各自源链代币的精度
+func TestFeeRevenueTokenDecimals(t *testing.T) {
+	useSharedAddressTokens(t)
+	s := newTestStore(t)
+	token := common.HexToAddress("0x036cbd53842c5426634e7929541ec2318f3dcf7e")
+	for _, p := range []struct {
+		tx     string
+		srcEid int64
+		fee    int64
+	}{{"0xf1", 1, 30000}, {"0xf2", 3, 1000000}} {
+		err := s.UpsertPayout(PayoutRecord{TxHash: p.tx, SrcEid: p.srcEid, DstEid: 2, SrcToken: token,
+			GrossAmount: big.NewInt(p.fee * 100), NetAmount: big.NewInt(p.fee * 99), FeeAmount: big.NewInt(p.fee),
+			Status: PayoutStatusPending, Timestamp: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	NewServer(s, nil).handleFeeRevenue(rec, httptest.NewRequest("GET", "/admin/fees?group_by=token", nil))
+	var resp struct{ Fees []FeeRevenue }
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Fees) != 2 {
+		t.Fatalf("fees = %+v, want one group per source chain", resp.Fees)
+	}
+	for i, want := range []struct {
+		eid      int64
+		symbol   string
+		decimals uint8
+	}{{1, "USDC", 6}, {3, "DAI", 18}} {
+		if g := resp.Fees[i]; g.TokenEid != want.eid || g.Symbol != want.symbol || g.Decimals == nil || *g.Decimals != want.decimals {
+			t.Errorf("group %d = %+v, want %s with %d decimals", i, g, want.symbol, want.decimals)
+		}
+	}
+}
+
+func TestTokenRegistryResolve(t *testing.T) {
+	s := newTestStore(t)
+	r := NewTokenRegistry(s)
+	ctx := context.Background()
+	addr := "0x75faf114eafb1BDbe2F0316DF893fd58CE46AA4d"
+
+	calls := 0
+	failing := func(ctx context.Context, address string) (TokenInfo, error) {
+		calls++
+		return TokenInfo{}, errors.New("rpc down")
+	}
+	if _, err := r.Resolve(ctx, 1, addr, failing); err == nil {
+		t.Fatal("expected fetch error")
+	}
+	if _, err := r.Resolve(ctx, 1, addr, failing); err == nil || calls != 1 {
+		t.Fatalf("failed token should not be refetched within retry interval (calls=%d)", calls)
+	}
+
+	r = NewTokenRegistry(s)
+	fetch := func(ctx context.Context, address string) (TokenInfo, error) {
+		calls++
+		return TokenInfo{Address: address, Symbol: "USDC", Decimals: 6}, nil
+	}
+	tok, err := r.Resolve(ctx, 1, addr, fetch)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if tok.Peg != "USD" || tok.Source != TokenSourceChain || tok.EID != 1 {
+		t.Errorf("resolved token = %+v", tok)
+	}
+	if _, err := r.Resolve(ctx, 1, addr, fetch); err != nil || calls != 2 {
+		t.Errorf("resolved token should be cached (calls=%d, err=%v)", calls, err)
+	}
+
+	// 重启后从 tokens 表加载
+	r = NewTokenRegistry(s)
+	if err := r.Load(nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got, ok := r.Lookup(1, addr); !ok || got.Symbol != "USDC" || got.Decimals != 6 || got.Peg != "USD" {
+		t.Errorf("persisted token = %+v, %v", got, ok)
+	}
+}
+
+// fakeCaller 按调用数据返回预设结果的 ContractCaller
+type fakeCaller map[string][]byte
+
+func (f fakeCaller) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	out, ok := f[common.Bytes2Hex(msg.Data)]
+	if !ok {
+		return nil, errors.New("execution reverted")
+	}
+	return out, nil
+}
+
+func TestFetchERC20Metadata(t *testing.T) {
+	token := common.HexToAddress("0x036CbD53842c5426634e7929541eC2318f3dCF7e")
+	decimals := common.LeftPadBytes([]byte{6}, 32)
+
+	// symbol() 返回 string
+	str := append(common.LeftPadBytes([]byte{0x20}, 32), common.LeftPadBytes([]byte{4}, 32)...)
+	str = append(str, common.RightPadBytes([]byte("USDC"), 32)...)
+	info, err := fetchERC20Metadata(context.Background(), fakeCaller{"313ce567": decimals, "95d89b41": str}, token)
+	if err != nil || info.Symbol != "USDC" || info.Decimals != 6 {
+		t.Errorf("string symbol: %+v, %v", info, err)
+	}
+
+	// symbol() 返回 bytes32
+	info, err = fetchERC20Metadata(context.Background(), fakeCaller{"313ce567": decimals, "95d89b41": common.RightPadBytes([]byte("MKR"), 32)}, token)
+	if err != nil || info.Symbol != "MKR" {
+		t.Errorf("bytes32 symbol: %+v, %v", info, err)
+	}
+
+	// 不是 ERC-20
+	if _, err := fetchERC20Metadata(context.Background(), fakeCaller{}, token); err == nil {
+		t.Error("expected error for contract without decimals()")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// 实时处理队列默认参数
+const (
+	defaultProcessingWorkers   = 4
+	defaultProcessingQueueSize = 256
+)
+
+// ProcessingOptions 实时处理队列参数（对应 chains.json 中的 "processing"）
+type ProcessingOptions struct {
+	Workers   int `json:"workers,omitempty"`    // 并发处理的事件数
+	QueueSize int `json:"queue_size,omitempty"` // 已接收但尚未处理完成的事件上限，达到后订阅暂停接收
+}
+
+func (o ProcessingOptions) withDefaults() ProcessingOptions {
+	if o.Workers <= 0 {
+		o.Workers = defaultProcessingWorkers
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultProcessingQueueSize
+	}
+	return o
+}
+
+// WorkQueueStats 处理队列指标（用于 /health 与终端面板）
+type WorkQueueStats struct {
+	Depth     int    `json:"depth"`     // 已提交、尚未处理完成的事件数
+	Capacity  int    `json:"capacity"`  // 队列上限
+	Workers   int    `json:"workers"`   // worker 数
+	Busy      int    `json:"busy"`      // 正在处理的事件数
+	Processed uint64 `json:"processed"` // 已处理完成的事件数
+	Errors    uint64 `json:"errors"`    // 处理返回错误的事件数
+	Blocked   uint64 `json:"blocked"`   // 提交时因队列已满而等待的次数
+}
+
+// WorkQueue 单条链的有序处理队列
+//
+// 最多 Workers 个任务并发执行 run，各任务的 commit 按提交顺序依次执行，
+// 因此 commit 推进的检查点之前的事件都已处理完成。已提交但未 commit 的任务达到 QueueSize 时
+// Submit 阻塞，订阅随之停止接收（背压），不会为每个事件启动协程。
+//
+// 某个 commit 返回错误后，之后的任务不再执行、不再 commit，Submit 返回该错误，直到 Flush 取走它。
+type WorkQueue struct {
+	opts ProcessingOptions
+
+	tasks chan *workTask // 等待 worker 执行
+	order chan *workTask // 按提交顺序等待 commit（容量即队列上限）
+
+	mu     sync.Mutex
+	failed error
+
+	depth, busy                atomic.Int64
+	processed, errors, blocked atomic.Uint64
+}
+
+// workTask 队列中的任务；flushed 不为 nil 时是 Flush 的屏障（不执行 run）
+type workTask struct {
+	run     func(ctx context.Context) error
+	commit  func(err error) error
+	err     error
+	done    chan struct{}
+	flushed chan struct{}
+}
+
+// NewWorkQueue 创建处理队列（未配置的参数使用默认值）；由 Run 执行任务
+func NewWorkQueue(opts ProcessingOptions) *WorkQueue {
+	opts = opts.withDefaults()
+	return &WorkQueue{
+		opts: opts,
+		// worker 取走任务前 commit 协程可能已从 order 中取出一个，多留出 Workers 个位置使这里不阻塞
+		tasks: make(chan *workTask, opts.QueueSize+opts.Workers),
+		order: make(chan *workTask, opts.QueueSize),
+	}
+}
+
+// Run 启动 worker 与 commit 协程，直到 ctx 结束；正在执行的任务随 ctx 取消，
+// 返回前等待它们结束，并丢弃尚未执行的任务（未 commit 的事件由下次追赶从检查点补上）
+func (q *WorkQueue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	q.sequence(ctx)
+	wg.Wait()
+	q.drain()
+}
+
+// Submit 提交任务：run 在 worker 中并发执行，commit 以 run 的结果按提交顺序执行；
+// 队列已满时阻塞，直到有空位或 ctx 结束
+func (q *WorkQueue) Submit(ctx context.Context, run func(ctx context.Context) error, commit func(err error) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+	t := &workTask{run: run, commit: commit, done: make(chan struct{})}
+	select {
+	case q.order <- t:
+	default:
+		q.blocked.Add(1)
+		select {
+		case q.order <- t:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	q.depth.Add(1)
+	select {
+	case q.tasks <- t:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Flush 等待此前提交的任务全部 commit，返回并清除其间 commit 失败的错误
+func (q *WorkQueue) Flush(ctx context.Context) error {
+	t := &workTask{flushed: make(chan struct{})}
+	select {
+	case q.order <- t:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-t.flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := q.failed
+	q.failed = nil
+	return err
+}
+
+// Stats 当前队列指标
+func (q *WorkQueue) Stats() WorkQueueStats {
+	return WorkQueueStats{
+		Depth:     int(q.depth.Load()),
+		Capacity:  q.opts.QueueSize,
+		Workers:   q.opts.Workers,
+		Busy:      int(q.busy.Load()),
+		Processed: q.processed.Load(),
+		Errors:    q.errors.Load(),
+		Blocked:   q.blocked.Load(),
+	}
+}
+
+func (q *WorkQueue) err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.failed
+}
+
+// work 执行任务；队列已失败时跳过（不会 commit）
+func (q *WorkQueue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-q.tasks:
+			if t.err = q.err(); t.err == nil {
+				q.busy.Add(1)
+				t.err = t.run(ctx)
+				q.busy.Add(-1)
+				if t.err != nil {
+					q.errors.Add(1)
+				}
+			}
+			close(t.done)
+		}
+	}
+}
+
+// sequence 按提交顺序等待任务完成并执行 commit
+func (q *WorkQueue) sequence(ctx context.Context) {
+	for {
+		var t *workTask
+		select {
+		case <-ctx.Done():
+			return
+		case t = <-q.order:
+		}
+		if t.flushed != nil {
+			close(t.flushed)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.done:
+		}
+		if q.err() == nil {
+			if err := t.commit(t.err); err != nil {
+				q.mu.Lock()
+				q.failed = err
+				q.mu.Unlock()
+			}
+			q.processed.Add(1)
+		}
+		q.depth.Add(-1)
+	}
+}
+
+// drain 停止后丢弃剩余任务并重置状态，下次 Run 从空队列开始
+func (q *WorkQueue) drain() {
+	for {
+		select {
+		case t := <-q.order:
+			if t.flushed != nil {
+				close(t.flushed)
+			}
+		case <-q.tasks:
+		default:
+			q.depth.Store(0)
+			q.mu.Lock()
+			q.failed = nil
+			q.mu.Unlock()
+			return
+		}
+	}
+}
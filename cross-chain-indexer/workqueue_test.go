@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func startTestWorkQueue(t *testing.T, opts ProcessingOptions) (*WorkQueue, context.Context) {
+	t.Helper()
+	q := NewWorkQueue(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return q, ctx
+}
+
+// TestWorkQueueOrderedCommit 任务并发执行（不超过 worker 数），commit 按提交顺序
+func TestWorkQueueOrderedCommit(t *testing.T) {
+	q, ctx := startTestWorkQueue(t, ProcessingOptions{Workers: 3, QueueSize: 8})
+
+	var inFlight, peak atomic.Int32
+	var commits []int
+	for i := 0; i < 40; i++ {
+		err := q.Submit(ctx, func(ctx context.Context) error {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			// 先提交的任务更慢，完成顺序与提交顺序不同
+			time.Sleep(time.Duration(40-i%4*10) * time.Millisecond / 10)
+			return nil
+		}, func(err error) error {
+			commits = append(commits, i)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 40 {
+		t.Fatalf("got %d commits", len(commits))
+	}
+	for i, c := range commits {
+		if c != i {
+			t.Fatalf("commits out of order: %v", commits)
+		}
+	}
+	if p := peak.Load(); p > 3 || p < 2 {
+		t.Errorf("peak concurrency %d, want 2..3", p)
+	}
+	if st := q.Stats(); st.Depth != 0 || st.Processed != 40 || st.Workers != 3 || st.Capacity != 8 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+// TestWorkQueueBackpressure 队列满时 Submit 阻塞，直到有任务完成
+func TestWorkQueueBackpressure(t *testing.T) {
+	q, ctx := startTestWorkQueue(t, ProcessingOptions{Workers: 1, QueueSize: 2})
+
+	release := make(chan struct{})
+	block := func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+	commit := func(error) error { return nil }
+	for i := 0; i < 2; i++ {
+		if err := q.Submit(ctx, block, commit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// commit 协程取走第一个任务后还能再放一个
+	deadline := time.Now().Add(time.Second)
+	for len(q.order) == 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := q.Submit(ctx, block, commit); err != nil {
+		t.Fatal(err)
+	}
+
+	submitted := make(chan error, 1)
+	go func() { submitted <- q.Submit(ctx, block, commit) }()
+	select {
+	case err := <-submitted:
+		t.Fatalf("Submit on a full queue returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if st := q.Stats(); st.Depth != 3 || st.Blocked != 1 {
+		t.Errorf("stats while full = %+v", st)
+	}
+
+	// 超时的提交返回 ctx 错误
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := q.Submit(short, block, commit); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit with expired context = %v", err)
+	}
+
+	close(release)
+	if err := <-submitted; err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := q.Stats(); st.Depth != 0 || st.Processed != 4 {
+		t.Errorf("stats after flush = %+v", st)
+	}
+}
+
+// TestWorkQueueCommitFailure commit 失败后之后的任务不再 commit，Submit 返回错误，Flush 取走后恢复
+func TestWorkQueueCommitFailure(t *testing.T) {
+	q, ctx := startTestWorkQueue(t, ProcessingOptions{Workers: 2, QueueSize: 16})
+
+	errBoom := errors.New("dead letter write failed")
+	gate := make(chan struct{}) // 全部提交后才开始执行
+	var mu sync.Mutex
+	var committed []int
+	for i := 0; i < 6; i++ {
+		err := q.Submit(ctx, func(ctx context.Context) error {
+			<-gate
+			if i == 2 {
+				return errors.New("decode failed")
+			}
+			return nil
+		}, func(err error) error {
+			if err != nil {
+				return errBoom
+			}
+			mu.Lock()
+			committed = append(committed, i)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(gate)
+	if err := q.Flush(ctx); !errors.Is(err, errBoom) {
+		t.Fatalf("Flush = %v, want %v", err, errBoom)
+	}
+	if len(committed) != 2 || committed[1] != 1 {
+		t.Errorf("committed = %v, want [0 1]", committed)
+	}
+
+	// Flush 之后恢复
+	if err := q.Submit(ctx, func(context.Context) error { return nil }, func(error) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := q.Stats(); st.Errors != 1 || st.Processed != 4 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+// TestWorkQueueCancel 停止时取消正在执行的任务，Run 等待它们结束后返回
+func TestWorkQueueCancel(t *testing.T) {
+	q := NewWorkQueue(ProcessingOptions{Workers: 2, QueueSize: 4})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+
+	started := make(chan struct{}, 2)
+	var cancelled atomic.Int32
+	for i := 0; i < 2; i++ {
+		if err := q.Submit(ctx, func(ctx context.Context) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			cancelled.Add(1)
+			return ctx.Err()
+		}, func(error) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if cancelled.Load() != 2 {
+		t.Errorf("%d tasks saw cancellation, want 2", cancelled.Load())
+	}
+	if st := q.Stats(); st.Depth != 0 || st.Busy != 0 {
+		t.Errorf("stats after stop = %+v", st)
+	}
+	if err := q.Submit(ctx, func(context.Context) error { return nil }, func(error) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Submit after stop = %v", err)
+	}
+}